@@ -197,7 +197,8 @@ func doOp(ctx context.Context, repo storage.Repository, op opType, r *rand.Rand,
 		if err := repo.UpsertTx(ctx, tx); err != nil {
 			return err
 		}
-		return repo.AddChatEvent(ctx, chatID, tx.Hash, storage.EventNotify)
+		_, err := repo.AddChatEvent(ctx, chatID, tx.Hash, storage.EventNotify)
+		return err
 	default:
 		return nil
 	}
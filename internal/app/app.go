@@ -4,14 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/big"
+	"time"
 
+	"github.com/pvzzle/scanblock/internal/blocksource"
 	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/chains"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/ens"
 	"github.com/pvzzle/scanblock/internal/ethwatch"
+	"github.com/pvzzle/scanblock/internal/prices"
+	"github.com/pvzzle/scanblock/internal/rpcpool"
 	"github.com/pvzzle/scanblock/internal/storage/pg"
 	"github.com/pvzzle/scanblock/internal/subs"
 	"github.com/pvzzle/scanblock/internal/tg"
 
-	"github.com/ethereum/go-ethereum/ethclient"
 	tgbot "github.com/go-telegram/bot"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -33,19 +40,118 @@ func Run(ctx context.Context) error {
 		return fmt.Errorf("ensure schema: %w", err)
 	}
 
-	ethCl, err := ethclient.DialContext(ctx, cfg.EthWSURL)
+	savedSubs, err := repo.ListSubscriptions(ctx)
 	if err != nil {
-		return fmt.Errorf("dial eth ws: %w", err)
+		return fmt.Errorf("list subscriptions: %w", err)
 	}
 
-	chainID, err := ethCl.NetworkID(ctx)
-	if err != nil {
-		return fmt.Errorf("network id: %w", err)
+	// встроенные сигнатуры + методы из ABI, присланных пользователями (общие для всех сетей)
+	selectors := contracts.NewSelectors()
+	notifyCh := make(chan bus.Notification, cfg.NotifyBuffer)
+
+	// chain — сеть, готовая к запуску watcher'а
+	type chain struct {
+		cfg     ChainConfig
+		net     chains.Network
+		rpc     chainClient
+		chainID *big.Int
+		subs    *subs.Store
+		prices  *prices.Oracle
 	}
 
-	subStore := subs.NewStore()
+	var (
+		networks []tg.Network
+		started  []chain
+		names    *ens.Resolver
+	)
+	for _, chCfg := range cfg.ChainConfigs() {
+		ethRPC, err := dialChain(ctx, cfg, chCfg)
+		if err != nil {
+			return fmt.Errorf("dial eth rpc %s: %w", chCfg.Key, err)
+		}
+		defer ethRPC.Close()
+		go ethRPC.Start(ctx)
 
-	notifyCh := make(chan bus.Notification, cfg.NotifyBuffer)
+		chainID, err := ethRPC.ChainID(ctx)
+		if err != nil {
+			return fmt.Errorf("chain id %s: %w", chCfg.Key, err)
+		}
+		net, err := chCfg.network(chainID.Uint64())
+		if err != nil {
+			return fmt.Errorf("chain %s: %w", chCfg.Key, err)
+		}
+		for _, other := range networks {
+			if other.ID == net.ID {
+				return fmt.Errorf("chains %s and %s point to the same chain id %d", other.Key, net.Key, net.ID)
+			}
+		}
+
+		subStore := subs.NewPersistentStore(repo, net.IDString())
+		if err := subStore.Load(savedSubs); err != nil {
+			return fmt.Errorf("load subscriptions %s: %w", net.Key, err)
+		}
+		for _, a := range subStore.ContractABIs() {
+			selectors.AddABI(a)
+		}
+		var oracle *prices.Oracle
+		if feeds := chCfg.priceFeeds(net.ID); !feeds.IsEmpty() {
+			oracle = prices.NewOracle(ethRPC, feeds)
+		} else {
+			log.Printf("prices %s: no Chainlink feeds, USD values disabled", net.Key)
+		}
+
+		networks = append(networks, tg.Network{Network: net, Reader: ethRPC, Subs: subStore, Prices: oracle})
+		started = append(started, chain{cfg: chCfg, net: net, rpc: ethRPC, chainID: chainID, subs: subStore, prices: oracle})
+
+		// имена ENS берём из первой сети с реестром ENS
+		if names == nil && ens.Supported(net.ID) {
+			names = ens.NewResolver(ethRPC, cfg.ENSCacheTTL)
+			log.Printf("ens: resolving names via %s", net.Key)
+		}
+	}
+	if names == nil {
+		log.Printf("ens: disabled, no Ethereum mainnet/testnet chain configured")
+	}
+
+	var nameResolver ethwatch.NameResolver
+	if names != nil {
+		nameResolver = names
+	}
+
+	watchers := make([]*ethwatch.Watcher, 0, len(started))
+	for _, c := range started {
+		chCfg, net := c.cfg, c.net
+
+		var pollInterval time.Duration
+		if chCfg.WatcherMode == WatcherModePoll {
+			pollInterval = chCfg.PollInterval
+		}
+
+		watchers = append(watchers, ethwatch.NewWatcher(c.rpc, c.chainID, c.subs, notifyCh, repo, selectors, ethwatch.WatcherConfig{
+			Workers:     cfg.WatcherWorkers,
+			TasksBuffer: cfg.TasksBuffer,
+
+			BackfillMaxDepth: cfg.BackfillMaxDepth,
+			ReorgDepth:       cfg.ReorgDepth,
+			PollInterval:     pollInterval,
+
+			ReconnectMinDelay: cfg.ReconnectMinDelay,
+			ReconnectMaxDelay: cfg.ReconnectMaxDelay,
+
+			TraceMode: chCfg.TraceMode,
+
+			Mempool:           chCfg.Mempool,
+			PendingDropAfter:  cfg.PendingDropAfter,
+			PendingStuckAfter: cfg.PendingStuckAfter,
+
+			Network: net,
+			Names:   nameResolver,
+			Prices:  c.prices,
+		}))
+
+		log.Printf("chain %s (%s): chain_id=%d mode=%s trace=%q mempool=%t endpoints=%d quorum=%d",
+			net.Key, net.Name, net.ID, chCfg.WatcherMode, chCfg.TraceMode, chCfg.Mempool, len(chCfg.RPCURLs), chCfg.RPCQuorum)
+	}
 
 	b, err := tgbot.New(cfg.TelegramToken,
 		tgbot.WithDebug(),
@@ -56,22 +162,56 @@ func Run(ctx context.Context) error {
 		return fmt.Errorf("telegram bot init: %w", err)
 	}
 
-	tgSvc := tg.NewService(b, ethCl, chainID, subStore, notifyCh, repo)
-	watcher := ethwatch.NewWatcher(ethCl, chainID, subStore, notifyCh, repo, ethwatch.WatcherConfig{
-		Workers:     cfg.WatcherWorkers,
-		TasksBuffer: cfg.TasksBuffer,
-	})
+	tgSvc := tg.NewService(b, networks, notifyCh, repo, selectors, names)
+	if err := tgSvc.RestoreNetworks(ctx); err != nil {
+		return fmt.Errorf("restore chat networks: %w", err)
+	}
 
-	go func() {
-		if err := watcher.Start(ctx); err != nil {
-			log.Printf("[WATCHER] stopped: %v", err)
-		}
-	}()
+	for _, watcher := range watchers {
+		go func() {
+			if err := watcher.Start(ctx); err != nil {
+				log.Printf("[WATCHER] stopped: %v", err)
+			}
+		}()
+	}
 
 	go tgSvc.StartNotifyLoop(ctx)
 
-	log.Printf("started. chain_id=%s workers=%d", chainID.String(), cfg.WatcherWorkers)
+	log.Printf("started. chains=%d workers=%d subscriptions=%d", len(networks), cfg.WatcherWorkers, len(savedSubs))
 	b.Start(ctx)
 
 	return nil
 }
+
+// chainClient — источник блоков сети: пул RPC-эндпоинтов или запись цепочки
+// (WATCHER_REPLAY_FILE) для демо и прогонов без ноды.
+type chainClient interface {
+	ethwatch.ChainClient
+	tg.ChainReader
+	ChainID(ctx context.Context) (*big.Int, error)
+	Start(ctx context.Context)
+	Close()
+}
+
+func dialChain(ctx context.Context, cfg Config, ch ChainConfig) (chainClient, error) {
+	if ch.ReplayFile != "" {
+		replay, err := blocksource.OpenReplay(ch.ReplayFile, ch.ReplayInterval)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("chain %s: replaying %s every %s", ch.Key, ch.ReplayFile, ch.ReplayInterval)
+		return replay, nil
+	}
+
+	pool, err := rpcpool.Dial(ctx, rpcpool.Config{
+		URLs:           ch.RPCURLs,
+		Quorum:         ch.RPCQuorum,
+		HealthInterval: cfg.RPCHealthInterval,
+		StallTimeout:   cfg.RPCStallTimeout,
+		MaxLag:         cfg.RPCMaxLag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
@@ -1,20 +1,99 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/chains"
+	"github.com/pvzzle/scanblock/internal/ethwatch"
+	"github.com/pvzzle/scanblock/internal/prices"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	TelegramToken string `env:"TELEGRAM_TOKEN,required"`
-	EthWSURL      string `env:"ETH_WS_URL,required"`
+	EthWSURL      string `env:"ETH_WS_URL"`
+	EthHTTPURL    string `env:"ETH_HTTP_URL"`
 	PostgresURL   string `env:"POSTGRES_URL,required"`
 
+	// EthRPCURLs — список эндпоинтов через запятую; если задан, заменяет ETH_WS_URL/ETH_HTTP_URL
+	EthRPCURLs        []string      `env:"ETH_RPC_URLS"`
+	RPCQuorum         int           `env:"ETH_RPC_QUORUM"`
+	RPCHealthInterval time.Duration `env:"ETH_RPC_HEALTH_INTERVAL"`
+	RPCStallTimeout   time.Duration `env:"ETH_RPC_STALL_TIMEOUT"`
+	RPCMaxLag         uint64        `env:"ETH_RPC_MAX_LAG"`
+
+	// WatcherMode: subscribe (eth_subscribe newHeads, нужен ws) или poll (eth_blockNumber по таймеру)
+	WatcherMode  string        `env:"WATCHER_MODE"`
+	PollInterval time.Duration `env:"WATCHER_POLL_INTERVAL"`
+
 	WatcherWorkers int `env:"WATCHER_WORKERS"`
 	TasksBuffer    int `env:"TASKS_BUFFER"`
 	NotifyBuffer   int `env:"NOTIFY_BUFFER"`
+
+	BackfillMaxDepth uint64 `env:"WATCHER_BACKFILL_MAX_DEPTH"`
+	ReorgDepth       int    `env:"WATCHER_REORG_DEPTH"`
+
+	ReconnectMinDelay time.Duration `env:"WATCHER_RECONNECT_MIN_DELAY"`
+	ReconnectMaxDelay time.Duration `env:"WATCHER_RECONNECT_MAX_DELAY"`
+
+	// TraceMode: пусто — без внутренних переводов, debug — debug_traceBlockByHash, trace — trace_block
+	TraceMode string `env:"WATCHER_TRACE_MODE"`
+
+	// Mempool — уведомления о pending tx (eth_subscribe newPendingTransactions, нужен ws)
+	Mempool           bool          `env:"WATCHER_MEMPOOL"`
+	PendingDropAfter  time.Duration `env:"WATCHER_PENDING_DROP_AFTER"`
+	PendingStuckAfter time.Duration `env:"WATCHER_PENDING_STUCK_AFTER"`
+
+	// ReplayFile — запись цепочки (go run ./cmd/record) вместо ноды: блоки
+	// выходят по одному раз в ReplayInterval. Для демо и прогонов без сети.
+	ReplayFile     string        `env:"WATCHER_REPLAY_FILE"`
+	ReplayInterval time.Duration `env:"WATCHER_REPLAY_INTERVAL"`
+
+	// ENSCacheTTL — сколько помним основное ENS-имя адреса (и его отсутствие)
+	ENSCacheTTL time.Duration `env:"ENS_CACHE_TTL"`
+
+	// PriceFeed — Chainlink-агрегатор нативной валюты/USD (off — без USD);
+	// TokenPriceFeeds — токен:агрегатор через запятую. Дополняют агрегаторы по
+	// умолчанию для известных сетей.
+	PriceFeed       string            `env:"PRICE_FEED"`
+	TokenPriceFeeds map[string]string `env:"TOKEN_PRICE_FEEDS"`
+
+	// Chains — ключи сетей через запятую (ethereum,arbitrum,base). Для каждой
+	// читаются CHAIN_<KEY>_*; пусто — одна сеть из ETH_* и WATCHER_*.
+	Chains []string `env:"CHAINS"`
+	chains []ChainConfig
+}
+
+// ChainConfig — эндпоинты и режим наблюдения одной сети. Не заданные для сети
+// параметры берутся из общих (ETH_RPC_QUORUM, WATCHER_MODE...).
+type ChainConfig struct {
+	Key string
+
+	RPCURLs   []string `env:"RPC_URLS"`
+	RPCQuorum int      `env:"RPC_QUORUM"`
+
+	WatcherMode  string        `env:"WATCHER_MODE"`
+	PollInterval time.Duration `env:"WATCHER_POLL_INTERVAL"`
+	TraceMode    string        `env:"WATCHER_TRACE_MODE"`
+	Mempool      bool          `env:"WATCHER_MEMPOOL"`
+
+	ReplayFile     string        `env:"REPLAY_FILE"`
+	ReplayInterval time.Duration `env:"WATCHER_REPLAY_INTERVAL"`
+
+	// ID — ожидаемый chain ID; для известных ключей (arbitrum, base...) не нужен
+	ID     uint64 `env:"ID"`
+	Name   string `env:"NAME"`
+	Symbol string `env:"SYMBOL"`
+
+	// агрегаторы у каждой сети свои, общие PRICE_FEED* не наследуются
+	PriceFeed       string            `env:"PRICE_FEED"`
+	TokenPriceFeeds map[string]string `env:"TOKEN_PRICE_FEEDS"`
 }
 
 func LoadConfig() (Config, error) {
@@ -24,14 +103,284 @@ func LoadConfig() (Config, error) {
 	}
 
 	config := Config{
+		WatcherMode:  WatcherModeSubscribe,
+		PollInterval: 4 * time.Second,
+
+		RPCQuorum:         1,
+		RPCHealthInterval: 10 * time.Second,
+		RPCStallTimeout:   time.Minute,
+		RPCMaxLag:         3,
+
 		WatcherWorkers: 8,
 		TasksBuffer:    4096,
 		NotifyBuffer:   4096,
+
+		BackfillMaxDepth: 1000,
+		ReorgDepth:       64,
+
+		ReconnectMinDelay: time.Second,
+		ReconnectMaxDelay: time.Minute,
+
+		PendingDropAfter:  30 * time.Minute,
+		PendingStuckAfter: 10 * time.Minute,
+
+		ReplayInterval: time.Second,
+
+		ENSCacheTTL: time.Hour,
 	}
 
 	if err := env.Parse(&config); err != nil {
 		return Config{}, err
 	}
 
+	for _, key := range config.Chains {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		ch := ChainConfig{
+			Key:          key,
+			RPCQuorum:    config.RPCQuorum,
+			WatcherMode:  config.WatcherMode,
+			PollInterval: config.PollInterval,
+			TraceMode:    config.TraceMode,
+			Mempool:      config.Mempool,
+
+			ReplayInterval: config.ReplayInterval,
+		}
+		if err := env.ParseWithOptions(&ch, env.Options{Prefix: chainEnvPrefix(key)}); err != nil {
+			return Config{}, fmt.Errorf("chain %s: %w", key, err)
+		}
+		config.chains = append(config.chains, ch)
+	}
+
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
+
+const (
+	WatcherModeSubscribe = "subscribe"
+	WatcherModePoll      = "poll"
+)
+
+func (c Config) validate() error {
+	seen := make(map[string]bool)
+	for _, ch := range c.ChainConfigs() {
+		if seen[ch.Key] {
+			return fmt.Errorf("chain %s is listed in CHAINS twice", ch.Key)
+		}
+		seen[ch.Key] = true
+
+		if err := ch.validate(); err != nil {
+			if ch.Key != "" {
+				return fmt.Errorf("chain %s: %w", ch.Key, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ChainConfigs — сети для наблюдения. Без CHAINS — одна сеть (без ключа) из
+// ETH_* и WATCHER_*, как до мультичейна.
+func (c Config) ChainConfigs() []ChainConfig {
+	if len(c.chains) > 0 {
+		return c.chains
+	}
+	return []ChainConfig{{
+		RPCURLs:      c.RPCURLs(),
+		RPCQuorum:    c.RPCQuorum,
+		WatcherMode:  c.WatcherMode,
+		PollInterval: c.PollInterval,
+		TraceMode:    c.TraceMode,
+		Mempool:      c.Mempool,
+
+		ReplayFile:     c.ReplayFile,
+		ReplayInterval: c.ReplayInterval,
+
+		PriceFeed:       c.PriceFeed,
+		TokenPriceFeeds: c.TokenPriceFeeds,
+	}}
+}
+
+func chainEnvPrefix(key string) string {
+	return "CHAIN_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_")) + "_"
+}
+
+// envName — имя переменной окружения для параметра сети (для сообщений об ошибках).
+func (ch ChainConfig) envName(name string) string {
+	if ch.Key == "" {
+		return name
+	}
+	return chainEnvPrefix(ch.Key) + name
+}
+
+func (ch ChainConfig) urlsEnv() string {
+	if ch.Key == "" {
+		return "ETH_WS_URL or ETH_RPC_URLS"
+	}
+	return ch.envName("RPC_URLS")
+}
+
+func (ch ChainConfig) validate() error {
+	if ch.ReplayFile != "" {
+		if err := ch.validateReplay(); err != nil {
+			return err
+		}
+	} else if err := ch.validateRPC(); err != nil {
+		return err
+	}
+
+	if ch.PriceFeed != "" && ch.PriceFeed != PriceFeedOff && !common.IsHexAddress(ch.PriceFeed) {
+		return fmt.Errorf("%s %q is not an address (or off)", ch.envName("PRICE_FEED"), ch.PriceFeed)
+	}
+	for token, feed := range ch.TokenPriceFeeds {
+		if !common.IsHexAddress(token) || !common.IsHexAddress(feed) {
+			return fmt.Errorf("%s: expected token:feed addresses, got %s:%s", ch.envName("TOKEN_PRICE_FEEDS"), token, feed)
+		}
+	}
+	return nil
+}
+
+// validateReplay — в записи нет мемпула и трассировок, эндпоинты не нужны.
+func (ch ChainConfig) validateReplay() error {
+	replayEnv := "WATCHER_REPLAY_FILE"
+	if ch.Key != "" {
+		replayEnv = ch.envName("REPLAY_FILE")
+	}
+	if ch.Mempool || ch.TraceMode != ethwatch.TraceModeOff {
+		return fmt.Errorf("%s: mempool and trace modes are not available for a replay", replayEnv)
+	}
+	switch ch.WatcherMode {
+	case WatcherModeSubscribe:
+	case WatcherModePoll:
+		if ch.PollInterval <= 0 {
+			return fmt.Errorf("%s must be > 0", ch.envName("WATCHER_POLL_INTERVAL"))
+		}
+	default:
+		return fmt.Errorf("unknown %s %q (expected subscribe or poll)", ch.envName("WATCHER_MODE"), ch.WatcherMode)
+	}
+	return nil
+}
+
+func (ch ChainConfig) validateRPC() error {
+	urls := ch.RPCURLs
+
+	switch ch.WatcherMode {
+	case WatcherModeSubscribe:
+		if !hasWebsocketURL(urls) {
+			return fmt.Errorf("WATCHER_MODE=subscribe needs a ws(s):// endpoint in %s", ch.urlsEnv())
+		}
+	case WatcherModePoll:
+		if len(urls) == 0 {
+			if ch.Key == "" {
+				return errors.New("ETH_RPC_URLS, ETH_HTTP_URL or ETH_WS_URL is required for WATCHER_MODE=poll")
+			}
+			return fmt.Errorf("%s is required", ch.envName("RPC_URLS"))
+		}
+		if ch.PollInterval <= 0 {
+			return fmt.Errorf("%s must be > 0", ch.envName("WATCHER_POLL_INTERVAL"))
+		}
+	default:
+		return fmt.Errorf("unknown %s %q (expected subscribe or poll)", ch.envName("WATCHER_MODE"), ch.WatcherMode)
+	}
+
+	switch ch.TraceMode {
+	case ethwatch.TraceModeOff, ethwatch.TraceModeDebug, ethwatch.TraceModeTrace:
+	default:
+		return fmt.Errorf("unknown %s %q (expected debug, trace or empty)", ch.envName("WATCHER_TRACE_MODE"), ch.TraceMode)
+	}
+
+	if ch.Mempool && !hasWebsocketURL(urls) {
+		return fmt.Errorf("WATCHER_MEMPOOL needs a ws(s):// endpoint in %s", ch.urlsEnv())
+	}
+
+	if ch.RPCQuorum > len(urls) {
+		quorumEnv := "ETH_RPC_QUORUM"
+		if ch.Key != "" {
+			quorumEnv = ch.envName("RPC_QUORUM")
+		}
+		return fmt.Errorf("%s=%d is more than the %d configured endpoint(s)", quorumEnv, ch.RPCQuorum, len(urls))
+	}
+	return nil
+}
+
+// PriceFeedOff — PRICE_FEED=off отключает оценку в USD для сети.
+const PriceFeedOff = "off"
+
+// priceFeeds — агрегаторы сети: по умолчанию для chain ID и поверх — из конфига.
+func (ch ChainConfig) priceFeeds(chainID uint64) prices.Feeds {
+	if ch.PriceFeed == PriceFeedOff {
+		return prices.Feeds{}
+	}
+	feeds := prices.DefaultFeeds(chainID)
+	if ch.PriceFeed != "" {
+		feeds.Native = common.HexToAddress(ch.PriceFeed)
+	}
+	for token, feed := range ch.TokenPriceFeeds {
+		feeds.Tokens[common.HexToAddress(token)] = common.HexToAddress(feed)
+	}
+	return feeds
+}
+
+// network — описание сети по chain ID, который вернула нода. Если в конфиге
+// ожидается другая сеть (ID или известный ключ), это ошибка: иначе подписки
+// одной сети начнут срабатывать на блоки другой.
+func (ch ChainConfig) network(nodeChainID uint64) (chains.Network, error) {
+	want := ch.ID
+	if want == 0 {
+		if k, ok := chains.ByKey(ch.Key); ok {
+			want = k.ID
+		}
+	}
+	if want != 0 && want != nodeChainID {
+		return chains.Network{}, fmt.Errorf("node reports chain id %d, expected %d", nodeChainID, want)
+	}
+
+	n := chains.Resolve(nodeChainID)
+	if ch.Key != "" {
+		n.Key = ch.Key
+	}
+	if ch.Name != "" {
+		n.Name = ch.Name
+	}
+	if ch.Symbol != "" {
+		n.Symbol = ch.Symbol
+	}
+	return n, nil
+}
+
+// RPCURLs — эндпоинты ноды: явный список, иначе одиночный URL для выбранного
+// режима (в режиме опроса предпочитаем HTTP).
+func (c Config) RPCURLs() []string {
+	var out []string
+	for _, u := range c.EthRPCURLs {
+		if u = strings.TrimSpace(u); u != "" {
+			out = append(out, u)
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+
+	single := c.EthWSURL
+	if c.WatcherMode == WatcherModePoll && c.EthHTTPURL != "" {
+		single = c.EthHTTPURL
+	}
+	if single == "" {
+		return nil
+	}
+	return []string{single}
+}
+
+func hasWebsocketURL(urls []string) bool {
+	for _, u := range urls {
+		if strings.HasPrefix(u, "ws://") || strings.HasPrefix(u, "wss://") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/prices"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestConfig_validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+		wantURL string
+	}{
+		{
+			name:    "subscribe needs ws",
+			cfg:     Config{WatcherMode: WatcherModeSubscribe, EthHTTPURL: "https://node"},
+			wantErr: true,
+		},
+		{
+			name:    "subscribe",
+			cfg:     Config{WatcherMode: WatcherModeSubscribe, EthWSURL: "wss://node", EthHTTPURL: "https://node"},
+			wantURL: "wss://node",
+		},
+		{
+			name:    "poll prefers http",
+			cfg:     Config{WatcherMode: WatcherModePoll, PollInterval: time.Second, EthWSURL: "wss://node", EthHTTPURL: "https://node"},
+			wantURL: "https://node",
+		},
+		{
+			name:    "poll over ws",
+			cfg:     Config{WatcherMode: WatcherModePoll, PollInterval: time.Second, EthWSURL: "wss://node"},
+			wantURL: "wss://node",
+		},
+		{
+			name:    "poll needs interval",
+			cfg:     Config{WatcherMode: WatcherModePoll, EthHTTPURL: "https://node"},
+			wantErr: true,
+		},
+		{
+			name:    "list overrides single url",
+			cfg:     Config{WatcherMode: WatcherModeSubscribe, EthWSURL: "wss://a", EthRPCURLs: []string{" wss://b ", "https://c"}, RPCQuorum: 2},
+			wantURL: "wss://b",
+		},
+		{
+			name:    "subscribe needs a ws endpoint in list",
+			cfg:     Config{WatcherMode: WatcherModeSubscribe, EthRPCURLs: []string{"https://b", "https://c"}},
+			wantErr: true,
+		},
+		{
+			name:    "quorum above endpoint count",
+			cfg:     Config{WatcherMode: WatcherModePoll, PollInterval: time.Second, EthRPCURLs: []string{"https://b", "https://c"}, RPCQuorum: 3},
+			wantErr: true,
+		},
+		{
+			name:    "trace mode",
+			cfg:     Config{WatcherMode: WatcherModeSubscribe, EthWSURL: "wss://node", TraceMode: "debug"},
+			wantURL: "wss://node",
+		},
+		{
+			name:    "unknown trace mode",
+			cfg:     Config{WatcherMode: WatcherModeSubscribe, EthWSURL: "wss://node", TraceMode: "callTracer"},
+			wantErr: true,
+		},
+		{
+			name:    "mempool needs ws",
+			cfg:     Config{WatcherMode: WatcherModePoll, PollInterval: time.Second, EthHTTPURL: "https://node", Mempool: true},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			cfg:     Config{WatcherMode: "stream", EthWSURL: "wss://node"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		err := tc.cfg.validate()
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: expected err=%v, got %v", tc.name, tc.wantErr, err)
+		}
+		if err == nil && tc.cfg.RPCURLs()[0] != tc.wantURL {
+			t.Fatalf("%s: expected url=%s, got %v", tc.name, tc.wantURL, tc.cfg.RPCURLs())
+		}
+	}
+}
+
+func TestLoadConfig_Chains(t *testing.T) {
+	t.Setenv("TELEGRAM_TOKEN", "token")
+	t.Setenv("POSTGRES_URL", "postgres://localhost/db")
+	t.Setenv("WATCHER_MODE", WatcherModePoll)
+	t.Setenv("ETH_RPC_QUORUM", "1")
+	t.Setenv("CHAINS", "ethereum, Arbitrum")
+	t.Setenv("CHAIN_ETHEREUM_RPC_URLS", "https://eth-a,https://eth-b")
+	t.Setenv("CHAIN_ETHEREUM_RPC_QUORUM", "2")
+	t.Setenv("CHAIN_ARBITRUM_RPC_URLS", "wss://arb")
+	t.Setenv("CHAIN_ARBITRUM_WATCHER_MODE", WatcherModeSubscribe)
+	t.Setenv("CHAIN_ARBITRUM_SYMBOL", "AETH")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	chs := cfg.ChainConfigs()
+	if len(chs) != 2 {
+		t.Fatalf("expected 2 chains, got %+v", chs)
+	}
+	if eth := chs[0]; eth.Key != "ethereum" || len(eth.RPCURLs) != 2 || eth.RPCQuorum != 2 || eth.WatcherMode != WatcherModePoll {
+		t.Fatalf("unexpected ethereum config: %+v", eth)
+	}
+	if arb := chs[1]; arb.Key != "arbitrum" || arb.RPCQuorum != 1 || arb.WatcherMode != WatcherModeSubscribe || arb.PollInterval != 4*time.Second {
+		t.Fatalf("expected arbitrum to inherit defaults, got %+v", arb)
+	}
+
+	n, err := chs[1].network(42161)
+	if err != nil || n.Key != "arbitrum" || n.Name != "Arbitrum One" || n.Symbol != "AETH" {
+		t.Fatalf("unexpected arbitrum network: %+v %v", n, err)
+	}
+	if _, err := chs[1].network(1); err == nil {
+		t.Fatalf("expected chain id mismatch for arbitrum on a mainnet node")
+	}
+}
+
+func TestConfig_validateChains(t *testing.T) {
+	cfg := Config{chains: []ChainConfig{
+		{Key: "base", WatcherMode: WatcherModeSubscribe, RPCURLs: []string{"wss://base"}},
+		{Key: "base", WatcherMode: WatcherModeSubscribe, RPCURLs: []string{"wss://base-2"}},
+	}}
+	if err := cfg.validate(); err == nil {
+		t.Fatalf("expected duplicate chain error")
+	}
+
+	cfg = Config{chains: []ChainConfig{
+		{Key: "base", WatcherMode: WatcherModeSubscribe, RPCURLs: []string{"wss://base"}},
+		{Key: "polygon", WatcherMode: WatcherModeSubscribe, RPCURLs: []string{"https://polygon"}},
+	}}
+	err := cfg.validate()
+	if err == nil || !strings.Contains(err.Error(), "CHAIN_POLYGON_RPC_URLS") {
+		t.Fatalf("expected polygon ws error, got %v", err)
+	}
+
+	// неизвестная сеть без CHAIN_<KEY>_ID принимает любой chain ID
+	devnet := ChainConfig{Key: "devnet", Name: "Devnet"}
+	if n, err := devnet.network(31337); err != nil || n.Key != "devnet" || n.Name != "Devnet" || n.Symbol != "ETH" {
+		t.Fatalf("unexpected devnet network: %+v %v", n, err)
+	}
+}
+
+func TestChainConfig_priceFeeds(t *testing.T) {
+	usdc := "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	feed := "0x1111111111111111111111111111111111111111"
+
+	ch := ChainConfig{WatcherMode: WatcherModeSubscribe, RPCURLs: []string{"wss://node"}, TokenPriceFeeds: map[string]string{usdc: feed}}
+	if err := ch.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	feeds := ch.priceFeeds(1)
+	if feeds.Native != prices.DefaultFeeds(1).Native {
+		t.Fatalf("expected default ETH/USD feed, got %s", feeds.Native.Hex())
+	}
+	if feeds.Tokens[common.HexToAddress(usdc)] != common.HexToAddress(feed) {
+		t.Fatalf("expected token feed override, got %v", feeds.Tokens)
+	}
+	if !prices.DefaultFeeds(31337).IsEmpty() {
+		t.Fatalf("expected no default feeds for an unknown chain")
+	}
+
+	ch.PriceFeed = PriceFeedOff
+	if !ch.priceFeeds(1).IsEmpty() {
+		t.Fatalf("expected PRICE_FEED=off to disable feeds")
+	}
+
+	ch.PriceFeed = "eth-usd"
+	if err := ch.validate(); err == nil || !strings.Contains(err.Error(), "PRICE_FEED") {
+		t.Fatalf("expected PRICE_FEED error, got %v", err)
+	}
+}
+
+func TestConfig_validateReplay(t *testing.T) {
+	cfg := Config{WatcherMode: WatcherModeSubscribe, ReplayFile: "testdata/mainnet.jsonl"}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("expected replay without endpoints to be valid, got %v", err)
+	}
+
+	cfg.Mempool = true
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "WATCHER_REPLAY_FILE") {
+		t.Fatalf("expected mempool error for a replay, got %v", err)
+	}
+
+	chained := Config{chains: []ChainConfig{{Key: "base", WatcherMode: WatcherModePoll, ReplayFile: "base.jsonl"}}}
+	if err := chained.validate(); err == nil || !strings.Contains(err.Error(), "CHAIN_BASE_WATCHER_POLL_INTERVAL") {
+		t.Fatalf("expected poll interval error, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package blocksource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Запись цепочки — JSONL: первая строка {"chainId":"0x1"}, дальше по строке на
+// блок (заголовок, транзакции и receipts в JSON-RPC виде) и на записанный
+// eth_call. Хэш блока считается из заголовка, поэтому запись подходит только
+// для сетей с заголовками go-ethereum (Ethereum, тестнеты, OP Stack без
+// deposit-tx).
+type line struct {
+	ChainID *hexutil.Big `json:"chainId,omitempty"`
+	Block   *BlockRecord `json:"block,omitempty"`
+	Call    *CallRecord  `json:"call,omitempty"`
+}
+
+type BlockRecord struct {
+	Header       *types.Header        `json:"header"`
+	Transactions []*types.Transaction `json:"transactions"`
+	Withdrawals  []*types.Withdrawal  `json:"withdrawals,omitempty"`
+	Receipts     []*types.Receipt     `json:"receipts"`
+}
+
+// CallRecord — ответ eth_call. Block nil — ответ не зависит от блока
+// (decimals/symbol токена), иначе — ответ на этом блоке (цена Chainlink).
+type CallRecord struct {
+	To     common.Address `json:"to"`
+	Data   hexutil.Bytes  `json:"data"`
+	Block  *hexutil.Big   `json:"block,omitempty"`
+	Result hexutil.Bytes  `json:"result,omitempty"`
+	// Error — текст ошибки вызова (revert): symbol() у токена может не быть
+	Error string `json:"error,omitempty"`
+}
+
+// Fixture — прочитанная запись.
+type Fixture struct {
+	ChainID *big.Int
+	Blocks  []BlockRecord
+	Calls   []CallRecord
+}
+
+// Block собирает блок из записи и проверяет, что транзакции совпадают с
+// transactionsRoot заголовка.
+func (r BlockRecord) Block() (*types.Block, error) {
+	if r.Header == nil {
+		return nil, errors.New("block without header")
+	}
+	if root := types.DeriveSha(types.Transactions(r.Transactions), trie.NewStackTrie(nil)); root != r.Header.TxHash {
+		return nil, fmt.Errorf("block #%s: transactions do not match transactionsRoot", r.Header.Number)
+	}
+	body := types.Body{Transactions: r.Transactions, Withdrawals: r.Withdrawals}
+	return types.NewBlockWithHeader(r.Header).WithBody(body), nil
+}
+
+// ReadFixture читает запись из потока.
+func ReadFixture(r io.Reader) (*Fixture, error) {
+	dec := json.NewDecoder(r)
+	f := &Fixture{}
+	for n := 1; ; n++ {
+		var l line
+		if err := dec.Decode(&l); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("fixture line %d: %w", n, err)
+		}
+		switch {
+		case l.ChainID != nil:
+			f.ChainID = l.ChainID.ToInt()
+		case l.Block != nil:
+			f.Blocks = append(f.Blocks, *l.Block)
+		case l.Call != nil:
+			f.Calls = append(f.Calls, *l.Call)
+		default:
+			return nil, fmt.Errorf("fixture line %d: expected chainId, block or call", n)
+		}
+	}
+	if f.ChainID == nil {
+		return nil, errors.New("fixture has no chainId line")
+	}
+	return f, nil
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f, err := ReadFixture(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Writer пишет запись построчно.
+type Writer struct {
+	enc *json.Encoder
+}
+
+// NewWriter пишет строку с chain ID; блоки и вызовы — через WriteBlock/WriteCall.
+func NewWriter(w io.Writer, chainID *big.Int) (*Writer, error) {
+	fw := &Writer{enc: json.NewEncoder(w)}
+	if err := fw.enc.Encode(line{ChainID: (*hexutil.Big)(chainID)}); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (w *Writer) WriteBlock(b *types.Block, receipts []*types.Receipt) error {
+	return w.enc.Encode(line{Block: &BlockRecord{
+		Header:       b.Header(),
+		Transactions: b.Transactions(),
+		Withdrawals:  b.Withdrawals(),
+		Receipts:     receipts,
+	}})
+}
+
+func (w *Writer) WriteCall(c CallRecord) error {
+	return w.enc.Encode(line{Call: &c})
+}
@@ -0,0 +1,153 @@
+package blocksource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+
+	"github.com/pvzzle/scanblock/internal/tokens"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Source — нода, с которой пишется запись (ethclient.Client, Simulated).
+type Source interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+type RecordOptions struct {
+	// TokenInfo — записать decimals()/symbol() токенов из логов Transfer, чтобы
+	// уведомления при воспроизведении были с символами и суммами
+	TokenInfo bool
+	// StaticCalls — eth_call, ответ которых не зависит от блока (пишутся на
+	// текущей голове ноды, архив не нужен)
+	StaticCalls []ethereum.CallMsg
+	// BlockCalls — eth_call на каждом блоке диапазона (latestRoundData Chainlink)
+	BlockCalls []ethereum.CallMsg
+}
+
+var (
+	selectorDecimals = crypto.Keccak256([]byte("decimals()"))[:4]
+	selectorSymbol   = crypto.Keccak256([]byte("symbol()"))[:4]
+)
+
+// Record пишет блоки from..to с receipts и нужными eth_call в out.
+func Record(ctx context.Context, src Source, from, to uint64, out io.Writer, opts RecordOptions) error {
+	if from > to {
+		return fmt.Errorf("empty range #%d..#%d", from, to)
+	}
+	chainID, err := src.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("chain id: %w", err)
+	}
+	w, err := NewWriter(out, chainID)
+	if err != nil {
+		return err
+	}
+
+	static := append([]ethereum.CallMsg(nil), opts.StaticCalls...)
+	seenTokens := make(map[common.Address]struct{})
+
+	for n := from; n <= to; n++ {
+		num := new(big.Int).SetUint64(n)
+		block, err := src.BlockByNumber(ctx, num)
+		if err != nil {
+			return fmt.Errorf("block #%d: %w", n, err)
+		}
+		receipts, err := blockReceipts(ctx, src, block)
+		if err != nil {
+			return fmt.Errorf("block #%d receipts: %w", n, err)
+		}
+		if err := w.WriteBlock(block, receipts); err != nil {
+			return err
+		}
+
+		for _, msg := range opts.BlockCalls {
+			if err := recordCall(ctx, src, w, msg, num); err != nil {
+				return err
+			}
+		}
+
+		if opts.TokenInfo {
+			for _, r := range receipts {
+				for _, l := range r.Logs {
+					t, ok := tokens.DecodeTransfer(l)
+					if !ok {
+						continue
+					}
+					if _, seen := seenTokens[t.Token]; seen {
+						continue
+					}
+					seenTokens[t.Token] = struct{}{}
+					token := t.Token
+					static = append(static,
+						ethereum.CallMsg{To: &token, Data: selectorDecimals},
+						ethereum.CallMsg{To: &token, Data: selectorSymbol},
+					)
+				}
+			}
+		}
+
+		log.Printf("[record] block #%d: %d txs", n, len(block.Transactions()))
+	}
+
+	for _, msg := range static {
+		if err := recordCall(ctx, src, w, msg, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockReceipts — eth_getBlockReceipts, а если нода его не знает — receipts по
+// одному.
+func blockReceipts(ctx context.Context, src Source, block *types.Block) ([]*types.Receipt, error) {
+	receipts, err := src.BlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+	if err == nil {
+		return receipts, nil
+	}
+
+	receipts = make([]*types.Receipt, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		r, rerr := src.TransactionReceipt(ctx, tx.Hash())
+		if rerr != nil {
+			return nil, fmt.Errorf("%w (per-tx fallback: %v)", err, rerr)
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, nil
+}
+
+// recordCall пишет ответ eth_call; revert тоже пишется — при воспроизведении
+// вызов упадёт так же.
+func recordCall(ctx context.Context, src Source, w *Writer, msg ethereum.CallMsg, block *big.Int) error {
+	if msg.To == nil {
+		return fmt.Errorf("eth_call without a target")
+	}
+	rec := CallRecord{To: *msg.To, Data: msg.Data}
+	if block != nil {
+		rec.Block = (*hexutil.Big)(block)
+	}
+
+	res, err := src.CallContract(ctx, msg, block)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rec.Error = err.Error()
+	} else {
+		rec.Result = res
+	}
+	return w.WriteCall(rec)
+}
@@ -0,0 +1,374 @@
+package blocksource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Replay — нода из записи: отдаёт блоки, receipts, логи и записанные eth_call
+// так же, как ethclient.Client. Блоки "выходят" по одному раз в interval
+// (Start), с рассылкой подписчикам newHeads; при interval <= 0 вся запись
+// доступна сразу. Блоки после текущей головы не видны — как у живой ноды.
+type Replay struct {
+	chainID  *big.Int
+	interval time.Duration
+
+	blocks   []*types.Block // по возрастанию номера, без пропусков
+	byHash   map[common.Hash]int
+	receipts map[common.Hash][]*types.Receipt // по hash блока
+	txs      map[common.Hash]txLocation
+	calls    map[callKey]CallRecord
+
+	mu      sync.Mutex
+	head    int           // индекс последнего вышедшего блока
+	changed chan struct{} // закрывается при сдвиге головы
+	done    chan struct{} // закрывается, когда вышел последний блок
+}
+
+type txLocation struct {
+	block int
+	index int
+}
+
+type callKey struct {
+	to    common.Address
+	data  string
+	block uint64
+	fixed bool // ответ на конкретном блоке
+}
+
+func NewReplay(f *Fixture, interval time.Duration) (*Replay, error) {
+	if len(f.Blocks) == 0 {
+		return nil, errors.New("fixture has no blocks")
+	}
+
+	r := &Replay{
+		chainID:  new(big.Int).Set(f.ChainID),
+		interval: interval,
+		byHash:   make(map[common.Hash]int, len(f.Blocks)),
+		receipts: make(map[common.Hash][]*types.Receipt, len(f.Blocks)),
+		txs:      make(map[common.Hash]txLocation),
+		calls:    make(map[callKey]CallRecord, len(f.Calls)),
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i, rec := range f.Blocks {
+		b, err := rec.Block()
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			prev := r.blocks[i-1]
+			if b.NumberU64() != prev.NumberU64()+1 || b.ParentHash() != prev.Hash() {
+				return nil, fmt.Errorf("block #%d does not follow #%d", b.NumberU64(), prev.NumberU64())
+			}
+		}
+		r.blocks = append(r.blocks, b)
+		r.byHash[b.Hash()] = i
+		r.receipts[b.Hash()] = rec.Receipts
+		for j, tx := range b.Transactions() {
+			r.txs[tx.Hash()] = txLocation{block: i, index: j}
+		}
+	}
+	for _, c := range f.Calls {
+		r.calls[newCallKey(c.To, c.Data, c.Block)] = c
+	}
+
+	// без интервала и в записи из одного блока выпускать нечего: вся запись
+	// видна сразу
+	if interval <= 0 || len(r.blocks) == 1 {
+		r.head = len(r.blocks) - 1
+		close(r.done)
+	}
+	return r, nil
+}
+
+// OpenReplay — Replay из файла записи.
+func OpenReplay(path string, interval time.Duration) (*Replay, error) {
+	f, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplay(f, interval)
+}
+
+func newCallKey(to common.Address, data []byte, block *hexutil.Big) callKey {
+	k := callKey{to: to, data: string(data)}
+	if block != nil {
+		k.block, k.fixed = block.ToInt().Uint64(), true
+	}
+	return k
+}
+
+// Start выпускает блоки записи по одному раз в interval до конца записи.
+func (r *Replay) Start(ctx context.Context) {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		r.head++
+		last := r.head == len(r.blocks)-1
+		close(r.changed)
+		r.changed = make(chan struct{})
+		r.mu.Unlock()
+
+		if last {
+			close(r.done)
+			return
+		}
+	}
+}
+
+// Done закрывается, когда вышел последний блок записи.
+func (r *Replay) Done() <-chan struct{} { return r.done }
+
+func (r *Replay) Close() {}
+
+func (r *Replay) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(r.chainID), nil
+}
+
+func (r *Replay) headIndex() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.head
+}
+
+// index — индекс вышедшего блока по номеру; nil и теги (latest, finalized...) —
+// голова.
+func (r *Replay) index(number *big.Int) (int, bool) {
+	head := r.headIndex()
+	if number == nil || number.Sign() < 0 {
+		return head, true
+	}
+	first := r.blocks[0].NumberU64()
+	if !number.IsUint64() || number.Uint64() < first {
+		return 0, false
+	}
+	i := int(number.Uint64() - first)
+	return i, i <= head
+}
+
+func (r *Replay) indexByHash(hash common.Hash) (int, bool) {
+	i, ok := r.byHash[hash]
+	return i, ok && i <= r.headIndex()
+}
+
+func (r *Replay) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		r.mu.Lock()
+		sent, changed := r.head, r.changed
+		r.mu.Unlock()
+
+		for {
+			select {
+			case <-quit:
+				return nil
+			case <-changed:
+			}
+
+			r.mu.Lock()
+			head := r.head
+			changed = r.changed
+			r.mu.Unlock()
+
+			for ; sent < head; sent++ {
+				select {
+				case ch <- r.blocks[sent+1].Header():
+				case <-quit:
+					return nil
+				}
+			}
+		}
+	}), nil
+}
+
+func (r *Replay) BlockNumber(ctx context.Context) (uint64, error) {
+	return r.blocks[r.headIndex()].NumberU64(), nil
+}
+
+func (r *Replay) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	b, err := r.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return b.Header(), nil
+}
+
+func (r *Replay) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	i, ok := r.index(number)
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return r.blocks[i], nil
+}
+
+func (r *Replay) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	i, ok := r.indexByHash(hash)
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return r.blocks[i], nil
+}
+
+func (r *Replay) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	var (
+		i  int
+		ok bool
+	)
+	if hash, isHash := blockNrOrHash.Hash(); isHash {
+		i, ok = r.indexByHash(hash)
+	} else if num, isNum := blockNrOrHash.Number(); isNum {
+		i, ok = r.index(big.NewInt(num.Int64()))
+	}
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return r.receipts[r.blocks[i].Hash()], nil
+}
+
+func (r *Replay) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	loc, ok := r.txs[txHash]
+	if !ok || loc.block > r.headIndex() {
+		return nil, ethereum.NotFound
+	}
+	for _, rc := range r.receipts[r.blocks[loc.block].Hash()] {
+		if rc.TxHash == txHash {
+			return rc, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (r *Replay) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	loc, ok := r.txs[hash]
+	if !ok || loc.block > r.headIndex() {
+		return nil, false, ethereum.NotFound
+	}
+	return r.blocks[loc.block].Transactions()[loc.index], false, nil
+}
+
+// CallContract отвечает записанным eth_call: сначала ответ на этом блоке (для
+// nil — на голове), потом не зависящий от блока.
+func (r *Replay) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if msg.To == nil {
+		return nil, errors.New("replay: eth_call without a target is not recorded")
+	}
+	i, ok := r.index(blockNumber)
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	num := (*hexutil.Big)(r.blocks[i].Number())
+
+	c, ok := r.calls[newCallKey(*msg.To, msg.Data, num)]
+	if !ok {
+		c, ok = r.calls[newCallKey(*msg.To, msg.Data, nil)]
+	}
+	if !ok {
+		return nil, fmt.Errorf("replay: no recorded eth_call to %s (%s) at #%s", msg.To.Hex(), hexutil.Encode(msg.Data), r.blocks[i].Number())
+	}
+	if c.Error != "" {
+		return nil, errors.New(c.Error)
+	}
+	return c.Result, nil
+}
+
+func (r *Replay) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var from, to int
+	if q.BlockHash != nil {
+		i, ok := r.indexByHash(*q.BlockHash)
+		if !ok {
+			return nil, ethereum.NotFound
+		}
+		from, to = i, i
+	} else {
+		head := r.headIndex()
+		from, to = r.rangeIndex(q.FromBlock, head), r.rangeIndex(q.ToBlock, head)
+		if from < 0 {
+			from = 0
+		}
+		if to > head {
+			to = head
+		}
+	}
+
+	var out []types.Log
+	for i := from; i <= to; i++ {
+		for _, rc := range r.receipts[r.blocks[i].Hash()] {
+			for _, l := range rc.Logs {
+				if matchLog(l, q) {
+					out = append(out, *l)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// rangeIndex — индекс блока для границы диапазона eth_getLogs (nil и теги —
+// голова); может выходить за пределы записи.
+func (r *Replay) rangeIndex(number *big.Int, head int) int {
+	if number == nil || number.Sign() < 0 {
+		return head
+	}
+	return int(number.Int64() - int64(r.blocks[0].NumberU64()))
+}
+
+// matchLog — фильтр eth_getLogs: адрес из списка и topics по позициям (пустая
+// позиция — любой topic).
+func matchLog(l *types.Log, q ethereum.FilterQuery) bool {
+	if len(q.Addresses) > 0 {
+		found := false
+		for _, a := range q.Addresses {
+			if a == l.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Topics) > len(l.Topics) {
+		return false
+	}
+	for i, alts := range q.Topics {
+		if len(alts) == 0 {
+			continue
+		}
+		found := false
+		for _, t := range alts {
+			if t == l.Topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
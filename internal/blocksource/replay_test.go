@@ -0,0 +1,242 @@
+package blocksource_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/blocksource"
+	"github.com/pvzzle/scanblock/internal/blocksource/simchain"
+	"github.com/pvzzle/scanblock/internal/tokens"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var decimalsSelector = crypto.Keccak256([]byte("decimals()"))[:4]
+
+// emitterCode — init code контракта, который на любой вызов пишет
+// Transfer(caller, caller, 42).
+func emitterCode() []byte {
+	runtime := []byte{0x60, 0x2a, 0x60, 0x00, 0x52, 0x33, 0x33, 0x7f}
+	runtime = append(runtime, tokens.TransferTopic.Bytes()...)
+	runtime = append(runtime, 0x60, 0x20, 0x60, 0x00, 0xa3, 0x00)
+
+	init := []byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}
+	return append(init, runtime...)
+}
+
+// simulatedChain — три блока: перевод 1 ETH, деплой эмиттера и вызов эмиттера.
+func simulatedChain(t *testing.T) (*simchain.Chain, *types.Transaction, common.Address) {
+	t.Helper()
+	ctx := context.Background()
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	eth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+	sim, err := simchain.New(types.GenesisAlloc{from: {Balance: new(big.Int).Mul(eth, big.NewInt(100))}})
+	if err != nil {
+		t.Fatalf("simulated: %v", err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+
+	bob := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	transfer, err := sim.Send(ctx, key, &bob, eth, nil)
+	if err != nil {
+		t.Fatalf("send transfer: %v", err)
+	}
+	sim.Commit()
+
+	deploy, err := sim.Send(ctx, key, nil, nil, emitterCode())
+	if err != nil {
+		t.Fatalf("send deploy: %v", err)
+	}
+	sim.Commit()
+	emitter := crypto.CreateAddress(from, deploy.Nonce())
+
+	if _, err := sim.Send(ctx, key, &emitter, nil, nil); err != nil {
+		t.Fatalf("send call: %v", err)
+	}
+	sim.Commit()
+
+	return sim, transfer, emitter
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	sim, transfer, emitter := simulatedChain(t)
+
+	var buf bytes.Buffer
+	if err := blocksource.Record(ctx, sim.Client(), 0, 3, &buf, blocksource.RecordOptions{TokenInfo: true}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	f, err := blocksource.ReadFixture(&buf)
+	if err != nil {
+		t.Fatalf("ReadFixture: %v", err)
+	}
+	if f.ChainID.Int64() != 1337 || len(f.Blocks) != 4 || len(f.Calls) != 2 {
+		t.Fatalf("unexpected fixture: chain=%s blocks=%d calls=%d", f.ChainID, len(f.Blocks), len(f.Calls))
+	}
+
+	r, err := blocksource.NewReplay(f, 0)
+	if err != nil {
+		t.Fatalf("NewReplay: %v", err)
+	}
+
+	for n := int64(0); n <= 3; n++ {
+		want, _ := sim.Client().BlockByNumber(ctx, big.NewInt(n))
+		got, err := r.BlockByNumber(ctx, big.NewInt(n))
+		if err != nil || got.Hash() != want.Hash() {
+			t.Fatalf("block #%d: expected hash %s, got %v %v", n, want.Hash().Hex(), got, err)
+		}
+	}
+	if head, _ := r.BlockNumber(ctx); head != 3 {
+		t.Fatalf("expected head #3, got #%d", head)
+	}
+
+	rc, err := r.TransactionReceipt(ctx, transfer.Hash())
+	if err != nil || rc.Status != types.ReceiptStatusSuccessful || rc.BlockNumber.Uint64() != 1 {
+		t.Fatalf("unexpected receipt: %+v %v", rc, err)
+	}
+	if tx, pending, err := r.TransactionByHash(ctx, transfer.Hash()); err != nil || pending || tx.Value().Cmp(transfer.Value()) != 0 {
+		t.Fatalf("unexpected tx: %v %v %v", tx, pending, err)
+	}
+
+	logs, err := r.FilterLogs(ctx, ethereum.FilterQuery{Topics: [][]common.Hash{{tokens.TransferTopic}}, FromBlock: big.NewInt(0)})
+	if err != nil || len(logs) != 1 || logs[0].Address != emitter || logs[0].BlockNumber != 3 {
+		t.Fatalf("unexpected transfer logs: %+v %v", logs, err)
+	}
+	other := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	if logs, _ := r.FilterLogs(ctx, ethereum.FilterQuery{Addresses: []common.Address{other}, FromBlock: big.NewInt(0)}); len(logs) != 0 {
+		t.Fatalf("expected no logs for another address, got %+v", logs)
+	}
+
+	// decimals() эмиттера записан (пустой ответ), чужие вызовы — ошибка
+	if _, err := r.CallContract(ctx, ethereum.CallMsg{To: &emitter, Data: decimalsSelector}, nil); err != nil {
+		t.Fatalf("expected recorded decimals() call, got %v", err)
+	}
+	if _, err := r.CallContract(ctx, ethereum.CallMsg{To: &other, Data: decimalsSelector}, nil); err == nil {
+		t.Fatalf("expected error for an unrecorded call")
+	}
+}
+
+func TestReplay_ReleasesBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sim, _, _ := simulatedChain(t)
+	var buf bytes.Buffer
+	if err := blocksource.Record(ctx, sim.Client(), 0, 3, &buf, blocksource.RecordOptions{}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	f, err := blocksource.ReadFixture(&buf)
+	if err != nil {
+		t.Fatalf("ReadFixture: %v", err)
+	}
+	r, err := blocksource.NewReplay(f, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReplay: %v", err)
+	}
+
+	// до Start видна только первая запись — как голова живой ноды
+	if _, err := r.BlockByNumber(ctx, big.NewInt(3)); !errors.Is(err, ethereum.NotFound) {
+		t.Fatalf("expected future block to be unknown, got %v", err)
+	}
+
+	headers := make(chan *types.Header, 8)
+	sub, err := r.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		t.Fatalf("SubscribeNewHead: %v", err)
+	}
+	defer sub.Unsubscribe()
+	go r.Start(ctx)
+
+	for want := uint64(1); want <= 3; want++ {
+		select {
+		case h := <-headers:
+			if h.Number.Uint64() != want {
+				t.Fatalf("expected header #%d, got #%d", want, h.Number.Uint64())
+			}
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for header #%d", want)
+		}
+	}
+	select {
+	case <-r.Done():
+	case <-ctx.Done():
+		t.Fatalf("expected replay to finish")
+	}
+	if head, _ := r.BlockNumber(ctx); head != 3 {
+		t.Fatalf("expected head #3, got #%d", head)
+	}
+}
+
+func TestReplay_SingleBlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// record -last 1: в записи один блок
+	sim, _, _ := simulatedChain(t)
+	var buf bytes.Buffer
+	if err := blocksource.Record(ctx, sim.Client(), 3, 3, &buf, blocksource.RecordOptions{}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	f, err := blocksource.ReadFixture(&buf)
+	if err != nil {
+		t.Fatalf("ReadFixture: %v", err)
+	}
+	r, err := blocksource.NewReplay(f, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReplay: %v", err)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(started)
+	}()
+	select {
+	case <-started:
+	case <-ctx.Done():
+		t.Fatalf("expected Start to return at once")
+	}
+	select {
+	case <-r.Done():
+	default:
+		t.Fatalf("expected a single-block replay to be done")
+	}
+	if head, err := r.BlockNumber(ctx); err != nil || head != 3 {
+		t.Fatalf("expected head #3, got #%d err=%v", head, err)
+	}
+}
+
+func TestNewReplay_RejectsBrokenFixture(t *testing.T) {
+	sim, _, _ := simulatedChain(t)
+	var buf bytes.Buffer
+	if err := blocksource.Record(context.Background(), sim.Client(), 1, 3, &buf, blocksource.RecordOptions{}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	f, err := blocksource.ReadFixture(&buf)
+	if err != nil {
+		t.Fatalf("ReadFixture: %v", err)
+	}
+
+	gap := *f
+	gap.Blocks = []blocksource.BlockRecord{f.Blocks[0], f.Blocks[2]}
+	if _, err := blocksource.NewReplay(&gap, 0); err == nil {
+		t.Fatalf("expected error for a gap in blocks")
+	}
+
+	tampered := *f
+	tampered.Blocks = append([]blocksource.BlockRecord(nil), f.Blocks...)
+	tampered.Blocks[0].Transactions = nil
+	if _, err := blocksource.NewReplay(&tampered, 0); err == nil {
+		t.Fatalf("expected error for transactions not matching the header")
+	}
+}
@@ -0,0 +1,97 @@
+package simchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/pvzzle/scanblock/internal/blocksource"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// Chain — цепочка go-ethereum в памяти (ethclient/simulated): блок
+// появляется по Commit, подписка newHeads и eth_getBlockReceipts работают как у
+// настоящей ноды. Chain ID — 1337. Для тестов; отдельный пакет, чтобы
+// приложение не тянуло за собой узел go-ethereum.
+type Chain struct {
+	backend *simulated.Backend
+	client  blocksource.Client
+	sender  simulated.Client
+}
+
+func New(alloc types.GenesisAlloc) (*Chain, error) {
+	b := simulated.NewBackend(alloc)
+	sender := b.Client()
+	client, ok := sender.(blocksource.Client)
+	if !ok {
+		_ = b.Close()
+		return nil, errors.New("simulated client lacks eth_getBlockReceipts")
+	}
+	return &Chain{backend: b, client: client, sender: sender}, nil
+}
+
+func (c *Chain) Client() blocksource.Client { return c.client }
+
+// Commit запечатывает блок из отправленных tx и возвращает его hash.
+func (c *Chain) Commit() common.Hash { return c.backend.Commit() }
+
+func (c *Chain) Close() error { return c.backend.Close() }
+
+// Send подписывает и отправляет EIP-1559 tx от key (to nil — деплой data). В
+// блок она попадёт на следующем Commit.
+func (c *Chain) Send(ctx context.Context, key *ecdsa.PrivateKey, to *common.Address, value *big.Int, data []byte) (*types.Transaction, error) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	gas, err := c.sender.EstimateGas(ctx, ethereum.CallMsg{From: from, To: to, Value: value, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("estimate gas: %w", err)
+	}
+	return c.SendWithGas(ctx, key, to, value, data, gas)
+}
+
+// SendWithGas — Send с заданным лимитом газа без оценки: так в блок можно
+// положить tx, которая откатится.
+func (c *Chain) SendWithGas(ctx context.Context, key *ecdsa.PrivateKey, to *common.Address, value *big.Int, data []byte, gas uint64) (*types.Transaction, error) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	chainID, err := c.client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := c.sender.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	tip, err := c.sender.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tip: %w", err)
+	}
+	head, err := c.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("head: %w", err)
+	}
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        to,
+		Value:     value,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.sender.SendTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
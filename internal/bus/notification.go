@@ -3,4 +3,18 @@ package bus
 type Notification struct {
 	ChatID int64
 	Text   string
+
+	// ChainID — сеть, к которой относятся адреса ниже
+	ChainID string
+	// Deployed — контракты, созданные tx: бот предложит следить за ними в одно касание
+	Deployed []string
+
+	// TxHash и Event — ключ идемпотентности (чат, tx, событие) в chat_tx: бот не
+	// шлёт уведомление, если событие уже записано, и записывает его только после
+	// того, как Telegram принял сообщение. Пусто — уведомление без ключа.
+	TxHash string
+	Event  string
+	// More — следом идут другие сообщения с тем же ключом; событие записывается
+	// после последнего из них
+	More bool
 }
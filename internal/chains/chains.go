@@ -0,0 +1,124 @@
+package chains
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Network — EVM-сеть: как называть её в тексте и в чём считать Value.
+type Network struct {
+	ID uint64
+	// Key — короткое имя для конфига (CHAINS) и выбора сети в поиске
+	Key    string
+	Name   string
+	Symbol string // нативная валюта
+}
+
+// IDString — chain ID так, как он хранится в БД (transactions.chain_id и т.п.).
+func (n Network) IDString() string { return strconv.FormatUint(n.ID, 10) }
+
+var known = []Network{
+	{ID: 1, Key: "ethereum", Name: "Ethereum", Symbol: "ETH"},
+	{ID: 10, Key: "optimism", Name: "Optimism", Symbol: "ETH"},
+	{ID: 56, Key: "bsc", Name: "BNB Smart Chain", Symbol: "BNB"},
+	{ID: 137, Key: "polygon", Name: "Polygon", Symbol: "POL"},
+	{ID: 8453, Key: "base", Name: "Base", Symbol: "ETH"},
+	{ID: 42161, Key: "arbitrum", Name: "Arbitrum One", Symbol: "ETH"},
+	{ID: 43114, Key: "avalanche", Name: "Avalanche C-Chain", Symbol: "AVAX"},
+	{ID: 11155111, Key: "sepolia", Name: "Sepolia", Symbol: "ETH"},
+	{ID: 17000, Key: "holesky", Name: "Holesky", Symbol: "ETH"},
+}
+
+// aliases — другие написания ключей известных сетей.
+var aliases = map[string]string{
+	"mainnet": "ethereum",
+	"eth":     "ethereum",
+	"op":      "optimism",
+	"bnb":     "bsc",
+	"matic":   "polygon",
+	"arb":     "arbitrum",
+	"avax":    "avalanche",
+}
+
+// Known — известная сеть по chain ID.
+func Known(id uint64) (Network, bool) {
+	for _, n := range known {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return Network{}, false
+}
+
+// ByKey — известная сеть по ключу или его синониму ("mainnet", "arb"...).
+func ByKey(key string) (Network, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if alias, ok := aliases[key]; ok {
+		key = alias
+	}
+	for _, n := range known {
+		if n.Key == key {
+			return n, true
+		}
+	}
+	return Network{}, false
+}
+
+// Resolve — сеть по chain ID; для неизвестной — "Chain <id>" с ETH.
+func Resolve(id uint64) Network {
+	if n, ok := Known(id); ok {
+		return n
+	}
+	return Network{
+		ID:     id,
+		Key:    strconv.FormatUint(id, 10),
+		Name:   fmt.Sprintf("Chain %d", id),
+		Symbol: "ETH",
+	}
+}
+
+// Set — сети, которые обслуживает процесс, в порядке из конфига.
+type Set []Network
+
+// ByID — сеть по chain ID из БД; незнакомый ID разрешается через Resolve.
+func (s Set) ByID(chainID string) Network {
+	id, err := strconv.ParseUint(chainID, 10, 64)
+	if err != nil {
+		return Network{Key: chainID, Name: chainID, Symbol: "ETH"}
+	}
+	for _, n := range s {
+		if n.ID == id {
+			return n
+		}
+	}
+	return Resolve(id)
+}
+
+// Find — сеть из набора по ключу, синониму известной сети или chain ID.
+func (s Set) Find(selector string) (Network, bool) {
+	selector = strings.ToLower(strings.TrimSpace(selector))
+	if selector == "" {
+		return Network{}, false
+	}
+	for _, n := range s {
+		if n.Key == selector {
+			return n, true
+		}
+	}
+	if k, ok := ByKey(selector); ok {
+		for _, n := range s {
+			if n.ID == k.ID {
+				return n, true
+			}
+		}
+	}
+	if id, err := strconv.ParseUint(selector, 10, 64); err == nil {
+		for _, n := range s {
+			if n.ID == id {
+				return n, true
+			}
+		}
+	}
+	return Network{}, false
+}
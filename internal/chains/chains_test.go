@@ -0,0 +1,47 @@
+package chains
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	if n := Resolve(42161); n.Key != "arbitrum" || n.Symbol != "ETH" {
+		t.Fatalf("unexpected arbitrum: %+v", n)
+	}
+	if n := Resolve(137); n.Symbol != "POL" {
+		t.Fatalf("unexpected polygon: %+v", n)
+	}
+	if n := Resolve(999); n.Name != "Chain 999" || n.Key != "999" || n.Symbol != "ETH" {
+		t.Fatalf("unexpected unknown chain: %+v", n)
+	}
+	if n, ok := ByKey(" Mainnet "); !ok || n.ID != 1 {
+		t.Fatalf("expected mainnet alias, got %+v %v", n, ok)
+	}
+}
+
+func TestSet_Find(t *testing.T) {
+	custom := Network{ID: 7777, Key: "devnet", Name: "Devnet", Symbol: "DEV"}
+	set := Set{Resolve(1), Resolve(8453), custom}
+
+	cases := map[string]uint64{
+		"base":     8453,
+		"ETH":      1,
+		"mainnet":  1,
+		"8453":     8453,
+		"devnet":   7777,
+		"7777":     7777,
+		"arbitrum": 0, // известная, но не настроена
+		"":         0,
+	}
+	for sel, want := range cases {
+		n, ok := set.Find(sel)
+		if ok != (want != 0) || n.ID != want {
+			t.Fatalf("Find(%q): expected %d, got %+v %v", sel, want, n, ok)
+		}
+	}
+
+	if n := set.ByID("7777"); n.Symbol != "DEV" {
+		t.Fatalf("expected configured network, got %+v", n)
+	}
+	if n := set.ByID("42161"); n.Name != "Arbitrum One" {
+		t.Fatalf("expected known network for history, got %+v", n)
+	}
+}
@@ -0,0 +1,198 @@
+package contracts
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//go:embed signatures.txt
+var builtinSignatures string
+
+//go:embed errors.txt
+var builtinErrors string
+
+// Call — декодированный calldata транзакции.
+type Call struct {
+	Selector [4]byte
+
+	// Name/Signature пустые, если селектор неизвестен
+	Name      string
+	Signature string
+	// Args nil, если метод известен, но аргументы не разобрались
+	Args []Arg
+}
+
+func (c Call) Known() bool { return c.Name != "" }
+
+// String — "transfer(to=0x…, amount=1000)" или hex селектора для неизвестного метода.
+func (c Call) String() string {
+	if !c.Known() {
+		return hexutil.Encode(c.Selector[:]) + " (unknown method)"
+	}
+	if c.Args == nil {
+		return c.Signature + " (undecodable args)"
+	}
+	return c.Name + "(" + joinArgs(c.Args) + ")"
+}
+
+func joinArgs(args []Arg) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = a.Name + "=" + a.Value
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SelectorHex — "0xa9059cbb" для calldata с селектором метода.
+func SelectorHex(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	return hexutil.Encode(data[:4]), true
+}
+
+// Selectors — база selector → метод или custom error: встроенные сигнатуры
+// плюс ABI, которые присылают пользователи. ABI только дополняет базу: селектор,
+// который уже известен, не переопределяется — иначе ABI одного чата с подобранной
+// коллизией селектора подменил бы расшифровку transfer/approve у всех.
+type Selectors struct {
+	mu      sync.RWMutex
+	methods map[[4]byte]abi.Method
+	errors  map[[4]byte]abi.Error
+}
+
+// NewSelectors создаёт базу со встроенными сигнатурами.
+func NewSelectors() *Selectors {
+	s := &Selectors{methods: make(map[[4]byte]abi.Method), errors: make(map[[4]byte]abi.Error)}
+	// файлы вшиты в бинарник — ошибка тут означает битый signatures.txt/errors.txt
+	if err := s.addSignatures(builtinSignatures, "function"); err != nil {
+		panic(fmt.Sprintf("contracts: builtin signatures: %v", err))
+	}
+	if err := s.addSignatures(builtinErrors, "error"); err != nil {
+		panic(fmt.Sprintf("contracts: builtin errors: %v", err))
+	}
+	return s
+}
+
+// AddABI добавляет ещё неизвестные методы и custom errors ABI (с именами
+// аргументов из ABI); уже известные селекторы не трогает.
+func (s *Selectors) AddABI(a *abi.ABI) {
+	if s == nil || a == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range a.Methods {
+		if _, ok := s.methods[[4]byte(m.ID)]; !ok {
+			s.methods[[4]byte(m.ID)] = m
+		}
+	}
+	for _, e := range a.Errors {
+		if _, ok := s.errors[[4]byte(e.ID[:4])]; !ok {
+			s.errors[[4]byte(e.ID[:4])] = e
+		}
+	}
+}
+
+// Decode разбирает calldata. false — в data нет селектора (перевод ETH).
+func (s *Selectors) Decode(data []byte) (Call, bool) {
+	if len(data) < 4 {
+		return Call{}, false
+	}
+	call := Call{Selector: [4]byte(data[:4])}
+	if s == nil {
+		return call, true
+	}
+
+	s.mu.RLock()
+	m, ok := s.methods[call.Selector]
+	s.mu.RUnlock()
+	if !ok {
+		return call, true
+	}
+
+	call.Name, call.Signature = m.RawName, m.Sig
+	vals, err := m.Inputs.Unpack(data[4:])
+	if err != nil || len(vals) != len(m.Inputs) {
+		return call, true
+	}
+	call.Args = unpackedArgs(m.Inputs, vals)
+	return call, true
+}
+
+func unpackedArgs(inputs abi.Arguments, vals []any) []Arg {
+	out := make([]Arg, len(inputs))
+	for i, in := range inputs {
+		name := in.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		out[i] = Arg{Name: name, Type: in.Type.String(), Value: FormatValue(vals[i])}
+	}
+	return out
+}
+
+// addSignatures разбирает строки "transfer(address,uint256) to,amount";
+// kind — "function" (методы) или "error" (custom errors).
+func (s *Selectors) addSignatures(text, kind string) error {
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; sc.Scan(); line++ {
+		row := strings.TrimSpace(sc.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+		sig, names, _ := strings.Cut(row, " ")
+		parsed, name, err := parseSignature(sig, strings.TrimSpace(names), kind)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if kind == "error" {
+			e := parsed.Errors[name]
+			s.errors[[4]byte(e.ID[:4])] = e
+		} else {
+			m := parsed.Methods[name]
+			s.methods[[4]byte(m.ID)] = m
+		}
+	}
+	return sc.Err()
+}
+
+// parseSignature собирает ABI из одной сигнатуры; возвращает его и имя записи.
+func parseSignature(sig, names, kind string) (abi.ABI, string, error) {
+	sel, err := abi.ParseSelector(sig)
+	if err != nil {
+		return abi.ABI{}, "", err
+	}
+	sel.Type = kind
+	// ParseSelector придумывает имена name0, name1... — заменяем своими или убираем
+	var list []string
+	if names != "" {
+		list = strings.Split(names, ",")
+		if len(list) != len(sel.Inputs) {
+			return abi.ABI{}, "", fmt.Errorf("%s: %d names for %d args", sig, len(list), len(sel.Inputs))
+		}
+	}
+	for i := range sel.Inputs {
+		sel.Inputs[i].Name = ""
+		if list != nil {
+			sel.Inputs[i].Name = strings.TrimSpace(list[i])
+		}
+	}
+
+	raw, err := json.Marshal([]abi.SelectorMarshaling{sel})
+	if err != nil {
+		return abi.ABI{}, "", err
+	}
+	parsed, err := abi.JSON(strings.NewReader(string(raw)))
+	if err != nil {
+		return abi.ABI{}, "", fmt.Errorf("%s: %w", sig, err)
+	}
+	return parsed, sel.Name, nil
+}
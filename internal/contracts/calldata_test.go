@@ -0,0 +1,95 @@
+package contracts
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestSelectors_DecodeBuiltin(t *testing.T) {
+	s := NewSelectors()
+
+	// transfer(0xaaaa…, 1000)
+	to := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	data := append(hexutil.MustDecode("0xa9059cbb"), common.LeftPadBytes(to.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)...)
+
+	call, ok := s.Decode(data)
+	if !ok || !call.Known() {
+		t.Fatalf("expected known call, got %+v", call)
+	}
+	if got, want := call.String(), "transfer(to="+to.Hex()+", amount=1000)"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if sel, ok := SelectorHex(data); !ok || sel != "0xa9059cbb" {
+		t.Fatalf("unexpected selector: %q", sel)
+	}
+
+	// обрезанные аргументы — метод известен, аргументы нет
+	call, _ = s.Decode(data[:20])
+	if call.String() != "transfer(address,uint256) (undecodable args)" {
+		t.Fatalf("unexpected truncated call: %q", call.String())
+	}
+
+	call, ok = s.Decode(hexutil.MustDecode("0xdeadbeef"))
+	if !ok || call.Known() || call.String() != "0xdeadbeef (unknown method)" {
+		t.Fatalf("unexpected unknown call: %+v", call)
+	}
+
+	if _, ok := s.Decode(nil); ok {
+		t.Fatalf("expected plain ETH transfer to have no call")
+	}
+}
+
+func TestSelectors_AddABI(t *testing.T) {
+	a, err := ParseABI([]byte(`[
+  {"type":"event","name":"Ping","inputs":[]},
+  {"type":"function","name":"ping","inputs":[{"name":"who","type":"address"},{"name":"note","type":"string"}],"outputs":[]}
+]`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	m := a.Methods["ping"]
+	who := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	args, err := m.Inputs.Pack(who, "hi")
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	data := append(append([]byte{}, m.ID...), args...)
+
+	s := NewSelectors()
+	if call, _ := s.Decode(data); call.Known() {
+		t.Fatalf("expected unknown before AddABI, got %+v", call)
+	}
+	s.AddABI(a)
+	call, _ := s.Decode(data)
+	if got, want := call.String(), `ping(who=`+who.Hex()+`, note="hi")`; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSelectors_AddABIDoesNotOverrideKnown(t *testing.T) {
+	// many_msg_babbage(bytes1) — известная коллизия с transfer(address,uint256)
+	a, err := ParseABI([]byte(`[
+  {"type":"event","name":"Ping","inputs":[]},
+  {"type":"function","name":"many_msg_babbage","inputs":[{"name":"b","type":"bytes1"}],"outputs":[]}
+]`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if id := hexutil.Encode(a.Methods["many_msg_babbage"].ID); id != "0xa9059cbb" {
+		t.Fatalf("expected a transfer selector collision, got %s", id)
+	}
+
+	s := NewSelectors()
+	s.AddABI(a)
+
+	to := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	data := append(hexutil.MustDecode("0xa9059cbb"), common.LeftPadBytes(to.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)...)
+	if call, _ := s.Decode(data); call.Name != "transfer" {
+		t.Fatalf("expected builtin transfer to stay, got %q", call.String())
+	}
+}
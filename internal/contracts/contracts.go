@@ -0,0 +1,221 @@
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MaxABISize — ABI больше этого не принимаем (и в БД не кладём).
+const MaxABISize = 512 << 10
+
+var (
+	ErrNoEvents     = errors.New("ABI has no non-anonymous events")
+	ErrUnknownEvent = errors.New("event is not in the ABI")
+)
+
+// ParseABI разбирает ABI в виде JSON-массива или артефакта сборки
+// (Hardhat/Truffle/Foundry: объект с полем "abi"). Нужно хотя бы одно событие.
+func ParseABI(raw []byte) (*abi.ABI, error) {
+	if len(raw) > MaxABISize {
+		return nil, fmt.Errorf("ABI is larger than %d bytes", MaxABISize)
+	}
+	data := []byte(strings.TrimSpace(string(raw)))
+
+	if len(data) > 0 && data[0] == '{' {
+		var artifact struct {
+			ABI json.RawMessage `json:"abi"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return nil, fmt.Errorf("parse ABI: %w", err)
+		}
+		if len(artifact.ABI) == 0 {
+			return nil, errors.New("parse ABI: object has no \"abi\" field")
+		}
+		data = artifact.ABI
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("parse ABI: %w", err)
+	}
+	if len(EventNames(&parsed)) == 0 {
+		return nil, ErrNoEvents
+	}
+	return &parsed, nil
+}
+
+// EventNames — имена событий ABI, которые можно отследить (без anonymous), по алфавиту.
+func EventNames(a *abi.ABI) []string {
+	var out []string
+	for name, ev := range a.Events {
+		if !ev.Anonymous {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ResolveEvents проверяет, что все names есть в ABI. Пустой список — все события.
+func ResolveEvents(a *abi.ABI, names []string) ([]string, error) {
+	var out []string
+	seen := make(map[string]struct{})
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		ev, ok := a.Events[name]
+		if !ok || ev.Anonymous {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, name)
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Event — декодированный лог контракта.
+type Event struct {
+	Contract  common.Address
+	TxHash    common.Hash
+	LogIndex  uint
+	Name      string
+	Signature string // Transfer(address,address,uint256)
+	Args      []Arg
+}
+
+type Arg struct {
+	Name    string
+	Type    string
+	Indexed bool
+	Value   string
+}
+
+// Decode разбирает лог по ABI. Индексированные аргументы динамических типов
+// (string, bytes, массивы, структуры) в topics лежат только как keccak-хэш —
+// его и показываем.
+func Decode(a *abi.ABI, l *types.Log) (Event, error) {
+	if l == nil || len(l.Topics) == 0 {
+		return Event{}, errors.New("log has no topics")
+	}
+	ev, err := a.EventByID(l.Topics[0])
+	if err != nil {
+		return Event{}, err
+	}
+
+	indexed := 0
+	for _, in := range ev.Inputs {
+		if in.Indexed {
+			indexed++
+		}
+	}
+	if len(l.Topics) != indexed+1 {
+		return Event{}, fmt.Errorf("%s: expected %d topics, got %d", ev.Name, indexed+1, len(l.Topics))
+	}
+
+	data, err := ev.Inputs.NonIndexed().Unpack(l.Data)
+	if err != nil {
+		return Event{}, fmt.Errorf("%s: unpack data: %w", ev.Name, err)
+	}
+
+	out := Event{
+		Contract:  l.Address,
+		TxHash:    l.TxHash,
+		LogIndex:  l.Index,
+		Name:      ev.Name,
+		Signature: ev.Sig,
+	}
+	topic, dataIdx := 1, 0
+	for i, in := range ev.Inputs {
+		arg := Arg{Name: in.Name, Type: in.Type.String(), Indexed: in.Indexed}
+		if arg.Name == "" {
+			arg.Name = fmt.Sprintf("arg%d", i)
+		}
+
+		if in.Indexed {
+			arg.Value, err = topicValue(in, l.Topics[topic])
+			if err != nil {
+				return Event{}, fmt.Errorf("%s.%s: %w", ev.Name, arg.Name, err)
+			}
+			topic++
+		} else {
+			arg.Value = FormatValue(data[dataIdx])
+			dataIdx++
+		}
+		out.Args = append(out.Args, arg)
+	}
+	return out, nil
+}
+
+func topicValue(in abi.Argument, topic common.Hash) (string, error) {
+	switch in.Type.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return topic.Hex() + " (keccak)", nil
+	}
+	vals := make(map[string]any, 1)
+	if err := abi.ParseTopicsIntoMap(vals, abi.Arguments{{Name: "v", Type: in.Type, Indexed: true}}, []common.Hash{topic}); err != nil {
+		return "", err
+	}
+	return FormatValue(vals["v"]), nil
+}
+
+// FormatValue — значение аргумента ABI в читаемом виде.
+func FormatValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case common.Address:
+		return x.Hex()
+	case common.Hash:
+		return x.Hex()
+	case *big.Int:
+		return x.String()
+	case []byte:
+		return hexutil.Encode(x)
+	case string:
+		return fmt.Sprintf("%q", x)
+	case bool:
+		return fmt.Sprint(x)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array:
+		// bytesN
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			parts[i] = FormatValue(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case reflect.Struct:
+		// tuple — позиционно, как в Solidity
+		parts := make([]string, rv.NumField())
+		for i := range parts {
+			parts[i] = FormatValue(rv.Field(i).Interface())
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return fmt.Sprint(v)
+}
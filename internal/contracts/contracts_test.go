@@ -0,0 +1,105 @@
+package contracts
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testABI = `[
+  {"type":"event","name":"Deposit","inputs":[
+    {"name":"user","type":"address","indexed":true},
+    {"name":"memo","type":"string","indexed":true},
+    {"name":"amount","type":"uint256","indexed":false},
+    {"name":"","type":"bool","indexed":false},
+    {"name":"tag","type":"bytes4","indexed":false}
+  ]},
+  {"type":"event","name":"Paused","inputs":[]},
+  {"type":"event","name":"Secret","anonymous":true,"inputs":[]},
+  {"type":"function","name":"deposit","inputs":[],"outputs":[]}
+]`
+
+func TestParseABI(t *testing.T) {
+	a, err := ParseABI([]byte(testABI))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := EventNames(a); len(got) != 2 || got[0] != "Deposit" || got[1] != "Paused" {
+		t.Fatalf("unexpected events: %v", got)
+	}
+
+	// артефакт Hardhat/Foundry
+	if _, err := ParseABI([]byte(`{"contractName":"Vault","abi":` + testABI + `}`)); err != nil {
+		t.Fatalf("parse artifact: %v", err)
+	}
+
+	if _, err := ParseABI([]byte(`[{"type":"function","name":"f","inputs":[],"outputs":[]}]`)); !errors.Is(err, ErrNoEvents) {
+		t.Fatalf("expected ErrNoEvents, got %v", err)
+	}
+	if _, err := ParseABI([]byte(`not json`)); err == nil {
+		t.Fatalf("expected error for garbage")
+	}
+
+	got, err := ResolveEvents(a, []string{" Paused", "Deposit", "Paused"})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("unexpected resolve: %v %v", got, err)
+	}
+	if _, err := ResolveEvents(a, []string{"Secret"}); !errors.Is(err, ErrUnknownEvent) {
+		t.Fatalf("expected anonymous event rejected, got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	a, err := ParseABI([]byte(testABI))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ev := a.Events["Deposit"]
+
+	user := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	memo := crypto.Keccak256Hash([]byte("hello"))
+	data, err := ev.Inputs.NonIndexed().Pack(big.NewInt(1500), true, [4]byte{0xde, 0xad, 0xbe, 0xef})
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+
+	l := &types.Log{
+		Address: common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc"),
+		Topics:  []common.Hash{ev.ID, common.BytesToHash(user.Bytes()), memo},
+		Data:    data,
+		Index:   3,
+	}
+	got, err := Decode(a, l)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Name != "Deposit" || got.Signature != "Deposit(address,string,uint256,bool,bytes4)" || got.LogIndex != 3 {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+
+	want := []Arg{
+		{Name: "user", Type: "address", Indexed: true, Value: user.Hex()},
+		{Name: "memo", Type: "string", Indexed: true, Value: memo.Hex() + " (keccak)"},
+		{Name: "amount", Type: "uint256", Value: "1500"},
+		{Name: "arg3", Type: "bool", Value: "true"},
+		{Name: "tag", Type: "bytes4", Value: "0xdeadbeef"},
+	}
+	if len(got.Args) != len(want) {
+		t.Fatalf("expected %d args, got %+v", len(want), got.Args)
+	}
+	for i := range want {
+		if got.Args[i] != want[i] {
+			t.Fatalf("arg %d: expected %+v, got %+v", i, want[i], got.Args[i])
+		}
+	}
+
+	// лог другого события с тем же числом topics, но не из ABI
+	l.Topics[0] = crypto.Keccak256Hash([]byte("Other()"))
+	if _, err := Decode(a, l); err == nil {
+		t.Fatalf("expected error for unknown topic")
+	}
+}
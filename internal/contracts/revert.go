@@ -0,0 +1,92 @@
+package contracts
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	selectorError = crypto.Keccak256([]byte("Error(string)"))[:4]
+	selectorPanic = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+)
+
+// panicReasons — коды Panic(uint256) компилятора Solidity.
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "invalid storage byte array",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to uninitialized function",
+}
+
+// DecodeRevert — причина отката по данным revert:
+//
+//	Error(string)   → "insufficient balance" (в кавычках)
+//	Panic(uint256)  → Panic(0x11): arithmetic overflow or underflow
+//	custom error    → ERC20InsufficientBalance(sender=0x…, balance=1, needed=2)
+//	неизвестное     → 0x1234abcd (unknown error)
+//
+// Custom errors ищутся во встроенной базе и в ABI, добавленных через AddABI.
+// Пустые данные — "" (контракт откатился без причины).
+func (s *Selectors) DecodeRevert(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if len(data) < 4 {
+		return hexutil.Encode(data) + " (malformed revert data)"
+	}
+
+	switch sel := data[:4]; {
+	case bytes.Equal(sel, selectorError):
+		vals, err := abi.Arguments{{Type: typeString}}.Unpack(data[4:])
+		if err != nil {
+			return "Error(string) (undecodable args)"
+		}
+		return strconv.Quote(vals[0].(string))
+	case bytes.Equal(sel, selectorPanic):
+		vals, err := abi.Arguments{{Type: typeUint256}}.Unpack(data[4:])
+		if err != nil {
+			return "Panic(uint256) (undecodable args)"
+		}
+		code := vals[0].(*big.Int)
+		reason, ok := panicReasons[code.Uint64()]
+		if !ok || !code.IsUint64() {
+			reason = "unknown panic code"
+		}
+		return fmt.Sprintf("Panic(%#x): %s", code, reason)
+	}
+
+	var (
+		e  abi.Error
+		ok bool
+	)
+	if s != nil {
+		s.mu.RLock()
+		e, ok = s.errors[[4]byte(data[:4])]
+		s.mu.RUnlock()
+	}
+	if !ok {
+		return hexutil.Encode(data[:4]) + " (unknown error)"
+	}
+	vals, err := e.Inputs.Unpack(data[4:])
+	if err != nil || len(vals) != len(e.Inputs) {
+		return e.Sig + " (undecodable args)"
+	}
+	return e.Name + "(" + joinArgs(unpackedArgs(e.Inputs, vals)) + ")"
+}
+
+var (
+	typeString, _  = abi.NewType("string", "", nil)
+	typeUint256, _ = abi.NewType("uint256", "", nil)
+)
@@ -0,0 +1,80 @@
+package contracts
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func revertData(t *testing.T, sig string, args ...any) []byte {
+	t.Helper()
+	sel, err := abi.ParseSelector(sig)
+	if err != nil {
+		t.Fatalf("parse %s: %v", sig, err)
+	}
+	var inputs abi.Arguments
+	for _, in := range sel.Inputs {
+		typ, err := abi.NewType(in.Type, "", nil)
+		if err != nil {
+			t.Fatalf("type %s: %v", in.Type, err)
+		}
+		inputs = append(inputs, abi.Argument{Type: typ})
+	}
+	packed, err := inputs.Pack(args...)
+	if err != nil {
+		t.Fatalf("pack %s: %v", sig, err)
+	}
+	return append(crypto.Keccak256([]byte(sig))[:4], packed...)
+}
+
+func TestSelectors_DecodeRevert(t *testing.T) {
+	s := NewSelectors()
+	sender := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"error string", revertData(t, "Error(string)", "ERC20: transfer amount exceeds balance"), `"ERC20: transfer amount exceeds balance"`},
+		{"panic", revertData(t, "Panic(uint256)", big.NewInt(0x11)), "Panic(0x11): arithmetic overflow or underflow"},
+		{"unknown panic", revertData(t, "Panic(uint256)", big.NewInt(0x99)), "Panic(0x99): unknown panic code"},
+		{"builtin custom error",
+			revertData(t, "ERC20InsufficientBalance(address,uint256,uint256)", sender, big.NewInt(1), big.NewInt(5)),
+			"ERC20InsufficientBalance(sender=" + sender.Hex() + ", balance=1, needed=5)"},
+		{"no args", revertData(t, "EnforcedPause()"), "EnforcedPause()"},
+		{"unknown", hexutil.MustDecode("0xdeadbeef"), "0xdeadbeef (unknown error)"},
+		{"truncated", revertData(t, "Error(string)", "x")[:10], "Error(string) (undecodable args)"},
+		{"malformed", []byte{0x01}, "0x01 (malformed revert data)"},
+	}
+	for _, tc := range cases {
+		if got := s.DecodeRevert(tc.data); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSelectors_DecodeRevertFromABI(t *testing.T) {
+	a, err := ParseABI([]byte(`[
+  {"type":"event","name":"Ping","inputs":[]},
+  {"type":"error","name":"TooLate","inputs":[{"name":"deadline","type":"uint256"}]}
+]`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	data := revertData(t, "TooLate(uint256)", big.NewInt(1700000000))
+
+	s := NewSelectors()
+	if got := s.DecodeRevert(data); got != hexutil.Encode(data[:4])+" (unknown error)" {
+		t.Fatalf("expected unknown before AddABI, got %q", got)
+	}
+	s.AddABI(a)
+	if got, want := s.DecodeRevert(data), "TooLate(deadline=1700000000)"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,266 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// RegistryAddress — реестр ENS; один адрес в mainnet, Sepolia и Holesky.
+var RegistryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+// supportedChains — сети, где развёрнут реестр ENS.
+var supportedChains = map[uint64]bool{1: true, 11155111: true, 17000: true}
+
+// Supported — есть ли ENS в сети с этим chain ID.
+func Supported(chainID uint64) bool { return supportedChains[chainID] }
+
+var ErrNotFound = errors.New("ENS name has no address")
+
+const ensABI = `[
+  {"type":"function","name":"resolver","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+  {"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+  {"type":"function","name":"name","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var parsedABI = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(ensABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// IsName — похоже ли на ENS-имя: непустые метки через точку (vitalik.eth).
+func IsName(s string) bool {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ".") || strings.ContainsAny(s, " \t\n/:") {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Normalize — имя в нижнем регистре без пробелов по краям. Полную нормализацию
+// ENSIP-15 (юникод, эмодзи) не делаем: для ASCII-имён результат тот же.
+func Normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NameHash — namehash по EIP-137.
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := crypto.Keccak256([]byte(labels[i]))
+		node = crypto.Keccak256Hash(node.Bytes(), label)
+	}
+	return node
+}
+
+// reverseNode — узел обратной записи адреса: <hex без 0x>.addr.reverse.
+func reverseNode(addr common.Address) common.Hash {
+	return NameHash(strings.ToLower(addr.Hex()[2:]) + ".addr.reverse")
+}
+
+// maxCachedNames — сколько адресов держим в кэше имён: watcher спрашивает
+// имена всех контрагентов китов и кошельков, и без предела кэш рос бы вечно.
+const maxCachedNames = 4096
+
+type cachedName struct {
+	name    string
+	expires time.Time
+}
+
+// Resolver разрешает ENS-имена через реестр и резолверы (eth_call) и кэширует
+// основные имена адресов на ttl — включая отсутствие имени.
+type Resolver struct {
+	caller ethereum.ContractCaller
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	names map[common.Address]cachedName
+}
+
+func NewResolver(c ethereum.ContractCaller, ttl time.Duration) *Resolver {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &Resolver{
+		caller: c,
+		ttl:    ttl,
+		now:    time.Now,
+		names:  make(map[common.Address]cachedName),
+	}
+}
+
+// Resolve — адрес, на который указывает имя.
+func (r *Resolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	node := NameHash(Normalize(name))
+	resolver, err := r.resolverOf(ctx, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	addr, err := r.callAddress(ctx, resolver, "addr", node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if addr == (common.Address{}) {
+		return common.Address{}, ErrNotFound
+	}
+	return addr, nil
+}
+
+// LookupAddress — основное имя адреса по обратной записи, без кэша. Имя
+// засчитывается, только если оно разрешается обратно в тот же адрес:
+// обратную запись владелец адреса может выставить любую.
+func (r *Resolver) LookupAddress(ctx context.Context, addr common.Address) (string, error) {
+	node := reverseNode(addr)
+	resolver, err := r.resolverOf(ctx, node)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	out, err := r.call(ctx, resolver, "name", node)
+	if err != nil {
+		return "", err
+	}
+	name, ok := out[0].(string)
+	if !ok || name == "" {
+		return "", nil
+	}
+
+	forward, err := r.Resolve(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if forward != addr {
+		return "", nil
+	}
+	return name, nil
+}
+
+// nameLookupTimeout — сколько ждём reverse-запрос ради подписи к адресу.
+const nameLookupTimeout = 3 * time.Second
+
+// Name — основное имя адреса из кэша, при промахе — LookupAddress. "" — имени
+// нет или ENS не ответил (тогда не кэшируем и спросим в следующий раз).
+func (r *Resolver) Name(ctx context.Context, addr common.Address) string {
+	now := r.now()
+	r.mu.Lock()
+	c, ok := r.names[addr]
+	r.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.name
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, nameLookupTimeout)
+	defer cancel()
+	name, err := r.LookupAddress(cctx, addr)
+	if err != nil {
+		return ""
+	}
+
+	r.mu.Lock()
+	if len(r.names) >= maxCachedNames {
+		r.evictExpired(now)
+	}
+	if len(r.names) >= maxCachedNames {
+		r.names = make(map[common.Address]cachedName)
+	}
+	r.names[addr] = cachedName{name: name, expires: now.Add(r.ttl)}
+	r.mu.Unlock()
+	return name
+}
+
+// evictExpired убирает из кэша истёкшие имена. Вызывается под r.mu.
+func (r *Resolver) evictExpired(now time.Time) {
+	for addr, c := range r.names {
+		if !now.Before(c.expires) {
+			delete(r.names, addr)
+		}
+	}
+}
+
+func (r *Resolver) resolverOf(ctx context.Context, node common.Hash) (common.Address, error) {
+	resolver, err := r.callAddress(ctx, RegistryAddress, "resolver", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("registry resolver(): %w", err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, ErrNotFound
+	}
+	return resolver, nil
+}
+
+func (r *Resolver) callAddress(ctx context.Context, to common.Address, method string, node common.Hash) (common.Address, error) {
+	out, err := r.call(ctx, to, method, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	addr, ok := out[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("%s(): unexpected output", method)
+	}
+	return addr, nil
+}
+
+func (r *Resolver) call(ctx context.Context, to common.Address, method string, node common.Hash) ([]any, error) {
+	data, err := parsedABI.Pack(method, node)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", method, err)
+	}
+	if len(raw) == 0 {
+		// у адреса нет кода — резолвер не развёрнут
+		return nil, ErrNotFound
+	}
+	out, err := parsedABI.Unpack(method, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", method, err)
+	}
+	return out, nil
+}
+
+// Names — основные имена адресов (только найденные); nil-резолвер — ENS не
+// настроен, имён нет.
+func (r *Resolver) Names(ctx context.Context, addrs ...common.Address) map[common.Address]string {
+	if r == nil {
+		return nil
+	}
+	var out map[common.Address]string
+	for _, a := range addrs {
+		if name := r.Name(ctx, a); name != "" {
+			if out == nil {
+				out = make(map[common.Address]string)
+			}
+			out[a] = name
+		}
+	}
+	return out
+}
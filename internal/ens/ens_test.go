@@ -0,0 +1,160 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeENS — реестр и один резолвер: node -> адрес и адрес -> имя.
+type fakeENS struct {
+	resolver common.Address
+	addrs    map[common.Hash]common.Address
+	names    map[common.Hash]string
+	fail     bool
+	calls    int
+}
+
+func (f *fakeENS) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	if f.fail {
+		return nil, errors.New("connection refused")
+	}
+	method, err := parsedABI.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, errors.New("execution reverted")
+	}
+	var node common.Hash
+	copy(node[:], msg.Data[4:36])
+
+	switch {
+	case *msg.To == RegistryAddress && method.Name == "resolver":
+		_, hasAddr := f.addrs[node]
+		_, hasName := f.names[node]
+		if !hasAddr && !hasName {
+			return method.Outputs.Pack(common.Address{})
+		}
+		return method.Outputs.Pack(f.resolver)
+	case *msg.To == f.resolver && method.Name == "addr":
+		return method.Outputs.Pack(f.addrs[node])
+	case *msg.To == f.resolver && method.Name == "name":
+		return method.Outputs.Pack(f.names[node])
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func TestNameHash(t *testing.T) {
+	if got := NameHash(""); got != (common.Hash{}) {
+		t.Fatalf("expected zero node for empty name, got %s", got.Hex())
+	}
+	// значения из EIP-137
+	if got := NameHash("eth").Hex(); got != "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae" {
+		t.Fatalf("unexpected namehash(eth): %s", got)
+	}
+	if got := NameHash("foo.eth").Hex(); got != "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f" {
+		t.Fatalf("unexpected namehash(foo.eth): %s", got)
+	}
+}
+
+func TestIsName(t *testing.T) {
+	for _, s := range []string{"vitalik.eth", "Pay.Vitalik.ETH", " foo.eth "} {
+		if !IsName(s) {
+			t.Fatalf("expected %q to be a name", s)
+		}
+	}
+	for _, s := range []string{"", "eth", "foo..eth", ".eth", "foo.", "https://foo.eth", "foo bar.eth"} {
+		if IsName(s) {
+			t.Fatalf("expected %q not to be a name", s)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	vitalik := common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045")
+	impostor := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	f := &fakeENS{
+		resolver: common.HexToAddress("0x231b0Ee14048e9dCcD1d247744d114a4EB5E8E63"),
+		addrs:    map[common.Hash]common.Address{NameHash("vitalik.eth"): vitalik},
+		names: map[common.Hash]string{
+			reverseNode(vitalik):  "vitalik.eth",
+			reverseNode(impostor): "vitalik.eth", // обратная запись без прямой
+		},
+	}
+	r := NewResolver(f, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	r.now = func() time.Time { return now }
+
+	if addr, err := r.Resolve(ctx, "Vitalik.ETH"); err != nil || addr != vitalik {
+		t.Fatalf("unexpected resolve: %s %v", addr.Hex(), err)
+	}
+	if _, err := r.Resolve(ctx, "nobody.eth"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if name := r.Name(ctx, vitalik); name != "vitalik.eth" {
+		t.Fatalf("expected primary name, got %q", name)
+	}
+	if name := r.Name(ctx, impostor); name != "" {
+		t.Fatalf("expected unverified reverse record to be ignored, got %q", name)
+	}
+	if name := r.Name(ctx, common.HexToAddress("0x2222222222222222222222222222222222222222")); name != "" {
+		t.Fatalf("expected no name, got %q", name)
+	}
+
+	// повтор — из кэша, в том числе отсутствие имени
+	calls := f.calls
+	r.Name(ctx, vitalik)
+	r.Name(ctx, impostor)
+	if f.calls != calls {
+		t.Fatalf("expected cached names, got %d extra calls", f.calls-calls)
+	}
+
+	// после TTL — снова в сеть; ошибка RPC не кэшируется
+	now = now.Add(2 * time.Minute)
+	f.fail = true
+	if name := r.Name(ctx, vitalik); name != "" {
+		t.Fatalf("expected no name on rpc error, got %q", name)
+	}
+	f.fail = false
+	if name := r.Name(ctx, vitalik); name != "vitalik.eth" {
+		t.Fatalf("expected name after rpc recovered, got %q", name)
+	}
+}
+
+func TestResolver_CacheIsBounded(t *testing.T) {
+	ctx := context.Background()
+
+	r := NewResolver(&fakeENS{resolver: common.HexToAddress("0x01")}, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < maxCachedNames; i++ {
+		r.Name(ctx, common.BigToAddress(big.NewInt(int64(i+1))))
+	}
+	if len(r.names) != maxCachedNames {
+		t.Fatalf("expected a full cache, got %d", len(r.names))
+	}
+
+	// истёкшие записи уходят первыми
+	now = now.Add(2 * time.Minute)
+	r.Name(ctx, common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff"))
+	if len(r.names) != 1 {
+		t.Fatalf("expected expired names evicted, got %d", len(r.names))
+	}
+
+	// свежий кэш без истёкших сбрасывается целиком
+	for i := 1; i < maxCachedNames; i++ {
+		r.Name(ctx, common.BigToAddress(big.NewInt(int64(i+1))))
+	}
+	r.Name(ctx, common.HexToAddress("0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"))
+	if len(r.names) > maxCachedNames {
+		t.Fatalf("expected cache to stay within %d, got %d", maxCachedNames, len(r.names))
+	}
+}
@@ -0,0 +1,152 @@
+package ethwatch
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/blocksource"
+	"github.com/pvzzle/scanblock/internal/blocksource/simchain"
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/storage"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	e2eBob   = common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	e2eCarol = common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+)
+
+// simulatedTransfers — цепочка в памяти: #1 — 1 ETH Бобу, #2 — 0.1 ETH Кэрол.
+func simulatedTransfers(t *testing.T) *simchain.Chain {
+	t.Helper()
+	ctx := context.Background()
+
+	key, _ := crypto.GenerateKey()
+	eth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	sim, err := simchain.New(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: new(big.Int).Mul(eth, big.NewInt(10))},
+	})
+	if err != nil {
+		t.Fatalf("simulated: %v", err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+
+	for _, tr := range []struct {
+		to    common.Address
+		value *big.Int
+	}{
+		{e2eBob, eth},
+		{e2eCarol, new(big.Int).Div(eth, big.NewInt(10))},
+	} {
+		if _, err := sim.Send(ctx, key, &tr.to, tr.value, nil); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		sim.Commit()
+	}
+	return sim
+}
+
+// runPipeline запускает Watcher.Start на client с чекпоинта на генезисе и ждёт
+// want уведомлений и чекпоинта на блоке last. Чат 1 следит за кошельком Боба,
+// чат 2 — за tx от 0.5 ETH.
+func runPipeline(t *testing.T, client ChainClient, genesis common.Hash, want int, last uint64) ([]bus.Notification, *mockRepo) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := subs.NewStore()
+	_ = store.SetWallet(ctx, 1, e2eBob)
+	_ = store.SetLargeTxMin(ctx, 2, new(big.Int).Mul(big.NewInt(5), new(big.Int).Exp(big.NewInt(10), big.NewInt(17), nil)))
+
+	repo := &mockRepo{checkpoint: &storage.Checkpoint{ChainID: "1337", BlockNum: 0, BlockHash: genesis.Hex()}}
+	notifyCh := make(chan bus.Notification, 16)
+	w := NewWatcher(client, big.NewInt(1337), store, notifyCh, repo, nil, WatcherConfig{Workers: 2})
+
+	done := make(chan error, 1)
+	go func() { done <- w.Start(ctx) }()
+
+	var got []bus.Notification
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for len(got) < want || !savedUpTo(repo, last) {
+		select {
+		case n := <-notifyCh:
+			got = append(got, n)
+		case <-tick.C:
+		case err := <-done:
+			t.Fatalf("watcher stopped: %v", err)
+		case <-ctx.Done():
+			t.Fatalf("timeout: got %d of %d notifications, checkpoints %+v", len(got), want, repo.saved)
+		}
+	}
+	cancel()
+	<-done
+	return got, repo
+}
+
+func savedUpTo(repo *mockRepo, last uint64) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return len(repo.saved) > 0 && repo.saved[len(repo.saved)-1].BlockNum >= last
+}
+
+func checkPipeline(t *testing.T, got []bus.Notification) {
+	t.Helper()
+	chats := make(map[int64]bool)
+	for _, n := range got {
+		chats[n.ChatID] = true
+		if !contains(n.Text, "Value: 1.000000 ETH") {
+			t.Fatalf("expected only the 1 ETH transfer, got: %s", n.Text)
+		}
+	}
+	if len(got) != 2 || !chats[1] || !chats[2] {
+		t.Fatalf("expected wallet and large-tx chats, got %v", chats)
+	}
+}
+
+func TestWatcher_Start_Simulated(t *testing.T) {
+	sim := simulatedTransfers(t)
+	genesis, err := sim.Client().HeaderByNumber(context.Background(), big.NewInt(0))
+	if err != nil {
+		t.Fatalf("genesis: %v", err)
+	}
+
+	got, _ := runPipeline(t, sim.Client(), genesis.Hash(), 2, 2)
+	checkPipeline(t, got)
+}
+
+func TestWatcher_Start_Replay(t *testing.T) {
+	ctx := context.Background()
+	sim := simulatedTransfers(t)
+
+	var buf bytes.Buffer
+	if err := blocksource.Record(ctx, sim.Client(), 0, 2, &buf, blocksource.RecordOptions{}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	f, err := blocksource.ReadFixture(&buf)
+	if err != nil {
+		t.Fatalf("ReadFixture: %v", err)
+	}
+	// блоки выходят по одному и приходят через подписку newHeads
+	replay, err := blocksource.NewReplay(f, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReplay: %v", err)
+	}
+	go replay.Start(ctx)
+
+	got, repo := runPipeline(t, replay, f.Blocks[0].Header.Hash(), 2, 2)
+	checkPipeline(t, got)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if len(repo.upserts) != 1 || repo.upserts[0].BlockNum == nil || *repo.upserts[0].BlockNum != 1 {
+		t.Fatalf("expected the 1 ETH tx stored once at #1, got %+v", repo.upserts)
+	}
+}
@@ -0,0 +1,192 @@
+package ethwatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/pvzzle/scanblock/internal/storage"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// trackedBlock — обработанный блок и кому по его транзакциям ушли уведомления.
+type trackedBlock struct {
+	Num      uint64
+	Hash     common.Hash
+	Notified map[common.Hash][]int64 // tx hash -> chat ids
+}
+
+// chainTracker хранит окно последних канонических блоков (по возрастанию номера,
+// без разрывов), чтобы находить точку форка при реорге.
+type chainTracker struct {
+	depth  int
+	blocks []trackedBlock
+}
+
+func newChainTracker(depth int) *chainTracker {
+	if depth <= 0 {
+		depth = 1
+	}
+	return &chainTracker{depth: depth}
+}
+
+func (t *chainTracker) hashAt(num uint64) (common.Hash, bool) {
+	if len(t.blocks) == 0 {
+		return common.Hash{}, false
+	}
+	first := t.blocks[0].Num
+	if num < first || num-first >= uint64(len(t.blocks)) {
+		return common.Hash{}, false
+	}
+	return t.blocks[num-first].Hash, true
+}
+
+// push добавляет следующий блок. Если он не продолжает окно, окно начинается заново.
+func (t *chainTracker) push(b trackedBlock) {
+	if n := len(t.blocks); n > 0 && t.blocks[n-1].Num+1 != b.Num {
+		t.blocks = t.blocks[:0]
+	}
+	t.blocks = append(t.blocks, b)
+	if over := len(t.blocks) - t.depth; over > 0 {
+		t.blocks = append(t.blocks[:0], t.blocks[over:]...)
+	}
+}
+
+// rollback убирает из окна все блоки выше forkNum и возвращает их.
+func (t *chainTracker) rollback(forkNum uint64) []trackedBlock {
+	for i, b := range t.blocks {
+		if b.Num > forkNum {
+			orphaned := append([]trackedBlock(nil), t.blocks[i:]...)
+			t.blocks = t.blocks[:i]
+			return orphaned
+		}
+	}
+	return nil
+}
+
+// applyBlock обрабатывает блок с учётом реоргов: если он не продолжает известную
+// цепочку, идём по parent hash назад до точки форка, откатываем осиротевшие блоки
+// и обрабатываем новую каноническую ветку целиком.
+func (w *Watcher) applyBlock(ctx context.Context, block *types.Block) error {
+	if err := w.confirmBlock(ctx, block); err != nil {
+		return err
+	}
+
+	segment, err := w.newChainSegment(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	var orphaned []trackedBlock
+	if first := segment[0].NumberU64(); first > 0 {
+		orphaned = w.chain.rollback(first - 1)
+	}
+	var held map[common.Hash]map[int64]struct{}
+	if len(orphaned) > 0 {
+		forkNum := segment[0].NumberU64() - 1
+		w.lastBlock = &forkNum
+		// отложенные уведомления по осиротевшим блокам так и не ушли — отменять нечего
+		if w.held != nil {
+			held = w.held.dropAbove(forkNum)
+			for hash, chats := range held {
+				for chatID := range chats {
+					w.forgetHeld(ctx, chatID, hash)
+				}
+			}
+		}
+		log.Printf("[WATCHER] reorg detected: fork at #%d, %d block(s) orphaned, new branch up to #%d",
+			forkNum, len(orphaned), block.NumberU64())
+	}
+
+	included := make(map[common.Hash]struct{})
+	for _, b := range segment {
+		if err := w.processBlock(ctx, b); err != nil {
+			return err
+		}
+		if len(orphaned) > 0 {
+			for _, tx := range b.Transactions() {
+				included[tx.Hash()] = struct{}{}
+			}
+		}
+	}
+
+	if len(orphaned) > 0 {
+		w.retract(ctx, orphaned, included, held)
+	}
+	return nil
+}
+
+// confirmBlock требует подтверждения hash блока кворумом, если клиент это умеет.
+// Неподтверждённый блок не обрабатывается и будет взят снова со следующей головой.
+func (w *Watcher) confirmBlock(ctx context.Context, block *types.Block) error {
+	c, ok := w.client.(blockConfirmer)
+	if !ok {
+		return nil
+	}
+	agreed, err := c.ConfirmBlock(ctx, block.NumberU64(), block.Hash())
+	if err != nil {
+		return fmt.Errorf("block #%d quorum: %w", block.NumberU64(), err)
+	}
+	if !agreed {
+		return fmt.Errorf("block #%d %s not confirmed by quorum yet", block.NumberU64(), block.Hash().Hex())
+	}
+	return nil
+}
+
+// newChainSegment возвращает ветку новой цепочки от точки форка (не включая её) до block.
+// Ходим назад, пока parent hash не совпадёт с известным блоком или не выйдем за окно.
+func (w *Watcher) newChainSegment(ctx context.Context, block *types.Block) ([]*types.Block, error) {
+	segment := []*types.Block{block}
+	for {
+		cur := segment[0]
+		if cur.NumberU64() == 0 {
+			return segment, nil
+		}
+
+		known, ok := w.chain.hashAt(cur.NumberU64() - 1)
+		if !ok || known == cur.ParentHash() {
+			return segment, nil
+		}
+
+		parent, err := w.client.BlockByHash(ctx, cur.ParentHash())
+		if err != nil {
+			return nil, fmt.Errorf("parent block #%d fetch: %w", cur.NumberU64()-1, err)
+		}
+		segment = append([]*types.Block{parent}, segment...)
+	}
+}
+
+// retract сообщает чатам о транзакциях из осиротевших блоков, которые не вошли
+// в новую ветку, и сбрасывает у них данные о блоке в БД. Чатам из held
+// уведомление ещё не отправлялось — им откат не шлём.
+func (w *Watcher) retract(ctx context.Context, orphaned []trackedBlock, included map[common.Hash]struct{}, held map[common.Hash]map[int64]struct{}) {
+	for _, b := range orphaned {
+		for hash, chats := range b.Notified {
+			if _, ok := included[hash]; ok {
+				continue
+			}
+
+			if err := w.repo.MarkTxReorged(ctx, hash.Hex()); err != nil {
+				log.Printf("[watcher] mark tx reorged error: %v", err)
+			}
+
+			text := FormatReorgNotification(hash, b.Num)
+			for _, chatID := range chats {
+				if _, ok := held[hash][chatID]; ok {
+					continue
+				}
+				_, _ = w.repo.AddChatEvent(ctx, chatID, hash.Hex(), storage.EventReorg)
+				// если tx войдёт в другой блок, чат узнает об этом заново
+				if err := w.repo.RemoveChatEvent(ctx, chatID, hash.Hex(), storage.EventNotify); err != nil {
+					log.Printf("[watcher] remove notify event error: %v", err)
+				}
+
+				if !w.notify(ctx, chatID, text) {
+					return
+				}
+			}
+		}
+	}
+}
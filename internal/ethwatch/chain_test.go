@@ -0,0 +1,82 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/storage"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestChainTracker_PushAndRollback(t *testing.T) {
+	tr := newChainTracker(3)
+	for n := uint64(10); n <= 14; n++ {
+		tr.push(trackedBlock{Num: n, Hash: common.BigToHash(bigU(n))})
+	}
+
+	if _, ok := tr.hashAt(11); ok {
+		t.Fatalf("expected #11 to be trimmed out of window")
+	}
+	if h, ok := tr.hashAt(13); !ok || h != common.BigToHash(bigU(13)) {
+		t.Fatalf("expected #13 in window, got=%s ok=%v", h.Hex(), ok)
+	}
+
+	orphaned := tr.rollback(12)
+	if len(orphaned) != 2 || orphaned[0].Num != 13 || orphaned[1].Num != 14 {
+		t.Fatalf("expected #13,#14 orphaned, got=%+v", orphaned)
+	}
+	if _, ok := tr.hashAt(13); ok {
+		t.Fatalf("expected #13 removed after rollback")
+	}
+
+	// разрыв — окно начинается заново
+	tr.push(trackedBlock{Num: 20})
+	if _, ok := tr.hashAt(12); ok {
+		t.Fatalf("expected window reset after gap")
+	}
+}
+
+func TestWatcher_retract(t *testing.T) {
+	ctx := context.Background()
+
+	gone := common.HexToHash("0x01")
+	reincluded := common.HexToHash("0x02")
+
+	// уведомление о gone снимается, чтобы при повторном включении оно ушло снова
+	repo := &mockRepo{events: []mockEvent{{chatID: 1, hash: gone.Hex(), etype: storage.EventNotify}}}
+	notifyCh := make(chan bus.Notification, 4)
+	w := &Watcher{notifyCh: notifyCh, repo: repo}
+
+	orphaned := []trackedBlock{{
+		Num: 100,
+		Notified: map[common.Hash][]int64{
+			gone:       {1, 2},
+			reincluded: {3},
+		},
+	}}
+	w.retract(ctx, orphaned, map[common.Hash]struct{}{reincluded: {}}, nil)
+
+	if len(notifyCh) != 2 {
+		t.Fatalf("expected 2 retraction notices, got=%d", len(notifyCh))
+	}
+	n := <-notifyCh
+	if !contains(n.Text, gone.Hex()) || !contains(n.Text, "#100") {
+		t.Fatalf("unexpected retraction text: %s", n.Text)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if len(repo.reorged) != 1 || repo.reorged[0] != gone.Hex() {
+		t.Fatalf("expected only %s marked reorged, got=%v", gone.Hex(), repo.reorged)
+	}
+	for _, e := range repo.events {
+		if e.etype != storage.EventReorg {
+			t.Fatalf("expected reorg events only, got=%+v", e)
+		}
+	}
+}
+
+func bigU(n uint64) *big.Int { return new(big.Int).SetUint64(n) }
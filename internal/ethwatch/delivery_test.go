@@ -0,0 +1,102 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/blocksource/simchain"
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/storage"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestWatcher_processBlock_OrderedAndDeduplicated(t *testing.T) {
+	ctx := context.Background()
+
+	key, _ := crypto.GenerateKey()
+	eth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	sim, err := simchain.New(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: new(big.Int).Mul(eth, big.NewInt(10))},
+	})
+	if err != nil {
+		t.Fatalf("simulated: %v", err)
+	}
+	defer sim.Close()
+
+	// один блок с кучей переводов одному кошельку — воркеры разберут их вразнобой
+	for i := 0; i < 12; i++ {
+		if _, err := sim.Send(ctx, key, &e2eBob, big.NewInt(int64(i+1)), nil); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	sim.Commit()
+	block, err := sim.Client().BlockByNumber(ctx, big.NewInt(1))
+	if err != nil || len(block.Transactions()) != 12 {
+		t.Fatalf("expected block #1 with 12 txs, got %v %v", block, err)
+	}
+
+	store := subs.NewStore()
+	_ = store.SetWallet(ctx, 1, e2eBob)
+
+	repo := &mockRepo{}
+	notifyCh := make(chan bus.Notification, 32)
+	w := NewWatcher(sim.Client(), big.NewInt(1337), store, notifyCh, repo, nil, WatcherConfig{Workers: 8})
+	w.startWorkers(ctx)
+	defer w.stopWorkers()
+
+	if err := w.processBlock(ctx, block); err != nil {
+		t.Fatalf("processBlock: %v", err)
+	}
+	if len(notifyCh) != 12 {
+		t.Fatalf("expected 12 notifications, got %d", len(notifyCh))
+	}
+	for i, tx := range block.Transactions() {
+		n := <-notifyCh
+		if !contains(n.Text, tx.Hash().Hex()) {
+			t.Fatalf("notification #%d is not about tx #%d %s: %s", i, i, tx.Hash().Hex(), n.Text)
+		}
+		repo.delivered(n)
+	}
+
+	// блок пришёл повторно (рестарт до чекпоинта) — чату уже сообщили
+	if err := w.processBlock(ctx, block); err != nil {
+		t.Fatalf("processBlock again: %v", err)
+	}
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected no duplicates, got %d notifications", len(notifyCh))
+	}
+}
+
+func TestWatcher_send_NotMarkedUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &mockRepo{}
+	notifyCh := make(chan bus.Notification, 4)
+	w := &Watcher{chainID: big.NewInt(1), notifyCh: notifyCh, repo: repo}
+
+	n := heldNotification{ChatID: 1, TxHash: common.HexToHash("0x01"), BlockNum: 1, Messages: []heldMessage{{Text: "tx"}, {Text: "transfer"}}}
+	w.send(ctx, n)
+	if len(repo.events) != 0 {
+		t.Fatalf("expected no chat event before the bot sends, got=%+v", repo.events)
+	}
+
+	// бот не успел отправить (рестарт) — повторная обработка шлёт снова
+	<-notifyCh
+	<-notifyCh
+	w.send(ctx, n)
+	first, last := <-notifyCh, <-notifyCh
+	if !first.More || last.More || first.TxHash != last.TxHash || first.Event != string(storage.EventNotify) {
+		t.Fatalf("expected one key for the group marked after the last message, got=%+v %+v", first, last)
+	}
+
+	repo.delivered(first, last)
+	w.send(ctx, n)
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected no resend after delivery")
+	}
+}
@@ -0,0 +1,147 @@
+package ethwatch
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxDeployCandidates — сколько адресов из логов одной tx проверяем через
+// eth_getCode (два запроса на адрес) в запасном поиске без трассировки.
+const maxDeployCandidates = 16
+
+// CreatedAddress — адрес контракта, созданного самой tx (To == nil): из receipt,
+// а без него — из отправителя и nonce. false — tx не деплой или откатилась.
+func CreatedAddress(tx *types.Transaction, from common.Address, r *types.Receipt) (common.Address, bool) {
+	if tx.To() != nil {
+		return common.Address{}, false
+	}
+	if r != nil {
+		if r.Status != types.ReceiptStatusSuccessful {
+			return common.Address{}, false
+		}
+		if r.ContractAddress != (common.Address{}) {
+			return r.ContractAddress, true
+		}
+	}
+	return crypto.CreateAddress(from, tx.Nonce()), true
+}
+
+// deployedContracts — контракты, созданные tx: прямой деплой и контракты,
+// которые развернула фабрика (CREATE/CREATE2). Если блок трассировали, берём
+// фреймы CREATE/CREATE2 из трассировки — это полный и точный список.
+//
+// Без трассировки адрес CREATE2 из самой tx не вычислить, и остаётся запасная
+// эвристика: кандидаты из логов receipt (не больше maxDeployCandidates),
+// из которых оставляем те, у кого код появился именно в этом блоке. Контракт,
+// который в этой tx не пишет логов и не упомянут в событиях фабрики, она
+// пропустит.
+func (w *Watcher) deployedContracts(ctx context.Context, task TxTask, from common.Address, r *types.Receipt) []common.Address {
+	var out []common.Address
+	if addr, ok := CreatedAddress(task.Tx, from, r); ok {
+		out = append(out, addr)
+	}
+	if r == nil || r.Status != types.ReceiptStatusSuccessful || task.BlockNum == 0 {
+		return out
+	}
+	if task.Traced {
+		for _, addr := range task.Created {
+			if !slices.Contains(out, addr) {
+				out = append(out, addr)
+			}
+		}
+		return out
+	}
+	cr, ok := w.client.(stateReader)
+	if !ok {
+		return out
+	}
+
+	skip := map[common.Address]struct{}{from: {}}
+	for _, addr := range out {
+		skip[addr] = struct{}{}
+	}
+	if to := task.Tx.To(); to != nil {
+		skip[*to] = struct{}{}
+	}
+
+	block := new(big.Int).SetUint64(task.BlockNum)
+	parent := new(big.Int).SetUint64(task.BlockNum - 1)
+	for _, addr := range deployCandidates(task.Tx.To(), r.Logs, skip) {
+		code, err := cr.CodeAt(ctx, addr, block)
+		if err != nil {
+			log.Printf("[watcher] code of %s at #%d error: %v", addr.Hex(), task.BlockNum, err)
+			continue
+		}
+		if len(code) == 0 {
+			continue
+		}
+		before, err := cr.CodeAt(ctx, addr, parent)
+		if err != nil {
+			log.Printf("[watcher] code of %s at #%d error: %v", addr.Hex(), task.BlockNum-1, err)
+			continue
+		}
+		if len(before) == 0 {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// deployCandidates — адреса, которые могли быть созданы tx: источники логов
+// (новый контракт часто пишет событие в конструкторе) и адреса в событиях
+// самой фабрики (PairCreated, ProxyCreation...). Не больше maxDeployCandidates.
+func deployCandidates(factory *common.Address, logs []*types.Log, skip map[common.Address]struct{}) []common.Address {
+	var out []common.Address
+	seen := make(map[common.Address]struct{})
+	add := func(a common.Address) {
+		if len(out) >= maxDeployCandidates || a == (common.Address{}) {
+			return
+		}
+		if _, ok := skip[a]; ok {
+			return
+		}
+		if _, ok := seen[a]; ok {
+			return
+		}
+		seen[a] = struct{}{}
+		out = append(out, a)
+	}
+
+	for _, l := range logs {
+		add(l.Address)
+		if factory == nil || l.Address != *factory {
+			continue
+		}
+		for _, topic := range l.Topics[min(1, len(l.Topics)):] {
+			if a, ok := wordAddress(topic.Bytes()); ok {
+				add(a)
+			}
+		}
+		for i := 0; i+32 <= len(l.Data); i += 32 {
+			if a, ok := wordAddress(l.Data[i : i+32]); ok {
+				add(a)
+			}
+		}
+	}
+	return out
+}
+
+// wordAddress — 32-байтное ABI-слово, похожее на адрес (12 нулевых байт слева).
+func wordAddress(word []byte) (common.Address, bool) {
+	if len(word) != 32 || !bytes.Equal(word[:12], make([]byte, 12)) {
+		return common.Address{}, false
+	}
+	a := common.BytesToAddress(word[12:])
+	// маленькие числа (id, количества) — не адреса
+	if bytes.Equal(a.Bytes()[:4], make([]byte, 4)) {
+		return common.Address{}, false
+	}
+	return a, true
+}
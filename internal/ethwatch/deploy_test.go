@@ -0,0 +1,188 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// codeClient — fakeClient с eth_getCode: контракт есть начиная с блока из deployedAt.
+type codeClient struct {
+	*fakeClient
+	deployedAt map[common.Address]uint64
+}
+
+func (c *codeClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	if at, ok := c.deployedAt[account]; ok && blockNumber.Uint64() >= at {
+		return []byte{0x60, 0x80}, nil
+	}
+	return nil, nil
+}
+
+func TestCreatedAddress(t *testing.T) {
+	from := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	deploy := types.NewTx(&types.LegacyTx{Nonce: 7, Gas: 500000, GasPrice: big.NewInt(1), Data: []byte{0x60, 0x80}})
+
+	addr, ok := CreatedAddress(deploy, from, nil)
+	if !ok || addr != crypto.CreateAddress(from, 7) {
+		t.Fatalf("expected address from sender and nonce, got %s %v", addr.Hex(), ok)
+	}
+
+	fromReceipt := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	r := &types.Receipt{Status: types.ReceiptStatusSuccessful, ContractAddress: fromReceipt}
+	if addr, ok := CreatedAddress(deploy, from, r); !ok || addr != fromReceipt {
+		t.Fatalf("expected receipt contract address, got %s %v", addr.Hex(), ok)
+	}
+
+	r.Status = types.ReceiptStatusFailed
+	if _, ok := CreatedAddress(deploy, from, r); ok {
+		t.Fatalf("expected no contract for a failed deployment")
+	}
+
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	call := types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1)})
+	if _, ok := CreatedAddress(call, from, nil); ok {
+		t.Fatalf("expected no contract for a plain call")
+	}
+}
+
+func TestWatcher_handleTask_FactoryDeployment(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	deployer := crypto.PubkeyToAddress(key.PublicKey)
+
+	factory := common.HexToAddress("0xfac7000000000000000000000000000000000001")
+	token := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	pair := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &factory, Gas: 3_000_000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// PairCreated(address indexed token0, address indexed token1, address pair, uint256)
+	data := append(common.LeftPadBytes(pair.Bytes(), 32), common.LeftPadBytes(big.NewInt(42).Bytes(), 32)...)
+	receipt := &types.Receipt{
+		TxHash: tx.Hash(),
+		Status: types.ReceiptStatusSuccessful,
+		Logs: []*types.Log{
+			{Address: pair, Topics: []common.Hash{common.HexToHash("0x01")}},
+			{Address: factory, Topics: []common.Hash{
+				common.HexToHash("0x0d3648bd0f6ba80134a33ba9275ac585d9d315f0ad8355cddefde31afa28d0e9"),
+				common.BytesToHash(token.Bytes()),
+				common.BytesToHash(pair.Bytes()),
+			}, Data: data},
+		},
+	}
+
+	subStore := subs.NewStore()
+	chatID := int64(7)
+	_ = subStore.SetWallet(ctx, chatID, deployer)
+
+	notifyCh := make(chan bus.Notification, 1)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client: &codeClient{
+			fakeClient: &fakeClient{receipts: map[common.Hash]*types.Receipt{tx.Hash(): receipt}},
+			// token существовал до блока, pair появился в нём
+			deployedAt: map[common.Address]uint64{token: 1, pair: 100, factory: 1},
+		},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		repo:     repo,
+	}
+
+	w.handleTask(ctx, signer, TxTask{Tx: tx, BlockNum: 100, BlockTime: uint64(time.Now().Unix())})
+
+	select {
+	case n := <-notifyCh:
+		if len(n.Deployed) != 1 || n.Deployed[0] != pair.Hex() || n.ChainID != "1" {
+			t.Fatalf("expected deployed pair with chain id, got %+v", n)
+		}
+		if !contains(n.Text, "Deployed contract: "+pair.Hex()) {
+			t.Fatalf("expected deployed contract in text: %s", n.Text)
+		}
+	default:
+		t.Fatal("expected notification")
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if got := repo.upserts[0].CreatedContracts; len(got) != 1 || got[0] != pair.Hex() {
+		t.Fatalf("expected created contract stored with tx, got %v", got)
+	}
+}
+
+func TestWatcher_handleTask_DeploymentFromTrace(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	deployer := crypto.PubkeyToAddress(key.PublicKey)
+
+	factory := common.HexToAddress("0xfac7000000000000000000000000000000000001")
+	clone := common.HexToAddress("0x3333333333333333333333333333333333333333")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &factory, Gas: 3_000_000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	// клон без логов: эвристика по receipt его бы не нашла
+	receipt := &types.Receipt{TxHash: tx.Hash(), Status: types.ReceiptStatusSuccessful}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 7, deployer)
+
+	notifyCh := make(chan bus.Notification, 1)
+	w := &Watcher{
+		client:   &fakeClient{receipts: map[common.Hash]*types.Receipt{tx.Hash(): receipt}},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		repo:     &mockRepo{},
+	}
+
+	w.handleTask(ctx, signer, TxTask{
+		Tx: tx, BlockNum: 100, BlockTime: uint64(time.Now().Unix()),
+		Created: []common.Address{clone}, Traced: true,
+	})
+
+	select {
+	case n := <-notifyCh:
+		if len(n.Deployed) != 1 || n.Deployed[0] != clone.Hex() {
+			t.Fatalf("expected contract from the CREATE2 frame, got %+v", n)
+		}
+	default:
+		t.Fatal("expected notification")
+	}
+}
+
+func TestDeployCandidates_SkipsNumbersAndKnown(t *testing.T) {
+	factory := common.HexToAddress("0xfac7000000000000000000000000000000000001")
+	data := append(common.LeftPadBytes(big.NewInt(1_000_000).Bytes(), 32), common.LeftPadBytes(factory.Bytes(), 32)...)
+	logs := []*types.Log{{Address: factory, Topics: []common.Hash{common.HexToHash("0x01")}, Data: data}}
+
+	got := deployCandidates(&factory, logs, map[common.Address]struct{}{factory: {}})
+	if len(got) != 0 {
+		t.Fatalf("expected no candidates, got %v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package ethwatch
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/pvzzle/scanblock/internal/storage"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxFees — параметры комиссии tx по её типу. Поля, которые к типу не относятся,
+// пустые: у legacy нет потолков, а у EIP-1559 tx.GasPrice() — это лишь maxFee.
+type TxFees struct {
+	Type uint8
+
+	// GasPrice — legacy и EIP-2930
+	GasPrice *big.Int
+
+	// EIP-1559 и новее
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	// BaseFee — base fee блока; nil для pending и блоков до London
+	BaseFee *big.Int
+
+	// EIP-4844: blob gas, потолок его цены и число versioned hash'ей
+	BlobGas    uint64
+	BlobFeeCap *big.Int
+	BlobHashes int
+}
+
+// TxTypeName — тип tx для текста: "2 (EIP-1559)".
+func TxTypeName(t uint8) string {
+	var name string
+	switch t {
+	case types.LegacyTxType:
+		name = "legacy"
+	case types.AccessListTxType:
+		name = "EIP-2930"
+	case types.DynamicFeeTxType:
+		name = "EIP-1559"
+	case types.BlobTxType:
+		name = "EIP-4844 blob"
+	case types.SetCodeTxType:
+		name = "EIP-7702"
+	default:
+		return fmt.Sprintf("%d", t)
+	}
+	return fmt.Sprintf("%d (%s)", t, name)
+}
+
+// TxFeesOf собирает параметры комиссии из tx и base fee её блока.
+func TxFeesOf(tx *types.Transaction, baseFee *big.Int) TxFees {
+	f := TxFees{Type: tx.Type()}
+	switch tx.Type() {
+	case types.LegacyTxType, types.AccessListTxType:
+		f.GasPrice = tx.GasPrice()
+	default:
+		f.MaxFeePerGas = tx.GasFeeCap()
+		f.MaxPriorityFeePerGas = tx.GasTipCap()
+		f.BaseFee = baseFee
+	}
+	if tx.Type() == types.BlobTxType {
+		f.BlobGas = tx.BlobGas()
+		f.BlobFeeCap = tx.BlobGasFeeCap()
+		f.BlobHashes = len(tx.BlobHashes())
+	}
+	return f
+}
+
+// FillRecord заполняет поля комиссии записи tx; receipt (может быть nil)
+// даёт фактически потраченный gas и цены.
+func (f TxFees) FillRecord(rec *storage.TxRecord, r *types.Receipt) {
+	rec.GasPriceWei = bigString(f.GasPrice)
+	rec.MaxFeePerGasWei = bigString(f.MaxFeePerGas)
+	rec.MaxPriorityFeePerGasWei = bigString(f.MaxPriorityFeePerGas)
+	rec.BaseFeeWei = bigString(f.BaseFee)
+	if f.Type == types.BlobTxType {
+		blobGas, hashes := f.BlobGas, f.BlobHashes
+		rec.BlobGas = &blobGas
+		rec.BlobFeeCapWei = bigString(f.BlobFeeCap)
+		rec.BlobHashes = &hashes
+	}
+
+	if r == nil {
+		return
+	}
+	gasUsed := r.GasUsed
+	rec.GasUsed = &gasUsed
+	rec.EffectiveGasPriceWei = bigString(r.EffectiveGasPrice)
+	rec.BlobGasPriceWei = bigString(r.BlobGasPrice)
+}
+
+func bigString(x *big.Int) *string {
+	if x == nil {
+		return nil
+	}
+	s := x.String()
+	return &s
+}
+
+// BlobFeeWei — комиссия за blob'ы: blobGasUsed * blobGasPrice.
+func BlobFeeWei(r *types.Receipt) *big.Int {
+	if r == nil || r.BlobGasPrice == nil || r.BlobGasUsed == 0 {
+		return nil
+	}
+	return new(big.Int).Mul(new(big.Int).SetUint64(r.BlobGasUsed), r.BlobGasPrice)
+}
+
+// FormatFees — строки о комиссии (каждая с "\n" впереди). Без receipt — цена
+// или потолки из самой tx; с receipt — итог и его разбивка: сожжённый base fee,
+// чаевые валидатору, blob'ы.
+func FormatFees(f TxFees, r *types.Receipt, symbol string) string {
+	symbol = nativeSymbol(symbol)
+	var text string
+
+	if r == nil {
+		if f.GasPrice != nil {
+			text += "\nGas price: " + WeiToGweiString(f.GasPrice) + " gwei"
+		}
+	} else if r.EffectiveGasPrice != nil {
+		text += fmt.Sprintf("\nFee: %s %s (gas used %d @ %s gwei)",
+			WeiToEthString(TxFeeWei(r)), symbol, r.GasUsed, WeiToGweiString(r.EffectiveGasPrice))
+
+		if f.BaseFee != nil && r.EffectiveGasPrice.Cmp(f.BaseFee) >= 0 {
+			gasUsed := new(big.Int).SetUint64(r.GasUsed)
+			tip := new(big.Int).Sub(r.EffectiveGasPrice, f.BaseFee)
+			text += fmt.Sprintf("\nBurnt: %s %s (base fee %s gwei) · Tip: %s %s (%s gwei)",
+				WeiToEthString(new(big.Int).Mul(gasUsed, f.BaseFee)), symbol, WeiToGweiString(f.BaseFee),
+				WeiToEthString(new(big.Int).Mul(gasUsed, tip)), symbol, WeiToGweiString(tip))
+		}
+	} else {
+		text += fmt.Sprintf("\nGas used: %d", r.GasUsed)
+	}
+
+	if f.MaxFeePerGas != nil {
+		text += fmt.Sprintf("\nMax fee: %s gwei · Max priority fee: %s gwei",
+			WeiToGweiString(f.MaxFeePerGas), WeiToGweiString(f.MaxPriorityFeePerGas))
+	}
+
+	if f.Type == types.BlobTxType {
+		if blobFee := BlobFeeWei(r); blobFee != nil {
+			text += fmt.Sprintf("\nBlob fee: %s %s (%d blobs, blob gas %d @ %s gwei, max %s gwei)",
+				WeiToEthString(blobFee), symbol, f.BlobHashes, r.BlobGasUsed,
+				WeiToGweiString(r.BlobGasPrice), WeiToGweiString(f.BlobFeeCap))
+			if fee := TxFeeWei(r); fee != nil {
+				text += fmt.Sprintf("\nTotal fee: %s %s", WeiToEthString(fee.Add(fee, blobFee)), symbol)
+			}
+		} else {
+			text += fmt.Sprintf("\nBlobs: %d (blob gas %d, max %s gwei)",
+				f.BlobHashes, f.BlobGas, WeiToGweiString(f.BlobFeeCap))
+		}
+	}
+	return text
+}
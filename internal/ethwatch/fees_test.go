@@ -0,0 +1,96 @@
+package ethwatch
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/storage"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func gwei(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), weiPerGwei) }
+
+func TestTxFeesOf(t *testing.T) {
+	to := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	legacy := types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: gwei(20)})
+	if f := TxFeesOf(legacy, gwei(10)); f.GasPrice.Cmp(gwei(20)) != 0 || f.MaxFeePerGas != nil || f.BaseFee != nil {
+		t.Fatalf("unexpected legacy fees: %+v", f)
+	}
+
+	dynamic := types.NewTx(&types.DynamicFeeTx{To: &to, Gas: 21000, GasFeeCap: gwei(40), GasTipCap: gwei(2)})
+	f := TxFeesOf(dynamic, gwei(10))
+	if f.GasPrice != nil || f.MaxFeePerGas.Cmp(gwei(40)) != 0 || f.MaxPriorityFeePerGas.Cmp(gwei(2)) != 0 || f.BaseFee.Cmp(gwei(10)) != 0 {
+		t.Fatalf("unexpected 1559 fees: %+v", f)
+	}
+
+	var rec storage.TxRecord
+	f.FillRecord(&rec, &types.Receipt{GasUsed: 21000, EffectiveGasPrice: gwei(12)})
+	if rec.GasPriceWei != nil {
+		t.Fatalf("expected no gas price for 1559 tx, got %s", *rec.GasPriceWei)
+	}
+	if rec.MaxFeePerGasWei == nil || *rec.MaxFeePerGasWei != "40000000000" ||
+		rec.MaxPriorityFeePerGasWei == nil || *rec.MaxPriorityFeePerGasWei != "2000000000" ||
+		rec.BaseFeeWei == nil || *rec.BaseFeeWei != "10000000000" {
+		t.Fatalf("unexpected 1559 record: %+v", rec)
+	}
+	if rec.GasUsed == nil || *rec.GasUsed != 21000 || rec.EffectiveGasPriceWei == nil || *rec.EffectiveGasPriceWei != "12000000000" {
+		t.Fatalf("unexpected receipt fields: %+v", rec)
+	}
+	if rec.BlobGas != nil || rec.BlobHashes != nil {
+		t.Fatalf("expected no blob fields for 1559 tx: %+v", rec)
+	}
+}
+
+func TestFormatFees(t *testing.T) {
+	dynamic := TxFees{Type: types.DynamicFeeTxType, MaxFeePerGas: gwei(40), MaxPriorityFeePerGas: gwei(2), BaseFee: gwei(10)}
+	txt := FormatFees(dynamic, &types.Receipt{GasUsed: 21000, EffectiveGasPrice: gwei(12)}, "ETH")
+	for _, want := range []string{
+		"Fee: 0.000252 ETH (gas used 21000 @ 12.00 gwei)",
+		"Burnt: 0.000210 ETH (base fee 10.00 gwei) · Tip: 0.000042 ETH (2.00 gwei)",
+		"Max fee: 40.00 gwei · Max priority fee: 2.00 gwei",
+	} {
+		if !contains(txt, want) {
+			t.Fatalf("expected %q in:%s", want, txt)
+		}
+	}
+
+	// pending: только потолки из tx
+	if txt := FormatFees(dynamic, nil, "ETH"); contains(txt, "Fee:") || !contains(txt, "Max fee: 40.00 gwei") {
+		t.Fatalf("unexpected pending fees:%s", txt)
+	}
+	if txt := FormatFees(TxFees{GasPrice: gwei(20)}, nil, "BNB"); txt != "\nGas price: 20.00 gwei" {
+		t.Fatalf("unexpected legacy pending fees: %q", txt)
+	}
+
+	blob := TxFees{
+		Type: types.BlobTxType, MaxFeePerGas: gwei(40), MaxPriorityFeePerGas: gwei(2), BaseFee: gwei(10),
+		BlobGas: 2 * 131072, BlobFeeCap: gwei(3), BlobHashes: 2,
+	}
+	txt = FormatFees(blob, &types.Receipt{
+		GasUsed: 21000, EffectiveGasPrice: gwei(12),
+		BlobGasUsed: 2 * 131072, BlobGasPrice: big.NewInt(1),
+	}, "ETH")
+	for _, want := range []string{
+		"Blob fee: 0.000000 ETH (2 blobs, blob gas 262144 @ 0.000000001 gwei, max 3.00 gwei)",
+		"Total fee: 0.000252 ETH",
+	} {
+		if !contains(txt, want) {
+			t.Fatalf("expected %q in:%s", want, txt)
+		}
+	}
+	if txt := FormatFees(blob, nil, "ETH"); !contains(txt, "Blobs: 2 (blob gas 262144, max 3.00 gwei)") {
+		t.Fatalf("unexpected pending blob fees:%s", txt)
+	}
+}
+
+func TestWeiToGweiString_Small(t *testing.T) {
+	if got := WeiToGweiString(big.NewInt(5_000_000)); got != "0.005" {
+		t.Fatalf("expected 0.005, got %s", got)
+	}
+	if got := WeiToGweiString(big.NewInt(0)); got != "0.00" {
+		t.Fatalf("expected 0.00, got %s", got)
+	}
+}
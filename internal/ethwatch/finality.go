@@ -0,0 +1,353 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/storage"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// heldNotification — уведомления чату о tx; с уровнем выше latest ждут нужной
+// глубины блока. Все сообщения по одной tx уходят вместе: у них общий ключ
+// идемпотентности (чат, tx, notify).
+type heldNotification struct {
+	ChatID   int64
+	TxHash   common.Hash
+	BlockNum uint64
+	Messages []heldMessage
+}
+
+type heldMessage struct {
+	Text string
+
+	// Deployed — контракты, созданные tx (кнопки «следить» под уведомлением)
+	Deployed []common.Address
+}
+
+// heldQueue — очереди уведомлений по уровням (N подтверждений, safe, finalized).
+// Копия каждого уведомления лежит в БД (held_notifications), пока оно не ушло:
+// чекпоинт уходит за блок раньше, чем уведомление отпускается.
+type heldQueue struct {
+	mu     sync.Mutex
+	levels map[subs.Level][]heldNotification
+}
+
+func newHeldQueue() *heldQueue {
+	return &heldQueue{levels: make(map[subs.Level][]heldNotification)}
+}
+
+func (q *heldQueue) add(level subs.Level, n heldNotification) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.levels[level] = append(q.levels[level], n)
+}
+
+// release забирает из очереди уровня все уведомления по блокам <= upTo.
+func (q *heldQueue) release(level subs.Level, upTo uint64) []heldNotification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var out, keep []heldNotification
+	for _, n := range q.levels[level] {
+		if n.BlockNum <= upTo {
+			out = append(out, n)
+		} else {
+			keep = append(keep, n)
+		}
+	}
+	if len(keep) == 0 {
+		delete(q.levels, level)
+	} else {
+		q.levels[level] = keep
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].BlockNum < out[j].BlockNum })
+	return out
+}
+
+// dropAbove выкидывает уведомления по осиротевшим блокам (> forkNum) и
+// возвращает, каким чатам по каким tx они так и не ушли.
+func (q *heldQueue) dropAbove(forkNum uint64) map[common.Hash]map[int64]struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := make(map[common.Hash]map[int64]struct{})
+	for level, items := range q.levels {
+		keep := items[:0]
+		for _, n := range items {
+			if n.BlockNum <= forkNum {
+				keep = append(keep, n)
+				continue
+			}
+			if dropped[n.TxHash] == nil {
+				dropped[n.TxHash] = make(map[int64]struct{})
+			}
+			dropped[n.TxHash][n.ChatID] = struct{}{}
+		}
+		if len(keep) == 0 {
+			delete(q.levels, level)
+		} else {
+			q.levels[level] = keep
+		}
+	}
+	return dropped
+}
+
+func (q *heldQueue) pendingLevels() []subs.Level {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make([]subs.Level, 0, len(q.levels))
+	for level := range q.levels {
+		out = append(out, level)
+	}
+	return out
+}
+
+// Глубина вместо тегов safe/finalized для нод, которые их не знают
+// (2 и 3 эпохи Ethereum PoS).
+const (
+	FallbackSafeDepth      = 64
+	FallbackFinalizedDepth = 96
+)
+
+// deliver отправляет уведомление сразу или откладывает его до уровня чата.
+// false — контекст отменён.
+func (w *Watcher) deliver(ctx context.Context, n heldNotification) bool {
+	if level := w.subStore.Level(n.ChatID); !level.IsLatest() && w.held != nil {
+		w.saveHeld(ctx, n)
+		w.held.add(level, n)
+		return true
+	}
+	return w.send(ctx, n)
+}
+
+func (w *Watcher) saveHeld(ctx context.Context, n heldNotification) {
+	rec := storage.HeldNotificationRecord{
+		ChainID:  w.chainID.String(),
+		ChatID:   n.ChatID,
+		TxHash:   n.TxHash.Hex(),
+		BlockNum: n.BlockNum,
+	}
+	for _, m := range n.Messages {
+		hm := storage.HeldMessage{Text: m.Text}
+		for _, addr := range m.Deployed {
+			hm.Deployed = append(hm.Deployed, addr.Hex())
+		}
+		rec.Messages = append(rec.Messages, hm)
+	}
+	if err := w.repo.AddHeldNotification(ctx, rec); err != nil {
+		log.Printf("[watcher] save held notification %d/%s error: %v", n.ChatID, n.TxHash.Hex(), err)
+	}
+}
+
+func (w *Watcher) forgetHeld(ctx context.Context, chatID int64, hash common.Hash) {
+	if err := w.repo.DeleteHeldNotification(ctx, w.chainID.String(), chatID, hash.Hex()); err != nil {
+		log.Printf("[watcher] delete held notification %d/%s error: %v", chatID, hash.Hex(), err)
+	}
+}
+
+// restoreHeld поднимает из БД уведомления, не дождавшиеся уровня до рестарта.
+// Уровень берётся текущий: если чат успел переключиться на latest, уведомление
+// уходит сразу.
+func (w *Watcher) restoreHeld(ctx context.Context) {
+	if w.held == nil {
+		return
+	}
+	recs, err := w.repo.ListHeldNotifications(ctx, w.chainID.String())
+	if err != nil {
+		log.Printf("[WATCHER] restore held notifications error: %v", err)
+		return
+	}
+	for _, rec := range recs {
+		n := heldNotification{ChatID: rec.ChatID, TxHash: common.HexToHash(rec.TxHash), BlockNum: rec.BlockNum}
+		for _, m := range rec.Messages {
+			hm := heldMessage{Text: m.Text}
+			for _, addr := range m.Deployed {
+				hm.Deployed = append(hm.Deployed, common.HexToAddress(addr))
+			}
+			n.Messages = append(n.Messages, hm)
+		}
+		if level := w.subStore.Level(rec.ChatID); !level.IsLatest() {
+			w.held.add(level, n)
+			continue
+		}
+		if !w.send(ctx, n) {
+			return
+		}
+		w.forgetHeld(ctx, n.ChatID, n.TxHash)
+	}
+	if len(recs) > 0 {
+		log.Printf("[WATCHER] restored %d held notification(s)", len(recs))
+	}
+}
+
+// send отправляет сообщения, если чату о tx ещё не сообщали: запись (чат, tx,
+// notify) в chat_tx — ключ идемпотентности. Повторно обработанный блок (рестарт
+// до чекпоинта, та же tx в новой ветке после реорга) дублей не шлёт. Пишет ключ
+// бот после отправки (bus.Notification.TxHash/Event), здесь — только проверка.
+func (w *Watcher) send(ctx context.Context, n heldNotification) bool {
+	if w.alreadySent(ctx, n.ChatID, n.TxHash, storage.EventNotify) {
+		return true
+	}
+
+	for i, m := range n.Messages {
+		msg := bus.Notification{
+			ChatID: n.ChatID,
+			Text:   m.Text,
+			TxHash: n.TxHash.Hex(),
+			Event:  string(storage.EventNotify),
+			More:   i < len(n.Messages)-1,
+		}
+		for _, addr := range m.Deployed {
+			msg.Deployed = append(msg.Deployed, addr.Hex())
+		}
+		if !w.push(ctx, msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// alreadySent — событие (чат, tx, event) уже записано в chat_tx.
+func (w *Watcher) alreadySent(ctx context.Context, chatID int64, hash common.Hash, event storage.TxEventType) bool {
+	sent, err := w.repo.HasChatEvent(ctx, chatID, hash.Hex(), event)
+	if err != nil {
+		// без БД лучше дубль, чем потерянное уведомление
+		log.Printf("[watcher] chat %d event for %s error: %v", chatID, hash.Hex(), err)
+		return false
+	}
+	return sent
+}
+
+// notify кладёт текст в очередь бота. false — контекст отменён.
+func (w *Watcher) notify(ctx context.Context, chatID int64, text string) bool {
+	return w.push(ctx, bus.Notification{ChatID: chatID, Text: text})
+}
+
+// notifyOnce — notify с ключом идемпотентности (чат, tx, event): если событие
+// уже есть в chat_tx, чату не пишем.
+func (w *Watcher) notifyOnce(ctx context.Context, chatID int64, hash common.Hash, event storage.TxEventType, text string) bool {
+	if w.alreadySent(ctx, chatID, hash, event) {
+		return true
+	}
+	return w.push(ctx, bus.Notification{ChatID: chatID, Text: text, TxHash: hash.Hex(), Event: string(event)})
+}
+
+// push подписывает уведомление сетью и кладёт его в очередь бота.
+func (w *Watcher) push(ctx context.Context, n bus.Notification) bool {
+	n.Text = withNetwork(n.Text, w.cfg.Network)
+	n.ChainID = w.chainID.String()
+	select {
+	case w.notifyCh <- n:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseHeld отпускает уведомления, чьи блоки достигли нужной глубины.
+// head — последний обработанный блок; safe/finalized спрашиваем у ноды.
+func (w *Watcher) releaseHeld(ctx context.Context, head uint64) {
+	if w.held == nil {
+		return
+	}
+
+	tags := make(map[subs.LevelKind]uint64)
+	for _, level := range w.held.pendingLevels() {
+		var upTo uint64
+		switch level.Kind {
+		case subs.LevelConfirmations:
+			var ok bool
+			if upTo, ok = confirmedUpTo(head, level.Confirmations); !ok {
+				continue
+			}
+
+		case subs.LevelSafe, subs.LevelFinalized:
+			num, ok := tags[level.Kind]
+			if !ok {
+				if num, ok = w.taggedBlock(ctx, level.Kind, head); !ok {
+					continue
+				}
+				tags[level.Kind] = num
+			}
+			upTo = num
+
+		default:
+			continue
+		}
+
+		for _, n := range w.held.release(level, upTo) {
+			if !w.send(ctx, n) {
+				return
+			}
+			w.forgetHeld(ctx, n.ChatID, n.TxHash)
+		}
+	}
+}
+
+// confirmedUpTo — последний блок с не меньше чем confirmations подтверждений
+// при голове head (сам блок — первое подтверждение).
+func confirmedUpTo(head, confirmations uint64) (uint64, bool) {
+	if head+1 < confirmations {
+		return 0, false
+	}
+	return head + 1 - confirmations, true
+}
+
+// taggedBlock — номер блока safe/finalized. Если нода тег не знает (сети без
+// PoS-финальности, старые ноды), считаем по глубине FallbackSafeDepth /
+// FallbackFinalizedDepth: иначе очередь уровня росла бы без конца. Прочие
+// ошибки (таймаут, сбой эндпоинтов) глубиной не подменяем: на L2 финальность
+// отстаёт на тысячи блоков, и уведомление ушло бы раньше гарантии — ждём
+// следующего блока.
+func (w *Watcher) taggedBlock(ctx context.Context, kind subs.LevelKind, head uint64) (uint64, bool) {
+	tag, depth := rpc.SafeBlockNumber, uint64(FallbackSafeDepth)
+	if kind == subs.LevelFinalized {
+		tag, depth = rpc.FinalizedBlockNumber, FallbackFinalizedDepth
+	}
+
+	h, err := w.client.HeaderByNumber(ctx, big.NewInt(int64(tag)))
+	if err == nil && h != nil {
+		if w.tagFallback[kind] {
+			log.Printf("[WATCHER] %s block tag is available again", kind)
+			delete(w.tagFallback, kind)
+		}
+		return h.Number.Uint64(), true
+	}
+	if err == nil {
+		err = ethereum.NotFound
+	}
+	if !isTagUnsupported(err) {
+		log.Printf("[watcher] %s block tag error, holding notifications: %v", kind, err)
+		return 0, false
+	}
+
+	if !w.tagFallback[kind] {
+		log.Printf("[WATCHER] %s block tag is unavailable (%v), using %d confirmations instead", kind, err, depth)
+		if w.tagFallback == nil {
+			w.tagFallback = make(map[subs.LevelKind]bool)
+		}
+		w.tagFallback[kind] = true
+	}
+	return confirmedUpTo(head, depth)
+}
+
+// isTagUnsupported — нода ответила, что тега нет: блок не найден, метод или
+// параметр не поддерживается (-32601, -32602).
+func isTagUnsupported(err error) bool {
+	if errors.Is(err, ethereum.NotFound) || isMethodNotFound(err) {
+		return true
+	}
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32602
+}
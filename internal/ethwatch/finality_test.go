@@ -0,0 +1,200 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/storage"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestWatcher_HeldUntilLevel(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	for chatID := int64(1); chatID <= 3; chatID++ {
+		_ = subStore.SetWallet(ctx, chatID, from)
+	}
+	_ = subStore.SetLevel(ctx, 2, subs.Level{Kind: subs.LevelConfirmations, Confirmations: 3})
+	_ = subStore.SetLevel(ctx, 3, subs.Level{Kind: subs.LevelFinalized})
+
+	client := &fakeClient{tagged: map[int64]uint64{int64(rpc.FinalizedBlockNumber): 90}}
+	notifyCh := make(chan bus.Notification, 4)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   client,
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		held:     newHeldQueue(),
+		repo:     repo,
+	}
+
+	chats := w.handleTask(ctx, signer, TxTask{Tx: tx, BlockNum: 100})
+	if len(chats) != 3 {
+		t.Fatalf("expected all matched chats reported for retraction, got=%v", chats)
+	}
+	n := <-notifyCh
+	if n.ChatID != 1 || len(notifyCh) != 0 {
+		t.Fatalf("expected only the latest chat notified at once, got=%+v extra=%d", n, len(notifyCh))
+	}
+	repo.delivered(n)
+
+	w.releaseHeld(ctx, 101)
+	if len(notifyCh) != 0 {
+		t.Fatalf("released before 3 confirmations")
+	}
+
+	w.releaseHeld(ctx, 102)
+	if n = <-notifyCh; n.ChatID != 2 || !contains(n.Text, tx.Hash().Hex()) || len(notifyCh) != 0 {
+		t.Fatalf("expected chat 2 released at 3 confirmations, got=%+v", n)
+	}
+	repo.delivered(n)
+
+	client.tagged[int64(rpc.FinalizedBlockNumber)] = 100
+	w.releaseHeld(ctx, 103)
+	if n = <-notifyCh; n.ChatID != 3 {
+		t.Fatalf("expected chat 3 released on finality, got=%+v", n)
+	}
+	repo.delivered(n)
+
+	notifies := 0
+	for _, e := range repo.events {
+		if e.etype == storage.EventNotify {
+			notifies++
+		}
+	}
+	if notifies != 3 {
+		t.Fatalf("expected notify event per actual delivery, got=%d", notifies)
+	}
+}
+
+func TestWatcher_HeldDroppedOnReorg(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &mockRepo{}
+	notifyCh := make(chan bus.Notification, 4)
+	w := &Watcher{notifyCh: notifyCh, repo: repo, held: newHeldQueue()}
+
+	hash := common.HexToHash("0x01")
+	level := subs.Level{Kind: subs.LevelConfirmations, Confirmations: 12}
+	w.held.add(level, heldNotification{ChatID: 2, TxHash: hash, BlockNum: 100})
+	w.held.add(level, heldNotification{ChatID: 3, TxHash: common.HexToHash("0x02"), BlockNum: 99})
+
+	held := w.held.dropAbove(99)
+	orphaned := []trackedBlock{{Num: 100, Notified: map[common.Hash][]int64{hash: {1, 2}}}}
+	w.retract(ctx, orphaned, nil, held)
+
+	// откат уходит только чату, которому уведомление уже было отправлено
+	if n := <-notifyCh; n.ChatID != 1 || len(notifyCh) != 0 {
+		t.Fatalf("expected retraction only for chat 1, got=%+v extra=%d", n, len(notifyCh))
+	}
+
+	if got := w.held.release(level, 200); len(got) != 1 || got[0].ChatID != 3 {
+		t.Fatalf("expected held notification below fork to survive, got=%+v", got)
+	}
+}
+
+func TestWatcher_HeldSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+
+	subStore := subs.NewStore()
+	_ = subStore.SetLevel(ctx, 2, subs.Level{Kind: subs.LevelConfirmations, Confirmations: 12})
+
+	repo := &mockRepo{}
+	newWatcher := func(notifyCh chan bus.Notification) *Watcher {
+		return &Watcher{client: &fakeClient{}, chainID: big.NewInt(1), subStore: subStore, notifyCh: notifyCh, repo: repo, held: newHeldQueue()}
+	}
+
+	hash := common.HexToHash("0x01")
+	deployed := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	w := newWatcher(make(chan bus.Notification, 1))
+	w.deliver(ctx, heldNotification{ChatID: 2, TxHash: hash, BlockNum: 100, Messages: []heldMessage{{Text: "held", Deployed: []common.Address{deployed}}}})
+	if len(repo.held) != 1 {
+		t.Fatalf("expected held notification persisted, got=%+v", repo.held)
+	}
+
+	// рестарт: очередь в памяти пуста, чекпоинт давно за блоком #100
+	notifyCh := make(chan bus.Notification, 1)
+	w = newWatcher(notifyCh)
+	w.restoreHeld(ctx)
+	w.releaseHeld(ctx, 111)
+	n := <-notifyCh
+	if n.ChatID != 2 || !contains(n.Text, "held") || len(n.Deployed) != 1 || n.Deployed[0] != deployed.Hex() {
+		t.Fatalf("expected restored notification released at 12 confirmations, got=%+v", n)
+	}
+	if len(repo.held) != 0 {
+		t.Fatalf("expected delivered notification removed from db, got=%+v", repo.held)
+	}
+}
+
+func TestWatcher_HeldFallsBackToDepthWithoutTag(t *testing.T) {
+	ctx := context.Background()
+
+	subStore := subs.NewStore()
+	_ = subStore.SetLevel(ctx, 3, subs.Level{Kind: subs.LevelFinalized})
+
+	// нода не знает тег finalized
+	notifyCh := make(chan bus.Notification, 1)
+	w := &Watcher{client: &fakeClient{}, chainID: big.NewInt(1), subStore: subStore, notifyCh: notifyCh, repo: &mockRepo{}, held: newHeldQueue()}
+	w.deliver(ctx, heldNotification{ChatID: 3, TxHash: common.HexToHash("0x01"), BlockNum: 100, Messages: []heldMessage{{Text: "held"}}})
+
+	w.releaseHeld(ctx, 100+FallbackFinalizedDepth-2)
+	if len(notifyCh) != 0 {
+		t.Fatalf("released before the fallback depth")
+	}
+	w.releaseHeld(ctx, 100+FallbackFinalizedDepth-1)
+	if n := <-notifyCh; n.ChatID != 3 {
+		t.Fatalf("expected release at the fallback depth, got=%+v", n)
+	}
+}
+
+func TestWatcher_HeldKeptOnTransientTagError(t *testing.T) {
+	ctx := context.Background()
+
+	subStore := subs.NewStore()
+	_ = subStore.SetLevel(ctx, 3, subs.Level{Kind: subs.LevelFinalized})
+
+	// сбой сети — не повод считать finalized по глубине
+	client := &fakeClient{taggedErr: errors.New("i/o timeout")}
+	notifyCh := make(chan bus.Notification, 1)
+	w := &Watcher{client: client, chainID: big.NewInt(1), subStore: subStore, notifyCh: notifyCh, repo: &mockRepo{}, held: newHeldQueue()}
+	w.deliver(ctx, heldNotification{ChatID: 3, TxHash: common.HexToHash("0x01"), BlockNum: 100, Messages: []heldMessage{{Text: "held"}}})
+
+	w.releaseHeld(ctx, 100+FallbackFinalizedDepth*10)
+	if len(notifyCh) != 0 {
+		t.Fatalf("released on a transient tag error")
+	}
+
+	client.mu.Lock()
+	client.taggedErr = nil
+	client.tagged = map[int64]uint64{int64(rpc.FinalizedBlockNumber): 100}
+	client.mu.Unlock()
+	w.releaseHeld(ctx, 100+FallbackFinalizedDepth*10)
+	if n := <-notifyCh; n.ChatID != 3 {
+		t.Fatalf("expected release once the tag answers, got=%+v", n)
+	}
+}
@@ -3,9 +3,17 @@ package ethwatch
 import (
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
+	"github.com/pvzzle/scanblock/internal/chains"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/prices"
+	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 var weiPerEth = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
@@ -21,19 +29,383 @@ func WeiToEthString(wei *big.Int) string {
 	return fmt.Sprintf("%.6f", f)
 }
 
-func FormatTxNotification(hash common.Hash, from common.Address, to *common.Address, valueWei *big.Int, blockNum uint64, blockTime uint64) string {
-	toStr := "contract-creation"
-	if to != nil {
-		toStr = to.Hex()
+var weiPerGwei = big.NewInt(1_000_000_000)
+
+func WeiToGweiString(wei *big.Int) string {
+	if wei == nil {
+		return "0"
+	}
+	r := new(big.Rat).SetFrac(wei, weiPerGwei)
+	f, _ := r.Float64()
+	// на L2 и у blob gas цены бывают в доли gwei — их не округляем до нуля
+	if wei.Sign() > 0 && f < 0.01 {
+		return strings.TrimRight(r.FloatString(9), "0")
+	}
+	return fmt.Sprintf("%.2f", f)
+}
+
+// USDSuffix — оценка в USD для строки Value/Amount: " (~$1,500.50)"; пусто без оценки.
+func USDSuffix(cents *big.Int) string {
+	if cents == nil {
+		return ""
+	}
+	return " (~" + prices.FormatUSD(cents) + ")"
+}
+
+// nativeSymbol — символ нативной валюты; ETH, если сеть его не задала.
+func nativeSymbol(symbol string) string {
+	if symbol == "" {
+		return "ETH"
+	}
+	return symbol
+}
+
+// withNetwork добавляет строку "Network: ..." сразу после заголовка уведомления.
+func withNetwork(text string, n chains.Network) string {
+	if n.Name == "" {
+		return text
+	}
+	title, body, ok := strings.Cut(text, "\n\n")
+	if !ok {
+		return text + "\nNetwork: " + n.Name
+	}
+	return title + "\n\nNetwork: " + n.Name + "\n" + body
+}
+
+// FormatAddress — адрес с основным ENS-именем, если оно известно:
+// "0xd8dA…6045 (vitalik.eth)".
+func FormatAddress(a common.Address, names map[common.Address]string) string {
+	if name := names[a]; name != "" {
+		return a.Hex() + " (" + name + ")"
+	}
+	return a.Hex()
+}
+
+func formatTo(to *common.Address, names map[common.Address]string) string {
+	if to == nil {
+		return "contract-creation"
+	}
+	return FormatAddress(*to, names)
+}
+
+// TxNotification — данные для текста уведомления о транзакции.
+type TxNotification struct {
+	Hash      common.Hash
+	From      common.Address
+	To        *common.Address
+	ValueWei  *big.Int
+	BlockNum  uint64
+	BlockTime uint64
+
+	// ValueUSD — Value в центах USD по цене на блоке tx; nil — цены нет
+	ValueUSD *big.Int
+
+	// Receipt nil, если его не удалось получить
+	Receipt *types.Receipt
+
+	// Revert — причина отката откатившейся tx (RevertReason); пусто — неизвестна
+	Revert string
+
+	// Internal — тип внутреннего вызова (CALL, CREATE...), если перевод найден трассировкой
+	Internal string
+
+	// PendingConfirmed — подтверждение для чатов, получивших уведомление о pending tx
+	PendingConfirmed bool
+
+	// Call — разобранный calldata; nil для простого перевода ETH
+	Call *contracts.Call
+
+	// Symbol — нативная валюта сети (пусто — ETH)
+	Symbol string
+
+	// Fees — параметры комиссии по типу tx (см. TxFeesOf)
+	Fees TxFees
+
+	// Deployed — контракты, созданные tx (деплой или вызов фабрики)
+	Deployed []common.Address
+
+	// Names — ENS-имена адресов (nil, если ENS не настроен)
+	Names map[common.Address]string
+}
+
+func FormatTxNotification(n TxNotification) string {
+	failed := n.Receipt != nil && n.Receipt.Status != types.ReceiptStatusSuccessful
+
+	title := "🔔 New tx"
+	switch {
+	case n.Internal != "":
+		title = fmt.Sprintf("🔔 New internal transfer (%s inside tx)", n.Internal)
+	case n.PendingConfirmed && failed:
+		title = "❌ Pending tx failed"
+	case n.PendingConfirmed:
+		title = "✅ Pending tx confirmed"
+	case failed:
+		title = "❌ Failed tx"
+	}
+	tm := time.Unix(int64(n.BlockTime), 0).UTC().Format(time.RFC3339)
+	text := fmt.Sprintf(
+		"%s\n\nHash: %s\nFrom: %s\nTo: %s\nValue: %s %s%s\nBlock: #%d\nTime: %s",
+		title,
+		n.Hash.Hex(),
+		FormatAddress(n.From, n.Names),
+		formatTo(n.To, n.Names),
+		WeiToEthString(n.ValueWei),
+		nativeSymbol(n.Symbol),
+		USDSuffix(n.ValueUSD),
+		n.BlockNum,
+		tm,
+	)
+	if n.Call != nil {
+		text += "\nCall: " + n.Call.String()
+	}
+	for _, addr := range n.Deployed {
+		text += "\nDeployed contract: " + addr.Hex()
+	}
+
+	if r := n.Receipt; r != nil {
+		text += "\nStatus: " + FormatReceiptStatus(r.Status)
+		if failed && n.Revert != "" {
+			text += "\nRevert reason: " + n.Revert
+		}
+	}
+	return text + FormatFees(n.Fees, n.Receipt, n.Symbol)
+}
+
+func FormatReceiptStatus(status uint64) string {
+	if status == types.ReceiptStatusSuccessful {
+		return "✅ success"
+	}
+	return "❌ failed"
+}
+
+// TxFeeWei — комиссия исполнения: gasUsed * effectiveGasPrice.
+func TxFeeWei(r *types.Receipt) *big.Int {
+	if r == nil || r.EffectiveGasPrice == nil {
+		return nil
 	}
+	return new(big.Int).Mul(new(big.Int).SetUint64(r.GasUsed), r.EffectiveGasPrice)
+}
+
+// TokenTransferNotification — данные для текста уведомления об ERC-20 переводе.
+type TokenTransferNotification struct {
+	Transfer  tokens.Transfer
+	BlockNum  uint64
+	BlockTime uint64
+
+	// Token nil, если decimals()/symbol() получить не удалось
+	Token *tokens.Info
+
+	// Names — ENS-имена отправителя и получателя
+	Names map[common.Address]string
+
+	// ValueUSD — сумма в центах USD по цене токена на блоке; nil — цены нет
+	ValueUSD *big.Int
+}
+
+func FormatTokenTransferNotification(n TokenTransferNotification) string {
+	tokenStr := n.Transfer.Token.Hex()
+	amountStr := n.Transfer.Amount.String() + " (raw units)"
+	if n.Token != nil {
+		tokenStr = n.Token.Label()
+		amountStr = tokens.FormatUnits(n.Transfer.Amount, n.Token.Decimals)
+		if n.Token.Symbol != "" {
+			amountStr += " " + n.Token.Symbol
+		}
+		amountStr += USDSuffix(n.ValueUSD)
+	}
+	tm := time.Unix(int64(n.BlockTime), 0).UTC().Format(time.RFC3339)
+	return fmt.Sprintf(
+		"🪙 Token transfer\n\nToken: %s\nFrom: %s\nTo: %s\nAmount: %s\nTx: %s\nBlock: #%d\nTime: %s",
+		tokenStr,
+		FormatAddress(n.Transfer.From, n.Names),
+		FormatAddress(n.Transfer.To, n.Names),
+		amountStr,
+		n.Transfer.TxHash.Hex(),
+		n.BlockNum,
+		tm,
+	)
+}
+
+func FormatNFTTransferNotification(t tokens.Transfer, blockNum, blockTime uint64, names map[common.Address]string) string {
+	items := make([]string, 0, len(t.TokenIDs))
+	for i, id := range t.TokenIDs {
+		if t.Standard == tokens.ERC721 {
+			items = append(items, "#"+id.String())
+			continue
+		}
+		items = append(items, fmt.Sprintf("#%s × %s", id.String(), t.Amounts[i].String()))
+	}
+
 	tm := time.Unix(int64(blockTime), 0).UTC().Format(time.RFC3339)
 	return fmt.Sprintf(
-		"🔔 New tx\n\nHash: %s\nFrom: %s\nTo: %s\nValue: %s ETH\nBlock: #%d\nTime: %s",
-		hash.Hex(),
-		from.Hex(),
-		toStr,
-		WeiToEthString(valueWei),
+		"🖼 NFT transfer (%s)\n\nCollection: %s\nFrom: %s\nTo: %s\nTokens: %s\nTx: %s\nBlock: #%d\nTime: %s",
+		strings.ToUpper(string(t.Standard)),
+		t.Token.Hex(),
+		FormatAddress(t.From, names),
+		FormatAddress(t.To, names),
+		strings.Join(items, ", "),
+		t.TxHash.Hex(),
 		blockNum,
 		tm,
 	)
 }
+
+func FormatContractEventNotification(ev contracts.Event, blockNum, blockTime uint64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📜 Contract event: %s\n\nContract: %s\nEvent: %s\n", ev.Name, ev.Contract.Hex(), ev.Signature)
+	if len(ev.Args) > 0 {
+		b.WriteString("Args:\n")
+		for _, a := range ev.Args {
+			fmt.Fprintf(&b, "  %s (%s): %s\n", a.Name, a.Type, a.Value)
+		}
+	}
+	tm := time.Unix(int64(blockTime), 0).UTC().Format(time.RFC3339)
+	fmt.Fprintf(&b, "Tx: %s\nBlock: #%d\nTime: %s", ev.TxHash.Hex(), blockNum, tm)
+	return b.String()
+}
+
+// FormatContractLogNotification — лог контракта, на который подписались без ABI.
+func FormatContractLogNotification(l *types.Log, blockNum, blockTime uint64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📜 Contract log\n\nContract: %s\n", l.Address.Hex())
+	for i, topic := range l.Topics {
+		fmt.Fprintf(&b, "Topic %d: %s\n", i, topic.Hex())
+	}
+	if len(l.Data) > 0 {
+		fmt.Fprintf(&b, "Data: %d bytes\n", len(l.Data))
+	}
+	tm := time.Unix(int64(blockTime), 0).UTC().Format(time.RFC3339)
+	fmt.Fprintf(&b, "Tx: %s\nBlock: #%d\nTime: %s", l.TxHash.Hex(), blockNum, tm)
+	return b.String()
+}
+
+// PendingNotification — данные для текста уведомления о tx из мемпула.
+type PendingNotification struct {
+	Hash     common.Hash
+	From     common.Address
+	To       *common.Address
+	ValueWei *big.Int
+	// ValueUSD — Value в центах USD по последней цене; nil — цены нет
+	ValueUSD *big.Int
+	Symbol   string
+	Call     *contracts.Call
+	Names    map[common.Address]string
+}
+
+func FormatPendingNotification(n PendingNotification) string {
+	callStr := ""
+	if n.Call != nil {
+		callStr = "\nCall: " + n.Call.String()
+	}
+	return fmt.Sprintf(
+		"⏳ Pending tx\n\nHash: %s\nFrom: %s\nTo: %s\nValue: %s %s%s%s\nNot mined yet, you will get a follow-up when it is included.",
+		n.Hash.Hex(),
+		FormatAddress(n.From, n.Names),
+		formatTo(n.To, n.Names),
+		WeiToEthString(n.ValueWei),
+		nativeSymbol(n.Symbol),
+		USDSuffix(n.ValueUSD),
+		callStr,
+	)
+}
+
+// FormatPendingGoneNotification — pending tx заменена (by != nil) или выпала из мемпула.
+func FormatPendingGoneNotification(hash common.Hash, by *Replacement) string {
+	if by == nil {
+		return fmt.Sprintf(
+			"🗑 Pending tx dropped\n\nHash: %s\nIt was not mined in time and is no longer tracked.",
+			hash.Hex(),
+		)
+	}
+	if by.Hash == nil {
+		return fmt.Sprintf(
+			"🔁 Pending tx replaced\n\nHash: %s\nNonce %d of the sender is already used on chain by another tx, so this one will not be mined.",
+			hash.Hex(),
+			by.Nonce,
+		)
+	}
+	text := fmt.Sprintf(
+		"🔁 Pending tx replaced\n\nHash: %s\nReplaced by: %s (same sender and nonce)",
+		hash.Hex(),
+		by.Hash.Hex(),
+	)
+	switch by.Kind {
+	case ReplacedSpeedUp:
+		text += "\nKind: speed-up (same call with a higher fee)"
+	case ReplacedCancel:
+		text += "\nKind: cancel (empty 0-value tx to the sender itself)"
+	}
+	return text
+}
+
+// StuckNotification — исходящая tx кошелька долго висит в мемпуле.
+type StuckNotification struct {
+	Hash       common.Hash
+	From       common.Address
+	Nonce      uint64
+	PendingFor time.Duration
+
+	// NextNonce — nonce кошелька на последнем блоке; nil — нода не сказала
+	NextNonce *uint64
+	// FeeCap — max fee tx (gas price у legacy), BaseFee — base fee последнего блока; nil — неизвестны
+	FeeCap  *big.Int
+	BaseFee *big.Int
+
+	Names map[common.Address]string
+}
+
+func FormatStuckNotification(n StuckNotification) string {
+	text := fmt.Sprintf(
+		"⚠️ Pending tx stuck\n\nHash: %s\nFrom: %s\nNonce: %d\nPending for: %s",
+		n.Hash.Hex(),
+		FormatAddress(n.From, n.Names),
+		n.Nonce,
+		n.PendingFor.Round(time.Second),
+	)
+
+	if next := n.NextNonce; next != nil && *next < n.Nonce {
+		missing := fmt.Sprintf("nonce %d is", *next)
+		if n.Nonce-*next > 1 {
+			missing = fmt.Sprintf("nonces %d-%d are", *next, n.Nonce-1)
+		}
+		return text + fmt.Sprintf(
+			"\nReason: nonce gap, %s not mined yet.\nThe tx will wait until the earlier nonces are mined or replaced.",
+			missing,
+		)
+	}
+
+	switch {
+	case n.FeeCap != nil && n.BaseFee != nil && n.FeeCap.Cmp(n.BaseFee) < 0:
+		text += fmt.Sprintf("\nReason: max fee %s gwei is below the current base fee %s gwei.",
+			WeiToGweiString(n.FeeCap), WeiToGweiString(n.BaseFee))
+	case n.NextNonce != nil:
+		text += "\nReason: it is next in line, the fee is probably too low for the current load."
+	default:
+		text += "\nThe fee is probably too low for the current load."
+	}
+	return text + "\nTo speed it up or cancel it, send a tx with the same nonce and a higher fee."
+}
+
+func FormatReorgNotification(hash common.Hash, blockNum uint64) string {
+	return fmt.Sprintf(
+		"↩️ Tx reorged out\n\nHash: %s\nWas in block: #%d\nThe block is no longer canonical and the tx is not in the new chain yet.",
+		hash.Hex(),
+		blockNum,
+	)
+}
+
+// FormatGasNotification — газ перешёл порог алерта.
+func FormatGasNotification(a subs.GasAlert, r subs.GasReading) string {
+	metric := "Base fee"
+	if a.Metric == subs.GasPriorityFee {
+		metric = fmt.Sprintf("Priority fee (median of last %d blocks)", GasPriorityWindow)
+	}
+	return fmt.Sprintf(
+		"⛽ Gas alert\n\n%s: %s gwei (%s %s gwei)\nBlock: #%d",
+		metric,
+		WeiToGweiString(r.Value(a.Metric)),
+		a.Direction,
+		WeiToGweiString(a.ThresholdWei),
+		r.BlockNum,
+	)
+}
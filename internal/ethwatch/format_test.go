@@ -4,8 +4,14 @@ import (
 	"math/big"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/chains"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/tokens"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 func TestWeiToEthString(t *testing.T) {
@@ -28,7 +34,9 @@ func TestFormatTxNotification(t *testing.T) {
 
 	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
 
-	txt := FormatTxNotification(hash, from, &to, oneEth, 123, 1700000000)
+	txt := FormatTxNotification(TxNotification{
+		Hash: hash, From: from, To: &to, ValueWei: oneEth, BlockNum: 123, BlockTime: 1700000000,
+	})
 	if txt == "" {
 		t.Fatal("expected non-empty")
 	}
@@ -37,6 +45,104 @@ func TestFormatTxNotification(t *testing.T) {
 	}
 }
 
+func TestFormatTxNotification_Network(t *testing.T) {
+	hash := common.HexToHash("0x" + strings.Repeat("11", 32))
+	from := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+	txt := FormatTxNotification(TxNotification{
+		Hash: hash, From: from, ValueWei: oneEth, BlockNum: 1, BlockTime: 1700000000, Symbol: "POL",
+	})
+	if !contains(txt, "Value: 1.000000 POL") {
+		t.Fatalf("expected native symbol: %s", txt)
+	}
+
+	txt = withNetwork(txt, chains.Resolve(137))
+	if !strings.HasPrefix(txt, "🔔 New tx\n\nNetwork: Polygon\nHash: ") {
+		t.Fatalf("expected network line after title: %s", txt)
+	}
+	if got := withNetwork("plain", chains.Network{}); got != "plain" {
+		t.Fatalf("expected text unchanged without network, got %q", got)
+	}
+}
+
+func TestFormatTxNotification_Call(t *testing.T) {
+	hash := common.HexToHash("0x" + strings.Repeat("11", 32))
+	from := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	data := append(common.FromHex("0xa9059cbb"), common.LeftPadBytes(from.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(5).Bytes(), 32)...)
+	call, ok := contracts.NewSelectors().Decode(data)
+	if !ok {
+		t.Fatal("expected calldata to decode")
+	}
+
+	txt := FormatTxNotification(TxNotification{
+		Hash: hash, From: from, To: &token, ValueWei: big.NewInt(0), BlockNum: 1, BlockTime: 1700000000, Call: &call,
+	})
+	if !contains(txt, "Call: transfer(to="+from.Hex()+", amount=5)") {
+		t.Fatalf("expected decoded call: %s", txt)
+	}
+}
+
+func TestFormatTxNotification_Receipt(t *testing.T) {
+	hash := common.HexToHash("0x" + strings.Repeat("11", 32))
+	from := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	n := TxNotification{
+		Hash: hash, From: from, ValueWei: big.NewInt(0), BlockNum: 1, BlockTime: 1700000000,
+		Receipt: &types.Receipt{
+			Status:            types.ReceiptStatusFailed,
+			GasUsed:           21000,
+			EffectiveGasPrice: big.NewInt(20_000_000_000), // 20 gwei
+		},
+	}
+
+	txt := FormatTxNotification(n)
+	if !contains(txt, "❌ failed") {
+		t.Fatalf("expected failed status: %s", txt)
+	}
+	// 21000 * 20 gwei = 0.00042 ETH
+	if !contains(txt, "Fee: 0.000420 ETH (gas used 21000 @ 20.00 gwei)") {
+		t.Fatalf("expected fee breakdown: %s", txt)
+	}
+
+	n.Receipt.Status = types.ReceiptStatusSuccessful
+	if txt := FormatTxNotification(n); !contains(txt, "✅ success") {
+		t.Fatalf("expected success status: %s", txt)
+	}
+}
+
+func TestFormatTokenTransferNotification(t *testing.T) {
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	n := TokenTransferNotification{
+		Transfer: tokens.Transfer{
+			Token:  token,
+			From:   common.HexToAddress("0x1111111111111111111111111111111111111111"),
+			To:     common.HexToAddress("0x2222222222222222222222222222222222222222"),
+			Amount: big.NewInt(2_500_000_000_000),
+		},
+		BlockNum: 7,
+	}
+
+	if txt := FormatTokenTransferNotification(n); !contains(txt, "Amount: 2500000000000 (raw units)") {
+		t.Fatalf("expected raw amount without metadata: %s", txt)
+	}
+
+	n.Token = &tokens.Info{Address: token, Symbol: "USDT", Decimals: 6}
+	txt := FormatTokenTransferNotification(n)
+	if !contains(txt, "Amount: 2500000 USDT") || !contains(txt, "Token: USDT ("+token.Hex()+")") {
+		t.Fatalf("unexpected text: %s", txt)
+	}
+
+	n.Names = map[common.Address]string{n.Transfer.To: "bob.eth"}
+	txt = FormatTokenTransferNotification(n)
+	if !contains(txt, "To: "+n.Transfer.To.Hex()+" (bob.eth)") || !contains(txt, "From: "+n.Transfer.From.Hex()+"\n") {
+		t.Fatalf("expected ENS name next to recipient only: %s", txt)
+	}
+}
+
 func contains(s, sub string) bool {
 	return len(sub) == 0 || (len(s) >= len(sub) && (func() bool { return (stringIndex(s, sub) >= 0) })())
 }
@@ -49,3 +155,32 @@ func stringIndex(s, sub string) int {
 	}
 	return -1
 }
+
+func TestFormatStuckNotification(t *testing.T) {
+	next := uint64(3)
+	n := StuckNotification{
+		Hash:       common.HexToHash("0x01"),
+		From:       common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+		Nonce:      3,
+		PendingFor: 754_300 * time.Millisecond,
+		NextNonce:  &next,
+		FeeCap:     big.NewInt(5_000_000_000),
+		BaseFee:    big.NewInt(12_000_000_000),
+	}
+	text := FormatStuckNotification(n)
+	for _, want := range []string{"Pending for: 12m34s", "Reason: max fee 5.00 gwei is below the current base fee 12.00 gwei.", "same nonce and a higher fee"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in:\n%s", want, text)
+		}
+	}
+
+	n.FeeCap = big.NewInt(20_000_000_000)
+	if text := FormatStuckNotification(n); !strings.Contains(text, "it is next in line") {
+		t.Fatalf("expected next-in-line reason, got:\n%s", text)
+	}
+
+	next = 1
+	if text := FormatStuckNotification(n); !strings.Contains(text, "nonces 1-2 are not mined yet") || strings.Contains(text, "higher fee") {
+		t.Fatalf("expected nonce gap reason, got:\n%s", text)
+	}
+}
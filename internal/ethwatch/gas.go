@@ -0,0 +1,138 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// GasPriorityWindow — за сколько последних блоков считается медиана чаевых.
+const GasPriorityWindow = 20
+
+// gasTracker — окно медиан чаевых по блокам и сработавшие газовые алерты.
+// Трогается только из цикла обработки блоков.
+type gasTracker struct {
+	window int
+	tips   []*big.Int // медиана чаевых каждого блока, старые первыми
+
+	// fired — чаты, чей алерт сработал и ждёт, пока газ отойдёт за полосу гистерезиса
+	fired map[int64]subs.GasAlert
+	// seeded — fired уже заполнен по первому живому блоку (см. seed)
+	seeded bool
+}
+
+func newGasTracker(window int) *gasTracker {
+	if window <= 0 {
+		window = 1
+	}
+	return &gasTracker{window: window, fired: make(map[int64]subs.GasAlert)}
+}
+
+// observe добавляет блок в окно и возвращает газ на нём. Пустые блоки окно
+// не двигают: по ним о чаевых ничего не известно.
+func (t *gasTracker) observe(block *types.Block) subs.GasReading {
+	r := subs.GasReading{BlockNum: block.NumberU64(), BaseFee: block.BaseFee()}
+
+	if tip := blockMedianTip(block); tip != nil {
+		t.tips = append(t.tips, tip)
+		if over := len(t.tips) - t.window; over > 0 {
+			t.tips = append(t.tips[:0], t.tips[over:]...)
+		}
+	}
+	if len(t.tips) > 0 {
+		r.PriorityFee = median(t.tips)
+	}
+	return r
+}
+
+// check — пора ли уведомить чат: алерт взведён и значение перешло порог.
+// Сработавший алерт молчит, пока значение не вернётся за порог дальше полосы
+// гистерезиса; изменённый пользователем алерт взводится заново.
+func (t *gasTracker) check(chatID int64, a subs.GasAlert, v *big.Int) bool {
+	if prev, ok := t.fired[chatID]; ok && prev.Equal(a) {
+		if a.Rearmed(v) {
+			delete(t.fired, chatID)
+		}
+		return false
+	}
+	if !a.Triggered(v) {
+		delete(t.fired, chatID)
+		return false
+	}
+	t.fired[chatID] = a
+	return true
+}
+
+// seed взводит fired по текущему газу без уведомлений: fired живёт только в
+// памяти, и после рестарта алерт, о котором чат уже знает, иначе пришёл бы снова.
+func (t *gasTracker) seed(alerts map[int64]subs.GasAlert, r subs.GasReading) {
+	for chatID, a := range alerts {
+		if v := r.Value(a.Metric); v != nil && a.Triggered(v) {
+			t.fired[chatID] = a
+		}
+	}
+	t.seeded = true
+}
+
+// forget убирает состояние чатов, у которых алерта больше нет.
+func (t *gasTracker) forget(alerts map[int64]subs.GasAlert) {
+	for chatID := range t.fired {
+		if _, ok := alerts[chatID]; !ok {
+			delete(t.fired, chatID)
+		}
+	}
+}
+
+// blockMedianTip — медиана фактических чаевых tx блока; nil для пустого блока.
+func blockMedianTip(block *types.Block) *big.Int {
+	tips := make([]*big.Int, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		tip, err := tx.EffectiveGasTip(block.BaseFee())
+		if err != nil {
+			continue
+		}
+		tips = append(tips, tip)
+	}
+	if len(tips) == 0 {
+		return nil
+	}
+	return median(tips)
+}
+
+// median — нижняя медиана; xs не меняется.
+func median(xs []*big.Int) *big.Int {
+	sorted := append([]*big.Int(nil), xs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+	return new(big.Int).Set(sorted[(len(sorted)-1)/2])
+}
+
+// checkGas обновляет газ сети и шлёт сработавшие газовые алерты. live=false —
+// блок из догонялки: окно чаевых двигаем, но алерт о газе давно прошедшего
+// блока не шлём.
+func (w *Watcher) checkGas(ctx context.Context, block *types.Block, live bool) {
+	reading := w.gas.observe(block)
+	w.subStore.SetGas(reading)
+	if !live {
+		return
+	}
+
+	alerts := w.subStore.GasAlerts()
+	w.gas.forget(alerts)
+	if !w.gas.seeded {
+		w.gas.seed(alerts, reading)
+		return
+	}
+	for chatID, a := range alerts {
+		v := reading.Value(a.Metric)
+		if v == nil || !w.gas.check(chatID, a, v) {
+			continue
+		}
+		if !w.notify(ctx, chatID, FormatGasNotification(a, reading)) {
+			return
+		}
+	}
+}
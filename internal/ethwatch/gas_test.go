@@ -0,0 +1,115 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// gasBlock — блок с base fee и EIP-1559 tx с заданными чаевыми.
+func gasBlock(num uint64, baseFee *big.Int, tips ...int64) *types.Block {
+	var txs []*types.Transaction
+	for i, tip := range tips {
+		txs = append(txs, types.NewTx(&types.DynamicFeeTx{
+			Nonce:     uint64(i),
+			GasTipCap: gwei(tip),
+			GasFeeCap: new(big.Int).Add(baseFee, gwei(tip)),
+			Gas:       21000,
+			To:        &common.Address{},
+		}))
+	}
+	header := &types.Header{Number: new(big.Int).SetUint64(num), BaseFee: baseFee}
+	return types.NewBlock(header, &types.Body{Transactions: txs}, nil, trie.NewStackTrie(nil))
+}
+
+func TestGasTracker_MedianTip(t *testing.T) {
+	tr := newGasTracker(3)
+
+	if r := tr.observe(gasBlock(1, gwei(10))); r.PriorityFee != nil || r.BaseFee.Cmp(gwei(10)) != 0 {
+		t.Fatalf("expected no priority fee for an empty block, got=%+v", r)
+	}
+	tr.observe(gasBlock(2, gwei(10), 1, 5, 3))
+	tr.observe(gasBlock(3, gwei(10), 2))
+	tr.observe(gasBlock(4, gwei(10), 7, 7))
+	// окно из трёх блоков: медианы 3, 2, 7
+	if r := tr.observe(gasBlock(5, gwei(10))); r.PriorityFee.Cmp(gwei(3)) != 0 {
+		t.Fatalf("expected median tip 3 gwei, got=%s", r.PriorityFee)
+	}
+	tr.observe(gasBlock(6, gwei(10), 9))
+	if r := tr.observe(gasBlock(7, gwei(10))); r.PriorityFee.Cmp(gwei(7)) != 0 {
+		t.Fatalf("expected median tip 7 gwei after the window moved, got=%s", r.PriorityFee)
+	}
+}
+
+func TestWatcher_checkGas_Hysteresis(t *testing.T) {
+	ctx := context.Background()
+
+	store := subs.NewStore()
+	if err := store.SetGasAlert(ctx, 7, subs.GasAlert{Metric: subs.GasBaseFee, Direction: subs.GasBelow, ThresholdWei: gwei(10)}); err != nil {
+		t.Fatalf("SetGasAlert: %v", err)
+	}
+	notifyCh := make(chan bus.Notification, 8)
+	w := &Watcher{subStore: store, notifyCh: notifyCh, chainID: big.NewInt(1), gas: newGasTracker(GasPriorityWindow)}
+
+	// 12 → 9 (сработал) → 10.5 → 9 (внутри полосы — молчим) → 11 (взвёлся) → 8 (снова)
+	want := []bool{false, true, false, false, false, true}
+	for i, fee := range []int64{12_000, 9_000, 10_500, 9_000, 11_000, 8_000} {
+		baseFee := new(big.Int).Mul(big.NewInt(fee), big.NewInt(1_000_000)) // fee в mwei
+		w.checkGas(ctx, gasBlock(uint64(100+i), baseFee), true)
+
+		if got := len(notifyCh) == 1; got != want[i] {
+			t.Fatalf("block %d (base fee %s): expected alert=%v, got %d notifications", 100+i, baseFee, want[i], len(notifyCh))
+		}
+		if want[i] {
+			n := <-notifyCh
+			if n.ChatID != 7 || !contains(n.Text, "⛽ Gas alert") || !contains(n.Text, "Base fee: "+WeiToGweiString(baseFee)+" gwei (below 10.00 gwei)") {
+				t.Fatalf("unexpected gas alert: %s", n.Text)
+			}
+		}
+	}
+
+	if r, ok := store.Gas(); !ok || r.BlockNum != 105 || r.BaseFee.Cmp(gwei(8)) != 0 {
+		t.Fatalf("expected last gas reading in store, got=%+v", r)
+	}
+}
+
+func TestWatcher_checkGas_NoAlertsWhileCatchingUp(t *testing.T) {
+	ctx := context.Background()
+
+	store := subs.NewStore()
+	if err := store.SetGasAlert(ctx, 7, subs.GasAlert{Metric: subs.GasBaseFee, Direction: subs.GasBelow, ThresholdWei: gwei(10)}); err != nil {
+		t.Fatalf("SetGasAlert: %v", err)
+	}
+	notifyCh := make(chan bus.Notification, 8)
+	w := &Watcher{subStore: store, notifyCh: notifyCh, chainID: big.NewInt(1), gas: newGasTracker(GasPriorityWindow)}
+
+	// догонялка после рестарта: газ в истории пересекал порог — молчим
+	w.checkGas(ctx, gasBlock(100, gwei(12)), false)
+	w.checkGas(ctx, gasBlock(101, gwei(8)), false)
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected no alerts for backfilled blocks, got %d", len(notifyCh))
+	}
+	if r, ok := store.Gas(); !ok || r.BlockNum != 101 {
+		t.Fatalf("expected gas reading from backfilled blocks, got=%+v", r)
+	}
+
+	// на голове газ всё ещё ниже порога: чат об этом знал до рестарта
+	w.checkGas(ctx, gasBlock(102, gwei(9)), true)
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected an already triggered alert to stay quiet after restart")
+	}
+
+	// газ отошёл за гистерезис и снова упал — алерт приходит
+	w.checkGas(ctx, gasBlock(103, gwei(12)), true)
+	w.checkGas(ctx, gasBlock(104, gwei(8)), true)
+	if len(notifyCh) != 1 {
+		t.Fatalf("expected one alert after rearm, got %d", len(notifyCh))
+	}
+}
@@ -0,0 +1,459 @@
+package ethwatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/storage"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pendingSubscriber — клиент с подпиской newPendingTransactions (rpcpool.Pool).
+type pendingSubscriber interface {
+	SubscribePendingTransactions(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error)
+}
+
+// pendingTx — tx из мемпула, о которой чатам ушло уведомление "pending" или
+// за отправителем которой следят.
+type pendingTx struct {
+	Hash  common.Hash
+	From  common.Address
+	Nonce uint64
+	// Chats — получатели уведомления "pending" (только уровень latest)
+	Chats []int64
+	// Owners — все чаты, следящие за кошельком-отправителем, с любым уровнем:
+	// им уходят предупреждения о зависании и замене
+	Owners []int64
+	SeenAt time.Time
+
+	// что делает tx — чтобы понять, чем была замена (см. replacementKind)
+	To       *common.Address
+	Value    *big.Int
+	Selector string   // "0xa9059cbb"; пусто — calldata нет
+	FeeCap   *big.Int // max fee (gas price у legacy); nil — неизвестен
+
+	// warned — о зависании уже предупредили (трогается под mempoolTracker.mu)
+	warned bool
+}
+
+func newPendingTx(tx *types.Transaction, from common.Address, chats, owners []int64, seenAt time.Time) *pendingTx {
+	p := &pendingTx{
+		Hash:   tx.Hash(),
+		From:   from,
+		Nonce:  tx.Nonce(),
+		Chats:  chats,
+		Owners: owners,
+		SeenAt: seenAt,
+		To:     tx.To(),
+		Value:  tx.Value(),
+		FeeCap: tx.GasFeeCap(),
+	}
+	if p.Value == nil {
+		p.Value = big.NewInt(0)
+	}
+	p.Selector, _ = contracts.SelectorHex(tx.Data())
+	return p
+}
+
+// pendingFromRecord — pending tx из БД после рестарта.
+func pendingFromRecord(rec storage.PendingTxRecord) (*pendingTx, error) {
+	if !common.IsHexAddress(rec.Tx.FromAddr) {
+		return nil, fmt.Errorf("bad from address %q", rec.Tx.FromAddr)
+	}
+	value, ok := new(big.Int).SetString(rec.Tx.ValueWei, 10)
+	if !ok {
+		return nil, fmt.Errorf("bad value %q", rec.Tx.ValueWei)
+	}
+	p := &pendingTx{
+		Hash:   common.HexToHash(rec.Tx.Hash),
+		From:   common.HexToAddress(rec.Tx.FromAddr),
+		Nonce:  rec.Tx.Nonce,
+		Chats:  rec.ChatIDs,
+		SeenAt: rec.SeenAt,
+		Value:  value,
+	}
+	if rec.Tx.ToAddr != nil && common.IsHexAddress(*rec.Tx.ToAddr) {
+		to := common.HexToAddress(*rec.Tx.ToAddr)
+		p.To = &to
+	}
+	if rec.Tx.MethodSelector != nil {
+		p.Selector = *rec.Tx.MethodSelector
+	}
+	feeCap := rec.Tx.MaxFeePerGasWei
+	if feeCap == nil {
+		feeCap = rec.Tx.GasPriceWei
+	}
+	if feeCap != nil {
+		p.FeeCap, _ = new(big.Int).SetString(*feeCap, 10)
+	}
+	return p, nil
+}
+
+// ReplacementKind — чем была замена pending tx.
+type ReplacementKind string
+
+const (
+	ReplacedOther ReplacementKind = ""
+	// ReplacedSpeedUp — тот же вызов (получатель, сумма, метод) с большей комиссией
+	ReplacedSpeedUp ReplacementKind = "speed-up"
+	// ReplacedCancel — пустая tx на 0 самому себе: так кошельки отменяют tx
+	ReplacedCancel ReplacementKind = "cancel"
+)
+
+// Replacement — tx с тем же sender+nonce, вытеснившая pending tx.
+type Replacement struct {
+	// Hash nil — саму замену не видели, но nonce уже занят в цепочке
+	Hash  *common.Hash
+	Kind  ReplacementKind
+	Nonce uint64
+}
+
+// replacementKind сравнивает вытесненную tx с заменой от того же отправителя.
+func replacementKind(old *pendingTx, tx *types.Transaction, from common.Address) ReplacementKind {
+	sel, _ := contracts.SelectorHex(tx.Data())
+	val := tx.Value()
+	if val == nil {
+		val = big.NewInt(0)
+	}
+	to := tx.To()
+
+	sameTo := (old.To == nil && to == nil) || (old.To != nil && to != nil && *old.To == *to)
+	switch {
+	case sameTo && old.Value.Cmp(val) == 0 && old.Selector == sel:
+		return ReplacedSpeedUp
+	case to != nil && *to == from && val.Sign() == 0 && len(tx.Data()) == 0:
+		return ReplacedCancel
+	}
+	return ReplacedOther
+}
+
+type senderNonce struct {
+	from  common.Address
+	nonce uint64
+}
+
+// mempoolTracker помнит уведомлённые pending tx до включения в блок, замены
+// (та же пара sender+nonce) или истечения срока.
+type mempoolTracker struct {
+	mu      sync.Mutex
+	byHash  map[common.Hash]*pendingTx
+	byNonce map[senderNonce]*pendingTx
+}
+
+func newMempoolTracker() *mempoolTracker {
+	return &mempoolTracker{
+		byHash:  make(map[common.Hash]*pendingTx),
+		byNonce: make(map[senderNonce]*pendingTx),
+	}
+}
+
+// observe учитывает новую pending tx. replaced — вытесненная ей отслеживаемая tx;
+// fresh — tx раньше не встречалась и запомнена (только если у неё есть чаты
+// или владельцы).
+func (m *mempoolTracker) observe(p *pendingTx) (replaced *pendingTx, fresh bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.byHash[p.Hash]; ok {
+		return nil, false
+	}
+
+	key := senderNonce{p.From, p.Nonce}
+	if old, ok := m.byNonce[key]; ok && old.Hash != p.Hash {
+		replaced = old
+		m.removeLocked(old)
+	}
+	if len(p.Chats) > 0 || len(p.Owners) > 0 {
+		m.byHash[p.Hash] = p
+		m.byNonce[key] = p
+		fresh = true
+	}
+	return replaced, fresh
+}
+
+// mined вызывается для каждой tx из блока: confirmed — это и была отслеживаемая
+// pending tx, replaced — в блок попала другая tx с тем же sender+nonce.
+func (m *mempoolTracker) mined(hash common.Hash, from common.Address, nonce uint64) (confirmed, replaced *pendingTx) {
+	if m == nil {
+		return nil, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.byHash[hash]; ok {
+		m.removeLocked(p)
+		return p, nil
+	}
+	if old, ok := m.byNonce[senderNonce{from, nonce}]; ok {
+		m.removeLocked(old)
+		return nil, old
+	}
+	return nil, nil
+}
+
+// stuck возвращает tx, ждущие с момента раньше deadline, о которых ещё не
+// предупреждали, и помечает их: предупреждение уходит один раз.
+func (m *mempoolTracker) stuck(deadline time.Time) []*pendingTx {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []*pendingTx
+	for _, p := range m.byHash {
+		if !p.warned && p.SeenAt.Before(deadline) {
+			p.warned = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (m *mempoolTracker) remove(p *pendingTx) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.byHash[p.Hash]; ok && cur == p {
+		m.removeLocked(p)
+	}
+}
+
+// expire убирает и возвращает tx, которые не попали в блок до deadline.
+func (m *mempoolTracker) expire(deadline time.Time) []*pendingTx {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []*pendingTx
+	for _, p := range m.byHash {
+		if p.SeenAt.Before(deadline) {
+			out = append(out, p)
+		}
+	}
+	for _, p := range out {
+		m.removeLocked(p)
+	}
+	return out
+}
+
+func (m *mempoolTracker) removeLocked(p *pendingTx) {
+	delete(m.byHash, p.Hash)
+	key := senderNonce{p.From, p.Nonce}
+	if cur, ok := m.byNonce[key]; ok && cur == p {
+		delete(m.byNonce, key)
+	}
+}
+
+// watchMempool держит подписку на pending tx с теми же задержками, что и
+// основной поток голов. Переподключение самого клиента делает supervise.
+func (w *Watcher) watchMempool(ctx context.Context) {
+	ps, ok := w.client.(pendingSubscriber)
+	if !ok {
+		return
+	}
+	signer := types.LatestSignerForChainID(w.chainID)
+
+	attempt := 0
+	for {
+		err := w.followMempool(ctx, ps, signer, func() { attempt = 0 })
+		if ctx.Err() != nil {
+			return
+		}
+
+		attempt++
+		delay := backoffDelay(attempt, w.cfg.ReconnectMinDelay, w.cfg.ReconnectMaxDelay, rand.Int64N)
+		log.Printf("[WATCHER] mempool subscription lost: %v; resubscribe attempt %d in %s", err, attempt, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) followMempool(ctx context.Context, ps pendingSubscriber, signer types.Signer, onSubscribed func()) error {
+	txs := make(chan *types.Transaction, 1024)
+
+	sub, err := ps.SubscribePendingTransactions(ctx, txs)
+	if err != nil {
+		return fmt.Errorf("subscribe pending txs: %w", err)
+	}
+	defer sub.Unsubscribe()
+	onSubscribed()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return fmt.Errorf("pending subscription error: %w", err)
+		case tx := <-txs:
+			if tx != nil {
+				w.handlePending(ctx, signer, tx)
+			}
+		}
+	}
+}
+
+func (w *Watcher) handlePending(ctx context.Context, signer types.Signer, tx *types.Transaction) {
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return
+	}
+	val := tx.Value()
+	if val == nil {
+		val = big.NewInt(0)
+	}
+
+	// pending-алерты только для чатов с уровнем latest: остальные ждут глубины блока
+	var chats []int64
+	for _, chatID := range w.subStore.MatchTx(from, tx.To(), val) {
+		if w.subStore.Level(chatID).IsLatest() {
+			chats = append(chats, chatID)
+		}
+	}
+
+	p := newPendingTx(tx, from, chats, w.subStore.MatchWallet(from), time.Now())
+	replaced, fresh := w.mempool.observe(p)
+	if replaced != nil {
+		hash := p.Hash
+		w.notifyPendingGone(ctx, replaced, &Replacement{Hash: &hash, Kind: replacementKind(replaced, tx, from), Nonce: p.Nonce})
+	}
+	if !fresh {
+		return
+	}
+
+	rec := w.txRecord(TxTask{Tx: tx}, from, nil)
+	rec.BlockNum, rec.BlockTime = nil, nil
+	valueUSD := w.nativeUSD(ctx, 0, val)
+	rec.ValueUSD = usdString(valueUSD)
+	if err := w.repo.UpsertTx(ctx, rec); err != nil {
+		log.Printf("[watcher] db upsert pending tx error: %v", err)
+	}
+
+	text := FormatPendingNotification(PendingNotification{
+		Hash:     tx.Hash(),
+		From:     from,
+		To:       tx.To(),
+		ValueWei: val,
+		ValueUSD: valueUSD,
+		Symbol:   w.cfg.Network.Symbol,
+		Call:     w.decodeCall(tx),
+		Names:    w.names(ctx, &from, tx.To()),
+	})
+	for _, chatID := range p.Chats {
+		if !w.notifyOnce(ctx, chatID, tx.Hash(), storage.EventPending, text) {
+			return
+		}
+	}
+}
+
+// expirePending сообщает о tx, которые так и не попали в блок за PendingDropAfter.
+func (w *Watcher) expirePending(ctx context.Context) {
+	for _, p := range w.mempool.expire(time.Now().Add(-w.cfg.PendingDropAfter)) {
+		w.notifyPendingGone(ctx, p, nil)
+	}
+}
+
+// restorePending возвращает в трекер pending tx, о которых чаты узнали до
+// рестарта: иначе их подтверждение, замену и зависание было бы не заметить.
+// Владельцы берутся по текущим подпискам. Tx без уведомления "pending" (за
+// отправителем следят только чаты с уровнем выше latest) в БД не отмечены и
+// после рестарта не восстанавливаются.
+func (w *Watcher) restorePending(ctx context.Context) {
+	recs, err := w.repo.ListPendingTxs(ctx, w.chainID.String(), time.Now().Add(-w.cfg.PendingDropAfter))
+	if err != nil {
+		log.Printf("[watcher] load pending txs error: %v", err)
+		return
+	}
+	restored := 0
+	for _, rec := range recs {
+		p, err := pendingFromRecord(rec)
+		if err != nil {
+			log.Printf("[watcher] pending tx %s: %v", rec.Tx.Hash, err)
+			continue
+		}
+		p.Owners = w.subStore.MatchWallet(p.From)
+		if _, fresh := w.mempool.observe(p); fresh {
+			restored++
+		}
+	}
+	if restored > 0 {
+		log.Printf("[watcher] restored %d pending tx(s)", restored)
+	}
+}
+
+// checkStuck предупреждает чаты, следящие за кошельком-отправителем, об
+// исходящих tx, которые висят в мемпуле дольше PendingStuckAfter. Nonce
+// кошелька на только что обработанном блоке объясняет причину: перед tx есть
+// не попавшие в блок nonce или её nonce уже занят другой tx — значит, её
+// заменили tx, которой не было в нашем мемпуле.
+func (w *Watcher) checkStuck(ctx context.Context, block *types.Block) {
+	stuck := w.mempool.stuck(time.Now().Add(-w.cfg.PendingStuckAfter))
+	if len(stuck) == 0 {
+		return
+	}
+	nr, hasNonce := w.client.(stateReader)
+
+	for _, p := range stuck {
+		n := StuckNotification{
+			Hash:       p.Hash,
+			From:       p.From,
+			Nonce:      p.Nonce,
+			PendingFor: time.Since(p.SeenAt),
+			FeeCap:     p.FeeCap,
+			BaseFee:    block.BaseFee(),
+			Names:      w.names(ctx, &p.From),
+		}
+		if hasNonce {
+			next, err := nr.NonceAt(ctx, p.From, block.Number())
+			switch {
+			case err != nil:
+				log.Printf("[watcher] nonce of %s at #%d error: %v", p.From.Hex(), block.NumberU64(), err)
+			case next > p.Nonce:
+				w.mempool.remove(p)
+				w.notifyPendingGone(ctx, p, &Replacement{Nonce: p.Nonce})
+				continue
+			default:
+				n.NextNonce = &next
+			}
+		}
+
+		text := FormatStuckNotification(n)
+		for _, chatID := range p.Owners {
+			if !w.notifyOnce(ctx, chatID, p.Hash, storage.EventStuck, text) {
+				return
+			}
+		}
+	}
+}
+
+// notifyPendingGone — tx заменена (by != nil) или выпала из мемпула. О выпадении
+// узнают получатели "pending", о замене — ещё и владельцы кошелька.
+func (w *Watcher) notifyPendingGone(ctx context.Context, p *pendingTx, by *Replacement) {
+	event := storage.EventDropped
+	chats := p.Chats
+	if by != nil {
+		event = storage.EventReplaced
+		chats = append(p.Chats[:len(p.Chats):len(p.Chats)], withoutChats(p.Owners, p.Chats)...)
+	}
+
+	text := FormatPendingGoneNotification(p.Hash, by)
+	for _, chatID := range chats {
+		if !w.notifyOnce(ctx, chatID, p.Hash, event, text) {
+			return
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/storage"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestWatcher_Mempool_PendingThenConfirmed(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 3, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, from)
+
+	notifyCh := make(chan bus.Notification, 4)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   &fakeClient{},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		mempool:  newMempoolTracker(),
+		repo:     repo,
+	}
+
+	w.handlePending(ctx, signer, tx)
+	// повтор из подписки не даёт второго уведомления
+	w.handlePending(ctx, signer, tx)
+
+	n := <-notifyCh
+	if n.ChatID != 5 || !contains(n.Text, "⏳ Pending tx") {
+		t.Fatalf("unexpected pending notification: %+v", n)
+	}
+	repo.delivered(n)
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected a single pending notification")
+	}
+	if len(repo.upserts) != 1 || repo.upserts[0].BlockNum != nil {
+		t.Fatalf("expected pending tx stored without block, got=%+v", repo.upserts)
+	}
+
+	w.handleTask(ctx, signer, TxTask{Tx: tx, BlockNum: 100})
+
+	n = <-notifyCh
+	if n.ChatID != 5 || !contains(n.Text, "✅ Pending tx confirmed") || !contains(n.Text, "Block: #100") {
+		t.Fatalf("unexpected confirmation: %+v", n)
+	}
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected confirmation instead of a regular notification, extra=%d", len(notifyCh))
+	}
+	repo.delivered(n)
+
+	var etypes []storage.TxEventType
+	for _, e := range repo.events {
+		etypes = append(etypes, e.etype)
+	}
+	if len(etypes) != 2 || etypes[0] != storage.EventPending || etypes[1] != storage.EventNotify {
+		t.Fatalf("unexpected events: %v", etypes)
+	}
+}
+
+func TestWatcher_Mempool_ReplacedAndDropped(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	sign := func(nonce uint64, gasPrice int64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Gas: 21000, GasPrice: big.NewInt(gasPrice)}), signer, key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return tx
+	}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, from)
+
+	notifyCh := make(chan bus.Notification, 8)
+	w := &Watcher{
+		client:   &fakeClient{},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		mempool:  newMempoolTracker(),
+		repo:     &mockRepo{},
+		cfg:      WatcherConfig{PendingDropAfter: time.Minute},
+	}
+
+	// speed-up с тем же nonce, а в блок попадает третья tx с этим nonce
+	orig, bumped, mined := sign(0, 1), sign(0, 2), sign(0, 3)
+	w.handlePending(ctx, signer, orig)
+	<-notifyCh
+	w.handlePending(ctx, signer, bumped)
+
+	n := <-notifyCh
+	if !contains(n.Text, "🔁 Pending tx replaced") || !contains(n.Text, orig.Hash().Hex()) || !contains(n.Text, bumped.Hash().Hex()) {
+		t.Fatalf("unexpected replace notice: %s", n.Text)
+	}
+	<-notifyCh // pending для bumped
+
+	w.handleTask(ctx, signer, TxTask{Tx: mined, BlockNum: 1})
+	n = <-notifyCh
+	if !contains(n.Text, "🔁 Pending tx replaced") || !contains(n.Text, bumped.Hash().Hex()) {
+		t.Fatalf("expected replaced-by-mined notice, got: %s", n.Text)
+	}
+	<-notifyCh // обычное уведомление о mined
+
+	// tx, которая так и не попала в блок
+	stale := sign(1, 1)
+	w.handlePending(ctx, signer, stale)
+	<-notifyCh
+	w.mempool.byHash[stale.Hash()].SeenAt = time.Now().Add(-2 * time.Minute)
+
+	w.expirePending(ctx)
+	n = <-notifyCh
+	if !contains(n.Text, "🗑 Pending tx dropped") || !contains(n.Text, stale.Hash().Hex()) {
+		t.Fatalf("unexpected drop notice: %s", n.Text)
+	}
+	if len(w.mempool.byHash) != 0 || len(w.mempool.byNonce) != 0 {
+		t.Fatalf("expected tracker to be empty")
+	}
+}
+
+func TestWatcher_Mempool_StuckAndCancelled(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	sign := func(nonce uint64, to common.Address, value int64, gasPrice int64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Value: big.NewInt(value), Gas: 21000, GasPrice: gwei(gasPrice)}), signer, key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return tx
+	}
+
+	// 5 следит за отправителем, 6 — за получателем
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, from)
+	_ = subStore.SetWallet(ctx, 6, to)
+
+	client := &fakeClient{nonces: map[common.Address]uint64{from: 1}}
+	notifyCh := make(chan bus.Notification, 8)
+	w := &Watcher{
+		client:   client,
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		mempool:  newMempoolTracker(),
+		repo:     &mockRepo{},
+		cfg:      WatcherConfig{PendingStuckAfter: 10 * time.Minute, PendingDropAfter: time.Hour},
+	}
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(50), BaseFee: gwei(10)})
+
+	// nonce 2 при nonce кошелька 1 — перед tx дырка
+	orig := sign(2, to, 1, 20)
+	w.handlePending(ctx, signer, orig)
+	<-notifyCh
+	<-notifyCh
+	w.checkStuck(ctx, block)
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected no stuck warning before the threshold")
+	}
+
+	w.mempool.byHash[orig.Hash()].SeenAt = time.Now().Add(-15 * time.Minute)
+	w.checkStuck(ctx, block)
+	w.checkStuck(ctx, block)
+	if len(notifyCh) != 1 {
+		t.Fatalf("expected a single stuck warning for the sender, got %d", len(notifyCh))
+	}
+	n := <-notifyCh
+	if n.ChatID != 5 || !contains(n.Text, "⚠️ Pending tx stuck") || !contains(n.Text, orig.Hash().Hex()) || !contains(n.Text, "nonce gap, nonce 1 is not mined yet") {
+		t.Fatalf("unexpected stuck warning: %+v", n)
+	}
+
+	// отмена: пустая tx самому себе с тем же nonce
+	cancel := sign(2, from, 0, 30)
+	w.handlePending(ctx, signer, cancel)
+	for _, chatID := range []int64{5, 6} {
+		n := <-notifyCh
+		if n.ChatID != chatID || !contains(n.Text, "🔁 Pending tx replaced") || !contains(n.Text, "Kind: cancel") {
+			t.Fatalf("unexpected cancel notice: %+v", n)
+		}
+	}
+	<-notifyCh // pending для самой отмены
+
+	// nonce 2 занят в цепочке, а замены в мемпуле не было
+	client.nonces[from] = 3
+	w.mempool.byHash[cancel.Hash()].SeenAt = time.Now().Add(-15 * time.Minute)
+	w.checkStuck(ctx, block)
+	n = <-notifyCh
+	if n.ChatID != 5 || !contains(n.Text, "🔁 Pending tx replaced") || !contains(n.Text, "Nonce 2 of the sender is already used") {
+		t.Fatalf("unexpected nonce-used notice: %+v", n)
+	}
+	if len(notifyCh) != 0 || len(w.mempool.byHash) != 0 || len(w.mempool.byNonce) != 0 {
+		t.Fatalf("expected tracker to be empty, extra notifications=%d", len(notifyCh))
+	}
+}
+
+func TestWatcher_Mempool_StuckForNonLatestOwner(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	// 5 следит за отправителем с уровнем finalized — pending ему не шлём,
+	// но о зависании и замене своей tx он узнать должен; 6 следит за получателем
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, from)
+	_ = subStore.SetLevel(ctx, 5, subs.Level{Kind: subs.LevelFinalized})
+	_ = subStore.SetWallet(ctx, 6, to)
+
+	notifyCh := make(chan bus.Notification, 8)
+	w := &Watcher{
+		client:   &fakeClient{nonces: map[common.Address]uint64{from: 2}},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		mempool:  newMempoolTracker(),
+		repo:     &mockRepo{},
+		cfg:      WatcherConfig{PendingStuckAfter: 10 * time.Minute, PendingDropAfter: time.Hour},
+	}
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(50), BaseFee: gwei(10)})
+
+	orig, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 2, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: gwei(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	w.handlePending(ctx, signer, orig)
+	if n := <-notifyCh; n.ChatID != 6 || len(notifyCh) != 0 {
+		t.Fatalf("expected pending alert only for the latest chat, got=%+v extra=%d", n, len(notifyCh))
+	}
+
+	w.mempool.byHash[orig.Hash()].SeenAt = time.Now().Add(-15 * time.Minute)
+	w.checkStuck(ctx, block)
+	if n := <-notifyCh; n.ChatID != 5 || !contains(n.Text, "⚠️ Pending tx stuck") || len(notifyCh) != 0 {
+		t.Fatalf("expected stuck warning only for the sender's chat, got=%+v extra=%d", n, len(notifyCh))
+	}
+
+	bumped, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 2, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: gwei(20)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	w.handlePending(ctx, signer, bumped)
+	for _, chatID := range []int64{6, 5} {
+		if n := <-notifyCh; n.ChatID != chatID || !contains(n.Text, "🔁 Pending tx replaced") || !contains(n.Text, "Kind: speed-up") {
+			t.Fatalf("expected replaced notice for chat %d, got=%+v", chatID, n)
+		}
+	}
+}
+
+func TestWatcher_Mempool_RestoredAfterRestart(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, from)
+
+	toStr := to.Hex()
+	repo := &mockRepo{pending: []storage.PendingTxRecord{{
+		Tx: storage.TxRecord{
+			Hash:     "0x" + strings.Repeat("1", 64),
+			FromAddr: from.Hex(),
+			ToAddr:   &toStr,
+			ValueWei: "7",
+			Nonce:    4,
+		},
+		ChatIDs: []int64{5},
+		SeenAt:  time.Now().Add(-time.Minute),
+	}}}
+	notifyCh := make(chan bus.Notification, 4)
+	w := &Watcher{
+		client:   &fakeClient{},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		mempool:  newMempoolTracker(),
+		repo:     repo,
+		cfg:      WatcherConfig{PendingDropAfter: time.Hour},
+	}
+	w.restorePending(ctx)
+
+	// до рестарта отслеживали nonce 4 — в блок попала та же оплата с большей комиссией
+	bumped, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 4, To: &to, Value: big.NewInt(7), Gas: 21000, GasPrice: big.NewInt(2)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	w.handleTask(ctx, signer, TxTask{Tx: bumped, BlockNum: 10})
+
+	n := <-notifyCh
+	if n.ChatID != 5 || !contains(n.Text, "🔁 Pending tx replaced") || !contains(n.Text, bumped.Hash().Hex()) || !contains(n.Text, "Kind: speed-up") {
+		t.Fatalf("unexpected replaced notice: %+v", n)
+	}
+}
+
+func TestWatcher_Mempool_NoStuckWhileCatchingUp(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, from)
+
+	// nonce на старом блоке ещё не знает, что tx смайнили в простое
+	client := &fakeClient{nonces: map[common.Address]uint64{from: 1}}
+	notifyCh := make(chan bus.Notification, 8)
+	w := NewWatcher(client, chainID, subStore, notifyCh, &mockRepo{}, nil,
+		WatcherConfig{Workers: 1, Mempool: true, PendingStuckAfter: 10 * time.Minute, PendingDropAfter: time.Hour})
+	w.startWorkers(ctx)
+	defer w.stopWorkers()
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 1, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: gwei(20)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	w.handlePending(ctx, signer, tx)
+	for len(notifyCh) > 0 {
+		<-notifyCh
+	}
+	// как после restorePending: tx видели задолго до рестарта
+	w.mempool.byHash[tx.Hash()].SeenAt = time.Now().Add(-time.Hour)
+
+	w.head = 60
+	if err := w.processBlock(ctx, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(50), BaseFee: gwei(10)})); err != nil {
+		t.Fatalf("processBlock: %v", err)
+	}
+	if len(notifyCh) != 0 {
+		t.Fatalf("expected no stuck warning for a backfilled block, got %+v", <-notifyCh)
+	}
+	if _, ok := w.mempool.byHash[tx.Hash()]; !ok {
+		t.Fatalf("expected the tx to stay tracked while catching up")
+	}
+
+	if err := w.processBlock(ctx, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(60), BaseFee: gwei(10)})); err != nil {
+		t.Fatalf("processBlock: %v", err)
+	}
+	if n := <-notifyCh; n.ChatID != 5 || !contains(n.Text, "Pending tx stuck") {
+		t.Fatalf("expected a stuck warning at the head, got %+v", n)
+	}
+}
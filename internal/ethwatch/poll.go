@@ -0,0 +1,43 @@
+package ethwatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// poll — замена follow для RPC без подписок: раз в PollInterval спрашивает
+// eth_blockNumber и догоняет все блоки, появившиеся с прошлого опроса.
+// Ошибка eth_blockNumber возвращается наверх, чтобы supervise переподключился.
+func (w *Watcher) poll(ctx context.Context, onConnected func()) error {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	connected := false
+	for {
+		headNum, err := w.client.BlockNumber(ctx)
+		if err != nil {
+			return fmt.Errorf("eth_blockNumber: %w", err)
+		}
+		if !connected {
+			connected = true
+			onConnected()
+		}
+
+		if err := w.catchUp(ctx, headNum, common.Hash{}); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("[WATCHER] catch up to #%d error: %v", headNum, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
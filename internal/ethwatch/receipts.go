@@ -0,0 +1,136 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/pvzzle/scanblock/internal/tokens"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// receiptFor возвращает receipt транзакции или nil, если получить его не удалось.
+// В рамках блока receipts берутся одним eth_getBlockReceipts; если нода его не
+// поддерживает — отдельным eth_getTransactionReceipt на каждую совпавшую tx.
+func (w *Watcher) receiptFor(ctx context.Context, task TxTask) *types.Receipt {
+	hash := task.Tx.Hash()
+
+	if task.run != nil {
+		if r, ok := w.blockReceipts(ctx, task.run)[hash]; ok {
+			return r
+		}
+	}
+
+	r, err := w.client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		log.Printf("[watcher] receipt %s error: %v", hash.Hex(), err)
+		return nil
+	}
+	return r
+}
+
+// blockReceipts грузит receipts блока один раз на blockRun; nil, если не вышло.
+func (w *Watcher) blockReceipts(ctx context.Context, run *blockRun) map[common.Hash]*types.Receipt {
+	if w.blockReceiptsUnsupported.Load() {
+		return nil
+	}
+	run.receiptsOnce.Do(func() {
+		run.receipts = w.fetchBlockReceipts(ctx, run.hash)
+	})
+	return run.receipts
+}
+
+// blockTransfers возвращает переводы токенов (ERC-20/721/1155) блока по tx hash.
+func (w *Watcher) blockTransfers(ctx context.Context, run *blockRun) (map[common.Hash][]tokens.Transfer, error) {
+	out := make(map[common.Hash][]tokens.Transfer)
+	err := w.eachBlockLog(ctx, run, ethereum.FilterQuery{Topics: [][]common.Hash{tokens.TransferTopics()}}, func(l *types.Log) {
+		if t, ok := tokens.DecodeTransfer(l); ok {
+			out[t.TxHash] = append(out[t.TxHash], t)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// blockContractLogs возвращает логи отслеживаемых контрактов блока по tx hash.
+func (w *Watcher) blockContractLogs(ctx context.Context, run *blockRun, addrs []common.Address) (map[common.Hash][]*types.Log, error) {
+	watched := make(map[common.Address]struct{}, len(addrs))
+	for _, a := range addrs {
+		watched[a] = struct{}{}
+	}
+
+	out := make(map[common.Hash][]*types.Log)
+	err := w.eachBlockLog(ctx, run, ethereum.FilterQuery{Addresses: addrs}, func(l *types.Log) {
+		if _, ok := watched[l.Address]; ok {
+			out[l.TxHash] = append(out[l.TxHash], l)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// eachBlockLog обходит логи блока: из receipts блока, а если их нет — одним
+// eth_getLogs по hash блока с фильтром q. fn всё равно должен сам проверять лог:
+// в receipts лежат все логи блока. Ошибка — логи не получены ни одним способом:
+// блок нельзя считать обработанным, иначе его переводы и события потеряются.
+func (w *Watcher) eachBlockLog(ctx context.Context, run *blockRun, q ethereum.FilterQuery, fn func(l *types.Log)) error {
+	if receipts := w.blockReceipts(ctx, run); receipts != nil {
+		for _, r := range receipts {
+			for _, l := range r.Logs {
+				if !l.Removed {
+					fn(l)
+				}
+			}
+		}
+		return nil
+	}
+
+	hash := run.hash
+	q.BlockHash = &hash
+	logs, err := w.client.FilterLogs(ctx, q)
+	if err != nil {
+		return fmt.Errorf("block logs %s: %w", hash.Hex(), err)
+	}
+	for i := range logs {
+		if !logs[i].Removed {
+			fn(&logs[i])
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) fetchBlockReceipts(ctx context.Context, blockHash common.Hash) map[common.Hash]*types.Receipt {
+	receipts, err := w.client.BlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(blockHash, false))
+	if err != nil {
+		if isMethodNotFound(err) {
+			w.blockReceiptsUnsupported.Store(true)
+			log.Printf("[WATCHER] eth_getBlockReceipts is not supported, falling back to per-tx receipts")
+		} else {
+			log.Printf("[watcher] block receipts %s error: %v", blockHash.Hex(), err)
+		}
+		return nil
+	}
+
+	out := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, r := range receipts {
+		if r != nil {
+			out[r.TxHash] = r
+		}
+	}
+	return out
+}
+
+func isMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	// -32601 — стандартный JSON-RPC "method not found"
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601
+}
@@ -0,0 +1,174 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func receiptTask(hash common.Hash, run *blockRun) TxTask {
+	tx := types.NewTx(&types.LegacyTx{Nonce: hash.Big().Uint64()})
+	return TxTask{Tx: tx, run: run}
+}
+
+func TestWatcher_receiptFor_OneBlockCallPerBlock(t *testing.T) {
+	ctx := context.Background()
+
+	t1 := receiptTask(common.HexToHash("0x01"), nil)
+	t2 := receiptTask(common.HexToHash("0x02"), nil)
+
+	cl := &fakeClient{receipts: map[common.Hash]*types.Receipt{
+		t1.Tx.Hash(): {TxHash: t1.Tx.Hash(), Status: 1},
+		t2.Tx.Hash(): {TxHash: t2.Tx.Hash(), Status: 0},
+	}}
+	w := &Watcher{client: cl}
+
+	run := &blockRun{hash: common.HexToHash("0xb1")}
+	t1.run, t2.run = run, run
+
+	if r := w.receiptFor(ctx, t1); r == nil || r.Status != 1 {
+		t.Fatalf("unexpected receipt: %+v", r)
+	}
+	if r := w.receiptFor(ctx, t2); r == nil || r.Status != 0 {
+		t.Fatalf("unexpected receipt: %+v", r)
+	}
+	if cl.blockReceiptCalls != 1 || cl.txReceiptCalls != 0 {
+		t.Fatalf("expected 1 block receipts call and no per-tx calls, got block=%d tx=%d",
+			cl.blockReceiptCalls, cl.txReceiptCalls)
+	}
+}
+
+func TestWatcher_receiptFor_FallbackWhenBlockReceiptsUnsupported(t *testing.T) {
+	ctx := context.Background()
+
+	t1 := receiptTask(common.HexToHash("0x01"), nil)
+	cl := &fakeClient{
+		receipts:         map[common.Hash]*types.Receipt{t1.Tx.Hash(): {TxHash: t1.Tx.Hash(), Status: 1}},
+		blockReceiptsErr: methodNotFoundErr{},
+	}
+	w := &Watcher{client: cl}
+
+	t1.run = &blockRun{hash: common.HexToHash("0xb1")}
+	if r := w.receiptFor(ctx, t1); r == nil || r.Status != 1 {
+		t.Fatalf("expected receipt via fallback, got=%+v", r)
+	}
+	if !w.blockReceiptsUnsupported.Load() {
+		t.Fatalf("expected eth_getBlockReceipts to be marked unsupported")
+	}
+
+	// следующий блок уже не пробует eth_getBlockReceipts
+	t1.run = &blockRun{hash: common.HexToHash("0xb2")}
+	_ = w.receiptFor(ctx, t1)
+	if cl.blockReceiptCalls != 1 {
+		t.Fatalf("expected no more block receipts calls, got=%d", cl.blockReceiptCalls)
+	}
+}
+
+func TestWatcher_blockTransfers_FallbackToLogs(t *testing.T) {
+	ctx := context.Background()
+
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	from := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	to := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	txHash := common.HexToHash("0x0a")
+
+	cl := &fakeClient{
+		blockReceiptsErr: methodNotFoundErr{},
+		logs: []types.Log{
+			{
+				Address: token,
+				Topics:  []common.Hash{tokens.TransferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+				Data:    common.LeftPadBytes(big.NewInt(42).Bytes(), 32),
+				TxHash:  txHash,
+			},
+			{
+				// ERC-721: tokenId в четвёртом topic
+				Address: token,
+				Topics:  []common.Hash{tokens.TransferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes()), common.HexToHash("0x01")},
+				TxHash:  txHash,
+			},
+		},
+	}
+	w := &Watcher{client: cl}
+
+	got, err := w.blockTransfers(ctx, &blockRun{hash: common.HexToHash("0xb1")})
+	if err != nil {
+		t.Fatalf("blockTransfers: %v", err)
+	}
+	if cl.filterLogsCalls != 1 {
+		t.Fatalf("expected eth_getLogs fallback, got %d calls", cl.filterLogsCalls)
+	}
+	ts := got[txHash]
+	if len(ts) != 2 {
+		t.Fatalf("expected erc20 and erc721 transfers, got: %+v", got)
+	}
+	if ts[0].Standard != tokens.ERC20 || ts[0].Token != token || ts[0].From != from || ts[0].To != to || ts[0].Amount.Int64() != 42 {
+		t.Fatalf("unexpected erc20 transfer: %+v", ts[0])
+	}
+	if ts[1].Standard != tokens.ERC721 || len(ts[1].TokenIDs) != 1 || ts[1].TokenIDs[0].Int64() != 1 {
+		t.Fatalf("unexpected erc721 transfer: %+v", ts[1])
+	}
+}
+
+func TestWatcher_blockContractLogs_FromReceipts(t *testing.T) {
+	ctx := context.Background()
+
+	vault := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	txHash := common.HexToHash("0x0a")
+
+	cl := &fakeClient{receipts: map[common.Hash]*types.Receipt{
+		txHash: {TxHash: txHash, Logs: []*types.Log{
+			{Address: vault, Topics: []common.Hash{common.HexToHash("0x01")}, TxHash: txHash},
+			{Address: common.HexToAddress("0x02"), Topics: []common.Hash{common.HexToHash("0x01")}, TxHash: txHash},
+			{Address: vault, Topics: []common.Hash{common.HexToHash("0x01")}, TxHash: txHash, Removed: true},
+		}},
+	}}
+	w := &Watcher{client: cl}
+
+	got, err := w.blockContractLogs(ctx, &blockRun{hash: common.HexToHash("0xb1")}, []common.Address{vault})
+	if err != nil {
+		t.Fatalf("blockContractLogs: %v", err)
+	}
+	if cl.filterLogsCalls != 0 {
+		t.Fatalf("expected logs from block receipts, got %d eth_getLogs calls", cl.filterLogsCalls)
+	}
+	if ls := got[txHash]; len(ls) != 1 || ls[0].Address != vault {
+		t.Fatalf("expected only the watched contract log, got: %+v", got)
+	}
+}
+
+func TestWatcher_processBlock_LogsErrorKeepsCheckpoint(t *testing.T) {
+	ctx := context.Background()
+
+	store := subs.NewStore()
+	_ = store.SetWallet(ctx, 1, common.HexToAddress("0x1111111111111111111111111111111111111111"))
+
+	cl := &fakeClient{blockReceiptsErr: methodNotFoundErr{}, logsErr: errors.New("connection reset")}
+	repo := &mockRepo{}
+	w := NewWatcher(cl, big.NewInt(1), store, make(chan bus.Notification, 1), repo, nil, WatcherConfig{})
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(100)}).
+		WithBody(types.Body{Transactions: []*types.Transaction{types.NewTx(&types.LegacyTx{})}})
+	if err := w.processBlock(ctx, block); err == nil {
+		t.Fatalf("expected error when block logs are unavailable")
+	}
+	if len(repo.saved) != 0 || w.lastBlock != nil {
+		t.Fatalf("expected block to stay unprocessed, saved=%+v", repo.saved)
+	}
+}
+
+type methodNotFoundErr struct{}
+
+func (methodNotFoundErr) Error() string  { return "the method eth_getBlockReceipts does not exist" }
+func (methodNotFoundErr) ErrorCode() int { return -32601 }
+
+var _ rpc.Error = methodNotFoundErr{}
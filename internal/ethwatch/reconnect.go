@@ -0,0 +1,73 @@
+package ethwatch
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// supervise держит источник голов живым: после обрыва ждёт с экспоненциальной
+// задержкой и джиттером, переподключается и снова запускает follow/poll,
+// которые сами догоняют пропущенные блоки.
+func (w *Watcher) supervise(ctx context.Context) error {
+	run := w.follow
+	if w.cfg.PollInterval > 0 {
+		run = w.poll
+	}
+
+	attempt := 0
+	for {
+		err := run(ctx, func() {
+			if attempt > 0 {
+				log.Printf("[WATCHER] reconnected after %d attempt(s)", attempt)
+			}
+			attempt = 0
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		attempt++
+		delay := backoffDelay(attempt, w.cfg.ReconnectMinDelay, w.cfg.ReconnectMaxDelay, rand.Int64N)
+		log.Printf("[WATCHER] connection lost: %v; reconnect attempt %d in %s", err, attempt, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := w.redial(ctx); err != nil {
+			log.Printf("[WATCHER] reconnect attempt %d failed: %v", attempt, err)
+		}
+	}
+}
+
+// redial просит клиента переподключиться, если он это умеет. Простой
+// ethclient.Client переподключает websocket сам на следующем вызове.
+func (w *Watcher) redial(ctx context.Context) error {
+	r, ok := w.client.(redialer)
+	if !ok {
+		return nil
+	}
+	return r.Redial(ctx)
+}
+
+// backoffDelay — min*2^(attempt-1), ограниченное max, со "equal jitter":
+// половина задержки фиксированная, половина случайная.
+func backoffDelay(attempt int, min, max time.Duration, randN func(int64) int64) time.Duration {
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(randN(int64(half)+1))
+}
@@ -0,0 +1,34 @@
+package ethwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	noJitter := func(int64) int64 { return 0 }
+	fullJitter := func(n int64) int64 { return n - 1 }
+
+	min, max := time.Second, 10*time.Second
+
+	cases := []struct {
+		attempt int
+		want    time.Duration // без джиттера — половина базовой задержки
+	}{
+		{attempt: 1, want: 500 * time.Millisecond},
+		{attempt: 2, want: time.Second},
+		{attempt: 3, want: 2 * time.Second},
+		{attempt: 4, want: 4 * time.Second},
+		{attempt: 5, want: 5 * time.Second}, // 16s обрезано до max
+		{attempt: 50, want: 5 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := backoffDelay(tc.attempt, min, max, noJitter); got != tc.want {
+			t.Fatalf("attempt %d: expected %s, got %s", tc.attempt, tc.want, got)
+		}
+	}
+
+	if got := backoffDelay(50, min, max, fullJitter); got != max {
+		t.Fatalf("expected full jitter to reach max %s, got %s", max, got)
+	}
+}
@@ -0,0 +1,75 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+
+	"github.com/pvzzle/scanblock/internal/contracts"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// noRevertReason — контракт откатился без данных (revert() или require без сообщения).
+const noRevertReason = "reverted without a reason"
+
+// RevertReason повторяет откатившуюся tx через eth_call на состоянии
+// родительского блока и расшифровывает причину отката (см. Selectors.DecodeRevert).
+// Tx, шедшие в блоке раньше, при повторе не учитываются, поэтому повтор может
+// и пройти — тогда причины нет. Цена газа в вызов не передаётся: на родителе
+// у отправителя могло не хватать на комиссию, а на исход вызова она не влияет.
+// "" — причину узнать не удалось.
+func RevertReason(ctx context.Context, c ethereum.ContractCaller, sel *contracts.Selectors, tx *types.Transaction, from common.Address, blockNum uint64) string {
+	if blockNum == 0 {
+		return ""
+	}
+	msg := ethereum.CallMsg{
+		From:       from,
+		To:         tx.To(),
+		Gas:        tx.Gas(),
+		Value:      tx.Value(),
+		Data:       tx.Data(),
+		AccessList: tx.AccessList(),
+	}
+	_, err := c.CallContract(ctx, msg, new(big.Int).SetUint64(blockNum-1))
+	if err == nil || ctx.Err() != nil {
+		return ""
+	}
+
+	var de rpc.DataError
+	if errors.As(err, &de) {
+		if s, ok := de.ErrorData().(string); ok {
+			if data, derr := hexutil.Decode(s); derr == nil {
+				if reason := sel.DecodeRevert(data); reason != "" {
+					return reason
+				}
+				return noRevertReason
+			}
+		}
+	}
+	// ответ ноды без данных: out of gas, invalid opcode, "execution reverted"...
+	var re rpc.Error
+	if errors.As(err, &re) {
+		if err.Error() == "execution reverted" {
+			return noRevertReason
+		}
+		return err.Error()
+	}
+
+	log.Printf("[watcher] replay tx %s at #%d error: %v", tx.Hash().Hex(), blockNum-1, err)
+	return ""
+}
+
+// revertReason — причина отката tx из блока; "" — tx не откатилась или причину
+// узнать не удалось.
+func (w *Watcher) revertReason(ctx context.Context, task TxTask, from common.Address, r *types.Receipt) string {
+	if r == nil || r.Status != types.ReceiptStatusFailed {
+		return ""
+	}
+	return RevertReason(ctx, w.client, w.selectors, task.Tx, from, task.BlockNum)
+}
@@ -0,0 +1,105 @@
+package ethwatch
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/blocksource/simchain"
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// reverterCode — init code контракта, который на любой вызов откатывается с Error(reason).
+func reverterCode(t *testing.T, reason string) []byte {
+	t.Helper()
+	typ, _ := abi.NewType("string", "", nil)
+	args, err := abi.Arguments{{Type: typ}}.Pack(reason)
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	data := append(crypto.Keccak256([]byte("Error(string)"))[:4], args...)
+
+	// CODECOPY(0, 13, len) REVERT(0, len) + сами данные revert
+	n := byte(len(data))
+	runtime := []byte{0x60, n, 0x60, 0x0d, 0x60, 0x00, 0x39, 0x60, n, 0x60, 0x00, 0xfd}
+	runtime = append(append(runtime, 0x00), data...)
+
+	init := []byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}
+	return append(init, runtime...)
+}
+
+func TestWatcher_processBlock_FailedTxWithRevertReason(t *testing.T) {
+	ctx := context.Background()
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	eth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	sim, err := simchain.New(types.GenesisAlloc{from: {Balance: eth}})
+	if err != nil {
+		t.Fatalf("simulated: %v", err)
+	}
+	defer sim.Close()
+
+	deploy, err := sim.Send(ctx, key, nil, nil, reverterCode(t, "nope"))
+	if err != nil {
+		t.Fatalf("send deploy: %v", err)
+	}
+	sim.Commit()
+	reverter := crypto.CreateAddress(from, deploy.Nonce())
+
+	// откат с причиной и нехватка газа (хватает только на intrinsic gas)
+	reverted, err := sim.SendWithGas(ctx, key, &reverter, nil, nil, 100_000)
+	if err != nil {
+		t.Fatalf("send reverted: %v", err)
+	}
+	outOfGas, err := sim.SendWithGas(ctx, key, &reverter, nil, nil, 21_000)
+	if err != nil {
+		t.Fatalf("send out of gas: %v", err)
+	}
+	sim.Commit()
+	block, err := sim.Client().BlockByNumber(ctx, big.NewInt(2))
+	if err != nil || len(block.Transactions()) != 2 {
+		t.Fatalf("expected block #2 with 2 txs, got %v %v", block, err)
+	}
+
+	store := subs.NewStore()
+	_ = store.SetWallet(ctx, 1, from)
+
+	repo := &mockRepo{}
+	notifyCh := make(chan bus.Notification, 8)
+	w := NewWatcher(sim.Client(), big.NewInt(1337), store, notifyCh, repo, contracts.NewSelectors(), WatcherConfig{})
+	w.startWorkers(ctx)
+	defer w.stopWorkers()
+
+	if err := w.processBlock(ctx, block); err != nil {
+		t.Fatalf("processBlock: %v", err)
+	}
+	if len(notifyCh) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifyCh))
+	}
+	for _, want := range []struct {
+		hash, reason string
+	}{
+		{reverted.Hash().Hex(), `"nope"`},
+		{outOfGas.Hash().Hex(), "out of gas"},
+	} {
+		n := <-notifyCh
+		if !contains(n.Text, "❌ Failed tx") || !contains(n.Text, want.hash) || !contains(n.Text, "Revert reason: "+want.reason) {
+			t.Fatalf("unexpected failed tx notification: %s", n.Text)
+		}
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, rec := range repo.upserts {
+		if rec.Hash == reverted.Hash().Hex() && (rec.RevertReason == nil || *rec.RevertReason != `"nope"`) {
+			t.Fatalf("expected revert reason in tx record, got %v", rec.RevertReason)
+		}
+	}
+}
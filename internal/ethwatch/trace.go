@@ -0,0 +1,245 @@
+package ethwatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Режимы трассировки внутренних переводов ETH.
+const (
+	TraceModeOff   = ""
+	TraceModeDebug = "debug" // debug_traceBlockByHash + callTracer (geth, erigon, reth)
+	TraceModeTrace = "trace" // trace_block (erigon, nethermind, reth)
+)
+
+// rawCaller — клиент, через который можно сделать произвольный JSON-RPC вызов.
+type rawCaller interface {
+	CallContext(ctx context.Context, result any, method string, args ...any) error
+}
+
+// InternalTransfer — перевод ETH внутри вызова контракта (не верхнеуровневый).
+type InternalTransfer struct {
+	TxHash common.Hash
+	From   common.Address
+	To     common.Address
+	Value  *big.Int
+	Type   string // CALL, CREATE, CREATE2, SELFDESTRUCT
+}
+
+// probeTrace проверяет на генезисе, что нода знает метод трассировки. Если нет —
+// трассировка выключается на всё время работы: иначе каждый блок падал бы на ней
+// и вставал в повтор. Прочие ошибки (генезис не трассируется, сбой сети) метод
+// не опровергают — режим остаётся включённым.
+func (w *Watcher) probeTrace(ctx context.Context) {
+	rc, ok := w.client.(rawCaller)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch w.cfg.TraceMode {
+	case TraceModeDebug:
+		genesis, herr := w.client.HeaderByNumber(ctx, big.NewInt(0))
+		if herr != nil {
+			log.Printf("[WATCHER] trace mode %q: genesis header error, skipping the probe: %v", w.cfg.TraceMode, herr)
+			return
+		}
+		var res json.RawMessage
+		err = rc.CallContext(ctx, &res, "debug_traceBlockByHash", genesis.Hash(),
+			map[string]any{"tracer": "callTracer"})
+	case TraceModeTrace:
+		var res json.RawMessage
+		err = rc.CallContext(ctx, &res, "trace_block", hexutil.EncodeUint64(0))
+	default:
+		return
+	}
+	if isMethodNotFound(err) {
+		log.Printf("[WATCHER] node does not support trace mode %q, internal transfers are disabled: %v", w.cfg.TraceMode, err)
+		w.cfg.TraceMode = TraceModeOff
+	}
+}
+
+// blockTrace — то, что watcher берёт из трассировки блока, по tx hash.
+type blockTrace struct {
+	Internal map[common.Hash][]InternalTransfer
+	// Created — контракты, созданные внутри tx (успешные фреймы CREATE/CREATE2)
+	Created map[common.Hash][]common.Address
+}
+
+// blockTraces трассирует блок: внутренние переводы и созданные контракты.
+func (w *Watcher) blockTraces(ctx context.Context, block *types.Block) (blockTrace, error) {
+	rc, ok := w.client.(rawCaller)
+	if !ok {
+		return blockTrace{}, fmt.Errorf("client does not support raw JSON-RPC calls")
+	}
+
+	switch w.cfg.TraceMode {
+	case TraceModeDebug:
+		var res []callTracerResult
+		err := rc.CallContext(ctx, &res, "debug_traceBlockByHash", block.Hash(),
+			map[string]any{"tracer": "callTracer"})
+		if err != nil {
+			return blockTrace{}, fmt.Errorf("debug_traceBlockByHash: %w", err)
+		}
+		return traceFromCallTracer(res, block.Transactions()), nil
+
+	case TraceModeTrace:
+		var res []parityTrace
+		if err := rc.CallContext(ctx, &res, "trace_block", hexutil.EncodeUint64(block.NumberU64())); err != nil {
+			return blockTrace{}, fmt.Errorf("trace_block: %w", err)
+		}
+		return traceFromParity(res, block.Hash()), nil
+	}
+	return blockTrace{}, nil
+}
+
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+type callTracerResult struct {
+	TxHash common.Hash `json:"txHash"`
+	Result callFrame   `json:"result"`
+}
+
+// traceFromCallTracer обходит дерево вызовов. Корень — сама tx, он уже
+// обрабатывается как верхнеуровневый перевод (и прямой деплой). Откатившиеся
+// поддеревья пропускаем.
+func traceFromCallTracer(res []callTracerResult, txs types.Transactions) blockTrace {
+	out := blockTrace{
+		Internal: make(map[common.Hash][]InternalTransfer),
+		Created:  make(map[common.Hash][]common.Address),
+	}
+	for i, r := range res {
+		hash := r.TxHash
+		// старые ноды не отдают txHash — порядок совпадает с транзакциями блока
+		if hash == (common.Hash{}) && i < len(txs) {
+			hash = txs[i].Hash()
+		}
+		if r.Result.Error != "" {
+			continue
+		}
+
+		var walk func(frames []callFrame)
+		walk = func(frames []callFrame) {
+			for _, f := range frames {
+				if f.Error != "" {
+					continue
+				}
+				typ := strings.ToUpper(f.Type)
+				if typ == "CREATE" || typ == "CREATE2" {
+					out.Created[hash] = append(out.Created[hash], f.To)
+				}
+				// DELEGATECALL/STATICCALL ETH не переводят
+				if typ != "DELEGATECALL" && typ != "STATICCALL" && f.Value != nil && f.Value.ToInt().Sign() > 0 {
+					out.Internal[hash] = append(out.Internal[hash], InternalTransfer{
+						TxHash: hash,
+						From:   f.From,
+						To:     f.To,
+						Value:  new(big.Int).Set(f.Value.ToInt()),
+						Type:   typ,
+					})
+				}
+				walk(f.Calls)
+			}
+		}
+		walk(r.Result.Calls)
+	}
+	return out
+}
+
+type parityTrace struct {
+	Type   string `json:"type"` // call, create, suicide, reward
+	Action struct {
+		CallType      string          `json:"callType"`
+		From          common.Address  `json:"from"`
+		To            common.Address  `json:"to"`
+		Value         *hexutil.Big    `json:"value"`
+		Address       common.Address  `json:"address"`
+		RefundAddress common.Address  `json:"refundAddress"`
+		Balance       *hexutil.Big    `json:"balance"`
+		Init          json.RawMessage `json:"init"`
+	} `json:"action"`
+	Result *struct {
+		Address common.Address `json:"address"`
+	} `json:"result"`
+	BlockHash       common.Hash  `json:"blockHash"`
+	TransactionHash *common.Hash `json:"transactionHash"`
+	TraceAddress    []int        `json:"traceAddress"`
+	Error           string       `json:"error"`
+}
+
+// traceFromParity разбирает плоский список trace_block. traceAddress пустой
+// у корня tx; поддеревья с ошибкой отбрасываются целиком.
+func traceFromParity(res []parityTrace, blockHash common.Hash) blockTrace {
+	out := blockTrace{
+		Internal: make(map[common.Hash][]InternalTransfer),
+		Created:  make(map[common.Hash][]common.Address),
+	}
+	failed := make(map[string]struct{}) // tx hash + traceAddress откатившихся вызовов
+
+	key := func(tx common.Hash, addr []int) string {
+		return fmt.Sprintf("%s/%v", tx.Hex(), addr)
+	}
+	underFailed := func(tx common.Hash, addr []int) bool {
+		for i := 0; i <= len(addr); i++ {
+			if _, ok := failed[key(tx, addr[:i])]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, t := range res {
+		if t.TransactionHash == nil || (t.BlockHash != (common.Hash{}) && t.BlockHash != blockHash) {
+			continue // награды за блок и чужие трейсы
+		}
+		tx := *t.TransactionHash
+
+		if t.Error != "" {
+			failed[key(tx, t.TraceAddress)] = struct{}{}
+			continue
+		}
+		if len(t.TraceAddress) == 0 || underFailed(tx, t.TraceAddress) {
+			continue
+		}
+
+		it := InternalTransfer{TxHash: tx}
+		switch t.Type {
+		case "call":
+			if t.Action.CallType == "delegatecall" || t.Action.CallType == "staticcall" {
+				continue
+			}
+			it.From, it.To, it.Value, it.Type = t.Action.From, t.Action.To, t.Action.Value.ToInt(), "CALL"
+		case "create":
+			if t.Result == nil {
+				continue
+			}
+			out.Created[tx] = append(out.Created[tx], t.Result.Address)
+			it.From, it.To, it.Value, it.Type = t.Action.From, t.Result.Address, t.Action.Value.ToInt(), "CREATE"
+		case "suicide":
+			it.From, it.To, it.Value, it.Type = t.Action.Address, t.Action.RefundAddress, t.Action.Balance.ToInt(), "SELFDESTRUCT"
+		default:
+			continue
+		}
+		if it.Value == nil || it.Value.Sign() <= 0 {
+			continue
+		}
+		it.Value = new(big.Int).Set(it.Value)
+		out.Internal[tx] = append(out.Internal[tx], it)
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package ethwatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestInternalFromCallTracer(t *testing.T) {
+	// multisig -> delegatecall в реализацию -> call с 1 ETH на кошелёк;
+	// второй перевод откатился вместе со своим фреймом
+	raw := `[{
+		"txHash": "0x00000000000000000000000000000000000000000000000000000000000000aa",
+		"result": {
+			"type": "CALL", "from": "0x0000000000000000000000000000000000000001",
+			"to": "0x0000000000000000000000000000000000000002", "value": "0x0",
+			"calls": [{
+				"type": "DELEGATECALL", "from": "0x0000000000000000000000000000000000000002",
+				"to": "0x0000000000000000000000000000000000000003", "value": "0x5",
+				"calls": [
+					{"type": "CALL", "from": "0x0000000000000000000000000000000000000002",
+					 "to": "0x00000000000000000000000000000000000000aa", "value": "0xde0b6b3a7640000"},
+					{"type": "CALL", "from": "0x0000000000000000000000000000000000000002",
+					 "to": "0x00000000000000000000000000000000000000bb", "value": "0x1", "error": "execution reverted"}
+				]
+			}]
+		}
+	}]`
+	var res []callTracerResult
+	if err := json.Unmarshal([]byte(raw), &res); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	got := traceFromCallTracer(res, nil).Internal
+	its := got[common.HexToHash("0xaa")]
+	if len(its) != 1 {
+		t.Fatalf("expected 1 internal transfer, got=%+v", got)
+	}
+	if its[0].To != common.HexToAddress("0xaa") || its[0].Value.String() != "1000000000000000000" || its[0].Type != "CALL" {
+		t.Fatalf("unexpected transfer: %+v", its[0])
+	}
+}
+
+func TestInternalFromParity(t *testing.T) {
+	raw := `[
+		{"type": "call", "action": {"callType": "call", "from": "0x0000000000000000000000000000000000000001",
+		 "to": "0x0000000000000000000000000000000000000002", "value": "0x0"},
+		 "transactionHash": "0x00000000000000000000000000000000000000000000000000000000000000aa", "traceAddress": []},
+		{"type": "call", "action": {"callType": "call", "from": "0x0000000000000000000000000000000000000002",
+		 "to": "0x00000000000000000000000000000000000000aa", "value": "0x10"},
+		 "transactionHash": "0x00000000000000000000000000000000000000000000000000000000000000aa", "traceAddress": [0]},
+		{"type": "call", "action": {"callType": "call", "from": "0x0000000000000000000000000000000000000002",
+		 "to": "0x0000000000000000000000000000000000000004", "value": "0x0"}, "error": "Reverted",
+		 "transactionHash": "0x00000000000000000000000000000000000000000000000000000000000000aa", "traceAddress": [1]},
+		{"type": "call", "action": {"callType": "call", "from": "0x0000000000000000000000000000000000000004",
+		 "to": "0x00000000000000000000000000000000000000bb", "value": "0x20"},
+		 "transactionHash": "0x00000000000000000000000000000000000000000000000000000000000000aa", "traceAddress": [1, 0]},
+		{"type": "call", "action": {"callType": "staticcall", "from": "0x0000000000000000000000000000000000000002",
+		 "to": "0x00000000000000000000000000000000000000cc", "value": "0x30"},
+		 "transactionHash": "0x00000000000000000000000000000000000000000000000000000000000000aa", "traceAddress": [2]},
+		{"type": "reward", "action": {"author": "0x00000000000000000000000000000000000000dd", "value": "0x1"}, "traceAddress": []}
+	]`
+	var res []parityTrace
+	if err := json.Unmarshal([]byte(raw), &res); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	got := traceFromParity(res, common.Hash{}).Internal
+	its := got[common.HexToHash("0xaa")]
+	if len(its) != 1 || its[0].To != common.HexToAddress("0xaa") || its[0].Value.Int64() != 16 {
+		t.Fatalf("expected only the successful internal call, got=%+v", got)
+	}
+}
+
+func TestTraceFromCallTracer_Created(t *testing.T) {
+	// фабрика создала клон через CREATE2 без value; второй CREATE откатился
+	raw := `[{
+		"txHash": "0x00000000000000000000000000000000000000000000000000000000000000aa",
+		"result": {
+			"type": "CALL", "from": "0x0000000000000000000000000000000000000001",
+			"to": "0x0000000000000000000000000000000000000002", "value": "0x0",
+			"calls": [
+				{"type": "CREATE2", "from": "0x0000000000000000000000000000000000000002",
+				 "to": "0x00000000000000000000000000000000000000c1", "value": "0x0"},
+				{"type": "CREATE", "from": "0x0000000000000000000000000000000000000002",
+				 "to": "0x00000000000000000000000000000000000000c2", "value": "0x0", "error": "out of gas"}
+			]
+		}
+	}]`
+	var res []callTracerResult
+	if err := json.Unmarshal([]byte(raw), &res); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	got := traceFromCallTracer(res, nil)
+	created := got.Created[common.HexToHash("0xaa")]
+	if len(created) != 1 || created[0] != common.HexToAddress("0xc1") {
+		t.Fatalf("expected only the successful CREATE2, got=%v", got.Created)
+	}
+	if len(got.Internal) != 0 {
+		t.Fatalf("expected no value transfers, got=%+v", got.Internal)
+	}
+}
+
+func TestWatcher_handleTask_InternalTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	router := common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D")
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &router, Gas: 200000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, wallet)
+
+	notifyCh := make(chan bus.Notification, 4)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   &fakeClient{},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		repo:     repo,
+	}
+
+	task := TxTask{
+		Tx:       tx,
+		BlockNum: 10,
+		Internal: []InternalTransfer{{TxHash: tx.Hash(), From: router, To: wallet, Value: big.NewInt(1e18), Type: "CALL"}},
+	}
+
+	if chats := w.handleTask(ctx, signer, task); len(chats) != 1 || chats[0] != 5 {
+		t.Fatalf("expected wallet chat notified, got=%v", chats)
+	}
+	n := <-notifyCh
+	if !contains(n.Text, "internal transfer (CALL inside tx)") || !contains(n.Text, "Value: 1.000000 ETH") || !contains(n.Text, "From: "+router.Hex()) {
+		t.Fatalf("unexpected notification: %s", n.Text)
+	}
+	if len(repo.upserts) != 1 {
+		t.Fatalf("expected tx to be persisted, got=%d", len(repo.upserts))
+	}
+}
+
+// traceClient — fakeClient с сырыми JSON-RPC вызовами; err — ответ на любой из них.
+type traceClient struct {
+	*fakeClient
+	err error
+}
+
+func (c *traceClient) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	return c.err
+}
+
+func TestWatcher_probeTrace_DisablesUnsupportedMode(t *testing.T) {
+	ctx := context.Background()
+
+	w := &Watcher{client: &traceClient{fakeClient: &fakeClient{}, err: methodNotFoundErr{}}, cfg: WatcherConfig{TraceMode: TraceModeTrace}}
+	w.probeTrace(ctx)
+	if w.cfg.TraceMode != TraceModeOff {
+		t.Fatalf("expected trace mode to be disabled, got %q", w.cfg.TraceMode)
+	}
+
+	// ошибка на генезисе — метод есть, режим остаётся
+	w = &Watcher{client: &traceClient{fakeClient: &fakeClient{}, err: errors.New("genesis is not traceable")}, cfg: WatcherConfig{TraceMode: TraceModeTrace}}
+	w.probeTrace(ctx)
+	if w.cfg.TraceMode != TraceModeTrace {
+		t.Fatalf("expected trace mode to stay, got %q", w.cfg.TraceMode)
+	}
+}
+
+func TestWatcher_processBlock_TraceErrorKeepsCheckpoint(t *testing.T) {
+	ctx := context.Background()
+
+	store := subs.NewStore()
+	_ = store.SetWallet(ctx, 1, common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+
+	cl := &traceClient{fakeClient: &fakeClient{}, err: errors.New("request timed out")}
+	repo := &mockRepo{}
+	w := NewWatcher(cl, big.NewInt(1), store, make(chan bus.Notification, 1), repo, nil, WatcherConfig{TraceMode: TraceModeTrace})
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(100)}).
+		WithBody(types.Body{Transactions: []*types.Transaction{types.NewTx(&types.LegacyTx{})}})
+	if err := w.processBlock(ctx, block); err == nil {
+		t.Fatalf("expected error when the block cannot be traced")
+	}
+	if len(repo.saved) != 0 || w.lastBlock != nil {
+		t.Fatalf("expected block to stay unprocessed, saved=%+v", repo.saved)
+	}
+}
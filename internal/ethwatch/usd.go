@@ -0,0 +1,82 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+
+	"github.com/pvzzle/scanblock/internal/prices"
+	"github.com/pvzzle/scanblock/internal/tokens"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// nativeDecimals — знаков после запятой у нативных валют EVM-сетей.
+const nativeDecimals = 18
+
+// blockArg — блок для eth_call к агрегатору; 0 (pending tx) — последний.
+func blockArg(num uint64) *big.Int {
+	if num == 0 {
+		return nil
+	}
+	return new(big.Int).SetUint64(num)
+}
+
+// nativeUSD — сумма в нативной валюте в центах USD по цене на блоке; nil, если
+// агрегатора нет или он не ответил.
+func (w *Watcher) nativeUSD(ctx context.Context, blockNum uint64, wei *big.Int) *big.Int {
+	if !w.cfg.Prices.HasNative() || wei == nil || wei.Sign() == 0 {
+		return nil
+	}
+	p, err := w.cfg.Prices.Native(ctx, blockArg(blockNum))
+	if err != nil {
+		log.Printf("[watcher] native price at #%d error: %v", blockNum, err)
+		return nil
+	}
+	return p.Cents(wei, nativeDecimals)
+}
+
+// tokenUSD — ERC-20 перевод в центах USD по цене на блоке; nil для токенов без
+// агрегатора и NFT.
+func (w *Watcher) tokenUSD(ctx context.Context, blockNum uint64, t tokens.Transfer) *big.Int {
+	if w.cfg.Prices == nil || t.Standard != tokens.ERC20 {
+		return nil
+	}
+	p, err := w.cfg.Prices.Token(ctx, t.Token, blockArg(blockNum))
+	if errors.Is(err, prices.ErrNoFeed) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("[watcher] token %s price at #%d error: %v", t.Token.Hex(), blockNum, err)
+		return nil
+	}
+	info, err := w.tokens.Lookup(ctx, t.Token)
+	if err != nil {
+		return nil
+	}
+	return p.Cents(t.Amount, info.Decimals)
+}
+
+// refreshNativePrice обновляет цену, по которой сравниваются пороги в USD, —
+// на каждом блоке, пока такие пороги есть.
+func (w *Watcher) refreshNativePrice(ctx context.Context, block *types.Block) {
+	if !w.cfg.Prices.HasNative() || !w.subStore.WantsNativePrice() {
+		return
+	}
+	p, err := w.cfg.Prices.Native(ctx, block.Number())
+	if err != nil {
+		log.Printf("[watcher] native price at #%d error: %v", block.NumberU64(), err)
+		return
+	}
+	w.subStore.SetNativePrice(p)
+}
+
+// usdString — центы для записи в БД; nil, если оценки нет.
+func usdString(cents *big.Int) *string {
+	if cents == nil {
+		return nil
+	}
+	s := prices.CentsString(cents)
+	return &s
+}
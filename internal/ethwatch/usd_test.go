@@ -0,0 +1,108 @@
+package ethwatch
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/prices"
+	"github.com/pvzzle/scanblock/internal/subs"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// feedCaller — Chainlink-агрегатор с 8 знаками и ценой по номеру блока.
+type feedCaller struct {
+	answers map[uint64]int64
+}
+
+func (f *feedCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	uint8T, _ := abi.NewType("uint8", "", nil)
+	uint80T, _ := abi.NewType("uint80", "", nil)
+	int256T, _ := abi.NewType("int256", "", nil)
+	uint256T, _ := abi.NewType("uint256", "", nil)
+
+	switch common.Bytes2Hex(msg.Data) {
+	case common.Bytes2Hex(crypto.Keccak256([]byte("decimals()"))[:4]):
+		return abi.Arguments{{Type: uint8T}}.Pack(uint8(8))
+	case common.Bytes2Hex(crypto.Keccak256([]byte("latestRoundData()"))[:4]):
+		if blockNumber == nil {
+			return nil, errors.New("expected price at the tx block")
+		}
+		answer, ok := f.answers[blockNumber.Uint64()]
+		if !ok {
+			return nil, errors.New("missing trie node")
+		}
+		return abi.Arguments{{Type: uint80T}, {Type: int256T}, {Type: uint256T}, {Type: uint256T}, {Type: uint80T}}.
+			Pack(big.NewInt(1), big.NewInt(answer), big.NewInt(0), big.NewInt(0), big.NewInt(1))
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func TestWatcher_handleTask_USDThreshold(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	to := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &to, Value: oneEth, Gas: 21000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	chatID := int64(5)
+	_ = subStore.SetLargeTxMinUSD(ctx, chatID, big.NewInt(2500_00)) // $2500
+
+	feed := common.HexToAddress("0x5f4eC3Df9cbd43714FE2740F5E3616155c5b8419")
+	notifyCh := make(chan bus.Notification, 1)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   &fakeClient{receipts: map[common.Hash]*types.Receipt{}},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		repo:     repo,
+		cfg: WatcherConfig{Prices: prices.NewOracle(&feedCaller{answers: map[uint64]int64{
+			100: 2000_00000000,
+			101: 3000_00000000,
+		}}, prices.Feeds{Native: feed})},
+	}
+
+	// $2000 за ETH: 1 ETH не дотягивает до $2500
+	w.refreshNativePrice(ctx, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(100)}))
+	if chats := w.handleTask(ctx, signer, TxTask{Tx: tx, BlockNum: 100, BlockTime: uint64(time.Now().Unix())}); len(chats) != 0 {
+		t.Fatalf("expected no notification at $2000, got %v", chats)
+	}
+
+	// цена выросла — тот же порог срабатывает
+	w.refreshNativePrice(ctx, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(101)}))
+	w.handleTask(ctx, signer, TxTask{Tx: tx, BlockNum: 101, BlockTime: uint64(time.Now().Unix())})
+
+	select {
+	case n := <-notifyCh:
+		if !contains(n.Text, "Value: 1.000000 ETH (~$3,000.00)") {
+			t.Fatalf("expected USD value in text: %s", n.Text)
+		}
+	default:
+		t.Fatal("expected notification at $3000")
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if got := repo.upserts[0].ValueUSD; got == nil || *got != "3000.00" {
+		t.Fatalf("expected value_usd stored, got %v", got)
+	}
+}
@@ -6,30 +6,155 @@ import (
 	"log"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/chains"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/prices"
 	"github.com/pvzzle/scanblock/internal/storage"
 	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type WatcherConfig struct {
 	Workers     int
 	TasksBuffer int
+
+	// BackfillMaxDepth — сколько блоков максимум догонять после простоя
+	BackfillMaxDepth uint64
+
+	// ReorgDepth — сколько последних блоков помним для поиска точки форка
+	ReorgDepth int
+
+	// PollInterval > 0 включает режим опроса eth_blockNumber вместо подписки
+	// на новые головы (для HTTP-only RPC)
+	PollInterval time.Duration
+
+	ReconnectMinDelay time.Duration
+	ReconnectMaxDelay time.Duration
+
+	// TraceMode включает поиск внутренних переводов ETH (TraceModeDebug/TraceModeTrace)
+	TraceMode string
+
+	// Mempool включает уведомления о pending tx (нужна подписка newPendingTransactions)
+	Mempool bool
+	// PendingDropAfter — через сколько не попавшая в блок pending tx считается выпавшей
+	PendingDropAfter time.Duration
+	// PendingStuckAfter — через сколько исходящая pending tx считается зависшей
+	// (предупреждение владельцу кошелька); имеет смысл меньше PendingDropAfter
+	PendingStuckAfter time.Duration
+
+	// Network — имя сети и нативная валюта для текста уведомлений
+	Network chains.Network
+
+	// Names — ENS-имена адресов для текста уведомлений (nil — без имён)
+	Names NameResolver
+
+	// Prices — цены Chainlink для USD в уведомлениях и порогов в USD (nil — без USD)
+	Prices *prices.Oracle
+}
+
+// NameResolver — основные ENS-имена адресов, только найденные (ens.Resolver).
+type NameResolver interface {
+	Names(ctx context.Context, addrs ...common.Address) map[common.Address]string
 }
 
 type TxTask struct {
 	Tx        *types.Transaction
 	BlockNum  uint64
 	BlockTime uint64
+	BaseFee   *big.Int // base fee блока; nil до London
+	Index     int      // позиция tx в блоке
+
+	// Transfers — ERC-20 переводы внутри tx (заполняются, только если на них есть подписки)
+	Transfers []tokens.Transfer
+
+	// Internal — переводы ETH внутри вызовов (заполняются в режиме трассировки)
+	Internal []InternalTransfer
+
+	// Created — контракты, созданные внутри вызовов (по трассировке); Traced —
+	// блок трассировали, и Created полон, даже если пуст
+	Created []common.Address
+	Traced  bool
+
+	// Logs — логи отслеживаемых контрактов (заполняются, только если на них есть подписки)
+	Logs []*types.Log
+
+	run *blockRun // nil, если задача не привязана к обработке блока
+}
+
+// blockRun собирает результаты обработки транзакций одного блока воркерами.
+type blockRun struct {
+	hash    common.Hash
+	pending sync.WaitGroup
+
+	mu       sync.Mutex
+	notified map[common.Hash][]int64
+
+	// outbox — уведомления по позиции tx в блоке; уходят после обработки всего
+	// блока, чтобы чат получал их в порядке tx, а не в порядке работы воркеров
+	outbox [][]heldNotification
+
+	// receipts блока грузятся один раз, когда они впервые понадобились воркеру
+	receiptsOnce sync.Once
+	receipts     map[common.Hash]*types.Receipt
+}
+
+func (r *blockRun) finish(hash common.Hash, chats []int64) {
+	if len(chats) > 0 {
+		r.mu.Lock()
+		r.notified[hash] = chats
+		r.mu.Unlock()
+	}
+	r.pending.Done()
+}
+
+func (r *blockRun) queue(index int, notes []heldNotification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outbox[index] = notes
+}
+
+// ChainClient — то, что watcher'у нужно от RPC (ethclient.Client, rpcpool.Pool
+// или запись цепочки blocksource.Replay).
+type ChainClient interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// redialer — клиент, который умеет переподключаться сам (rpcpool.Pool).
+type redialer interface {
+	Redial(ctx context.Context) error
+}
+
+// stateReader — клиент, который читает состояние аккаунтов: eth_getCode и
+// eth_getTransactionCount (rpcpool.Pool, ethclient.Client; у записи цепочки нет).
+type stateReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+// blockConfirmer — клиент, который может подтвердить блок кворумом эндпоинтов.
+type blockConfirmer interface {
+	ConfirmBlock(ctx context.Context, num uint64, hash common.Hash) (bool, error)
 }
 
 type Watcher struct {
-	client  *ethclient.Client
+	client  ChainClient
 	chainID *big.Int
 
 	subStore *subs.Store
@@ -40,15 +165,46 @@ type Watcher struct {
 	tasks chan TxTask
 	wg    sync.WaitGroup
 
+	// blockReceiptsUnsupported — нода не знает eth_getBlockReceipts, берём receipts по одному
+	blockReceiptsUnsupported atomic.Bool
+
+	// lastBlock — последний полностью обработанный блок (nil до первого блока)
+	lastBlock *uint64
+	chain     *chainTracker
+
+	// tokens — decimals/symbol токенов для текста уведомлений
+	tokens *tokens.Registry
+
+	// mempool — pending tx, о которых уже ушли уведомления
+	mempool *mempoolTracker
+
+	// selectors — база сигнатур для разбора calldata (nil — не разбираем)
+	selectors *contracts.Selectors
+
+	// held — уведомления чатов с уровнем выше latest, ждущие глубины блока
+	held *heldQueue
+	// tagFallback — уровни, для которых нода не отдаёт тег safe/finalized
+	// (считаем по глубине, см. taggedBlock)
+	tagFallback map[subs.LevelKind]bool
+
+	// gas — медиана чаевых и состояние газовых алертов
+	gas *gasTracker
+
+	// head — последняя известная голова сети. Блоки ниже неё — догонялка после
+	// старта или переподключения: по ним не шлём газовых алертов и не ищем
+	// зависшие tx, всё это про прошлое
+	head uint64
+
 	repo storage.Repository
 }
 
 func NewWatcher(
-	client *ethclient.Client,
+	client ChainClient,
 	chainID *big.Int,
 	subStore *subs.Store,
 	notifyCh chan<- bus.Notification,
 	repo storage.Repository,
+	selectors *contracts.Selectors,
 	cfg WatcherConfig,
 ) *Watcher {
 
@@ -60,6 +216,30 @@ func NewWatcher(
 		cfg.TasksBuffer = 1024
 	}
 
+	if cfg.BackfillMaxDepth == 0 {
+		cfg.BackfillMaxDepth = 1000
+	}
+
+	if cfg.ReorgDepth <= 0 {
+		cfg.ReorgDepth = 64
+	}
+
+	if cfg.ReconnectMinDelay <= 0 {
+		cfg.ReconnectMinDelay = time.Second
+	}
+
+	if cfg.ReconnectMaxDelay < cfg.ReconnectMinDelay {
+		cfg.ReconnectMaxDelay = time.Minute
+	}
+
+	if cfg.PendingDropAfter <= 0 {
+		cfg.PendingDropAfter = 30 * time.Minute
+	}
+
+	if cfg.PendingStuckAfter <= 0 {
+		cfg.PendingStuckAfter = 10 * time.Minute
+	}
+
 	return &Watcher{
 		client:   client,
 		chainID:  chainID,
@@ -67,14 +247,50 @@ func NewWatcher(
 		notifyCh: notifyCh,
 		cfg:      cfg,
 		tasks:    make(chan TxTask, cfg.TasksBuffer),
+		chain:    newChainTracker(cfg.ReorgDepth),
+		tokens:   tokens.NewRegistry(client),
+		mempool:  newMempoolTracker(),
+		held:     newHeldQueue(),
+		gas:      newGasTracker(GasPriorityWindow),
 		repo:     repo,
+
+		selectors: selectors,
 	}
 }
 
 func (w *Watcher) Start(ctx context.Context) error {
+	if w.cfg.TraceMode != TraceModeOff {
+		if _, ok := w.client.(rawCaller); !ok {
+			return fmt.Errorf("trace mode %q needs a client with raw JSON-RPC calls", w.cfg.TraceMode)
+		}
+		w.probeTrace(ctx)
+	}
+
+	if w.cfg.Mempool {
+		if _, ok := w.client.(pendingSubscriber); !ok {
+			return fmt.Errorf("mempool mode needs a client with pending tx subscription")
+		}
+	}
+
 	w.startWorkers(ctx)
 	defer w.stopWorkers()
 
+	if err := w.loadCheckpoint(ctx); err != nil {
+		return err
+	}
+	w.restoreHeld(ctx)
+
+	if w.cfg.Mempool {
+		w.restorePending(ctx)
+		go w.watchMempool(ctx)
+	}
+
+	return w.supervise(ctx)
+}
+
+// follow подписывается на новые головы, догоняет пропущенные блоки и обрабатывает
+// поток до первой ошибки подписки. onSubscribed вызывается после успешной подписки.
+func (w *Watcher) follow(ctx context.Context, onSubscribed func()) error {
 	headers := make(chan *types.Header, 128)
 
 	sub, err := w.client.SubscribeNewHead(ctx, headers)
@@ -82,6 +298,16 @@ func (w *Watcher) Start(ctx context.Context) error {
 		return fmt.Errorf("SubscribeNewHead: %w", err)
 	}
 	defer sub.Unsubscribe()
+	onSubscribed()
+
+	// блоки, вышедшие пока нас не было (старт/переподключение)
+	head, err := w.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("head header: %w", err)
+	}
+	if err := w.catchUp(ctx, head.Number.Uint64(), head.Hash()); err != nil {
+		return fmt.Errorf("backfill to #%d: %w", head.Number.Uint64(), err)
+	}
 
 	for {
 		select {
@@ -96,27 +322,212 @@ func (w *Watcher) Start(ctx context.Context) error {
 				continue
 			}
 
-			block, err := w.client.BlockByHash(ctx, h.Hash())
-			if err != nil {
-				log.Printf("[WATCHER] block fetch error: %v", err)
-				continue
+			if err := w.catchUp(ctx, h.Number.Uint64(), h.Hash()); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("[WATCHER] catch up to #%d error: %v", h.Number.Uint64(), err)
 			}
+		}
+	}
+}
 
-			for _, tx := range block.Transactions() {
-				task := TxTask{
-					Tx:        tx,
-					BlockNum:  block.NumberU64(),
-					BlockTime: block.Time(),
-				}
+// loadCheckpoint подтягивает последний обработанный блок, чтобы после простоя
+// догнать пропущенное.
+func (w *Watcher) loadCheckpoint(ctx context.Context) error {
+	cp, err := w.repo.GetCheckpoint(ctx, w.chainID.String())
+	if err != nil {
+		return fmt.Errorf("get checkpoint: %w", err)
+	}
+	if cp == nil {
+		log.Printf("[WATCHER] no checkpoint for chain %s, starting from live head", w.chainID.String())
+		return nil
+	}
+	last := cp.BlockNum
+	w.lastBlock = &last
+	w.chain.push(trackedBlock{Num: cp.BlockNum, Hash: common.HexToHash(cp.BlockHash)})
 
-				select {
-				case w.tasks <- task:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
+	log.Printf("[WATCHER] resuming after #%d", cp.BlockNum)
+	return nil
+}
+
+// catchUp обрабатывает все блоки после последнего обработанного вплоть до головы.
+// headHash может быть пустым (режим опроса) — тогда голова берётся по номеру.
+// Если разрыв больше BackfillMaxDepth, самые старые блоки пропускаются.
+func (w *Watcher) catchUp(ctx context.Context, headNum uint64, headHash common.Hash) error {
+	// голова не выше уже обработанного: либо дубль, либо реорг на той же/меньшей высоте
+	if w.lastBlock != nil && headNum <= *w.lastBlock {
+		if headHash == (common.Hash{}) {
+			return nil
+		}
+		known, ok := w.chain.hashAt(headNum)
+		if !ok || known == headHash {
+			return nil
+		}
+		block, err := w.client.BlockByHash(ctx, headHash)
+		if err != nil {
+			return fmt.Errorf("block #%d fetch: %w", headNum, err)
+		}
+		return w.applyBlock(ctx, block)
+	}
+
+	if headNum > w.head {
+		w.head = headNum
+	}
+
+	from, skipped := backfillRange(w.lastBlock, headNum, w.cfg.BackfillMaxDepth)
+	if skipped > 0 {
+		log.Printf("[WATCHER] gap of %d blocks exceeds max backfill depth %d, skipping #%d..#%d",
+			skipped+w.cfg.BackfillMaxDepth, w.cfg.BackfillMaxDepth, from-skipped, from-1)
+	}
+
+	for n := from; n <= headNum; n++ {
+		var (
+			block *types.Block
+			err   error
+		)
+		if n == headNum && headHash != (common.Hash{}) {
+			block, err = w.client.BlockByHash(ctx, headHash)
+		} else {
+			block, err = w.client.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		}
+		if err != nil {
+			return fmt.Errorf("block #%d fetch: %w", n, err)
+		}
+
+		if err := w.applyBlock(ctx, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillRange возвращает первый блок, который нужно обработать, и сколько
+// блоков пропущено из-за ограничения глубины. Если from > head — догонять нечего.
+func backfillRange(last *uint64, head uint64, maxDepth uint64) (from uint64, skipped uint64) {
+	if last == nil {
+		return head, 0
+	}
+	from = *last + 1
+	if from > head {
+		return from, 0
+	}
+	if gap := head - from + 1; gap > maxDepth {
+		skipped = gap - maxDepth
+		from += skipped
+	}
+	return from, skipped
+}
+
+// processBlock раздаёт транзакции блока воркерам, дожидается их обработки
+// и только после этого двигает чекпоинт.
+func (w *Watcher) processBlock(ctx context.Context, block *types.Block) error {
+	run := &blockRun{
+		hash:     block.Hash(),
+		notified: make(map[common.Hash][]int64),
+		outbox:   make([][]heldNotification, len(block.Transactions())),
+	}
+
+	w.refreshNativePrice(ctx, block)
+
+	// без логов блок не обрабатываем: чекпоинт остаётся на месте, и catchUp
+	// возьмёт блок снова со следующей головой
+	var transfers map[common.Hash][]tokens.Transfer
+	if w.subStore.WantsTokenTransfers() && len(block.Transactions()) > 0 {
+		var err error
+		if transfers, err = w.blockTransfers(ctx, run); err != nil {
+			return fmt.Errorf("block #%d token transfers: %w", block.NumberU64(), err)
+		}
+	}
+
+	var contractLogs map[common.Hash][]*types.Log
+	if addrs := w.subStore.ContractAddresses(); len(addrs) > 0 && len(block.Transactions()) > 0 {
+		var err error
+		if contractLogs, err = w.blockContractLogs(ctx, run, addrs); err != nil {
+			return fmt.Errorf("block #%d contract logs: %w", block.NumberU64(), err)
+		}
+	}
+
+	var (
+		trace  blockTrace
+		traced bool
+	)
+	if w.cfg.TraceMode != TraceModeOff && w.subStore.WantsValueTransfers() && len(block.Transactions()) > 0 {
+		var err error
+		if trace, err = w.blockTraces(ctx, block); err != nil {
+			return fmt.Errorf("block #%d internal transfers: %w", block.NumberU64(), err)
+		}
+		traced = true
+	}
+
+	for i, tx := range block.Transactions() {
+		run.pending.Add(1)
+		task := TxTask{
+			Tx:        tx,
+			BlockNum:  block.NumberU64(),
+			BlockTime: block.Time(),
+			BaseFee:   block.BaseFee(),
+			Index:     i,
+			Transfers: transfers[tx.Hash()],
+			Internal:  trace.Internal[tx.Hash()],
+			Created:   trace.Created[tx.Hash()],
+			Traced:    traced,
+			Logs:      contractLogs[tx.Hash()],
+			run:       run,
+		}
+
+		select {
+		case w.tasks <- task:
+		case <-ctx.Done():
+			run.pending.Done()
+			return ctx.Err()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		run.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, notes := range run.outbox {
+		for _, n := range notes {
+			if !w.deliver(ctx, n) {
+				return ctx.Err()
 			}
 		}
 	}
+
+	num := block.NumberU64()
+	w.lastBlock = &num
+	w.chain.push(trackedBlock{Num: num, Hash: block.Hash(), Notified: run.notified})
+
+	cp := storage.Checkpoint{
+		ChainID:   w.chainID.String(),
+		BlockNum:  num,
+		BlockHash: block.Hash().Hex(),
+	}
+	if err := w.repo.SaveCheckpoint(ctx, cp); err != nil {
+		log.Printf("[watcher] save checkpoint #%d error: %v", num, err)
+	}
+
+	live := num >= w.head
+	w.releaseHeld(ctx, num)
+	w.checkGas(ctx, block, live)
+
+	// на догонялке зависшими выглядят все восстановленные tx, а nonce на старом
+	// блоке не знает, что их уже смайнили
+	if w.cfg.Mempool && live {
+		w.checkStuck(ctx, block)
+		w.expirePending(ctx)
+	}
+	return nil
 }
 
 func (w *Watcher) startWorkers(ctx context.Context) {
@@ -136,7 +547,10 @@ func (w *Watcher) startWorkers(ctx context.Context) {
 					if !ok {
 						return
 					}
-					w.handleTask(ctx, signer, task)
+					chats := w.handleTask(ctx, signer, task)
+					if task.run != nil {
+						task.run.finish(task.Tx.Hash(), chats)
+					}
 				}
 			}
 		}(i)
@@ -148,13 +562,14 @@ func (w *Watcher) stopWorkers() {
 	w.wg.Wait()
 }
 
-func (w *Watcher) handleTask(ctx context.Context, signer types.Signer, task TxTask) {
+// handleTask возвращает чаты, которым ушло уведомление.
+func (w *Watcher) handleTask(ctx context.Context, signer types.Signer, task TxTask) []int64 {
 	tx := task.Tx
 
 	from, err := types.Sender(signer, tx)
 	if err != nil {
 		// Во избежание так называемых legacy edge cases.
-		return
+		return nil
 	}
 
 	var to *common.Address = tx.To()
@@ -164,57 +579,327 @@ func (w *Watcher) handleTask(ctx context.Context, signer types.Signer, task TxTa
 	}
 
 	recipients := w.subStore.MatchTx(from, to, val)
-	if len(recipients) == 0 {
-		return
+
+	// tx из мемпула: чатам, получившим "pending", уходит подтверждение вместо
+	// обычного уведомления; другая tx с тем же nonce — значит, старую заменили
+	confirmed, replaced := w.mempool.mined(tx.Hash(), from, tx.Nonce())
+	if replaced != nil {
+		hash := tx.Hash()
+		w.notifyPendingGone(ctx, replaced, &Replacement{Hash: &hash, Kind: replacementKind(replaced, tx, from), Nonce: tx.Nonce()})
+	}
+	var confirmedChats []int64
+	if confirmed != nil {
+		confirmedChats = confirmed.Chats
+		recipients = withoutChats(recipients, confirmedChats)
 	}
 
-	// 1) сохраняем саму транзакцию
-	var toStr *string
-	if to != nil {
-		x := to.Hex()
-		toStr = &x
+	type matchedTransfer struct {
+		transfer tokens.Transfer
+		chats    []int64
+		usd      *big.Int // центы; nil — без оценки
+	}
+	var matched []matchedTransfer
+	for _, t := range task.Transfers {
+		var chats []int64
+		if t.Standard == tokens.ERC20 {
+			chats = w.subStore.MatchTokenTransfer(t.Token, t.From, t.To, t.Amount)
+		} else {
+			// NFT сверяем только с отслеживаемыми кошельками
+			chats = w.subStore.MatchWallet(t.From, t.To)
+		}
+		if len(chats) > 0 {
+			matched = append(matched, matchedTransfer{transfer: t, chats: chats})
+		}
 	}
-	var bt = time.Unix(int64(task.BlockTime), 0).UTC()
-	blockTime := &bt
-	blockNum := &task.BlockNum
 
-	var gasPriceWei *string
-	if gp := tx.GasPrice(); gp != nil {
-		s := gp.String()
-		gasPriceWei = &s
+	type matchedInternal struct {
+		transfer InternalTransfer
+		chats    []int64
+	}
+	var internal []matchedInternal
+	for _, it := range task.Internal {
+		to := it.To
+		if chats := w.subStore.MatchTx(it.From, &to, it.Value); len(chats) > 0 {
+			internal = append(internal, matchedInternal{transfer: it, chats: chats})
+		}
 	}
 
-	txRec := storage.TxRecord{
-		Hash:        tx.Hash().Hex(),
-		ChainID:     w.chainID.String(),
-		BlockNum:    blockNum,
-		BlockTime:   blockTime,
-		FromAddr:    from.Hex(),
-		ToAddr:      toStr,
-		ValueWei:    val.String(),
-		Nonce:       tx.Nonce(),
-		TxType:      tx.Type(),
-		Gas:         tx.Gas(),
-		GasPriceWei: gasPriceWei,
-		// Status неизвестен без receipt (можно расширить при желании)
-		Status: nil,
+	type matchedEvent struct {
+		text  string
+		chats []int64
+	}
+	var events []matchedEvent
+	for _, l := range task.Logs {
+		// у разных чатов может быть свой ABI одного контракта — декодируем по каждому
+		byText := make(map[string]int)
+		for _, m := range w.subStore.MatchContractLog(l) {
+			var text string
+			if m.ABI == nil {
+				text = FormatContractLogNotification(l, task.BlockNum, task.BlockTime)
+			} else {
+				ev, err := contracts.Decode(m.ABI, l)
+				if err != nil {
+					log.Printf("[watcher] decode log %s#%d for chat %d error: %v", l.TxHash.Hex(), l.Index, m.ChatID, err)
+					continue
+				}
+				text = FormatContractEventNotification(ev, task.BlockNum, task.BlockTime)
+			}
+			if i, ok := byText[text]; ok {
+				events[i].chats = append(events[i].chats, m.ChatID)
+				continue
+			}
+			byText[text] = len(events)
+			events = append(events, matchedEvent{text: text, chats: []int64{m.ChatID}})
+		}
+	}
+
+	if len(recipients) == 0 && len(confirmedChats) == 0 && len(matched) == 0 && len(internal) == 0 && len(events) == 0 {
+		return nil
 	}
 
+	// 1) сохраняем саму транзакцию и совпавшие переводы токенов
+	receipt := w.receiptFor(ctx, task)
+	txRec := w.txRecord(task, from, receipt)
+	valueUSD := w.nativeUSD(ctx, task.BlockNum, val)
+	txRec.ValueUSD = usdString(valueUSD)
+
+	revert := w.revertReason(ctx, task, from, receipt)
+	if revert != "" {
+		txRec.RevertReason = &revert
+	}
+
+	// созданные контракты ищем, только если о самой tx кто-то узнает
+	var deployed []common.Address
+	if len(recipients) > 0 || len(confirmedChats) > 0 {
+		deployed = w.deployedContracts(ctx, task, from, receipt)
+		for _, addr := range deployed {
+			txRec.CreatedContracts = append(txRec.CreatedContracts, addr.Hex())
+		}
+	}
 	if err := w.repo.UpsertTx(ctx, txRec); err != nil {
 		log.Printf("[watcher] db upsert tx error: %v", err)
 		// не возвращаем — уведомления важнее
 	}
+	if len(matched) > 0 {
+		var recs []storage.TokenTransferRecord
+		for i := range matched {
+			matched[i].usd = w.tokenUSD(ctx, task.BlockNum, matched[i].transfer)
+			trs := transferRecords(matched[i].transfer)
+			if matched[i].transfer.Standard == tokens.ERC20 {
+				trs[0].ValueUSD = usdString(matched[i].usd)
+			}
+			recs = append(recs, trs...)
+		}
+		if err := w.repo.UpsertTokenTransfers(ctx, recs); err != nil {
+			log.Printf("[watcher] db upsert token transfers error: %v", err)
+		}
+	}
 
-	// 2) отправляем уведомления + пишем событие в историю каждому чату
-	text := FormatTxNotification(tx.Hash(), from, to, val, task.BlockNum, task.BlockTime)
+	// 2) собираем уведомления по чатам: в блоке они уходят после всех tx по
+	// порядку (blockRun.outbox), без блока — сразу
+	var notes []heldNotification
+	byChat := make(map[int64]int)
+	send := func(chats []int64, text string, deployed []common.Address) {
+		for _, chatID := range chats {
+			i, ok := byChat[chatID]
+			if !ok {
+				i = len(notes)
+				byChat[chatID] = i
+				notes = append(notes, heldNotification{ChatID: chatID, TxHash: tx.Hash(), BlockNum: task.BlockNum})
+			}
+			notes[i].Messages = append(notes[i].Messages, heldMessage{Text: text, Deployed: deployed})
+		}
+	}
 
-	for _, chatID := range recipients {
-		_ = w.repo.AddChatEvent(ctx, chatID, txRec.Hash, storage.EventNotify)
+	n := TxNotification{
+		Hash:      tx.Hash(),
+		From:      from,
+		To:        to,
+		ValueWei:  val,
+		ValueUSD:  valueUSD,
+		BlockNum:  task.BlockNum,
+		BlockTime: task.BlockTime,
+		Receipt:   receipt,
+		Revert:    revert,
+		Call:      w.decodeCall(tx),
+		Symbol:    w.cfg.Network.Symbol,
+		Fees:      TxFeesOf(tx, task.BaseFee),
+		Deployed:  deployed,
+		Names:     w.names(ctx, &from, to),
+	}
+	send(recipients, FormatTxNotification(n), deployed)
 
-		select {
-		case w.notifyCh <- bus.Notification{ChatID: chatID, Text: text}:
-		case <-ctx.Done():
-			return
+	if len(confirmedChats) > 0 {
+		n.PendingConfirmed = true
+		send(confirmedChats, FormatTxNotification(n), deployed)
+	}
+
+	for _, m := range internal {
+		from, to := m.transfer.From, m.transfer.To
+		send(m.chats, FormatTxNotification(TxNotification{
+			Hash:      tx.Hash(),
+			From:      from,
+			To:        &to,
+			ValueWei:  m.transfer.Value,
+			ValueUSD:  w.nativeUSD(ctx, task.BlockNum, m.transfer.Value),
+			BlockNum:  task.BlockNum,
+			BlockTime: task.BlockTime,
+			Receipt:   receipt,
+			Internal:  m.transfer.Type,
+			Symbol:    w.cfg.Network.Symbol,
+			Fees:      n.Fees,
+			Names:     w.names(ctx, &from, &to),
+		}), nil)
+	}
+
+	for _, m := range matched {
+		send(m.chats, w.formatTransfer(ctx, task, m.transfer, m.usd), nil)
+	}
+
+	for _, m := range events {
+		send(m.chats, m.text, nil)
+	}
+
+	if task.run != nil {
+		task.run.queue(task.Index, notes)
+	} else {
+		for _, note := range notes {
+			if !w.deliver(ctx, note) {
+				break
+			}
 		}
 	}
+
+	out := make([]int64, 0, len(notes))
+	for _, note := range notes {
+		out = append(out, note.ChatID)
+	}
+	return out
+}
+
+// names — ENS-имена адресов для текста уведомления; nil, если ENS не настроен
+// или имён нет. nil-адреса (создание контракта) пропускаются.
+func (w *Watcher) names(ctx context.Context, addrs ...*common.Address) map[common.Address]string {
+	if w.cfg.Names == nil {
+		return nil
+	}
+	known := make([]common.Address, 0, len(addrs))
+	for _, a := range addrs {
+		if a != nil {
+			known = append(known, *a)
+		}
+	}
+	return w.cfg.Names.Names(ctx, known...)
+}
+
+// decodeCall разбирает calldata tx; nil для простого перевода ETH.
+func (w *Watcher) decodeCall(tx *types.Transaction) *contracts.Call {
+	call, ok := w.selectors.Decode(tx.Data())
+	if !ok {
+		return nil
+	}
+	return &call
+}
+
+func withoutChats(chats, exclude []int64) []int64 {
+	if len(exclude) == 0 {
+		return chats
+	}
+	skip := make(map[int64]struct{}, len(exclude))
+	for _, c := range exclude {
+		skip[c] = struct{}{}
+	}
+	out := chats[:0:0]
+	for _, c := range chats {
+		if _, ok := skip[c]; !ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (w *Watcher) formatTransfer(ctx context.Context, task TxTask, t tokens.Transfer, usd *big.Int) string {
+	if t.Standard != tokens.ERC20 {
+		return FormatNFTTransferNotification(t, task.BlockNum, task.BlockTime, w.names(ctx, &t.From, &t.To))
+	}
+
+	n := TokenTransferNotification{
+		Transfer:  t,
+		BlockNum:  task.BlockNum,
+		BlockTime: task.BlockTime,
+		Names:     w.names(ctx, &t.From, &t.To),
+		ValueUSD:  usd,
+	}
+	if info, err := w.tokens.Lookup(ctx, t.Token); err == nil {
+		n.Token = &info
+	} else {
+		log.Printf("[watcher] token %s metadata error: %v", t.Token.Hex(), err)
+	}
+	return FormatTokenTransferNotification(n)
+}
+
+// transferRecords раскладывает перевод на строки token_transfers (по одной на token id).
+func transferRecords(t tokens.Transfer) []storage.TokenTransferRecord {
+	base := storage.TokenTransferRecord{
+		TxHash:    t.TxHash.Hex(),
+		LogIndex:  t.LogIndex,
+		Standard:  string(t.Standard),
+		TokenAddr: t.Token.Hex(),
+		FromAddr:  t.From.Hex(),
+		ToAddr:    t.To.Hex(),
+	}
+	if t.Standard == tokens.ERC20 {
+		base.Amount = t.Amount.String()
+		return []storage.TokenTransferRecord{base}
+	}
+
+	out := make([]storage.TokenTransferRecord, 0, len(t.TokenIDs))
+	for i, id := range t.TokenIDs {
+		rec := base
+		rec.Seq = i
+		x := id.String()
+		rec.TokenID = &x
+		rec.Amount = t.Amounts[i].String()
+		out = append(out, rec)
+	}
+	return out
+}
+
+func (w *Watcher) txRecord(task TxTask, from common.Address, receipt *types.Receipt) storage.TxRecord {
+	tx := task.Tx
+
+	var toStr *string
+	if to := tx.To(); to != nil {
+		x := to.Hex()
+		toStr = &x
+	}
+	val := tx.Value()
+	if val == nil {
+		val = big.NewInt(0)
+	}
+	var bt = time.Unix(int64(task.BlockTime), 0).UTC()
+	blockNum := task.BlockNum
+
+	txRec := storage.TxRecord{
+		Hash:      tx.Hash().Hex(),
+		ChainID:   w.chainID.String(),
+		BlockNum:  &blockNum,
+		BlockTime: &bt,
+		FromAddr:  from.Hex(),
+		ToAddr:    toStr,
+		ValueWei:  val.String(),
+		Nonce:     tx.Nonce(),
+		TxType:    tx.Type(),
+		Gas:       tx.Gas(),
+	}
+	if sel, ok := contracts.SelectorHex(tx.Data()); ok {
+		txRec.MethodSelector = &sel
+	}
+	TxFeesOf(tx, task.BaseFee).FillRecord(&txRec, receipt)
+
+	if receipt != nil {
+		st := uint8(receipt.Status)
+		txRec.Status = &st
+	}
+	return txRec
 }
@@ -2,28 +2,49 @@ package ethwatch
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/contracts"
 	"github.com/pvzzle/scanblock/internal/storage"
 	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type mockRepo struct {
 	mu      sync.Mutex
 	upserts []storage.TxRecord
-	events  []struct {
-		chatID int64
-		hash   string
-		etype  storage.TxEventType
-	}
+	reorged []string
+
+	transfers []storage.TokenTransferRecord
+
+	// checkpoint — с чего продолжает Start; saved — сохранённые чекпоинты
+	checkpoint *storage.Checkpoint
+	saved      []storage.Checkpoint
+
+	events []mockEvent
+
+	// pending — ответ ListPendingTxs
+	pending []storage.PendingTxRecord
+
+	// held — отложенные уведомления (held_notifications)
+	held []storage.HeldNotificationRecord
+}
+
+type mockEvent struct {
+	chatID int64
+	hash   string
+	etype  storage.TxEventType
 }
 
 func (m *mockRepo) EnsureSchema(ctx context.Context) error { return nil }
@@ -33,19 +54,228 @@ func (m *mockRepo) UpsertTx(ctx context.Context, tx storage.TxRecord) error {
 	m.upserts = append(m.upserts, tx)
 	return nil
 }
-func (m *mockRepo) AddChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) error {
+func (m *mockRepo) MarkTxReorged(ctx context.Context, hash string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.events = append(m.events, struct {
-		chatID int64
-		hash   string
-		etype  storage.TxEventType
-	}{chatID: chatID, hash: txHash, etype: eventType})
+	m.reorged = append(m.reorged, hash)
+	return nil
+}
+func (m *mockRepo) AddChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.chatID == chatID && e.hash == txHash && e.etype == eventType {
+			return false, nil
+		}
+	}
+	m.events = append(m.events, mockEvent{chatID: chatID, hash: txHash, etype: eventType})
+	return true, nil
+}
+func (m *mockRepo) HasChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.chatID == chatID && e.hash == txHash && e.etype == eventType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// delivered записывает ключи уведомлений, как это делает бот после отправки
+// (tg.Service.deliver).
+func (m *mockRepo) delivered(ns ...bus.Notification) {
+	for _, n := range ns {
+		if n.TxHash != "" && n.Event != "" && !n.More {
+			_, _ = m.AddChatEvent(context.Background(), n.ChatID, n.TxHash, storage.TxEventType(n.Event))
+		}
+	}
+}
+
+func (m *mockRepo) ListPendingTxs(ctx context.Context, chainID string, since time.Time) ([]storage.PendingTxRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pending, nil
+}
+func (m *mockRepo) RemoveChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keep := m.events[:0]
+	for _, e := range m.events {
+		if e.chatID != chatID || e.hash != txHash || e.etype != eventType {
+			keep = append(keep, e)
+		}
+	}
+	m.events = keep
+	return nil
+}
+func (m *mockRepo) UpsertTokenTransfers(ctx context.Context, transfers []storage.TokenTransferRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transfers = append(m.transfers, transfers...)
 	return nil
 }
 func (m *mockRepo) ListHistory(ctx context.Context, chatID int64, limit int) ([]storage.HistoryItem, error) {
 	return nil, nil
 }
+func (m *mockRepo) UpsertSubscription(ctx context.Context, sub storage.SubscriptionRecord) error {
+	return nil
+}
+func (m *mockRepo) DeleteSubscription(ctx context.Context, chainID string, chatID int64) error {
+	return nil
+}
+func (m *mockRepo) ListSubscriptions(ctx context.Context) ([]storage.SubscriptionRecord, error) {
+	return nil, nil
+}
+func (m *mockRepo) GetCheckpoint(ctx context.Context, chainID string) (*storage.Checkpoint, error) {
+	return m.checkpoint, nil
+}
+func (m *mockRepo) SaveCheckpoint(ctx context.Context, cp storage.Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saved = append(m.saved, cp)
+	return nil
+}
+
+func (m *mockRepo) AddHeldNotification(ctx context.Context, n storage.HeldNotificationRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, h := range m.held {
+		if h.ChainID == n.ChainID && h.ChatID == n.ChatID && h.TxHash == n.TxHash {
+			m.held[i] = n
+			return nil
+		}
+	}
+	m.held = append(m.held, n)
+	return nil
+}
+func (m *mockRepo) DeleteHeldNotification(ctx context.Context, chainID string, chatID int64, txHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, h := range m.held {
+		if h.ChainID == chainID && h.ChatID == chatID && h.TxHash == txHash {
+			m.held = append(m.held[:i], m.held[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+func (m *mockRepo) ListHeldNotifications(ctx context.Context, chainID string) ([]storage.HeldNotificationRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []storage.HeldNotificationRecord
+	for _, h := range m.held {
+		if h.ChainID == chainID {
+			out = append(out, h)
+		}
+	}
+	return out, nil
+}
+func (m *mockRepo) SetChatNetwork(ctx context.Context, chatID int64, chainID string) error {
+	return nil
+}
+func (m *mockRepo) ListChatNetworks(ctx context.Context) (map[int64]string, error) {
+	return nil, nil
+}
+
+// fakeClient — ChainClient на map'ах; чего нет в map — NotFound.
+type fakeClient struct {
+	mu       sync.Mutex
+	receipts map[common.Hash]*types.Receipt
+	// blockReceiptsErr != nil — eth_getBlockReceipts отвечает ошибкой
+	blockReceiptsErr  error
+	blockReceiptCalls int
+	txReceiptCalls    int
+
+	// logs — ответ eth_getLogs, calls — ответы eth_call по hex calldata
+	logs            []types.Log
+	logsErr         error
+	filterLogsCalls int
+	calls           map[string][]byte
+
+	// tagged — номера блоков для тегов safe/finalized (rpc.SafeBlockNumber и т.п.);
+	// taggedErr != nil — запрос тега отвечает этой ошибкой
+	tagged    map[int64]uint64
+	taggedErr error
+
+	// nonces — ответы eth_getTransactionCount
+	nonces map[common.Address]uint64
+}
+
+func (f *fakeClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.nonces[account], nil
+}
+
+// CodeAt — у fakeClient нет контрактов; codeClient его переопределяет.
+func (f *fakeClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+func (f *fakeClient) BlockNumber(ctx context.Context) (uint64, error) { return 0, ethereum.NotFound }
+func (f *fakeClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.taggedErr != nil && number.Sign() < 0 {
+		return nil, f.taggedErr
+	}
+	if num, ok := f.tagged[number.Int64()]; ok && number.Sign() < 0 {
+		return &types.Header{Number: new(big.Int).SetUint64(num)}, nil
+	}
+	return nil, ethereum.NotFound
+}
+func (f *fakeClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return nil, ethereum.NotFound
+}
+func (f *fakeClient) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return nil, ethereum.NotFound
+}
+func (f *fakeClient) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blockReceiptCalls++
+	if f.blockReceiptsErr != nil {
+		return nil, f.blockReceiptsErr
+	}
+	var out []*types.Receipt
+	for _, r := range f.receipts {
+		out = append(out, r)
+	}
+	return out, nil
+}
+func (f *fakeClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.txReceiptCalls++
+	r, ok := f.receipts[txHash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return r, nil
+}
+
+func (f *fakeClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out, ok := f.calls[common.Bytes2Hex(msg.Data)]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	return out, nil
+}
+func (f *fakeClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filterLogsCalls++
+	if f.logsErr != nil {
+		return nil, f.logsErr
+	}
+	return f.logs, nil
+}
 
 func TestWatcher_handleTask_PersistsAndNotifies(t *testing.T) {
 	ctx := context.Background()
@@ -79,13 +309,20 @@ func TestWatcher_handleTask_PersistsAndNotifies(t *testing.T) {
 	subStore := subs.NewStore()
 	chatID := int64(99)
 
-	subStore.SetWallet(chatID, from)
+	_ = subStore.SetWallet(ctx, chatID, from)
 
 	notifyCh := make(chan bus.Notification, 1)
 	repo := &mockRepo{}
 
 	w := &Watcher{
-		client:   nil, // not used in handleTask
+		client: &fakeClient{receipts: map[common.Hash]*types.Receipt{
+			tx.Hash(): {
+				TxHash:            tx.Hash(),
+				Status:            types.ReceiptStatusSuccessful,
+				GasUsed:           21000,
+				EffectiveGasPrice: big.NewInt(1),
+			},
+		}},
 		chainID:  chainID,
 		subStore: subStore,
 		notifyCh: notifyCh,
@@ -108,6 +345,10 @@ func TestWatcher_handleTask_PersistsAndNotifies(t *testing.T) {
 		if n.Text == "" {
 			t.Fatal("expected non-empty notification text")
 		}
+		// ключ идемпотентности пишет бот после отправки
+		if n.TxHash != tx.Hash().Hex() || n.Event != string(storage.EventNotify) || n.More {
+			t.Fatalf("unexpected delivery key: %+v", n)
+		}
 	default:
 		t.Fatal("expected notification")
 	}
@@ -121,11 +362,231 @@ func TestWatcher_handleTask_PersistsAndNotifies(t *testing.T) {
 	if repo.upserts[0].Hash != tx.Hash().Hex() {
 		t.Fatalf("expected upsert hash=%s got=%s", tx.Hash().Hex(), repo.upserts[0].Hash)
 	}
+	if st := repo.upserts[0].Status; st == nil || *st != 1 {
+		t.Fatalf("expected status=1 from receipt, got=%v", st)
+	}
+	if gu := repo.upserts[0].GasUsed; gu == nil || *gu != 21000 {
+		t.Fatalf("expected gas used from receipt, got=%v", gu)
+	}
 
-	if len(repo.events) != 1 {
-		t.Fatalf("expected 1 event, got=%d", len(repo.events))
+	if len(repo.events) != 0 {
+		t.Fatalf("expected no chat events before the bot sends the notification, got=%+v", repo.events)
 	}
-	if repo.events[0].chatID != chatID || repo.events[0].etype != storage.EventNotify {
-		t.Fatalf("unexpected event: %+v", repo.events[0])
+}
+
+func TestWatcher_handleTask_TokenTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	// вызов transfer() на контракт токена, сам по себе ETH не двигает
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &token, Gas: 60000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, wallet)
+	_ = subStore.SetTokenMin(ctx, 6, token, subs.TokenSub{MinAmount: big.NewInt(1_000_000_000), Decimals: 6, Symbol: "USDT"})
+
+	cl := &fakeClient{calls: map[string][]byte{
+		"313ce567": common.LeftPadBytes([]byte{6}, 32), // decimals()
+		"95d89b41": common.RightPadBytes([]byte("USDT"), 32),
+	}}
+	notifyCh := make(chan bus.Notification, 4)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   cl,
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		tokens:   tokens.NewRegistry(cl),
+		repo:     repo,
+	}
+
+	task := TxTask{
+		Tx:       tx,
+		BlockNum: 10,
+		Transfers: []tokens.Transfer{
+			// 5 USDT на отслеживаемый кошелёк — ниже порога чата 6
+			{Standard: tokens.ERC20, TxHash: tx.Hash(), Token: token, From: common.HexToAddress("0x01"), To: wallet, Amount: big.NewInt(5_000_000)},
+		},
+	}
+
+	chats := w.handleTask(ctx, signer, task)
+	if len(chats) != 1 || chats[0] != 5 {
+		t.Fatalf("expected only wallet chat 5 notified, got=%v", chats)
+	}
+
+	n := <-notifyCh
+	if n.ChatID != 5 || !contains(n.Text, "Amount: 5 USDT") {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+	if len(repo.upserts) != 1 || repo.upserts[0].Hash != tx.Hash().Hex() {
+		t.Fatalf("expected tx to be persisted, got=%+v", repo.upserts)
+	}
+}
+
+func TestWatcher_handleTask_NFTTransferToWatchedWallet(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	coll := common.HexToAddress("0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D")
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &coll, Gas: 90000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetWallet(ctx, 5, wallet)
+
+	notifyCh := make(chan bus.Notification, 4)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   &fakeClient{},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		repo:     repo,
+	}
+
+	task := TxTask{
+		Tx:       tx,
+		BlockNum: 10,
+		Transfers: []tokens.Transfer{{
+			Standard: tokens.ERC1155,
+			TxHash:   tx.Hash(),
+			LogIndex: 3,
+			Token:    coll,
+			From:     common.HexToAddress("0x01"),
+			To:       wallet,
+			TokenIDs: []*big.Int{big.NewInt(1), big.NewInt(2)},
+			Amounts:  []*big.Int{big.NewInt(5), big.NewInt(1)},
+		}},
+	}
+
+	if chats := w.handleTask(ctx, signer, task); len(chats) != 1 || chats[0] != 5 {
+		t.Fatalf("expected wallet chat notified, got=%v", chats)
+	}
+
+	n := <-notifyCh
+	if !contains(n.Text, "NFT transfer (ERC1155)") || !contains(n.Text, "Tokens: #1 × 5, #2 × 1") {
+		t.Fatalf("unexpected notification: %s", n.Text)
+	}
+
+	if len(repo.transfers) != 2 {
+		t.Fatalf("expected 2 stored transfer rows, got=%+v", repo.transfers)
+	}
+	if r := repo.transfers[1]; r.Seq != 1 || r.TokenID == nil || *r.TokenID != "2" || r.Amount != "1" || r.LogIndex != 3 {
+		t.Fatalf("unexpected stored row: %+v", r)
+	}
+	if n.Event != string(storage.EventNotify) {
+		t.Fatalf("expected notify event for history, got=%+v", n)
+	}
+}
+
+func TestWatcher_handleTask_ContractEvent(t *testing.T) {
+	ctx := context.Background()
+
+	chainID := big.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	vault := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{To: &vault, Gas: 90000, GasPrice: big.NewInt(1)}), signer, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	raw := `[{"type":"event","name":"Deposit","inputs":[{"name":"user","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]}]`
+	parsed, err := contracts.ParseABI([]byte(raw))
+	if err != nil {
+		t.Fatalf("abi: %v", err)
+	}
+
+	subStore := subs.NewStore()
+	_ = subStore.SetContract(ctx, 5, vault, subs.ContractSub{ABI: parsed, RawABI: raw})
+	_ = subStore.SetContract(ctx, 6, vault, subs.ContractSub{ABI: parsed, RawABI: raw})
+
+	notifyCh := make(chan bus.Notification, 4)
+	repo := &mockRepo{}
+	w := &Watcher{
+		client:   &fakeClient{},
+		chainID:  chainID,
+		subStore: subStore,
+		notifyCh: notifyCh,
+		repo:     repo,
+	}
+
+	user := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	task := TxTask{
+		Tx:       tx,
+		BlockNum: 10,
+		Logs: []*types.Log{{
+			Address: vault,
+			Topics:  []common.Hash{parsed.Events["Deposit"].ID, common.BytesToHash(user.Bytes())},
+			Data:    common.LeftPadBytes(big.NewInt(42).Bytes(), 32),
+			TxHash:  tx.Hash(),
+		}},
+	}
+
+	if chats := w.handleTask(ctx, signer, task); len(chats) != 2 {
+		t.Fatalf("expected both contract chats notified, got=%v", chats)
+	}
+	for i := 0; i < 2; i++ {
+		n := <-notifyCh
+		if !contains(n.Text, "Contract event: Deposit") || !contains(n.Text, "user (address): "+user.Hex()) || !contains(n.Text, "amount (uint256): 42") {
+			t.Fatalf("unexpected notification: %s", n.Text)
+		}
+	}
+	if len(repo.upserts) != 1 {
+		t.Fatalf("expected tx to be persisted, got=%+v", repo.upserts)
+	}
+}
+
+func TestBackfillRange(t *testing.T) {
+	u := func(v uint64) *uint64 { return &v }
+
+	cases := []struct {
+		name        string
+		last        *uint64
+		head        uint64
+		maxDepth    uint64
+		wantFrom    uint64
+		wantSkipped uint64
+	}{
+		{name: "no checkpoint", last: nil, head: 100, maxDepth: 10, wantFrom: 100},
+		{name: "next block", last: u(99), head: 100, maxDepth: 10, wantFrom: 100},
+		{name: "small gap", last: u(90), head: 100, maxDepth: 10, wantFrom: 91},
+		{name: "gap over depth", last: u(50), head: 100, maxDepth: 10, wantFrom: 91, wantSkipped: 40},
+		{name: "already processed", last: u(100), head: 100, maxDepth: 10, wantFrom: 101},
+	}
+
+	for _, tc := range cases {
+		from, skipped := backfillRange(tc.last, tc.head, tc.maxDepth)
+		if from != tc.wantFrom || skipped != tc.wantSkipped {
+			t.Fatalf("%s: expected from=%d skipped=%d, got from=%d skipped=%d",
+				tc.name, tc.wantFrom, tc.wantSkipped, from, skipped)
+		}
 	}
 }
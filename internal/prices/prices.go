@@ -0,0 +1,309 @@
+package prices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const aggregatorABI = `[
+  {"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+  {"type":"function","name":"latestRoundData","stateMutability":"view","inputs":[],"outputs":[
+    {"name":"roundId","type":"uint80"},
+    {"name":"answer","type":"int256"},
+    {"name":"startedAt","type":"uint256"},
+    {"name":"updatedAt","type":"uint256"},
+    {"name":"answeredInRound","type":"uint80"}
+  ]}
+]`
+
+var parsedABI = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(aggregatorABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+var ErrNoFeed = errors.New("no price feed")
+
+// Price — ответ Chainlink-агрегатора: цена в USD с Decimals знаками.
+type Price struct {
+	Feed      common.Address
+	Answer    *big.Int
+	Decimals  uint8
+	UpdatedAt time.Time
+}
+
+// Valid — цена получена и положительна.
+func (p Price) Valid() bool { return p.Answer != nil && p.Answer.Sign() > 0 }
+
+// Cents — стоимость amount (в минимальных единицах с decimals знаками) в центах
+// USD, с округлением вниз. nil, если цены нет.
+func (p Price) Cents(amount *big.Int, decimals uint8) *big.Int {
+	if !p.Valid() || amount == nil {
+		return nil
+	}
+	num := new(big.Int).Mul(amount, p.Answer)
+	num.Mul(num, big.NewInt(100))
+	den := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)+int64(p.Decimals)), nil)
+	return num.Quo(num, den)
+}
+
+// Amount — сколько минимальных единиц (decimals знаков) стоят cents центов,
+// с округлением вверх: перевод такого размера уже дотягивает до порога.
+func (p Price) Amount(cents *big.Int, decimals uint8) *big.Int {
+	if !p.Valid() || cents == nil {
+		return nil
+	}
+	num := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)+int64(p.Decimals)), nil)
+	num.Mul(num, cents)
+	den := new(big.Int).Mul(p.Answer, big.NewInt(100))
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() > 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+// Feeds — Chainlink-агрегаторы сети: нативная валюта/USD и токен → агрегатор
+// токен/USD.
+type Feeds struct {
+	Native common.Address
+	Tokens map[common.Address]common.Address
+}
+
+func (f Feeds) IsEmpty() bool { return f.Native == (common.Address{}) && len(f.Tokens) == 0 }
+
+// defaultFeeds — агрегаторы USD из документации Chainlink для известных сетей.
+// Токены — только самые ходовые в mainnet; остальное задаётся в конфиге.
+var defaultFeeds = map[uint64]Feeds{
+	1: {
+		Native: common.HexToAddress("0x5f4eC3Df9cbd43714FE2740F5E3616155c5b8419"), // ETH/USD
+		Tokens: map[common.Address]common.Address{
+			// USDC
+			common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"): common.HexToAddress("0x8fFfFfd4AfB6115b954Bd326cbe7B4BA576818f6"),
+			// USDT
+			common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"): common.HexToAddress("0x3E7d1eAB13ad0104d2750B8863b489D65364e32D"),
+			// DAI
+			common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"): common.HexToAddress("0xAed0c38402a5d19df6E4c03F4E2DceD6e29c1ee9"),
+			// WETH — по ETH/USD
+			common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"): common.HexToAddress("0x5f4eC3Df9cbd43714FE2740F5E3616155c5b8419"),
+		},
+	},
+	10:       {Native: common.HexToAddress("0x13e3Ee699D1909E989722E753853AE30b17e08c5")}, // ETH/USD
+	137:      {Native: common.HexToAddress("0xAB594600376Ec9fD91F8e885dADF0CE036862dE0")}, // POL/USD
+	8453:     {Native: common.HexToAddress("0x71041dddad3595F9CEd3DcCFBe3D1F4b0a16Bb70")}, // ETH/USD
+	42161:    {Native: common.HexToAddress("0x639Fe6ab55C921f74e7fac1ee960C0B6293ba612")}, // ETH/USD
+	43114:    {Native: common.HexToAddress("0x0A77230d17318075983913bC2145DB16C7366156")}, // AVAX/USD
+	11155111: {Native: common.HexToAddress("0x694AA1769357215DE4FAC081bf1f309aDC325306")}, // ETH/USD
+}
+
+// DefaultFeeds — агрегаторы сети по умолчанию (пусто для незнакомой сети).
+func DefaultFeeds(chainID uint64) Feeds {
+	d := defaultFeeds[chainID]
+	out := Feeds{Native: d.Native, Tokens: make(map[common.Address]common.Address, len(d.Tokens))}
+	for token, feed := range d.Tokens {
+		out.Tokens[token] = feed
+	}
+	return out
+}
+
+// maxCachedRounds — сколько ответов (агрегатор, блок) держим в кэше.
+const maxCachedRounds = 4096
+
+type roundKey struct {
+	feed  common.Address
+	block uint64
+}
+
+// Oracle читает цены Chainlink через eth_call на блоке транзакции. Ответы по
+// блокам кэшируются (все tx блока оцениваются одним вызовом), decimals
+// агрегатора — навсегда. nil *Oracle — цен нет.
+type Oracle struct {
+	caller ethereum.ContractCaller
+	feeds  Feeds
+
+	mu       sync.Mutex
+	decimals map[common.Address]uint8
+	rounds   map[roundKey]Price
+}
+
+func NewOracle(c ethereum.ContractCaller, feeds Feeds) *Oracle {
+	return &Oracle{
+		caller:   c,
+		feeds:    feeds,
+		decimals: make(map[common.Address]uint8),
+		rounds:   make(map[roundKey]Price),
+	}
+}
+
+// HasNative — есть ли агрегатор нативной валюты (можно ставить пороги в USD).
+func (o *Oracle) HasNative() bool {
+	return o != nil && o.feeds.Native != (common.Address{})
+}
+
+// Native — цена нативной валюты на блоке (nil — последний блок).
+func (o *Oracle) Native(ctx context.Context, block *big.Int) (Price, error) {
+	if !o.HasNative() {
+		return Price{}, ErrNoFeed
+	}
+	return o.read(ctx, o.feeds.Native, block)
+}
+
+// Token — цена ERC-20 токена на блоке (nil — последний блок).
+func (o *Oracle) Token(ctx context.Context, token common.Address, block *big.Int) (Price, error) {
+	if o == nil {
+		return Price{}, ErrNoFeed
+	}
+	feed, ok := o.feeds.Tokens[token]
+	if !ok {
+		return Price{}, ErrNoFeed
+	}
+	return o.read(ctx, feed, block)
+}
+
+func (o *Oracle) read(ctx context.Context, feed common.Address, block *big.Int) (Price, error) {
+	// последний блок не кэшируем: он меняется
+	var key roundKey
+	if block != nil {
+		key = roundKey{feed: feed, block: block.Uint64()}
+		o.mu.Lock()
+		p, ok := o.rounds[key]
+		o.mu.Unlock()
+		if ok {
+			return p, nil
+		}
+	}
+
+	dec, err := o.feedDecimals(ctx, feed)
+	if err != nil {
+		return Price{}, err
+	}
+	out, err := o.call(ctx, feed, "latestRoundData", block)
+	if err != nil {
+		return Price{}, err
+	}
+	answer, ok1 := out[1].(*big.Int)
+	updatedAt, ok2 := out[3].(*big.Int)
+	if !ok1 || !ok2 {
+		return Price{}, fmt.Errorf("feed %s: unexpected latestRoundData output", feed.Hex())
+	}
+	p := Price{Feed: feed, Answer: answer, Decimals: dec, UpdatedAt: time.Unix(updatedAt.Int64(), 0).UTC()}
+	if !p.Valid() {
+		return Price{}, fmt.Errorf("feed %s: non-positive answer %s", feed.Hex(), answer)
+	}
+
+	if block != nil {
+		o.mu.Lock()
+		if len(o.rounds) >= maxCachedRounds {
+			o.rounds = make(map[roundKey]Price)
+		}
+		o.rounds[key] = p
+		o.mu.Unlock()
+	}
+	return p, nil
+}
+
+func (o *Oracle) feedDecimals(ctx context.Context, feed common.Address) (uint8, error) {
+	o.mu.Lock()
+	dec, ok := o.decimals[feed]
+	o.mu.Unlock()
+	if ok {
+		return dec, nil
+	}
+
+	out, err := o.call(ctx, feed, "decimals", nil)
+	if err != nil {
+		return 0, err
+	}
+	dec, ok = out[0].(uint8)
+	if !ok {
+		return 0, fmt.Errorf("feed %s: unexpected decimals output", feed.Hex())
+	}
+
+	o.mu.Lock()
+	o.decimals[feed] = dec
+	o.mu.Unlock()
+	return dec, nil
+}
+
+func (o *Oracle) call(ctx context.Context, feed common.Address, method string, block *big.Int) ([]any, error) {
+	data, err := parsedABI.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := o.caller.CallContract(ctx, ethereum.CallMsg{To: &feed, Data: data}, block)
+	if err != nil {
+		return nil, fmt.Errorf("feed %s %s(): %w", feed.Hex(), method, err)
+	}
+	out, err := parsedABI.Unpack(method, raw)
+	if err != nil {
+		return nil, fmt.Errorf("feed %s %s(): %w", feed.Hex(), method, err)
+	}
+	return out, nil
+}
+
+// ParseUSD — сумма в долларах ("1500", "$1,500.50", "0.5") в центах, > 0.
+func ParseUSD(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "$")
+	s = strings.TrimSpace(strings.TrimSuffix(strings.ToLower(s), "usd"))
+	s = strings.ReplaceAll(s, ",", "")
+	s = strings.ReplaceAll(s, " ", "")
+
+	cents, err := ParseCentsString(s)
+	if err != nil {
+		return nil, err
+	}
+	if cents.Sign() <= 0 {
+		return nil, fmt.Errorf("usd amount %q must be > 0", s)
+	}
+	return cents, nil
+}
+
+// CentsString — центы как десятичная сумма в долларах: "1500.50" (для БД).
+func CentsString(cents *big.Int) string {
+	return new(big.Rat).SetFrac(cents, big.NewInt(100)).FloatString(2)
+}
+
+// ParseCentsString — обратное к CentsString.
+func ParseCentsString(s string) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("bad usd amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(100))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("usd amount %q has fractions of a cent", s)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// FormatUSD — центы для текста: "$1,500.50".
+func FormatUSD(cents *big.Int) string {
+	neg := cents.Sign() < 0
+	s := CentsString(new(big.Int).Abs(cents))
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	out := "$" + b.String() + "." + frac
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
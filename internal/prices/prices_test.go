@@ -0,0 +1,132 @@
+package prices
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeFeed — агрегатор с ценой по номеру блока (nil — последний блок).
+type fakeFeed struct {
+	feed     common.Address
+	decimals uint8
+	answers  map[uint64]int64
+	latest   int64
+	calls    int
+}
+
+func (f *fakeFeed) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	if msg.To == nil || *msg.To != f.feed {
+		return nil, errors.New("execution reverted")
+	}
+	method, err := parsedABI.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	if method.Name == "decimals" {
+		return method.Outputs.Pack(f.decimals)
+	}
+	answer := f.latest
+	if blockNumber != nil {
+		answer = f.answers[blockNumber.Uint64()]
+	}
+	return method.Outputs.Pack(big.NewInt(1), big.NewInt(answer), big.NewInt(0), big.NewInt(1_700_000_000), big.NewInt(1))
+}
+
+func TestOracle_NativeAtBlock(t *testing.T) {
+	ctx := context.Background()
+	ethUSD := common.HexToAddress("0x5f4eC3Df9cbd43714FE2740F5E3616155c5b8419")
+	f := &fakeFeed{
+		feed:     ethUSD,
+		decimals: 8,
+		answers:  map[uint64]int64{100: 3000_00000000, 101: 3100_50000000},
+		latest:   3200_00000000,
+	}
+	o := NewOracle(f, Feeds{Native: ethUSD})
+
+	p, err := o.Native(ctx, big.NewInt(100))
+	if err != nil || p.Answer.Int64() != 3000_00000000 || p.Decimals != 8 {
+		t.Fatalf("unexpected price at #100: %+v %v", p, err)
+	}
+	calls := f.calls
+	if _, err := o.Native(ctx, big.NewInt(100)); err != nil || f.calls != calls {
+		t.Fatalf("expected cached price for the same block, got %d extra calls", f.calls-calls)
+	}
+	if p, _ := o.Native(ctx, big.NewInt(101)); p.Answer.Int64() != 3100_50000000 {
+		t.Fatalf("unexpected price at #101: %s", p.Answer)
+	}
+	if p, _ := o.Native(ctx, nil); p.Answer.Int64() != 3200_00000000 {
+		t.Fatalf("unexpected latest price: %s", p.Answer)
+	}
+
+	if _, err := o.Token(ctx, common.HexToAddress("0x1111111111111111111111111111111111111111"), nil); !errors.Is(err, ErrNoFeed) {
+		t.Fatalf("expected ErrNoFeed for unknown token, got %v", err)
+	}
+	var none *Oracle
+	if none.HasNative() {
+		t.Fatalf("expected nil oracle to have no feeds")
+	}
+}
+
+func TestPrice_CentsAndAmount(t *testing.T) {
+	p := Price{Answer: big.NewInt(3000_00000000), Decimals: 8} // $3000
+
+	oneAndHalfEth, _ := new(big.Int).SetString("1500000000000000000", 10)
+	if got := p.Cents(oneAndHalfEth, 18); got.String() != "450000" {
+		t.Fatalf("expected 450000 cents, got %s", got)
+	}
+	if got := p.Cents(big.NewInt(2_500_000), 6); got.String() != "750000" {
+		t.Fatalf("expected 750000 cents, got %s", got)
+	}
+
+	// $1 при $3000 за ETH — 1/3000 ETH, округлено вверх до wei
+	amount := p.Amount(big.NewInt(100), 18)
+	if amount.String() != "333333333333334" {
+		t.Fatalf("unexpected amount: %s", amount)
+	}
+	if got := p.Cents(amount, 18); got.Int64() != 100 {
+		t.Fatalf("expected rounded-up amount to reach threshold, got %s cents", got)
+	}
+
+	if (Price{}).Cents(oneAndHalfEth, 18) != nil {
+		t.Fatalf("expected nil without price")
+	}
+}
+
+func TestParseAndFormatUSD(t *testing.T) {
+	for in, want := range map[string]string{
+		"1500":        "150000",
+		"$1,500.50":   "150050",
+		"0.5":         "50",
+		"250000 USD":  "25000000",
+		" $ 100 000 ": "10000000",
+	} {
+		got, err := ParseUSD(in)
+		if err != nil || got.String() != want {
+			t.Fatalf("ParseUSD(%q) = %v, %v; want %s", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "abc", "0", "-5", "0.001"} {
+		if _, err := ParseUSD(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	if got := FormatUSD(big.NewInt(123456789)); got != "$1,234,567.89" {
+		t.Fatalf("unexpected format: %s", got)
+	}
+	if got := FormatUSD(big.NewInt(5)); got != "$0.05" {
+		t.Fatalf("unexpected format: %s", got)
+	}
+	if got := CentsString(big.NewInt(150050)); got != "1500.50" {
+		t.Fatalf("unexpected cents string: %s", got)
+	}
+	if c, err := ParseCentsString("1500.50"); err != nil || c.Int64() != 150050 {
+		t.Fatalf("unexpected parse: %v %v", c, err)
+	}
+}
@@ -0,0 +1,592 @@
+package rpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// коды ошибок JSON-RPC
+const (
+	codeMethodNotFound = -32601
+)
+
+var (
+	ErrNoEndpoints = errors.New("no rpc endpoints available")
+	// ErrFailover приходит в Err() подписки, когда пул переключился на другой эндпоинт.
+	ErrFailover = errors.New("rpc endpoint failover")
+)
+
+type Config struct {
+	URLs []string
+
+	// Quorum > 1 требует, чтобы столько эндпоинтов видели тот же hash блока
+	Quorum int
+
+	HealthInterval time.Duration
+	// StallTimeout — голова не двигалась дольше этого => эндпоинт нездоров
+	StallTimeout time.Duration
+	// MaxLag — на сколько блоков активный эндпоинт может отставать от лучшего
+	MaxLag uint64
+}
+
+// Pool — набор RPC-эндпоинтов одной сети. Вызовы идут в активный эндпоинт,
+// при ошибке — в следующий; фоновая проверка переключает активный, если его
+// голова зависла или отстала.
+type Pool struct {
+	cfg     Config
+	chainID *big.Int
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	active    int
+	// switched закрывается (и пересоздаётся) при каждой смене активного эндпоинта
+	switched chan struct{}
+	// underQuorum — ConfirmBlock уже предупредил, что здоровых эндпоинтов меньше Quorum
+	underQuorum bool
+}
+
+type endpoint struct {
+	url  string
+	name string // только хост: в URL часто лежит API-ключ
+
+	client  *ethclient.Client
+	healthy bool
+	head    uint64
+	headAt  time.Time
+	lastErr error
+}
+
+// Dial подключается ко всем эндпоинтам. Достаточно одного живого; недоступные
+// при старте будут переподключаться фоновой проверкой.
+func Dial(ctx context.Context, cfg Config) (*Pool, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = 10 * time.Second
+	}
+	if cfg.StallTimeout <= 0 {
+		cfg.StallTimeout = time.Minute
+	}
+
+	p := &Pool{cfg: cfg, switched: make(chan struct{})}
+
+	for _, u := range cfg.URLs {
+		ep := &endpoint{url: u, name: endpointName(u)}
+		p.endpoints = append(p.endpoints, ep)
+
+		cl, chainID, err := dialEndpoint(ctx, u)
+		if err != nil {
+			ep.lastErr = err
+			log.Printf("[RPC] %s: dial error: %v", ep.name, err)
+			continue
+		}
+		if p.chainID == nil {
+			p.chainID = chainID
+		} else if chainID.Cmp(p.chainID) != 0 {
+			cl.Close()
+			p.Close()
+			return nil, fmt.Errorf("%s: chain id %s differs from %s", ep.name, chainID, p.chainID)
+		}
+		ep.client = cl
+		ep.healthy = true
+		ep.headAt = time.Now()
+	}
+
+	if p.chainID == nil {
+		return nil, fmt.Errorf("%w: all %d endpoint(s) failed to dial", ErrNoEndpoints, len(cfg.URLs))
+	}
+	for i, ep := range p.endpoints {
+		if ep.healthy {
+			p.active = i
+			break
+		}
+	}
+	return p, nil
+}
+
+// ChainID — eth_chainId сети пула (EIP-155), сверенный при Dial у всех эндпоинтов.
+func (p *Pool) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(p.chainID), nil
+}
+
+// Start крутит проверку здоровья эндпоинтов до отмены ctx.
+func (p *Pool) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkAll(ctx)
+		}
+	}
+}
+
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ep := range p.endpoints {
+		if ep.client != nil {
+			ep.client.Close()
+			ep.client = nil
+		}
+	}
+}
+
+// Redial немедленно перепроверяет (и при необходимости переподключает) эндпоинты.
+func (p *Pool) Redial(ctx context.Context) error {
+	p.checkAll(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ep := range p.endpoints {
+		if ep.healthy {
+			return nil
+		}
+	}
+	return ErrNoEndpoints
+}
+
+// checkAll опрашивает голову каждого эндпоинта, переподключает упавшие
+// и при необходимости меняет активный.
+func (p *Pool) checkAll(ctx context.Context) {
+	p.mu.Lock()
+	eps := append([]*endpoint(nil), p.endpoints...)
+	p.mu.Unlock()
+
+	for _, ep := range eps {
+		p.checkEndpoint(ctx, ep)
+	}
+
+	p.mu.Lock()
+	p.reselect("health check")
+	p.mu.Unlock()
+}
+
+func (p *Pool) checkEndpoint(ctx context.Context, ep *endpoint) {
+	p.mu.Lock()
+	cl, wasDown := ep.client, !ep.healthy && ep.lastErr != nil
+	p.mu.Unlock()
+
+	if cl == nil || wasDown {
+		newCl, chainID, err := dialEndpoint(ctx, ep.url)
+		if err == nil && chainID.Cmp(p.chainID) != 0 {
+			newCl.Close()
+			err = fmt.Errorf("chain id %s differs from %s", chainID, p.chainID)
+		}
+		if err != nil {
+			p.mu.Lock()
+			ep.healthy, ep.lastErr = false, err
+			p.mu.Unlock()
+			return
+		}
+
+		p.mu.Lock()
+		if ep.client != nil {
+			ep.client.Close()
+		}
+		ep.client, cl = newCl, newCl
+		ep.headAt = time.Now()
+		p.mu.Unlock()
+		log.Printf("[RPC] %s: redialed", ep.name)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	head, err := cl.BlockNumber(cctx)
+	cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		if ep.healthy {
+			log.Printf("[RPC] %s: unhealthy: %v", ep.name, err)
+		}
+		ep.healthy, ep.lastErr = false, err
+		return
+	}
+	if head > ep.head {
+		ep.head, ep.headAt = head, now
+	}
+	ep.lastErr = nil
+
+	stalled := now.Sub(ep.headAt) > p.cfg.StallTimeout
+	if stalled && ep.healthy {
+		log.Printf("[RPC] %s: head #%d stalled for %s", ep.name, ep.head, now.Sub(ep.headAt).Round(time.Second))
+	}
+	ep.healthy = !stalled
+}
+
+// reselect меняет активный эндпоинт, если он нездоров или отстал больше MaxLag.
+// Вызывается под p.mu.
+func (p *Pool) reselect(reason string) {
+	best := -1
+	for i, ep := range p.endpoints {
+		if !ep.healthy || ep.client == nil {
+			continue
+		}
+		if best < 0 || ep.head > p.endpoints[best].head {
+			best = i
+		}
+	}
+	if best < 0 || best == p.active {
+		return
+	}
+
+	cur := p.endpoints[p.active]
+	if cur.healthy && cur.client != nil && p.endpoints[best].head <= cur.head+p.cfg.MaxLag {
+		return
+	}
+
+	log.Printf("[RPC] failover %s -> %s (%s)", cur.name, p.endpoints[best].name, reason)
+	p.active = best
+	close(p.switched)
+	p.switched = make(chan struct{})
+}
+
+// order — эндпоинты для очередного вызова: активный, затем здоровые, затем остальные.
+func (p *Pool) order() []*endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]*endpoint, 0, len(p.endpoints))
+	out = append(out, p.endpoints[p.active])
+	for pass := 0; pass < 2; pass++ {
+		for i, ep := range p.endpoints {
+			if i == p.active || ep.healthy != (pass == 0) {
+				continue
+			}
+			out = append(out, ep)
+		}
+	}
+	return out
+}
+
+func (p *Pool) markFailed(ep *endpoint, method string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ep.healthy {
+		log.Printf("[RPC] %s: %s failed: %v", ep.name, method, err)
+	}
+	ep.healthy, ep.lastErr = false, err
+	p.reselect(method + " error")
+}
+
+// do выполняет вызов с переходом на следующий эндпоинт при ошибке.
+// NotFound не считается сбоем, но спрашиваем остальных: эндпоинт мог отстать.
+// Сбоем считаются только ошибки транспорта (соединение, таймаут, HTTP-статус):
+// любой ответ JSON-RPC с ошибкой — revert, "missing trie node" у не-архивной
+// ноды на старом блоке, "header not found" — пришёл от живой ноды и отдаётся
+// как есть, без переключения эндпоинта.
+func do[T any](ctx context.Context, p *Pool, method string, fn func(cl *ethclient.Client) (T, error)) (T, error) {
+	var (
+		zero    T
+		lastErr error
+	)
+	for _, ep := range p.order() {
+		p.mu.Lock()
+		cl := ep.client
+		p.mu.Unlock()
+		if cl == nil {
+			continue
+		}
+
+		v, err := fn(cl)
+		if err == nil {
+			return v, nil
+		}
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		lastErr = err
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+
+		// метода может не быть только у этого провайдера — пробуем остальных;
+		// HTTP-эндпоинт живой, просто не умеет подписки
+		if isRPCCode(err, codeMethodNotFound) || errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			continue
+		}
+		if isRPCReply(err) {
+			return zero, err
+		}
+		p.markFailed(ep, method, err)
+	}
+
+	if lastErr == nil {
+		lastErr = ErrNoEndpoints
+	}
+	return zero, lastErr
+}
+
+func (p *Pool) BlockNumber(ctx context.Context) (uint64, error) {
+	return do(ctx, p, "eth_blockNumber", func(cl *ethclient.Client) (uint64, error) {
+		return cl.BlockNumber(ctx)
+	})
+}
+
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return do(ctx, p, "eth_getBlockByNumber", func(cl *ethclient.Client) (*types.Header, error) {
+		return cl.HeaderByNumber(ctx, number)
+	})
+}
+
+func (p *Pool) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return do(ctx, p, "eth_getBlockByNumber", func(cl *ethclient.Client) (*types.Block, error) {
+		return cl.BlockByNumber(ctx, number)
+	})
+}
+
+func (p *Pool) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return do(ctx, p, "eth_getBlockByHash", func(cl *ethclient.Client) (*types.Block, error) {
+		return cl.BlockByHash(ctx, hash)
+	})
+}
+
+func (p *Pool) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	return do(ctx, p, "eth_getBlockReceipts", func(cl *ethclient.Client) ([]*types.Receipt, error) {
+		return cl.BlockReceipts(ctx, blockNrOrHash)
+	})
+}
+
+func (p *Pool) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	type res struct {
+		tx      *types.Transaction
+		pending bool
+	}
+	r, err := do(ctx, p, "eth_getTransactionByHash", func(cl *ethclient.Client) (res, error) {
+		tx, pending, err := cl.TransactionByHash(ctx, hash)
+		return res{tx: tx, pending: pending}, err
+	})
+	return r.tx, r.pending, err
+}
+
+func (p *Pool) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return do(ctx, p, "eth_getTransactionReceipt", func(cl *ethclient.Client) (*types.Receipt, error) {
+		return cl.TransactionReceipt(ctx, hash)
+	})
+}
+
+func (p *Pool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return do(ctx, p, "eth_call", func(cl *ethclient.Client) ([]byte, error) {
+		return cl.CallContract(ctx, msg, blockNumber)
+	})
+}
+
+func (p *Pool) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return do(ctx, p, "eth_getCode", func(cl *ethclient.Client) ([]byte, error) {
+		return cl.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+func (p *Pool) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return do(ctx, p, "eth_getTransactionCount", func(cl *ethclient.Client) (uint64, error) {
+		return cl.NonceAt(ctx, account, blockNumber)
+	})
+}
+
+func (p *Pool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return do(ctx, p, "eth_getLogs", func(cl *ethclient.Client) ([]types.Log, error) {
+		return cl.FilterLogs(ctx, q)
+	})
+}
+
+// CallContext — произвольный JSON-RPC вызов (debug_*, trace_* и т.п.).
+// Эндпоинт без такого метода пропускается без пометки о сбое.
+func (p *Pool) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	_, err := do(ctx, p, method, func(cl *ethclient.Client) (struct{}, error) {
+		return struct{}{}, cl.Client().CallContext(ctx, result, method, args...)
+	})
+	return err
+}
+
+// SubscribeNewHead подписывается через активный эндпоинт. Если пул потом
+// переключится на другой, подписка завершится с ErrFailover.
+func (p *Pool) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return p.subscribe(ctx, func(cl *ethclient.Client) (ethereum.Subscription, error) {
+		return cl.SubscribeNewHead(ctx, ch)
+	})
+}
+
+// SubscribePendingTransactions — newPendingTransactions с полными телами tx.
+// Завершается с ErrFailover так же, как подписка на головы.
+func (p *Pool) SubscribePendingTransactions(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error) {
+	return p.subscribe(ctx, func(cl *ethclient.Client) (ethereum.Subscription, error) {
+		return cl.Client().EthSubscribe(ctx, ch, "newPendingTransactions", true)
+	})
+}
+
+func (p *Pool) subscribe(ctx context.Context, fn func(cl *ethclient.Client) (ethereum.Subscription, error)) (ethereum.Subscription, error) {
+	p.mu.Lock()
+	before := p.switched
+	p.mu.Unlock()
+
+	var used *ethclient.Client
+	sub, err := do(ctx, p, "eth_subscribe", func(cl *ethclient.Client) (ethereum.Subscription, error) {
+		used = cl
+		return fn(cl)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// подписка на активном эндпоинте ждёт следующего переключения: то, что
+	// сделал сам do (упавший эндпоинт до этого), её уже не касается. Если
+	// подписались не на активный (у него нет подписок или он сменился, пока
+	// подписка устанавливалась), её завершит любое переключение с начала вызова.
+	p.mu.Lock()
+	switched := before
+	if p.endpoints[p.active].client == used {
+		switched = p.switched
+	}
+	p.mu.Unlock()
+	return newPoolSub(sub, switched), nil
+}
+
+// ConfirmBlock проверяет, что не меньше Quorum эндпоинтов видят блок num с этим
+// hash. Если здоровых эндпоинтов меньше Quorum, кворум временно снижается до
+// их числа (с предупреждением в лог): иначе обработка блоков встала бы до
+// возвращения упавших эндпоинтов.
+func (p *Pool) ConfirmBlock(ctx context.Context, num uint64, hash common.Hash) (bool, error) {
+	if p.cfg.Quorum <= 1 {
+		return true, nil
+	}
+
+	p.mu.Lock()
+	var clients []*ethclient.Client
+	for _, ep := range p.endpoints {
+		if ep.healthy && ep.client != nil {
+			clients = append(clients, ep.client)
+		}
+	}
+	quorum := p.cfg.Quorum
+	if len(clients) < quorum {
+		if !p.underQuorum {
+			log.Printf("[RPC] only %d healthy endpoint(s), quorum %d lowered until they recover", len(clients), quorum)
+		}
+		quorum = len(clients)
+	} else if p.underQuorum {
+		log.Printf("[RPC] %d healthy endpoint(s), quorum %d restored", len(clients), quorum)
+	}
+	p.underQuorum = len(clients) < p.cfg.Quorum
+	p.mu.Unlock()
+
+	if len(clients) == 0 {
+		return false, ErrNoEndpoints
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		agreed int
+	)
+	for _, cl := range clients {
+		wg.Add(1)
+		go func(cl *ethclient.Client) {
+			defer wg.Done()
+			h, err := cl.HeaderByNumber(cctx, new(big.Int).SetUint64(num))
+			if err != nil || h.Hash() != hash {
+				return
+			}
+			mu.Lock()
+			agreed++
+			mu.Unlock()
+		}(cl)
+	}
+	wg.Wait()
+
+	return agreed >= quorum, nil
+}
+
+func isRPCCode(err error, code int) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == code
+}
+
+// isRPCReply — нода ответила ошибкой JSON-RPC (в отличие от сбоя транспорта).
+func isRPCReply(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
+
+func dialEndpoint(ctx context.Context, rawURL string) (*ethclient.Client, *big.Int, error) {
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cl, err := ethclient.DialContext(dctx, rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial: %w", err)
+	}
+	// eth_chainId, а не net_version: у части сетей они различаются, а подписи
+	// и chain_id в БД завязаны на первый
+	chainID, err := cl.ChainID(dctx)
+	if err != nil {
+		cl.Close()
+		return nil, nil, fmt.Errorf("chain id: %w", err)
+	}
+	return cl, chainID, nil
+}
+
+func endpointName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "endpoint"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// poolSub — подписка конкретного эндпоинта, которая дополнительно
+// завершается при смене активного эндпоинта.
+type poolSub struct {
+	inner ethereum.Subscription
+	err   chan error
+	quit  chan struct{}
+	once  sync.Once
+}
+
+func newPoolSub(inner ethereum.Subscription, switched <-chan struct{}) *poolSub {
+	s := &poolSub{inner: inner, err: make(chan error, 1), quit: make(chan struct{})}
+	go func() {
+		select {
+		case err, ok := <-inner.Err():
+			if ok && err != nil {
+				s.err <- err
+			}
+		case <-switched:
+			inner.Unsubscribe()
+			s.err <- ErrFailover
+		case <-s.quit:
+		}
+	}()
+	return s
+}
+
+func (s *poolSub) Err() <-chan error { return s.err }
+
+func (s *poolSub) Unsubscribe() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.inner.Unsubscribe()
+	})
+}
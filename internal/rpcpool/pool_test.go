@@ -0,0 +1,388 @@
+package rpcpool
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakeNode — минимальная нода: eth_blockNumber, eth_getBlockByNumber, eth_call,
+// eth_chainId. fail — нода недоступна: HTTP 503 на любой запрос.
+type fakeNode struct {
+	mu    sync.Mutex
+	head  uint64
+	fail  bool
+	extra []byte // разные extra => разные hash у "одного и того же" блока
+	chain uint64 // 0 => 1
+}
+
+func (n *fakeNode) ChainId() (*hexutil.Big, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.chain == 0 {
+		return (*hexutil.Big)(big.NewInt(1)), nil
+	}
+	return (*hexutil.Big)(new(big.Int).SetUint64(n.chain)), nil
+}
+
+// Call — eth_call не-архивной ноды: старого состояния у неё нет.
+func (n *fakeNode) Call(args map[string]any, block string) (hexutil.Bytes, error) {
+	return nil, errors.New("missing trie node")
+}
+
+func (n *fakeNode) down() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.fail
+}
+
+func (n *fakeNode) BlockNumber() (hexutil.Uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return hexutil.Uint64(n.head), nil
+}
+
+func (n *fakeNode) GetBlockByNumber(num rpc.BlockNumber, full bool) (*types.Header, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return testHeader(uint64(num), n.extra), nil
+}
+
+func (n *fakeNode) set(head uint64, fail bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.head, n.fail = head, fail
+}
+
+func testHeader(num uint64, extra []byte) *types.Header {
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(num),
+		Difficulty: big.NewInt(0),
+		Extra:      extra,
+	}
+}
+
+// NewHeads — eth_subscribe("newHeads"): подписка живёт, пока её не закроют.
+func (n *fakeNode) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	return notifier.CreateSubscription(), nil
+}
+
+func startNode(t *testing.T, n *fakeNode) string {
+	return serveNode(t, n, false)
+}
+
+// startWSNode — та же нода по websocket (подписки работают только так).
+func startWSNode(t *testing.T, n *fakeNode) string {
+	return "ws" + strings.TrimPrefix(serveNode(t, n, true), "http")
+}
+
+func serveNode(t *testing.T, n *fakeNode, ws bool) string {
+	t.Helper()
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", n); err != nil {
+		t.Fatalf("register eth: %v", err)
+	}
+	var h http.Handler = srv
+	if ws {
+		h = srv.WebsocketHandler([]string{"*"})
+	}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.down() {
+			http.Error(w, "node is down", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		hs.Close()
+		srv.Stop()
+	})
+	return hs.URL
+}
+
+func TestPool_FailoverOnError(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	if id, _ := p.ChainID(ctx); id.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("expected chain id 1, got %s", id)
+	}
+
+	a.set(100, true)
+	b.set(101, false)
+
+	head, err := p.BlockNumber(ctx)
+	if err != nil || head != 101 {
+		t.Fatalf("expected failover to second endpoint (101), got=%d err=%v", head, err)
+	}
+	if p.active != 1 {
+		t.Fatalf("expected second endpoint to become active, got=%d", p.active)
+	}
+}
+
+func TestPool_HealthCheckSwitchesOnLag(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}, MaxLag: 3})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	b.set(102, false)
+	p.checkAll(ctx)
+	if p.active != 0 {
+		t.Fatalf("expected to stay on first endpoint within max lag")
+	}
+
+	b.set(110, false)
+	p.checkAll(ctx)
+	if p.active != 1 {
+		t.Fatalf("expected failover to the endpoint ahead by more than max lag")
+	}
+}
+
+func TestPool_HealthCheckDetectsStall(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}, StallTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	p.checkAll(ctx)
+	time.Sleep(40 * time.Millisecond)
+	b.set(101, false)
+	p.checkAll(ctx)
+
+	if p.active != 1 {
+		t.Fatalf("expected failover away from the stalled endpoint")
+	}
+}
+
+func TestPool_ConfirmBlock(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}, Quorum: 2})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	hash := testHeader(100, nil).Hash()
+
+	ok, err := p.ConfirmBlock(ctx, 100, hash)
+	if err != nil || !ok {
+		t.Fatalf("expected quorum agreement, ok=%v err=%v", ok, err)
+	}
+
+	b.mu.Lock()
+	b.extra = []byte("fork")
+	b.mu.Unlock()
+
+	ok, err = p.ConfirmBlock(ctx, 100, hash)
+	if err != nil || ok {
+		t.Fatalf("expected no quorum when one endpoint sees another hash, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestEndpointName_HidesSecrets(t *testing.T) {
+	got := endpointName("wss://eth-mainnet.g.alchemy.com/v2/secret-key")
+	if got != "wss://eth-mainnet.g.alchemy.com" {
+		t.Fatalf("unexpected endpoint name: %s", got)
+	}
+}
+
+func TestPool_MethodNotFoundIsNotFailover(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	// fakeNode не реализует eth_getBlockReceipts
+	_, err = p.BlockReceipts(ctx, rpc.BlockNumberOrHashWithNumber(100))
+	if !isRPCCode(err, codeMethodNotFound) {
+		t.Fatalf("expected method not found, got %v", err)
+	}
+	if p.active != 0 || !p.endpoints[0].healthy {
+		t.Fatalf("expected endpoint to stay active and healthy")
+	}
+}
+
+func TestPool_RPCErrorReplyIsNotFailover(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	// eth_call на старом блоке у не-архивной ноды — ответ, а не сбой
+	to := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	_, err = p.CallContract(ctx, ethereum.CallMsg{To: &to}, big.NewInt(1))
+	if err == nil || err.Error() != "missing trie node" {
+		t.Fatalf("expected the node's error reply unchanged, got %v", err)
+	}
+	if p.active != 0 || !p.endpoints[0].healthy {
+		t.Fatalf("expected endpoint to stay active and healthy")
+	}
+}
+
+func TestPool_SubscriptionSeesFailoverDuringSetup(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	// переключение случается, пока подписка устанавливается
+	sub, err := p.subscribe(ctx, func(cl *ethclient.Client) (ethereum.Subscription, error) {
+		p.mu.Lock()
+		p.endpoints[0].healthy = false
+		p.reselect("test")
+		p.mu.Unlock()
+		return event.NewSubscription(func(quit <-chan struct{}) error { <-quit; return nil }), nil
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case err := <-sub.Err():
+		if !errors.Is(err, ErrFailover) {
+			t.Fatalf("expected ErrFailover, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected subscription to end on failover during setup")
+	}
+}
+
+func TestPool_ConfirmBlockBelowQuorum(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}, Quorum: 2})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	b.set(100, true)
+	p.checkAll(ctx)
+
+	// остался один эндпоинт — кворум снижается, блоки не встают
+	ok, err := p.ConfirmBlock(ctx, 100, testHeader(100, nil).Hash())
+	if err != nil || !ok {
+		t.Fatalf("expected confirmation by the remaining endpoint, ok=%v err=%v", ok, err)
+	}
+
+	a.set(100, true)
+	p.checkAll(ctx)
+	if _, err := p.ConfirmBlock(ctx, 100, testHeader(100, nil).Hash()); !errors.Is(err, ErrNoEndpoints) {
+		t.Fatalf("expected ErrNoEndpoints without healthy endpoints, got %v", err)
+	}
+}
+
+func TestPool_DialRejectsMixedChains(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100, chain: 137}
+
+	if _, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startNode(t, b)}}); err == nil {
+		t.Fatalf("expected Dial to fail when endpoints report different chain ids")
+	}
+}
+
+func TestPool_HTTPEndpointWithoutSubscriptionsStaysHealthy(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	// http первым, ws вторым — конфиг такое пропускает
+	p, err := Dial(ctx, Config{URLs: []string{startNode(t, a), startWSNode(t, b)}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	sub, err := p.SubscribeNewHead(ctx, make(chan *types.Header, 1))
+	if err != nil {
+		t.Fatalf("SubscribeNewHead: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if p.active != 0 || !p.endpoints[0].healthy {
+		t.Fatalf("expected the http endpoint to stay active and healthy")
+	}
+	select {
+	case err := <-sub.Err():
+		t.Fatalf("expected subscription on the ws endpoint to live, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPool_SubscriptionSurvivesOwnFailover(t *testing.T) {
+	ctx := context.Background()
+	a, b := &fakeNode{head: 100}, &fakeNode{head: 100}
+
+	p, err := Dial(ctx, Config{URLs: []string{startWSNode(t, a), startWSNode(t, b)}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	// первый эндпоинт падает: do сам переключится на второй и подпишется там
+	a.set(100, true)
+	p.endpoints[0].client.Close()
+
+	sub, err := p.SubscribeNewHead(ctx, make(chan *types.Header, 1))
+	if err != nil {
+		t.Fatalf("SubscribeNewHead: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if p.active != 1 {
+		t.Fatalf("expected failover to the second endpoint, got=%d", p.active)
+	}
+	select {
+	case err := <-sub.Err():
+		t.Fatalf("expected subscription after failover to live, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
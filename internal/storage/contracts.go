@@ -1,12 +1,45 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Repository interface {
 	EnsureSchema(ctx context.Context) error
 
 	UpsertTx(ctx context.Context, tx TxRecord) error
-	AddChatEvent(ctx context.Context, chatID int64, txHash string, eventType TxEventType) error
+	// MarkTxReorged сбрасывает блок/время/статус у транзакции, выпавшей из канонической цепочки.
+	MarkTxReorged(ctx context.Context, hash string) error
+	// AddChatEvent пишет событие чата по tx; false — такое событие уже было
+	// (ключ chat_tx — ключ идемпотентности доставки уведомлений).
+	AddChatEvent(ctx context.Context, chatID int64, txHash string, eventType TxEventType) (bool, error)
+	// HasChatEvent — есть ли уже такое событие чата по tx.
+	HasChatEvent(ctx context.Context, chatID int64, txHash string, eventType TxEventType) (bool, error)
+	// RemoveChatEvent снимает событие, чтобы о нём можно было сообщить снова.
+	RemoveChatEvent(ctx context.Context, chatID int64, txHash string, eventType TxEventType) error
+	// ListPendingTxs — pending tx сети с уведомлениями не раньше since (см. PendingTxRecord).
+	ListPendingTxs(ctx context.Context, chainID string, since time.Time) ([]PendingTxRecord, error)
+	// UpsertTokenTransfers сохраняет переводы токенов; транзакция уже должна быть в БД.
+	UpsertTokenTransfers(ctx context.Context, transfers []TokenTransferRecord) error
 
 	ListHistory(ctx context.Context, chatID int64, limit int) ([]HistoryItem, error)
+
+	UpsertSubscription(ctx context.Context, sub SubscriptionRecord) error
+	DeleteSubscription(ctx context.Context, chainID string, chatID int64) error
+	ListSubscriptions(ctx context.Context) ([]SubscriptionRecord, error)
+
+	GetCheckpoint(ctx context.Context, chainID string) (*Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, cp Checkpoint) error
+
+	// AddHeldNotification сохраняет уведомление, ждущее глубины блока, до того
+	// как чекпоинт уйдёт за его блок; повторная запись (чат, tx) его заменяет.
+	AddHeldNotification(ctx context.Context, n HeldNotificationRecord) error
+	DeleteHeldNotification(ctx context.Context, chainID string, chatID int64, txHash string) error
+	ListHeldNotifications(ctx context.Context, chainID string) ([]HeldNotificationRecord, error)
+
+	// SetChatNetwork запоминает сеть (chain_id), выбранную в чате.
+	SetChatNetwork(ctx context.Context, chatID int64, chainID string) error
+	// ListChatNetworks — выбранные сети по чатам: chat_id -> chain_id.
+	ListChatNetworks(ctx context.Context) (map[int64]string, error)
 }
@@ -2,11 +2,14 @@ package pg
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/pvzzle/scanblock/internal/storage"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -40,15 +43,152 @@ CREATE TABLE IF NOT EXISTS transactions (
   updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS gas_used BIGINT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS effective_gas_price_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS method_selector TEXT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_fee_per_gas_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_priority_fee_per_gas_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS base_fee_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_gas BIGINT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_fee_cap_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_gas_price_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_hashes INT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_contracts TEXT[] NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS value_usd NUMERIC(24,2) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS revert_reason TEXT NULL;
+
 CREATE TABLE IF NOT EXISTS chat_tx (
   chat_id BIGINT NOT NULL,
   tx_hash TEXT NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
-  event_type TEXT NOT NULL, -- search|notify
+  event_type TEXT NOT NULL, -- search|notify|reorg|pending|dropped|replaced|stuck
   created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
   PRIMARY KEY (chat_id, tx_hash, event_type)
 );
 
 CREATE INDEX IF NOT EXISTS chat_tx_chat_created_idx ON chat_tx(chat_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS chat_tx_event_created_idx ON chat_tx(event_type, created_at);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+  chat_id BIGINT PRIMARY KEY,
+
+  large_tx_min_wei NUMERIC(78,0) NULL,
+  wallet_addr      TEXT NULL,
+
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS notify_level TEXT NOT NULL DEFAULT 'latest';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS notify_confirmations BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS large_tx_min_usd NUMERIC(24,2) NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS gas_metric TEXT NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS gas_direction TEXT NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS gas_threshold_wei NUMERIC(78,0) NULL;
+
+CREATE TABLE IF NOT EXISTS token_subscriptions (
+  chat_id    BIGINT NOT NULL REFERENCES subscriptions(chat_id) ON DELETE CASCADE,
+  token_addr TEXT NOT NULL,
+
+  min_amount NUMERIC(78,0) NOT NULL,
+  decimals   SMALLINT NOT NULL,
+  symbol     TEXT NOT NULL DEFAULT '',
+
+  PRIMARY KEY (chat_id, token_addr)
+);
+
+CREATE TABLE IF NOT EXISTS contract_subscriptions (
+  chat_id       BIGINT NOT NULL REFERENCES subscriptions(chat_id) ON DELETE CASCADE,
+  contract_addr TEXT NOT NULL,
+
+  abi    JSONB NOT NULL,
+  events TEXT[] NOT NULL DEFAULT '{}',
+
+  PRIMARY KEY (chat_id, contract_addr)
+);
+
+-- подписка без ABI (на только что задеплоенный контракт) — все логи без расшифровки
+ALTER TABLE contract_subscriptions ALTER COLUMN abi DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS token_transfers (
+  tx_hash   TEXT NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  log_index INT NOT NULL,
+  seq       INT NOT NULL DEFAULT 0,
+
+  standard   TEXT NOT NULL, -- erc20|erc721|erc1155
+  token_addr TEXT NOT NULL,
+  from_addr  TEXT NOT NULL,
+  to_addr    TEXT NOT NULL,
+  token_id   NUMERIC(78,0) NULL,
+  amount     NUMERIC(78,0) NOT NULL,
+
+  PRIMARY KEY (tx_hash, log_index, seq)
+);
+
+ALTER TABLE token_transfers ADD COLUMN IF NOT EXISTS value_usd NUMERIC(24,2) NULL;
+
+CREATE TABLE IF NOT EXISTS chain_checkpoints (
+  chain_id TEXT PRIMARY KEY,
+
+  block_number BIGINT NOT NULL,
+  block_hash   TEXT NOT NULL,
+
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS held_notifications (
+  chain_id  TEXT NOT NULL,
+  chat_id   BIGINT NOT NULL,
+  tx_hash   TEXT NOT NULL,
+
+  block_number BIGINT NOT NULL,
+  messages     JSONB NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (chain_id, chat_id, tx_hash)
+);
+
+-- сеть, выбранная в чате (chain_id), переживает рестарт бота
+CREATE TABLE IF NOT EXISTS chat_settings (
+  chat_id  BIGINT PRIMARY KEY,
+  chain_id TEXT NOT NULL,
+
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- подписки по сетям: ключ (chat_id, chain_id). Подписки до мультичейна относим
+-- к сети, которую обрабатывал бот (единственный checkpoint), иначе — к mainnet
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS chain_id TEXT NOT NULL DEFAULT '1';
+ALTER TABLE token_subscriptions ADD COLUMN IF NOT EXISTS chain_id TEXT NOT NULL DEFAULT '1';
+ALTER TABLE contract_subscriptions ADD COLUMN IF NOT EXISTS chain_id TEXT NOT NULL DEFAULT '1';
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'subscriptions_chat_chain_pkey') THEN
+    UPDATE subscriptions SET chain_id = (SELECT chain_id FROM chain_checkpoints)
+    WHERE (SELECT count(*) FROM chain_checkpoints) = 1;
+    UPDATE token_subscriptions SET chain_id = (SELECT chain_id FROM chain_checkpoints)
+    WHERE (SELECT count(*) FROM chain_checkpoints) = 1;
+    UPDATE contract_subscriptions SET chain_id = (SELECT chain_id FROM chain_checkpoints)
+    WHERE (SELECT count(*) FROM chain_checkpoints) = 1;
+
+    ALTER TABLE token_subscriptions DROP CONSTRAINT IF EXISTS token_subscriptions_chat_id_fkey;
+    ALTER TABLE contract_subscriptions DROP CONSTRAINT IF EXISTS contract_subscriptions_chat_id_fkey;
+    ALTER TABLE token_subscriptions DROP CONSTRAINT IF EXISTS token_subscriptions_pkey;
+    ALTER TABLE contract_subscriptions DROP CONSTRAINT IF EXISTS contract_subscriptions_pkey;
+    ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_pkey;
+
+    ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_chat_chain_pkey PRIMARY KEY (chat_id, chain_id);
+    ALTER TABLE token_subscriptions ADD CONSTRAINT token_subscriptions_pkey PRIMARY KEY (chat_id, chain_id, token_addr);
+    ALTER TABLE contract_subscriptions ADD CONSTRAINT contract_subscriptions_pkey PRIMARY KEY (chat_id, chain_id, contract_addr);
+    ALTER TABLE token_subscriptions ADD CONSTRAINT token_subscriptions_chat_chain_fkey
+      FOREIGN KEY (chat_id, chain_id) REFERENCES subscriptions(chat_id, chain_id) ON DELETE CASCADE;
+    ALTER TABLE contract_subscriptions ADD CONSTRAINT contract_subscriptions_chat_chain_fkey
+      FOREIGN KEY (chat_id, chain_id) REFERENCES subscriptions(chat_id, chain_id) ON DELETE CASCADE;
+
+    ALTER TABLE subscriptions ALTER COLUMN chain_id DROP DEFAULT;
+    ALTER TABLE token_subscriptions ALTER COLUMN chain_id DROP DEFAULT;
+    ALTER TABLE contract_subscriptions ALTER COLUMN chain_id DROP DEFAULT;
+  END IF;
+END $$;
 `
 	_, err := r.pool.Exec(ctx, ddl)
 	return err
@@ -64,6 +204,20 @@ func (r *Postgres) UpsertTx(ctx context.Context, tx storage.TxRecord) error {
 		toAddr    any = nil
 		gasPrice  any = nil
 		status    any = nil
+		gasUsed   any = nil
+		effPrice  any = nil
+		selector  any = nil
+
+		maxFee      any = nil
+		maxPriority any = nil
+		baseFee     any = nil
+		blobGas     any = nil
+		blobFeeCap  any = nil
+		blobPrice   any = nil
+		blobHashes  any = nil
+		created     any = nil
+		valueUSD    any = nil
+		revert      any = nil
 	)
 
 	if tx.BlockNum != nil {
@@ -81,16 +235,69 @@ func (r *Postgres) UpsertTx(ctx context.Context, tx storage.TxRecord) error {
 	if tx.Status != nil {
 		status = int16(*tx.Status)
 	}
+	if tx.GasUsed != nil {
+		gasUsed = int64(*tx.GasUsed)
+	}
+	if tx.EffectiveGasPriceWei != nil {
+		effPrice = *tx.EffectiveGasPriceWei
+	}
+	if tx.MethodSelector != nil {
+		selector = *tx.MethodSelector
+	}
+	if tx.MaxFeePerGasWei != nil {
+		maxFee = *tx.MaxFeePerGasWei
+	}
+	if tx.MaxPriorityFeePerGasWei != nil {
+		maxPriority = *tx.MaxPriorityFeePerGasWei
+	}
+	if tx.BaseFeeWei != nil {
+		baseFee = *tx.BaseFeeWei
+	}
+	if tx.BlobGas != nil {
+		blobGas = int64(*tx.BlobGas)
+	}
+	if tx.BlobFeeCapWei != nil {
+		blobFeeCap = *tx.BlobFeeCapWei
+	}
+	if tx.BlobGasPriceWei != nil {
+		blobPrice = *tx.BlobGasPriceWei
+	}
+	if tx.BlobHashes != nil {
+		blobHashes = *tx.BlobHashes
+	}
+	if len(tx.CreatedContracts) > 0 {
+		created = tx.CreatedContracts
+	}
+	if tx.ValueUSD != nil {
+		valueUSD = *tx.ValueUSD
+	}
+	if tx.RevertReason != nil {
+		revert = *tx.RevertReason
+	}
 
 	q := `
 INSERT INTO transactions(
   hash, chain_id, block_number, block_time,
   from_addr, to_addr,
-  value_wei, nonce, tx_type, gas, gas_price_wei, status
+  value_wei, nonce, tx_type, gas, gas_price_wei, status,
+  gas_used, effective_gas_price_wei,
+  method_selector,
+  max_fee_per_gas_wei, max_priority_fee_per_gas_wei, base_fee_wei,
+  blob_gas, blob_fee_cap_wei, blob_gas_price_wei, blob_hashes,
+  created_contracts,
+  value_usd,
+  revert_reason
 ) VALUES (
   $1, $2, $3, $4,
   $5, $6,
-  $7::numeric, $8, $9, $10, $11::numeric, $12
+  $7::numeric, $8, $9, $10, $11::numeric, $12,
+  $13, $14::numeric,
+  $15,
+  $16::numeric, $17::numeric, $18::numeric,
+  $19, $20::numeric, $21::numeric, $22,
+  $23,
+  $24::numeric,
+  $25
 )
 ON CONFLICT(hash) DO UPDATE SET
   chain_id = EXCLUDED.chain_id,
@@ -104,28 +311,185 @@ ON CONFLICT(hash) DO UPDATE SET
   gas          = EXCLUDED.gas,
   gas_price_wei = COALESCE(EXCLUDED.gas_price_wei, transactions.gas_price_wei),
   status       = COALESCE(EXCLUDED.status, transactions.status),
+  gas_used     = COALESCE(EXCLUDED.gas_used, transactions.gas_used),
+  effective_gas_price_wei = COALESCE(EXCLUDED.effective_gas_price_wei, transactions.effective_gas_price_wei),
+  method_selector = COALESCE(EXCLUDED.method_selector, transactions.method_selector),
+  max_fee_per_gas_wei          = COALESCE(EXCLUDED.max_fee_per_gas_wei, transactions.max_fee_per_gas_wei),
+  max_priority_fee_per_gas_wei = COALESCE(EXCLUDED.max_priority_fee_per_gas_wei, transactions.max_priority_fee_per_gas_wei),
+  base_fee_wei       = COALESCE(EXCLUDED.base_fee_wei, transactions.base_fee_wei),
+  blob_gas           = COALESCE(EXCLUDED.blob_gas, transactions.blob_gas),
+  blob_fee_cap_wei   = COALESCE(EXCLUDED.blob_fee_cap_wei, transactions.blob_fee_cap_wei),
+  blob_gas_price_wei = COALESCE(EXCLUDED.blob_gas_price_wei, transactions.blob_gas_price_wei),
+  blob_hashes        = COALESCE(EXCLUDED.blob_hashes, transactions.blob_hashes),
+  created_contracts  = COALESCE(EXCLUDED.created_contracts, transactions.created_contracts),
+  value_usd          = COALESCE(EXCLUDED.value_usd, transactions.value_usd),
+  revert_reason      = COALESCE(EXCLUDED.revert_reason, transactions.revert_reason),
   updated_at   = now()
 `
 	_, err := r.pool.Exec(cctx, q,
 		tx.Hash, tx.ChainID, blockNum, blockTime,
 		tx.FromAddr, toAddr,
 		tx.ValueWei, int64(tx.Nonce), int(tx.TxType), int64(tx.Gas), gasPrice, status,
+		gasUsed, effPrice,
+		selector,
+		maxFee, maxPriority, baseFee,
+		blobGas, blobFeeCap, blobPrice, blobHashes,
+		created,
+		valueUSD,
+		revert,
 	)
 	return err
 }
 
-func (r *Postgres) AddChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) error {
+func (r *Postgres) MarkTxReorged(ctx context.Context, hash string) error {
 	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	_, err := r.pool.Exec(cctx,
+	_, err := r.pool.Exec(cctx, `
+UPDATE transactions SET
+  block_number = NULL,
+  block_time   = NULL,
+  status       = NULL,
+  gas_used     = NULL,
+  effective_gas_price_wei = NULL,
+  base_fee_wei       = NULL,
+  blob_gas_price_wei = NULL,
+  created_contracts  = NULL,
+  value_usd          = NULL,
+  revert_reason      = NULL,
+  updated_at   = now()
+WHERE hash = $1
+`, hash)
+	return err
+}
+
+func (r *Postgres) AddChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) (bool, error) {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	tag, err := r.pool.Exec(cctx,
 		`INSERT INTO chat_tx(chat_id, tx_hash, event_type) VALUES ($1, $2, $3)
 		 ON CONFLICT DO NOTHING`,
 		chatID, txHash, string(eventType),
 	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *Postgres) HasChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) (bool, error) {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var ok bool
+	err := r.pool.QueryRow(cctx,
+		`SELECT EXISTS (SELECT 1 FROM chat_tx WHERE chat_id = $1 AND tx_hash = $2 AND event_type = $3)`,
+		chatID, txHash, string(eventType),
+	).Scan(&ok)
+	return ok, err
+}
+
+func (r *Postgres) RemoveChatEvent(ctx context.Context, chatID int64, txHash string, eventType storage.TxEventType) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err := r.pool.Exec(cctx,
+		`DELETE FROM chat_tx WHERE chat_id = $1 AND tx_hash = $2 AND event_type = $3`,
+		chatID, txHash, string(eventType),
+	)
 	return err
 }
 
+func (r *Postgres) ListPendingTxs(ctx context.Context, chainID string, since time.Time) ([]storage.PendingTxRecord, error) {
+	cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := r.pool.Query(cctx, `
+SELECT
+  t.hash,
+  t.from_addr,
+  t.to_addr,
+  t.value_wei::text,
+  t.nonce,
+  t.tx_type,
+  t.gas,
+  t.gas_price_wei::text,
+  t.max_fee_per_gas_wei::text,
+  t.method_selector,
+  array_agg(c.chat_id ORDER BY c.chat_id),
+  min(c.created_at)
+FROM chat_tx c
+JOIN transactions t ON t.hash = c.tx_hash
+WHERE c.event_type = 'pending'
+  AND c.created_at >= $2
+  AND t.chain_id = $1
+  AND t.block_number IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM chat_tx g
+    WHERE g.tx_hash = t.hash AND g.event_type IN ('notify', 'dropped', 'replaced')
+  )
+GROUP BY t.hash
+ORDER BY min(c.created_at)
+`, chainID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.PendingTxRecord
+	for rows.Next() {
+		var (
+			p     storage.PendingTxRecord
+			nonce int64
+			typ   int32
+			gas   int64
+		)
+		p.Tx.ChainID = chainID
+		if err := rows.Scan(
+			&p.Tx.Hash, &p.Tx.FromAddr, &p.Tx.ToAddr, &p.Tx.ValueWei,
+			&nonce, &typ, &gas,
+			&p.Tx.GasPriceWei, &p.Tx.MaxFeePerGasWei, &p.Tx.MethodSelector,
+			&p.ChatIDs, &p.SeenAt,
+		); err != nil {
+			return nil, err
+		}
+		p.Tx.Nonce, p.Tx.TxType, p.Tx.Gas = uint64(nonce), uint8(typ), uint64(gas)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *Postgres) UpsertTokenTransfers(ctx context.Context, transfers []storage.TokenTransferRecord) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	q := `
+INSERT INTO token_transfers(tx_hash, log_index, seq, standard, token_addr, from_addr, to_addr, token_id, amount, value_usd)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8::numeric, $9::numeric, $10::numeric)
+ON CONFLICT(tx_hash, log_index, seq) DO UPDATE SET
+  value_usd = COALESCE(token_transfers.value_usd, EXCLUDED.value_usd)
+`
+	batch := &pgx.Batch{}
+	for _, t := range transfers {
+		var (
+			tokenID  any = nil
+			valueUSD any = nil
+		)
+		if t.TokenID != nil {
+			tokenID = *t.TokenID
+		}
+		if t.ValueUSD != nil {
+			valueUSD = *t.ValueUSD
+		}
+		batch.Queue(q, t.TxHash, int64(t.LogIndex), t.Seq, t.Standard, t.TokenAddr, t.FromAddr, t.ToAddr, tokenID, t.Amount, valueUSD)
+	}
+	return r.pool.SendBatch(cctx, batch).Close()
+}
+
 func (r *Postgres) ListHistory(ctx context.Context, chatID int64, limit int) ([]storage.HistoryItem, error) {
 	if limit <= 0 {
 		limit = 10
@@ -138,11 +502,13 @@ SELECT
   c.created_at,
   c.event_type,
   t.hash,
+  t.chain_id,
   t.block_number,
   t.block_time,
   t.from_addr,
   t.to_addr,
   t.value_wei::text,
+  t.value_usd::text,
   t.status
 FROM chat_tx c
 JOIN transactions t ON t.hash = c.tx_hash
@@ -162,15 +528,17 @@ LIMIT $2
 			at        time.Time
 			etype     string
 			hash      string
+			chainID   string
 			blockNum  *int64
 			blockTime *time.Time
 			from      string
 			to        *string
 			valueWei  string
+			valueUSD  *string
 			status    *int16
 		)
 
-		if err := rows.Scan(&at, &etype, &hash, &blockNum, &blockTime, &from, &to, &valueWei, &status); err != nil {
+		if err := rows.Scan(&at, &etype, &hash, &chainID, &blockNum, &blockTime, &from, &to, &valueWei, &valueUSD, &status); err != nil {
 			return nil, err
 		}
 
@@ -187,8 +555,8 @@ LIMIT $2
 
 		out = append(out, storage.HistoryItem{
 			At: at, EventType: storage.TxEventType(etype),
-			Hash: hash, BlockNum: bn, BlockTime: blockTime,
-			FromAddr: from, ToAddr: to, ValueWei: valueWei, Status: st,
+			Hash: hash, ChainID: chainID, BlockNum: bn, BlockTime: blockTime,
+			FromAddr: from, ToAddr: to, ValueWei: valueWei, ValueUSD: valueUSD, Status: st,
 		})
 	}
 
@@ -196,7 +564,403 @@ LIMIT $2
 		return nil, rows.Err()
 	}
 
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	hashes := make([]string, 0, len(out))
+	for _, it := range out {
+		hashes = append(hashes, it.Hash)
+	}
+	transfers, err := r.listTokenTransfers(cctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Transfers = transfers[out[i].Hash]
+	}
+
+	return out, nil
+}
+
+func (r *Postgres) listTokenTransfers(ctx context.Context, hashes []string) (map[string][]storage.TokenTransferRecord, error) {
+	rows, err := r.pool.Query(ctx, `
+SELECT tx_hash, log_index, seq, standard, token_addr, from_addr, to_addr, token_id::text, amount::text, value_usd::text
+FROM token_transfers
+WHERE tx_hash = ANY($1)
+ORDER BY tx_hash, log_index, seq
+`, hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]storage.TokenTransferRecord)
+	for rows.Next() {
+		var (
+			t        storage.TokenTransferRecord
+			logIndex int64
+		)
+		if err := rows.Scan(&t.TxHash, &logIndex, &t.Seq, &t.Standard, &t.TokenAddr, &t.FromAddr, &t.ToAddr, &t.TokenID, &t.Amount, &t.ValueUSD); err != nil {
+			return nil, err
+		}
+		t.LogIndex = uint(logIndex)
+		out[t.TxHash] = append(out[t.TxHash], t)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
 	return out, nil
 }
 
+// UpsertSubscription перезаписывает подписки чата в сети sub.ChainID целиком,
+// включая пороги по токенам.
+func (r *Postgres) UpsertSubscription(ctx context.Context, sub storage.SubscriptionRecord) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var (
+		largeMin    any = nil
+		largeMinUSD any = nil
+		wallet      any = nil
+
+		gasMetric    any = nil
+		gasDirection any = nil
+		gasThreshold any = nil
+	)
+	if sub.LargeTxMinWei != nil {
+		largeMin = *sub.LargeTxMinWei
+	}
+	if sub.LargeTxMinUSD != nil {
+		largeMinUSD = *sub.LargeTxMinUSD
+	}
+	if sub.WalletAddr != nil {
+		wallet = *sub.WalletAddr
+	}
+	if sub.Gas != nil {
+		gasMetric, gasDirection, gasThreshold = sub.Gas.Metric, sub.Gas.Direction, sub.Gas.ThresholdWei
+	}
+
+	tx, err := r.pool.Begin(cctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(cctx) }()
+
+	q := `
+INSERT INTO subscriptions(chat_id, chain_id, large_tx_min_wei, wallet_addr, notify_level, notify_confirmations, large_tx_min_usd,
+  gas_metric, gas_direction, gas_threshold_wei)
+VALUES ($1, $2, $3::numeric, $4, $5, $6, $7::numeric, $8, $9, $10::numeric)
+ON CONFLICT(chat_id, chain_id) DO UPDATE SET
+  large_tx_min_wei     = EXCLUDED.large_tx_min_wei,
+  large_tx_min_usd     = EXCLUDED.large_tx_min_usd,
+  wallet_addr          = EXCLUDED.wallet_addr,
+  notify_level         = EXCLUDED.notify_level,
+  notify_confirmations = EXCLUDED.notify_confirmations,
+  gas_metric           = EXCLUDED.gas_metric,
+  gas_direction        = EXCLUDED.gas_direction,
+  gas_threshold_wei    = EXCLUDED.gas_threshold_wei,
+  updated_at           = now()
+`
+	level := sub.NotifyLevel
+	if level == "" {
+		level = "latest"
+	}
+	if _, err := tx.Exec(cctx, q, sub.ChatID, sub.ChainID, largeMin, wallet, level, int64(sub.Confirmations), largeMinUSD,
+		gasMetric, gasDirection, gasThreshold); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(cctx, `DELETE FROM token_subscriptions WHERE chat_id = $1 AND chain_id = $2`, sub.ChatID, sub.ChainID); err != nil {
+		return err
+	}
+	for _, t := range sub.Tokens {
+		_, err := tx.Exec(cctx, `
+INSERT INTO token_subscriptions(chat_id, chain_id, token_addr, min_amount, decimals, symbol)
+VALUES ($1, $2, $3, $4::numeric, $5, $6)
+`, sub.ChatID, sub.ChainID, t.TokenAddr, t.MinAmount, int16(t.Decimals), t.Symbol)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(cctx, `DELETE FROM contract_subscriptions WHERE chat_id = $1 AND chain_id = $2`, sub.ChatID, sub.ChainID); err != nil {
+		return err
+	}
+	for _, c := range sub.Contracts {
+		events := c.Events
+		if events == nil {
+			events = []string{}
+		}
+		_, err := tx.Exec(cctx, `
+INSERT INTO contract_subscriptions(chat_id, chain_id, contract_addr, abi, events)
+VALUES ($1, $2, $3, NULLIF($4, '')::jsonb, $5)
+`, sub.ChatID, sub.ChainID, c.ContractAddr, c.ABI, events)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(cctx)
+}
+
+func (r *Postgres) DeleteSubscription(ctx context.Context, chainID string, chatID int64) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	// token_subscriptions и contract_subscriptions удаляются каскадом
+	_, err := r.pool.Exec(cctx, `DELETE FROM subscriptions WHERE chat_id = $1 AND chain_id = $2`, chatID, chainID)
+	return err
+}
+
+func (r *Postgres) ListSubscriptions(ctx context.Context) ([]storage.SubscriptionRecord, error) {
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := r.pool.Query(cctx, `
+SELECT chat_id, chain_id, large_tx_min_wei::text, large_tx_min_usd::text, wallet_addr, notify_level, notify_confirmations,
+  gas_metric, gas_direction, gas_threshold_wei::text
+FROM subscriptions
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type subKey struct {
+		chatID  int64
+		chainID string
+	}
+	var out []storage.SubscriptionRecord
+	idx := make(map[subKey]int)
+	for rows.Next() {
+		var (
+			sub           storage.SubscriptionRecord
+			confirmations int64
+
+			gasMetric, gasDirection, gasThreshold *string
+		)
+		if err := rows.Scan(&sub.ChatID, &sub.ChainID, &sub.LargeTxMinWei, &sub.LargeTxMinUSD, &sub.WalletAddr, &sub.NotifyLevel, &confirmations,
+			&gasMetric, &gasDirection, &gasThreshold); err != nil {
+			return nil, err
+		}
+		sub.Confirmations = uint64(confirmations)
+		if gasMetric != nil && gasDirection != nil && gasThreshold != nil {
+			sub.Gas = &storage.GasSubscription{Metric: *gasMetric, Direction: *gasDirection, ThresholdWei: *gasThreshold}
+		}
+		idx[subKey{sub.ChatID, sub.ChainID}] = len(out)
+		out = append(out, sub)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	trows, err := r.pool.Query(cctx, `
+SELECT chat_id, chain_id, token_addr, min_amount::text, decimals, symbol
+FROM token_subscriptions
+ORDER BY chat_id, chain_id, token_addr
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer trows.Close()
+
+	for trows.Next() {
+		var (
+			key      subKey
+			t        storage.TokenSubscription
+			decimals int16
+		)
+		if err := trows.Scan(&key.chatID, &key.chainID, &t.TokenAddr, &t.MinAmount, &decimals, &t.Symbol); err != nil {
+			return nil, err
+		}
+		t.Decimals = uint8(decimals)
+		if i, ok := idx[key]; ok {
+			out[i].Tokens = append(out[i].Tokens, t)
+		}
+	}
+
+	if trows.Err() != nil {
+		return nil, trows.Err()
+	}
+
+	crows, err := r.pool.Query(cctx, `
+SELECT chat_id, chain_id, contract_addr, COALESCE(abi::text, ''), events
+FROM contract_subscriptions
+ORDER BY chat_id, chain_id, contract_addr
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer crows.Close()
+
+	for crows.Next() {
+		var (
+			key subKey
+			c   storage.ContractSubscription
+		)
+		if err := crows.Scan(&key.chatID, &key.chainID, &c.ContractAddr, &c.ABI, &c.Events); err != nil {
+			return nil, err
+		}
+		if len(c.Events) == 0 {
+			c.Events = nil
+		}
+		if i, ok := idx[key]; ok {
+			out[i].Contracts = append(out[i].Contracts, c)
+		}
+	}
+
+	if crows.Err() != nil {
+		return nil, crows.Err()
+	}
+
+	return out, nil
+}
+
+// GetCheckpoint возвращает nil, если сеть ещё ни разу не обрабатывалась.
+func (r *Postgres) GetCheckpoint(ctx context.Context, chainID string) (*storage.Checkpoint, error) {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var (
+		blockNum  int64
+		blockHash string
+	)
+	err := r.pool.QueryRow(cctx,
+		`SELECT block_number, block_hash FROM chain_checkpoints WHERE chain_id = $1`,
+		chainID,
+	).Scan(&blockNum, &blockHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.Checkpoint{ChainID: chainID, BlockNum: uint64(blockNum), BlockHash: blockHash}, nil
+}
+
+func (r *Postgres) SaveCheckpoint(ctx context.Context, cp storage.Checkpoint) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	q := `
+INSERT INTO chain_checkpoints(chain_id, block_number, block_hash)
+VALUES ($1, $2, $3)
+ON CONFLICT(chain_id) DO UPDATE SET
+  block_number = EXCLUDED.block_number,
+  block_hash   = EXCLUDED.block_hash,
+  updated_at   = now()
+`
+	_, err := r.pool.Exec(cctx, q, cp.ChainID, int64(cp.BlockNum), cp.BlockHash)
+	return err
+}
+
+func (r *Postgres) AddHeldNotification(ctx context.Context, n storage.HeldNotificationRecord) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	messages, err := json.Marshal(n.Messages)
+	if err != nil {
+		return fmt.Errorf("marshal held messages: %w", err)
+	}
+
+	q := `
+INSERT INTO held_notifications(chain_id, chat_id, tx_hash, block_number, messages)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT(chain_id, chat_id, tx_hash) DO UPDATE SET
+  block_number = EXCLUDED.block_number,
+  messages     = EXCLUDED.messages
+`
+	_, err = r.pool.Exec(cctx, q, n.ChainID, n.ChatID, n.TxHash, int64(n.BlockNum), messages)
+	return err
+}
+
+func (r *Postgres) DeleteHeldNotification(ctx context.Context, chainID string, chatID int64, txHash string) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err := r.pool.Exec(cctx,
+		`DELETE FROM held_notifications WHERE chain_id = $1 AND chat_id = $2 AND tx_hash = $3`,
+		chainID, chatID, txHash,
+	)
+	return err
+}
+
+func (r *Postgres) ListHeldNotifications(ctx context.Context, chainID string) ([]storage.HeldNotificationRecord, error) {
+	cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := r.pool.Query(cctx, `
+SELECT chat_id, tx_hash, block_number, messages
+FROM held_notifications
+WHERE chain_id = $1
+ORDER BY block_number, created_at
+`, chainID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.HeldNotificationRecord
+	for rows.Next() {
+		var (
+			n        = storage.HeldNotificationRecord{ChainID: chainID}
+			blockNum int64
+			messages []byte
+		)
+		if err := rows.Scan(&n.ChatID, &n.TxHash, &blockNum, &messages); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(messages, &n.Messages); err != nil {
+			return nil, fmt.Errorf("held notification %d/%s: %w", n.ChatID, n.TxHash, err)
+		}
+		n.BlockNum = uint64(blockNum)
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (r *Postgres) SetChatNetwork(ctx context.Context, chatID int64, chainID string) error {
+	cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	q := `
+INSERT INTO chat_settings(chat_id, chain_id)
+VALUES ($1, $2)
+ON CONFLICT(chat_id) DO UPDATE SET
+  chain_id   = EXCLUDED.chain_id,
+  updated_at = now()
+`
+	_, err := r.pool.Exec(cctx, q, chatID, chainID)
+	return err
+}
+
+func (r *Postgres) ListChatNetworks(ctx context.Context) (map[int64]string, error) {
+	cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := r.pool.Query(cctx, `SELECT chat_id, chain_id FROM chat_settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64]string)
+	for rows.Next() {
+		var (
+			chatID  int64
+			chainID string
+		)
+		if err := rows.Scan(&chatID, &chainID); err != nil {
+			return nil, err
+		}
+		out[chatID] = chainID
+	}
+	return out, rows.Err()
+}
+
 func (r *Postgres) String() string { return fmt.Sprintf("pgrepo(%p)", r.pool) }
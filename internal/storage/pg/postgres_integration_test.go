@@ -4,12 +4,14 @@ package pg_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
-	"scanblock/internal/storage"
-	"scanblock/internal/storage/pg"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/storage"
+	"github.com/pvzzle/scanblock/internal/storage/pg"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -44,6 +46,7 @@ func TestRepo_UpsertAndHistory(t *testing.T) {
 	st := uint8(1)
 	to := "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
 	gp := "1"
+	usd := "3000.00"
 
 	tx := storage.TxRecord{
 		Hash:        "0x" + repeat("1", 64),
@@ -58,15 +61,65 @@ func TestRepo_UpsertAndHistory(t *testing.T) {
 		Gas:         21000,
 		GasPriceWei: &gp,
 		Status:      &st,
+		ValueUSD:    &usd,
 	}
 
 	if err := repo.UpsertTx(ctx, tx); err != nil {
 		t.Fatalf("UpsertTx: %v", err)
 	}
 
+	// blob-tx: поля EIP-1559/4844 пишутся в свои колонки, gas_price_wei пуст
+	maxFee, tip, baseFee, blobCap, blobPrice := "40000000000", "2000000000", "10000000000", "3000000000", "1"
+	blobGas, blobHashes := uint64(262144), 2
+	blobTx := tx
+	blobTx.Hash = "0x" + repeat("3", 64)
+	blobTx.TxType = 3
+	blobTx.GasPriceWei = nil
+	blobTx.MaxFeePerGasWei, blobTx.MaxPriorityFeePerGasWei, blobTx.BaseFeeWei = &maxFee, &tip, &baseFee
+	blobTx.BlobGas, blobTx.BlobFeeCapWei, blobTx.BlobGasPriceWei, blobTx.BlobHashes = &blobGas, &blobCap, &blobPrice, &blobHashes
+	blobTx.CreatedContracts = []string{"0xcccccccccccccccccccccccccccccccccccccccc"}
+	failed, reason := uint8(0), `"ERC20: transfer amount exceeds balance"`
+	blobTx.Status, blobTx.RevertReason = &failed, &reason
+	if err := repo.UpsertTx(ctx, blobTx); err != nil {
+		t.Fatalf("UpsertTx blob: %v", err)
+	}
+	var (
+		gotGasPrice                *string
+		gotMaxFee, gotBase, gotCap string
+		gotBlobGas                 int64
+		gotHashes                  int
+		gotCreated                 []string
+		gotReason                  *string
+	)
+	err = pool.QueryRow(ctx, `
+SELECT gas_price_wei::text, max_fee_per_gas_wei::text, base_fee_wei::text, blob_fee_cap_wei::text, blob_gas, blob_hashes, created_contracts, revert_reason
+FROM transactions WHERE hash = $1`, blobTx.Hash).Scan(&gotGasPrice, &gotMaxFee, &gotBase, &gotCap, &gotBlobGas, &gotHashes, &gotCreated, &gotReason)
+	if err != nil {
+		t.Fatalf("select blob tx: %v", err)
+	}
+	if gotGasPrice != nil || gotMaxFee != maxFee || gotBase != baseFee || gotCap != blobCap || gotBlobGas != 262144 || gotHashes != 2 {
+		t.Fatalf("unexpected blob tx fee columns: gas_price=%v max_fee=%s base_fee=%s cap=%s blob_gas=%d hashes=%d",
+			gotGasPrice, gotMaxFee, gotBase, gotCap, gotBlobGas, gotHashes)
+	}
+	if len(gotCreated) != 1 || gotCreated[0] != blobTx.CreatedContracts[0] {
+		t.Fatalf("expected created contracts stored, got %v", gotCreated)
+	}
+	if gotReason == nil || *gotReason != reason {
+		t.Fatalf("expected revert reason stored, got %v", gotReason)
+	}
+
 	chatID := int64(42)
-	if err := repo.AddChatEvent(ctx, chatID, tx.Hash, storage.EventSearch); err != nil {
-		t.Fatalf("AddChatEvent: %v", err)
+	if has, err := repo.HasChatEvent(ctx, chatID, tx.Hash, storage.EventSearch); err != nil || has {
+		t.Fatalf("expected no event yet: has=%v err=%v", has, err)
+	}
+	if fresh, err := repo.AddChatEvent(ctx, chatID, tx.Hash, storage.EventSearch); err != nil || !fresh {
+		t.Fatalf("AddChatEvent: fresh=%v err=%v", fresh, err)
+	}
+	if has, err := repo.HasChatEvent(ctx, chatID, tx.Hash, storage.EventSearch); err != nil || !has {
+		t.Fatalf("HasChatEvent: has=%v err=%v", has, err)
+	}
+	if fresh, err := repo.AddChatEvent(ctx, chatID, tx.Hash, storage.EventSearch); err != nil || fresh {
+		t.Fatalf("expected repeated AddChatEvent to be a no-op: fresh=%v err=%v", fresh, err)
 	}
 
 	h, err := repo.ListHistory(ctx, chatID, 10)
@@ -82,6 +135,266 @@ func TestRepo_UpsertAndHistory(t *testing.T) {
 	if h[0].EventType != storage.EventSearch {
 		t.Fatalf("expected event=search got=%s", h[0].EventType)
 	}
+	if h[0].ChainID != "1" {
+		t.Fatalf("expected chain_id=1 got=%s", h[0].ChainID)
+	}
+	if h[0].ValueUSD == nil || *h[0].ValueUSD != usd {
+		t.Fatalf("expected value_usd=%s got=%v", usd, h[0].ValueUSD)
+	}
+
+	tokenID := "7"
+	nft := storage.TokenTransferRecord{
+		TxHash:    tx.Hash,
+		LogIndex:  2,
+		Standard:  "erc721",
+		TokenAddr: "0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D",
+		FromAddr:  tx.FromAddr,
+		ToAddr:    to,
+		TokenID:   &tokenID,
+		Amount:    "1",
+	}
+	// повторная запись того же лога не должна дублировать строку
+	for i := 0; i < 2; i++ {
+		if err := repo.UpsertTokenTransfers(ctx, []storage.TokenTransferRecord{nft}); err != nil {
+			t.Fatalf("UpsertTokenTransfers: %v", err)
+		}
+	}
+
+	h, err = repo.ListHistory(ctx, chatID, 10)
+	if err != nil {
+		t.Fatalf("ListHistory: %v", err)
+	}
+	if len(h) != 1 || len(h[0].Transfers) != 1 {
+		t.Fatalf("expected 1 transfer in history, got=%+v", h)
+	}
+	if got := h[0].Transfers[0]; got.TokenID == nil || *got.TokenID != tokenID || got.Standard != "erc721" || got.LogIndex != 2 {
+		t.Fatalf("unexpected transfer: %+v", got)
+	}
+}
+
+func TestRepo_Subscriptions(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("PG_DSN")
+	}
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN/PG_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	repo := pg.New(pool)
+	if err := repo.EnsureSchema(ctx); err != nil {
+		t.Fatalf("EnsureSchema: %v", err)
+	}
+
+	_, _ = pool.Exec(ctx, "TRUNCATE subscriptions CASCADE")
+
+	minWei := "1500000000000000000"
+	wallet := "0xaAaAaAaaAaAaAaaAaAAAAAAAAaaaAaAaAaaAaaAa"
+
+	if err := repo.UpsertSubscription(ctx, storage.SubscriptionRecord{ChatID: 1, ChainID: "1", LargeTxMinWei: &minWei}); err != nil {
+		t.Fatalf("UpsertSubscription: %v", err)
+	}
+	token := storage.TokenSubscription{
+		TokenAddr: "0xdAC17F958D2ee523a2206206994597C13D831ec7",
+		MinAmount: "1000000000000",
+		Decimals:  6,
+		Symbol:    "USDT",
+	}
+	contract := storage.ContractSubscription{
+		ContractAddr: "0xcccccccccccccccccccccccccccccccccccccccc",
+		ABI:          `[{"type":"event","name":"Ping","inputs":[]}]`,
+		Events:       []string{"Ping"},
+	}
+	if err := repo.UpsertSubscription(ctx, storage.SubscriptionRecord{ChatID: 1, ChainID: "1", WalletAddr: &wallet, Tokens: []storage.TokenSubscription{token}}); err != nil {
+		t.Fatalf("UpsertSubscription: %v", err)
+	}
+	if err := repo.UpsertSubscription(ctx, storage.SubscriptionRecord{ChatID: 1, ChainID: "1", LargeTxMinWei: &minWei, WalletAddr: &wallet, Tokens: []storage.TokenSubscription{token}, Contracts: []storage.ContractSubscription{contract}, NotifyLevel: "confirmations", Confirmations: 12}); err != nil {
+		t.Fatalf("UpsertSubscription: %v", err)
+	}
+	// подписка на свежий деплой — без ABI
+	deployed := storage.ContractSubscription{ContractAddr: "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"}
+	minUSD := "250000.00"
+	gas := storage.GasSubscription{Metric: "base_fee", Direction: "below", ThresholdWei: "10000000000"}
+	// тот же чат в другой сети — отдельная подписка со своими токенами, порогом в USD и газовым алертом
+	if err := repo.UpsertSubscription(ctx, storage.SubscriptionRecord{ChatID: 1, ChainID: "42161", LargeTxMinUSD: &minUSD, WalletAddr: &wallet, Tokens: []storage.TokenSubscription{token}, Contracts: []storage.ContractSubscription{deployed}, Gas: &gas}); err != nil {
+		t.Fatalf("UpsertSubscription: %v", err)
+	}
+	for _, chainID := range []string{"1", "42161"} {
+		if err := repo.UpsertSubscription(ctx, storage.SubscriptionRecord{ChatID: 2, ChainID: chainID, WalletAddr: &wallet}); err != nil {
+			t.Fatalf("UpsertSubscription: %v", err)
+		}
+	}
+	if err := repo.DeleteSubscription(ctx, "1", 2); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+
+	subs, err := repo.ListSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("ListSubscriptions: %v", err)
+	}
+	if len(subs) != 3 {
+		t.Fatalf("expected 3 subscriptions, got=%d", len(subs))
+	}
+	byKey := make(map[string]storage.SubscriptionRecord)
+	for _, rec := range subs {
+		byKey[fmt.Sprintf("%d/%s", rec.ChatID, rec.ChainID)] = rec
+	}
+	if _, ok := byKey["2/1"]; ok {
+		t.Fatalf("expected chat 2 to be unsubscribed on chain 1, got=%+v", subs)
+	}
+	if arb, ok := byKey["1/42161"]; !ok || arb.LargeTxMinWei != nil || arb.LargeTxMinUSD == nil || *arb.LargeTxMinUSD != minUSD || len(arb.Tokens) != 1 ||
+		len(arb.Contracts) != 1 || arb.Contracts[0].ABI != "" || arb.Gas == nil || *arb.Gas != gas {
+		t.Fatalf("unexpected arbitrum subscription: %+v", arb)
+	}
+	got, ok := byKey["1/1"]
+	if !ok || got.LargeTxMinWei == nil || *got.LargeTxMinWei != minWei || got.Gas != nil {
+		t.Fatalf("unexpected subscription: %+v", got)
+	}
+	if got.WalletAddr == nil || *got.WalletAddr != wallet {
+		t.Fatalf("expected wallet=%s got=%v", wallet, got.WalletAddr)
+	}
+	if len(got.Tokens) != 1 || got.Tokens[0] != token {
+		t.Fatalf("expected tokens=[%+v] got=%+v", token, got.Tokens)
+	}
+	if len(got.Contracts) != 1 || got.Contracts[0].ContractAddr != contract.ContractAddr ||
+		len(got.Contracts[0].Events) != 1 || got.Contracts[0].Events[0] != "Ping" {
+		t.Fatalf("expected contracts=[%+v] got=%+v", contract, got.Contracts)
+	}
+	if _, err := contracts.ParseABI([]byte(got.Contracts[0].ABI)); err != nil {
+		t.Fatalf("stored ABI does not parse back: %v", err)
+	}
+	if got.NotifyLevel != "confirmations" || got.Confirmations != 12 {
+		t.Fatalf("expected 12 confirmations level, got=%q/%d", got.NotifyLevel, got.Confirmations)
+	}
+}
+
+func TestRepo_Checkpoint(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("PG_DSN")
+	}
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN/PG_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	repo := pg.New(pool)
+	if err := repo.EnsureSchema(ctx); err != nil {
+		t.Fatalf("EnsureSchema: %v", err)
+	}
+
+	_, _ = pool.Exec(ctx, "TRUNCATE chain_checkpoints")
+
+	cp, err := repo.GetCheckpoint(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetCheckpoint: %v", err)
+	}
+	if cp != nil {
+		t.Fatalf("expected no checkpoint, got=%+v", cp)
+	}
+
+	for _, n := range []uint64{100, 101} {
+		if err := repo.SaveCheckpoint(ctx, storage.Checkpoint{ChainID: "1", BlockNum: n, BlockHash: "0x" + repeat("a", 64)}); err != nil {
+			t.Fatalf("SaveCheckpoint: %v", err)
+		}
+	}
+
+	cp, err = repo.GetCheckpoint(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetCheckpoint: %v", err)
+	}
+	if cp == nil || cp.BlockNum != 101 {
+		t.Fatalf("expected checkpoint #101, got=%+v", cp)
+	}
+}
+
+func TestRepo_ListPendingTxs(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("PG_DSN")
+	}
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN/PG_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	repo := pg.New(pool)
+	if err := repo.EnsureSchema(ctx); err != nil {
+		t.Fatalf("EnsureSchema: %v", err)
+	}
+
+	_, _ = pool.Exec(ctx, "TRUNCATE chat_tx, transactions RESTART IDENTITY CASCADE")
+
+	to := "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	maxFee := "30000000000"
+	pending := func(hash string, nonce uint64) storage.TxRecord {
+		return storage.TxRecord{
+			Hash: hash, ChainID: "1",
+			FromAddr: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", ToAddr: &to,
+			ValueWei: "1", Nonce: nonce, TxType: 2, Gas: 21000,
+			MaxFeePerGasWei: &maxFee,
+		}
+	}
+	waiting := pending("0x"+repeat("1", 64), 7)
+	mined := pending("0x"+repeat("2", 64), 6)
+	bn := uint64(10)
+	mined.BlockNum = &bn
+	dropped := pending("0x"+repeat("3", 64), 8)
+
+	for _, tx := range []storage.TxRecord{waiting, mined, dropped} {
+		if err := repo.UpsertTx(ctx, tx); err != nil {
+			t.Fatalf("UpsertTx: %v", err)
+		}
+		for _, chatID := range []int64{2, 1} {
+			if _, err := repo.AddChatEvent(ctx, chatID, tx.Hash, storage.EventPending); err != nil {
+				t.Fatalf("AddChatEvent: %v", err)
+			}
+		}
+	}
+	if _, err := repo.AddChatEvent(ctx, 1, dropped.Hash, storage.EventDropped); err != nil {
+		t.Fatalf("AddChatEvent: %v", err)
+	}
+
+	got, err := repo.ListPendingTxs(ctx, "1", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListPendingTxs: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected only the waiting tx, got=%+v", got)
+	}
+	p := got[0]
+	if p.Tx.Hash != waiting.Hash || p.Tx.Nonce != 7 || p.Tx.FromAddr != waiting.FromAddr || p.Tx.MaxFeePerGasWei == nil || *p.Tx.MaxFeePerGasWei != maxFee {
+		t.Fatalf("unexpected pending tx: %+v", p.Tx)
+	}
+	if len(p.ChatIDs) != 2 || p.ChatIDs[0] != 1 || p.ChatIDs[1] != 2 || p.SeenAt.IsZero() {
+		t.Fatalf("unexpected pending chats: %v at %s", p.ChatIDs, p.SeenAt)
+	}
+
+	if got, err := repo.ListPendingTxs(ctx, "1", time.Now().Add(time.Minute)); err != nil || len(got) != 0 {
+		t.Fatalf("expected nothing newer than since, got=%+v err=%v", got, err)
+	}
 }
 
 func repeat(s string, n int) string {
@@ -91,3 +404,105 @@ func repeat(s string, n int) string {
 	}
 	return out
 }
+
+func TestRepo_HeldNotifications(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("PG_DSN")
+	}
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN/PG_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	repo := pg.New(pool)
+	if err := repo.EnsureSchema(ctx); err != nil {
+		t.Fatalf("EnsureSchema: %v", err)
+	}
+
+	_, _ = pool.Exec(ctx, "TRUNCATE held_notifications")
+
+	hash := "0x" + repeat("b", 64)
+	held := storage.HeldNotificationRecord{
+		ChainID: "1", ChatID: 7, TxHash: hash, BlockNum: 100,
+		Messages: []storage.HeldMessage{{Text: "first"}},
+	}
+	if err := repo.AddHeldNotification(ctx, held); err != nil {
+		t.Fatalf("AddHeldNotification: %v", err)
+	}
+	// повторная обработка блока заменяет запись, а не дублирует её
+	held.Messages = []storage.HeldMessage{{Text: "tx", Deployed: []string{"0x" + repeat("c", 40)}}}
+	if err := repo.AddHeldNotification(ctx, held); err != nil {
+		t.Fatalf("AddHeldNotification again: %v", err)
+	}
+
+	got, err := repo.ListHeldNotifications(ctx, "1")
+	if err != nil {
+		t.Fatalf("ListHeldNotifications: %v", err)
+	}
+	if len(got) != 1 || got[0].ChatID != 7 || got[0].BlockNum != 100 || len(got[0].Messages) != 1 ||
+		got[0].Messages[0].Text != "tx" || len(got[0].Messages[0].Deployed) != 1 {
+		t.Fatalf("unexpected held notifications: %+v", got)
+	}
+	if other, err := repo.ListHeldNotifications(ctx, "10"); err != nil || len(other) != 0 {
+		t.Fatalf("expected nothing for another chain, got=%+v err=%v", other, err)
+	}
+
+	if err := repo.DeleteHeldNotification(ctx, "1", 7, hash); err != nil {
+		t.Fatalf("DeleteHeldNotification: %v", err)
+	}
+	if got, err := repo.ListHeldNotifications(ctx, "1"); err != nil || len(got) != 0 {
+		t.Fatalf("expected held notification deleted, got=%+v err=%v", got, err)
+	}
+}
+
+func TestRepo_ChatNetworks(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("PG_DSN")
+	}
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN/PG_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	repo := pg.New(pool)
+	if err := repo.EnsureSchema(ctx); err != nil {
+		t.Fatalf("EnsureSchema: %v", err)
+	}
+
+	_, _ = pool.Exec(ctx, "TRUNCATE chat_settings")
+
+	if err := repo.SetChatNetwork(ctx, 7, "1"); err != nil {
+		t.Fatalf("SetChatNetwork: %v", err)
+	}
+	// новый выбор заменяет старый
+	if err := repo.SetChatNetwork(ctx, 7, "137"); err != nil {
+		t.Fatalf("SetChatNetwork again: %v", err)
+	}
+	if err := repo.SetChatNetwork(ctx, 8, "10"); err != nil {
+		t.Fatalf("SetChatNetwork: %v", err)
+	}
+
+	got, err := repo.ListChatNetworks(ctx)
+	if err != nil {
+		t.Fatalf("ListChatNetworks: %v", err)
+	}
+	if len(got) != 2 || got[7] != "137" || got[8] != "10" {
+		t.Fatalf("unexpected chat networks: %v", got)
+	}
+}
@@ -13,8 +13,35 @@ type TxRecord struct {
 	Nonce       uint64
 	TxType      uint8
 	Gas         uint64
-	GasPriceWei *string // может быть nil для некоторых tx
+	GasPriceWei *string // только legacy и EIP-2930; у EIP-1559 tx — nil
 	Status      *uint8  // 1 success, 0 failed, nil unknown/pending
+
+	// EIP-1559 и новее: потолки из tx и base fee блока (nil для pending)
+	MaxFeePerGasWei         *string
+	MaxPriorityFeePerGasWei *string
+	BaseFeeWei              *string
+
+	// EIP-4844 (type 3): blob gas, потолок его цены и число blob versioned hash'ей
+	BlobGas       *uint64
+	BlobFeeCapWei *string
+	BlobHashes    *int
+
+	// из receipt; nil пока receipt неизвестен
+	GasUsed              *uint64
+	EffectiveGasPriceWei *string
+	BlobGasPriceWei      *string
+
+	// MethodSelector — первые 4 байта calldata ("0xa9059cbb"), nil для простого перевода
+	MethodSelector *string
+
+	// CreatedContracts — адреса контрактов, созданных tx (деплой или вызов фабрики)
+	CreatedContracts []string
+
+	// ValueUSD — Value в USD по цене Chainlink на блоке tx ("1500.50"); nil — цены нет
+	ValueUSD *string
+
+	// RevertReason — расшифрованная причина отката (Status == 0); nil — не откатилась или неизвестна
+	RevertReason *string
 }
 
 type TxEventType string
@@ -22,17 +49,115 @@ type TxEventType string
 const (
 	EventSearch TxEventType = "search"
 	EventNotify TxEventType = "notify"
+	EventReorg  TxEventType = "reorg"
+
+	// мемпул
+	EventPending  TxEventType = "pending"
+	EventDropped  TxEventType = "dropped"
+	EventReplaced TxEventType = "replaced"
+	EventStuck    TxEventType = "stuck"
 )
 
+// PendingTxRecord — pending tx, о которой чатам ушло уведомление и которая ещё
+// не попала в блок, не выпала и не заменена (нужна, чтобы пережить рестарт).
+type PendingTxRecord struct {
+	// Tx — без блока; заполнены from/to/value/nonce/селектор и потолок комиссии
+	Tx      TxRecord
+	ChatIDs []int64
+	SeenAt  time.Time // первое уведомление "pending"
+}
+
 type HistoryItem struct {
 	At        time.Time
 	EventType TxEventType
 
 	Hash      string
+	ChainID   string
 	BlockNum  *uint64
 	BlockTime *time.Time
 	FromAddr  string
 	ToAddr    *string
 	ValueWei  string
+	ValueUSD  *string // см. TxRecord.ValueUSD
 	Status    *uint8
+
+	// Transfers — сохранённые переводы токенов этой tx
+	Transfers []TokenTransferRecord
+}
+
+// TokenTransferRecord — один перевод токена из лога. TransferBatch ERC-1155
+// раскладывается на несколько записей с разным Seq.
+type TokenTransferRecord struct {
+	TxHash    string
+	LogIndex  uint
+	Seq       int
+	Standard  string // erc20|erc721|erc1155
+	TokenAddr string
+	FromAddr  string
+	ToAddr    string
+	TokenID   *string // nil для ERC-20
+	Amount    string  // big.Int как строка
+	ValueUSD  *string // только ERC-20 с ценой Chainlink, "1500.50"
+}
+
+// SubscriptionRecord — сохранённые подписки одного чата в одной сети.
+type SubscriptionRecord struct {
+	ChatID        int64
+	ChainID       string
+	LargeTxMinWei *string // big.Int как строка, nil если подписки нет
+	LargeTxMinUSD *string // порог в USD ("1500.50") вместо LargeTxMinWei
+	WalletAddr    *string
+	Tokens        []TokenSubscription
+	Contracts     []ContractSubscription
+	Gas           *GasSubscription // nil, если газового алерта нет
+
+	// NotifyLevel: latest|confirmations|safe|finalized; Confirmations — для confirmations
+	NotifyLevel   string
+	Confirmations uint64
+}
+
+// TokenSubscription — порог на переводы одного ERC-20 токена.
+type TokenSubscription struct {
+	TokenAddr string
+	MinAmount string // в минимальных единицах токена (big.Int как строка)
+	Decimals  uint8
+	Symbol    string
+}
+
+// ContractSubscription — события контракта по ABI, присланному пользователем.
+type ContractSubscription struct {
+	ContractAddr string
+	ABI          string   // JSON ABI как прислал пользователь; пусто — все логи без расшифровки
+	Events       []string // имена событий; пусто — все события ABI
+}
+
+// GasSubscription — алерт на пересечение газом порога.
+type GasSubscription struct {
+	Metric       string // base_fee|priority_fee
+	Direction    string // below|above
+	ThresholdWei string // big.Int как строка
+}
+
+// Checkpoint — последний полностью обработанный блок сети.
+type Checkpoint struct {
+	ChainID   string
+	BlockNum  uint64
+	BlockHash string
+}
+
+// HeldNotificationRecord — уведомления чату о tx, отложенные до уровня чата
+// (N подтверждений, safe, finalized). Уровень не хранится: после рестарта
+// берётся текущий уровень чата.
+type HeldNotificationRecord struct {
+	ChainID  string
+	ChatID   int64
+	TxHash   string
+	BlockNum uint64
+	Messages []HeldMessage
+}
+
+// HeldMessage — текст уведомления и созданные tx контракты (кнопки под ним).
+type HeldMessage struct {
+	Text     string   `json:"text"`
+	Deployed []string `json:"deployed,omitempty"`
 }
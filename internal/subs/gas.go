@@ -0,0 +1,94 @@
+package subs
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// GasMetric — с чем сравнивается порог газового алерта.
+type GasMetric string
+
+const (
+	// GasBaseFee — base fee последнего блока
+	GasBaseFee GasMetric = "base_fee"
+	// GasPriorityFee — скользящая медиана чаевых (priority fee) за последние блоки
+	GasPriorityFee GasMetric = "priority_fee"
+)
+
+// GasDirection — в какую сторону газ должен пересечь порог.
+type GasDirection string
+
+const (
+	GasBelow GasDirection = "below"
+	GasAbove GasDirection = "above"
+)
+
+// GasHysteresisPercent — на сколько процентов от порога газ должен отойти
+// назад, чтобы сработавший алерт взвёлся снова. Без этого газ, колеблющийся
+// у порога, слал бы уведомление на каждом блоке.
+const GasHysteresisPercent = 10
+
+// GasAlert — уведомить, когда метрика газа пересечёт ThresholdWei в сторону Direction.
+type GasAlert struct {
+	Metric       GasMetric
+	Direction    GasDirection
+	ThresholdWei *big.Int
+}
+
+func (a GasAlert) validate() error {
+	switch a.Metric {
+	case GasBaseFee, GasPriorityFee:
+	default:
+		return fmt.Errorf("bad gas metric %q", a.Metric)
+	}
+	switch a.Direction {
+	case GasBelow, GasAbove:
+	default:
+		return fmt.Errorf("bad gas direction %q", a.Direction)
+	}
+	if a.ThresholdWei == nil || a.ThresholdWei.Sign() <= 0 {
+		return fmt.Errorf("gas threshold must be > 0")
+	}
+	return nil
+}
+
+// Equal — тот же алерт (после смены порога состояние гистерезиса сбрасывается).
+func (a GasAlert) Equal(b GasAlert) bool {
+	return a.Metric == b.Metric && a.Direction == b.Direction &&
+		a.ThresholdWei != nil && b.ThresholdWei != nil && a.ThresholdWei.Cmp(b.ThresholdWei) == 0
+}
+
+// Triggered — значение по нужную сторону порога.
+func (a GasAlert) Triggered(v *big.Int) bool {
+	if a.Direction == GasBelow {
+		return v.Cmp(a.ThresholdWei) < 0
+	}
+	return v.Cmp(a.ThresholdWei) > 0
+}
+
+// Rearmed — значение вернулось за порог дальше полосы гистерезиса.
+func (a GasAlert) Rearmed(v *big.Int) bool {
+	band := new(big.Int).Mul(a.ThresholdWei, big.NewInt(GasHysteresisPercent))
+	band.Quo(band, big.NewInt(100))
+	if a.Direction == GasBelow {
+		return v.Cmp(new(big.Int).Add(a.ThresholdWei, band)) >= 0
+	}
+	return v.Cmp(new(big.Int).Sub(a.ThresholdWei, band)) <= 0
+}
+
+// GasReading — газ сети на последнем обработанном блоке.
+type GasReading struct {
+	BlockNum uint64
+	// BaseFee — nil до London и в сетях без EIP-1559
+	BaseFee *big.Int
+	// PriorityFee — медиана чаевых за окно блоков; nil, пока не было ни одной tx
+	PriorityFee *big.Int
+}
+
+// Value — значение метрики; nil, если его нет.
+func (r GasReading) Value(m GasMetric) *big.Int {
+	if m == GasBaseFee {
+		return r.BaseFee
+	}
+	return r.PriorityFee
+}
@@ -0,0 +1,67 @@
+package subs
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func gwei(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1_000_000_000)) }
+
+func TestGasAlert_Hysteresis(t *testing.T) {
+	below := GasAlert{Metric: GasBaseFee, Direction: GasBelow, ThresholdWei: gwei(10)}
+	if below.Triggered(gwei(10)) || !below.Triggered(gwei(9)) {
+		t.Fatalf("expected below alert to trigger strictly under 10 gwei")
+	}
+	// полоса 10%: взводится снова только от 11 gwei
+	if below.Rearmed(new(big.Int).Sub(gwei(11), big.NewInt(1))) || !below.Rearmed(gwei(11)) {
+		t.Fatalf("expected below alert to rearm at 11 gwei")
+	}
+
+	above := GasAlert{Metric: GasPriorityFee, Direction: GasAbove, ThresholdWei: gwei(50)}
+	if above.Triggered(gwei(50)) || !above.Triggered(gwei(51)) {
+		t.Fatalf("expected above alert to trigger strictly over 50 gwei")
+	}
+	if above.Rearmed(gwei(46)) || !above.Rearmed(gwei(45)) {
+		t.Fatalf("expected above alert to rearm at 45 gwei")
+	}
+}
+
+func TestStore_GasAlert(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+
+	if err := s.SetGasAlert(ctx, 1, GasAlert{Metric: "gas_limit", Direction: GasBelow, ThresholdWei: gwei(1)}); err == nil {
+		t.Fatalf("expected error for unknown metric")
+	}
+	if err := s.SetGasAlert(ctx, 1, GasAlert{Metric: GasBaseFee, Direction: GasAbove}); err == nil {
+		t.Fatalf("expected error without threshold")
+	}
+
+	alert := GasAlert{Metric: GasPriorityFee, Direction: GasBelow, ThresholdWei: gwei(2)}
+	if err := s.SetGasAlert(ctx, 1, alert); err != nil {
+		t.Fatalf("SetGasAlert: %v", err)
+	}
+	if rec := p.subs[1]; rec.Gas == nil || rec.Gas.Metric != "priority_fee" || rec.Gas.Direction != "below" || rec.Gas.ThresholdWei != "2000000000" {
+		t.Fatalf("expected persisted gas alert, got=%+v", rec.Gas)
+	}
+
+	s2 := NewPersistentStore(p, "1")
+	if err := s2.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := s2.GasAlerts(); len(got) != 1 || !got[1].Equal(alert) {
+		t.Fatalf("expected gas alert restored, got=%+v", got)
+	}
+
+	if err := s2.ClearGasAlert(ctx, 1); err != nil {
+		t.Fatalf("ClearGasAlert: %v", err)
+	}
+	if len(s2.GasAlerts()) != 0 {
+		t.Fatalf("expected no gas alerts after clear")
+	}
+	if _, ok := p.subs[1]; ok {
+		t.Fatalf("expected empty subscription to be deleted")
+	}
+}
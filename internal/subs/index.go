@@ -0,0 +1,178 @@
+package subs
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// index — обратные индексы подписок, чтобы Match* не обходили все чаты на
+// каждую транзакцию: адрес → чаты и пороги, отсортированные по возрастанию.
+// Меняется только под Store.mu на запись, вместе с Store.data.
+type index struct {
+	wallets   map[common.Address]map[int64]struct{}
+	largeTx   thresholds
+	largeUSD  thresholds // в центах USD
+	tokens    map[common.Address]thresholds
+	contracts map[common.Address]map[int64]ContractSub
+	gas       map[int64]GasAlert
+}
+
+func newIndex() index {
+	return index{
+		wallets:   make(map[common.Address]map[int64]struct{}),
+		tokens:    make(map[common.Address]thresholds),
+		contracts: make(map[common.Address]map[int64]ContractSub),
+		gas:       make(map[int64]GasAlert),
+	}
+}
+
+// add индексирует подписки чата. u после этого не должен меняться —
+// Store подменяет UserSubs целиком (см. update).
+func (ix *index) add(chatID int64, u *UserSubs) {
+	if u.LargeTxMinWei != nil {
+		ix.largeTx = ix.largeTx.insert(chatID, u.LargeTxMinWei)
+	}
+	if u.LargeTxMinUSD != nil {
+		ix.largeUSD = ix.largeUSD.insert(chatID, u.LargeTxMinUSD)
+	}
+	if u.Wallet != nil {
+		chats := ix.wallets[*u.Wallet]
+		if chats == nil {
+			chats = make(map[int64]struct{})
+			ix.wallets[*u.Wallet] = chats
+		}
+		chats[chatID] = struct{}{}
+	}
+	for token, ts := range u.Tokens {
+		ix.tokens[token] = ix.tokens[token].insert(chatID, ts.MinAmount)
+	}
+	if u.Gas != nil {
+		ix.gas[chatID] = *u.Gas
+	}
+	for addr, c := range u.Contracts {
+		chats := ix.contracts[addr]
+		if chats == nil {
+			chats = make(map[int64]ContractSub)
+			ix.contracts[addr] = chats
+		}
+		chats[chatID] = c
+	}
+}
+
+// remove убирает из индекса всё, что add добавил для тех же u.
+func (ix *index) remove(chatID int64, u *UserSubs) {
+	if u.LargeTxMinWei != nil {
+		ix.largeTx = ix.largeTx.remove(chatID, u.LargeTxMinWei)
+	}
+	if u.LargeTxMinUSD != nil {
+		ix.largeUSD = ix.largeUSD.remove(chatID, u.LargeTxMinUSD)
+	}
+	delete(ix.gas, chatID)
+	if u.Wallet != nil {
+		if chats := ix.wallets[*u.Wallet]; chats != nil {
+			delete(chats, chatID)
+			if len(chats) == 0 {
+				delete(ix.wallets, *u.Wallet)
+			}
+		}
+	}
+	for token, ts := range u.Tokens {
+		if rest := ix.tokens[token].remove(chatID, ts.MinAmount); len(rest) > 0 {
+			ix.tokens[token] = rest
+		} else {
+			delete(ix.tokens, token)
+		}
+	}
+	for addr := range u.Contracts {
+		if chats := ix.contracts[addr]; chats != nil {
+			delete(chats, chatID)
+			if len(chats) == 0 {
+				delete(ix.contracts, addr)
+			}
+		}
+	}
+}
+
+type threshold struct {
+	min    *big.Int
+	chatID int64
+}
+
+// thresholds отсортированы по (min, chatID). Под порог value попадает префикс
+// среза, так что поиск — O(log n) плюс размер ответа.
+type thresholds []threshold
+
+// search — индекс первого порога > (min, chatID).
+func (t thresholds) search(min *big.Int, chatID int64) int {
+	return sort.Search(len(t), func(i int) bool {
+		if c := t[i].min.Cmp(min); c != 0 {
+			return c > 0
+		}
+		return t[i].chatID > chatID
+	})
+}
+
+func (t thresholds) insert(chatID int64, min *big.Int) thresholds {
+	i := t.search(min, chatID)
+	t = append(t, threshold{})
+	copy(t[i+1:], t[i:])
+	t[i] = threshold{min: min, chatID: chatID}
+	return t
+}
+
+func (t thresholds) remove(chatID int64, min *big.Int) thresholds {
+	i := t.search(min, chatID) - 1
+	if i < 0 || t[i].chatID != chatID || t[i].min.Cmp(min) != 0 {
+		return t
+	}
+	return append(t[:i], t[i+1:]...)
+}
+
+// upTo — пороги, которые value достигает (min <= value).
+func (t thresholds) upTo(value *big.Int) thresholds {
+	n := sort.Search(len(t), func(i int) bool { return t[i].min.Cmp(value) > 0 })
+	return t[:n]
+}
+
+// matchSet собирает чаты без повторов. Карта заводится, только когда
+// совпадений из разных источников больше одного.
+type matchSet struct {
+	out  []int64
+	seen map[int64]struct{}
+}
+
+func (m *matchSet) add(chatID int64) {
+	if m.seen == nil {
+		m.seen = make(map[int64]struct{}, len(m.out)+1)
+		for _, id := range m.out {
+			m.seen[id] = struct{}{}
+		}
+	}
+	if _, ok := m.seen[chatID]; ok {
+		return
+	}
+	m.seen[chatID] = struct{}{}
+	m.out = append(m.out, chatID)
+}
+
+// addThresholds — первый источник совпадений: повторов в нём нет.
+func (m *matchSet) addThresholds(t thresholds) {
+	if m.out == nil && m.seen == nil {
+		m.out = make([]int64, 0, len(t))
+		for _, th := range t {
+			m.out = append(m.out, th.chatID)
+		}
+		return
+	}
+	for _, th := range t {
+		m.add(th.chatID)
+	}
+}
+
+func (m *matchSet) addChats(chats map[int64]struct{}) {
+	for chatID := range chats {
+		m.add(chatID)
+	}
+}
@@ -0,0 +1,203 @@
+package subs
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// scanMatchTx / scanMatchTokenTransfer — прежняя семантика Match*: обход всех чатов.
+func scanMatchTx(s *Store, sender common.Address, receiver *common.Address, valueWei *big.Int) []int64 {
+	var out []int64
+	for chatID, u := range s.data {
+		switch {
+		case u.LargeTxMinWei != nil && valueWei != nil && valueWei.Sign() > 0 && valueWei.Cmp(u.LargeTxMinWei) >= 0:
+		case u.Wallet != nil && (sender == *u.Wallet || receiver != nil && *receiver == *u.Wallet):
+		default:
+			continue
+		}
+		out = append(out, chatID)
+	}
+	return out
+}
+
+func scanMatchTokenTransfer(s *Store, token, from, to common.Address, amount *big.Int) []int64 {
+	var out []int64
+	for chatID, u := range s.data {
+		ts, ok := u.Tokens[token]
+		switch {
+		case ok && amount != nil && amount.Cmp(ts.MinAmount) >= 0:
+		case u.Wallet != nil && (from == *u.Wallet || to == *u.Wallet):
+		default:
+			continue
+		}
+		out = append(out, chatID)
+	}
+	return out
+}
+
+func testAddr(i int) common.Address {
+	return common.BigToAddress(big.NewInt(int64(i) + 1))
+}
+
+// fillStore — chats чатов со случайными порогами и кошельками из пула addrs адресов.
+func fillStore(tb testing.TB, rng *rand.Rand, chats, addrs int) *Store {
+	tb.Helper()
+	ctx := context.Background()
+	s := NewStore()
+	token := testAddr(0)
+	for chatID := int64(1); chatID <= int64(chats); chatID++ {
+		if rng.Intn(2) == 0 {
+			if err := s.SetLargeTxMin(ctx, chatID, big.NewInt(rng.Int63n(1000))); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		if rng.Intn(3) == 0 {
+			if err := s.SetWallet(ctx, chatID, testAddr(rng.Intn(addrs))); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		if rng.Intn(3) == 0 {
+			sub := TokenSub{MinAmount: big.NewInt(rng.Int63n(1000)), Decimals: 6}
+			if err := s.SetTokenMin(ctx, chatID, token, sub); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return s
+}
+
+func sorted(ids []int64) []int64 {
+	out := slices.Clone(ids)
+	slices.Sort(out)
+	return out
+}
+
+func TestStore_IndexMatchesScan(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(1))
+	s := fillStore(t, rng, 500, 50)
+	token := testAddr(0)
+
+	check := func(round int) {
+		for i := 0; i < 200; i++ {
+			from, to := testAddr(rng.Intn(60)), testAddr(rng.Intn(60))
+			value := big.NewInt(rng.Int63n(1200) - 100)
+
+			got, want := sorted(s.MatchTx(from, &to, value)), sorted(scanMatchTx(s, from, &to, value))
+			if !slices.Equal(got, want) {
+				t.Fatalf("round %d MatchTx(%s, %s, %s): got %v, want %v", round, from, to, value, got, want)
+			}
+			got, want = sorted(s.MatchTx(from, nil, value)), sorted(scanMatchTx(s, from, nil, value))
+			if !slices.Equal(got, want) {
+				t.Fatalf("round %d MatchTx(%s, nil, %s): got %v, want %v", round, from, value, got, want)
+			}
+			got, want = sorted(s.MatchTokenTransfer(token, from, to, value)), sorted(scanMatchTokenTransfer(s, token, from, to, value))
+			if !slices.Equal(got, want) {
+				t.Fatalf("round %d MatchTokenTransfer(%s, %s, %s): got %v, want %v", round, from, to, value, got, want)
+			}
+		}
+	}
+	check(0)
+
+	// изменения и отписки должны переиндексироваться
+	for chatID := int64(1); chatID <= 500; chatID++ {
+		var err error
+		switch rng.Intn(4) {
+		case 0:
+			err = s.ClearAll(ctx, chatID)
+		case 1:
+			err = s.SetLargeTxMin(ctx, chatID, big.NewInt(rng.Int63n(1000)))
+		case 2:
+			err = s.SetWallet(ctx, chatID, testAddr(rng.Intn(50)))
+		case 3:
+			err = s.ClearToken(ctx, chatID, token)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(1)
+
+	got := sorted(s.MatchWallet(testAddr(1), testAddr(1)))
+	if len(slices.Compact(slices.Clone(got))) != len(got) {
+		t.Fatalf("expected MatchWallet without duplicates, got %v", got)
+	}
+}
+
+func TestStore_MatchTx_NoDuplicates(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	// чат совпадает сразу по порогу и по кошельку (он же отправитель и получатель)
+	if err := s.SetLargeTxMin(ctx, 1, big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetWallet(ctx, 1, wallet); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.MatchTx(wallet, &wallet, big.NewInt(5)); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected single match, got=%v", got)
+	}
+}
+
+// Бенчмарки: стоимость одного MatchTx на транзакцию, которая почти никому
+// не интересна, не должна расти с числом подписчиков (у scan — растёт линейно).
+
+func benchmarkMatchTx(b *testing.B, chats int, match func(s *Store, from common.Address, to *common.Address, v *big.Int) []int64) {
+	rng := rand.New(rand.NewSource(1))
+	s := fillStore(b, rng, chats, chats)
+	// value ниже всех порогов — совпадений по объёму нет
+	value := big.NewInt(500)
+	for chatID := int64(1); chatID <= int64(chats); chatID++ {
+		if u := s.data[chatID]; u != nil && u.LargeTxMinWei != nil && u.LargeTxMinWei.Cmp(value) <= 0 {
+			_ = s.SetLargeTxMin(context.Background(), chatID, big.NewInt(1000))
+		}
+	}
+	from, to := testAddr(chats+1), testAddr(chats+2)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		match(s, from, &to, value)
+	}
+}
+
+func BenchmarkStore_MatchTx(b *testing.B) {
+	for _, n := range []int{100, 1_000, 10_000, 100_000} {
+		b.Run(fmt.Sprintf("index/chats=%d", n), func(b *testing.B) {
+			benchmarkMatchTx(b, n, (*Store).MatchTx)
+		})
+		b.Run(fmt.Sprintf("scan/chats=%d", n), func(b *testing.B) {
+			benchmarkMatchTx(b, n, func(s *Store, from common.Address, to *common.Address, v *big.Int) []int64 {
+				s.mu.RLock()
+				defer s.mu.RUnlock()
+				return scanMatchTx(s, from, to, v)
+			})
+		})
+	}
+}
+
+func BenchmarkStore_MatchTokenTransfer(b *testing.B) {
+	for _, n := range []int{100, 1_000, 10_000, 100_000} {
+		b.Run(fmt.Sprintf("chats=%d", n), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			s := fillStore(b, rng, n, n)
+			token, from, to := testAddr(0), testAddr(n+1), testAddr(n+2)
+			// ~1% подписчиков токена проходят порог
+			amount := big.NewInt(10)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.MatchTokenTransfer(token, from, to, amount)
+			}
+		})
+	}
+}
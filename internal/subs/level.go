@@ -0,0 +1,63 @@
+package subs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type LevelKind string
+
+const (
+	LevelLatest        LevelKind = "latest"
+	LevelConfirmations LevelKind = "confirmations"
+	LevelSafe          LevelKind = "safe"
+	LevelFinalized     LevelKind = "finalized"
+)
+
+// Level — когда уведомлять о совпавшей tx: сразу (latest), после N подтверждений
+// или когда блок станет safe/finalized. Нулевое значение — latest.
+type Level struct {
+	Kind          LevelKind
+	Confirmations uint64 // только для LevelConfirmations
+}
+
+func (l Level) IsLatest() bool {
+	return l.Kind == "" || l.Kind == LevelLatest || (l.Kind == LevelConfirmations && l.Confirmations <= 1)
+}
+
+func (l Level) String() string {
+	switch {
+	case l.IsLatest():
+		return string(LevelLatest)
+	case l.Kind == LevelConfirmations:
+		return fmt.Sprintf("%d confirmations", l.Confirmations)
+	default:
+		return string(l.Kind)
+	}
+}
+
+// normalize сводит равнозначные варианты latest к нулевому значению.
+func (l Level) normalize() Level {
+	if l.IsLatest() {
+		return Level{}
+	}
+	return l
+}
+
+// ParseLevel понимает "latest", "safe", "finalized" и число подтверждений ("12").
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch LevelKind(s) {
+	case LevelLatest, "":
+		return Level{}, nil
+	case LevelSafe, LevelFinalized:
+		return Level{Kind: LevelKind(s)}, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n == 0 {
+		return Level{}, fmt.Errorf("bad notify level %q", s)
+	}
+	return Level{Kind: LevelConfirmations, Confirmations: n}.normalize(), nil
+}
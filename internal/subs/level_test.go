@@ -0,0 +1,69 @@
+package subs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Level
+		err  bool
+	}{
+		{in: "latest", want: Level{}},
+		{in: "1", want: Level{}},
+		{in: " Safe ", want: Level{Kind: LevelSafe}},
+		{in: "finalized", want: Level{Kind: LevelFinalized}},
+		{in: "12", want: Level{Kind: LevelConfirmations, Confirmations: 12}},
+		{in: "0", err: true},
+		{in: "-3", err: true},
+		{in: "soon", err: true},
+	}
+	for _, c := range cases {
+		got, err := ParseLevel(c.in)
+		if (err != nil) != c.err {
+			t.Fatalf("ParseLevel(%q) err=%v, want err=%v", c.in, err, c.err)
+		}
+		if !c.err && got != c.want {
+			t.Fatalf("ParseLevel(%q)=%+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestStore_LevelPersisted(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+
+	if err := s.SetLevel(ctx, 1, Level{Kind: LevelConfirmations, Confirmations: 6}); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	if err := s.SetLevel(ctx, 2, Level{Kind: LevelFinalized}); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+
+	recs := p.list()
+	if len(recs) != 2 {
+		t.Fatalf("expected level alone to keep chats persisted, got=%d", len(recs))
+	}
+
+	s2 := NewPersistentStore(p, "1")
+	if err := s2.Load(p.list()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := s2.Level(1); got != (Level{Kind: LevelConfirmations, Confirmations: 6}) {
+		t.Fatalf("unexpected level after load: %+v", got)
+	}
+	if got := s2.Level(2); got.Kind != LevelFinalized {
+		t.Fatalf("unexpected level after load: %+v", got)
+	}
+
+	// возврат к latest при пустых подписках удаляет чат
+	if err := s.SetLevel(ctx, 2, Level{}); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	if len(p.list()) != 1 {
+		t.Fatalf("expected chat with latest level and no subs to be removed")
+	}
+}
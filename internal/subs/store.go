@@ -1,75 +1,310 @@
 package subs
 
 import (
+	"context"
+	"fmt"
 	"math/big"
 	"sync"
 
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/prices"
+	"github.com/pvzzle/scanblock/internal/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 type UserSubs struct {
 	LargeTxMinWei *big.Int
+	// LargeTxMinUSD — порог в центах USD вместо LargeTxMinWei; сравнивается
+	// по текущей цене нативной валюты (SetNativePrice)
+	LargeTxMinUSD *big.Int
 	Wallet        *common.Address
+	Tokens        map[common.Address]TokenSub
+	Contracts     map[common.Address]ContractSub
+	// Gas — алерт на base fee / priority fee; nil — нет
+	Gas *GasAlert
+
+	// Level — когда отправлять уведомления по этим подпискам
+	Level Level
+}
+
+// TokenSub — порог на переводы ERC-20 токена (в минимальных единицах).
+type TokenSub struct {
+	MinAmount *big.Int
+	Decimals  uint8
+	Symbol    string
+}
+
+// ContractSub — события контракта по ABI пользователя. Без ABI (подписка
+// в одно касание на свежий деплой) — все логи контракта без расшифровки.
+type ContractSub struct {
+	ABI    *abi.ABI // разобранный RawABI, не меняется после создания; nil — без ABI
+	RawABI string
+	Events []string // пусто — все события ABI
+}
+
+// wants — нужно ли уведомлять о событии с этим topic0.
+func (c ContractSub) wants(topic common.Hash) bool {
+	if c.ABI == nil {
+		return true
+	}
+	ev, err := c.ABI.EventByID(topic)
+	if err != nil || ev.Anonymous {
+		return false
+	}
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, name := range c.Events {
+		if name == ev.Name {
+			return true
+		}
+	}
+	return false
 }
 
+// ContractMatch — чат и ABI, по которому ему декодировать лог.
+type ContractMatch struct {
+	ChatID int64
+	ABI    *abi.ABI // nil — подписка без ABI, лог не расшифровываем
+}
+
+// Persister — то, куда Store пишет изменения подписок (write-through).
+type Persister interface {
+	UpsertSubscription(ctx context.Context, sub storage.SubscriptionRecord) error
+	DeleteSubscription(ctx context.Context, chainID string, chatID int64) error
+}
+
+// Store — подписки чатов в одной сети (у каждой сети свой Store).
 type Store struct {
+	// chainID — сеть подписок, как она хранится в БД ("1", "42161")
+	chainID string
+
 	mu   sync.RWMutex
 	data map[int64]*UserSubs
+	idx  index
+
+	// nativePrice — последняя известная цена нативной валюты для порогов в USD
+	nativePrice prices.Price
+
+	// gas — газ на последнем обработанном блоке (для меню и алертов)
+	gas    GasReading
+	hasGas bool
+
+	// writeMu сериализует изменения, чтобы порядок записей в БД совпадал с памятью
+	writeMu sync.Mutex
+	persist Persister
 }
 
 func NewStore() *Store {
-	return &Store{data: make(map[int64]*UserSubs)}
+	return &Store{data: make(map[int64]*UserSubs), idx: newIndex()}
 }
 
-func (s *Store) SetLargeTxMin(chatID int64, minWei *big.Int) {
+// NewPersistentStore создаёт Store подписок сети chainID, который сохраняет
+// каждое изменение через p до того, как применить его в памяти.
+func NewPersistentStore(p Persister, chainID string) *Store {
+	s := NewStore()
+	s.persist = p
+	s.chainID = chainID
+	return s
+}
+
+// ChainID — сеть, к которой относятся подписки Store.
+func (s *Store) ChainID() string { return s.chainID }
+
+// Load заполняет Store сохранёнными подписками его сети (без записи обратно
+// в БД); записи других сетей пропускаются.
+func (s *Store) Load(recs []storage.SubscriptionRecord) error {
+	loaded := make(map[int64]*UserSubs, len(recs))
+	for _, rec := range recs {
+		if rec.ChainID != s.chainID {
+			continue
+		}
+		u, err := fromRecord(rec)
+		if err != nil {
+			return fmt.Errorf("chat %d: %w", rec.ChatID, err)
+		}
+		if u.isEmpty() {
+			continue
+		}
+		loaded[rec.ChatID] = u
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	for chatID, u := range loaded {
+		s.set(chatID, u)
+	}
+	return nil
+}
+
+func (s *Store) SetLargeTxMin(ctx context.Context, chatID int64, minWei *big.Int) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		u.LargeTxMinUSD = nil
+		if minWei == nil {
+			u.LargeTxMinWei = nil
+			return
+		}
+		u.LargeTxMinWei = new(big.Int).Set(minWei)
+	})
+}
 
-	u := s.getOrCreate(chatID)
-	if minWei == nil {
+// SetLargeTxMinUSD — порог крупных переводов в центах USD (заменяет порог
+// в нативной валюте).
+func (s *Store) SetLargeTxMinUSD(ctx context.Context, chatID int64, minCents *big.Int) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
 		u.LargeTxMinWei = nil
-		s.cleanupIfEmpty(chatID, u)
-		return
-	}
-	u.LargeTxMinWei = new(big.Int).Set(minWei)
+		if minCents == nil {
+			u.LargeTxMinUSD = nil
+			return
+		}
+		u.LargeTxMinUSD = new(big.Int).Set(minCents)
+	})
 }
 
-func (s *Store) SetWallet(chatID int64, addr common.Address) {
+// SetNativePrice обновляет цену нативной валюты, по которой MatchTx сравнивает
+// пороги в USD. Невалидная цена игнорируется — остаётся прежняя.
+func (s *Store) SetNativePrice(p prices.Price) {
+	if !p.Valid() {
+		return
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.nativePrice = p
+}
+
+// WantsNativePrice — есть ли пороги в USD, для которых нужна цена.
+func (s *Store) WantsNativePrice() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	u := s.getOrCreate(chatID)
-	u.Wallet = &addr
+	return len(s.idx.largeUSD) > 0
 }
 
-func (s *Store) ClearLargeTx(chatID int64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// SetGasAlert заменяет газовый алерт чата.
+func (s *Store) SetGasAlert(ctx context.Context, chatID int64, alert GasAlert) error {
+	if err := alert.validate(); err != nil {
+		return err
+	}
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		alert.ThresholdWei = new(big.Int).Set(alert.ThresholdWei)
+		u.Gas = &alert
+	})
+}
 
-	u := s.data[chatID]
-	if u == nil {
-		return
+func (s *Store) ClearGasAlert(ctx context.Context, chatID int64) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		u.Gas = nil
+	})
+}
+
+// GasAlerts — газовые алерты по чатам (копия).
+func (s *Store) GasAlerts() map[int64]GasAlert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[int64]GasAlert, len(s.idx.gas))
+	for chatID, a := range s.idx.gas {
+		out[chatID] = a
 	}
-	u.LargeTxMinWei = nil
-	s.cleanupIfEmpty(chatID, u)
+	return out
 }
 
-func (s *Store) ClearWallet(chatID int64) {
+// SetGas запоминает газ последнего обработанного блока.
+func (s *Store) SetGas(r GasReading) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.gas, s.hasGas = r, true
+}
 
-	u := s.data[chatID]
-	if u == nil {
-		return
+// Gas — газ последнего обработанного блока; false, пока блоков не было.
+func (s *Store) Gas() (GasReading, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.gas, s.hasGas
+}
+
+func (s *Store) SetWallet(ctx context.Context, chatID int64, addr common.Address) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		u.Wallet = &addr
+	})
+}
+
+func (s *Store) SetTokenMin(ctx context.Context, chatID int64, token common.Address, sub TokenSub) error {
+	if sub.MinAmount == nil {
+		return fmt.Errorf("token %s: nil threshold", token.Hex())
 	}
-	u.Wallet = nil
-	s.cleanupIfEmpty(chatID, u)
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		if u.Tokens == nil {
+			u.Tokens = make(map[common.Address]TokenSub)
+		}
+		sub.MinAmount = new(big.Int).Set(sub.MinAmount)
+		u.Tokens[token] = sub
+	})
 }
 
-func (s *Store) ClearAll(chatID int64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.data, chatID)
+func (s *Store) ClearToken(ctx context.Context, chatID int64, token common.Address) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		delete(u.Tokens, token)
+	})
+}
+
+func (s *Store) SetContract(ctx context.Context, chatID int64, addr common.Address, sub ContractSub) error {
+	// без ABI выбрать события нельзя — только все логи
+	if sub.ABI == nil && (sub.RawABI != "" || len(sub.Events) > 0) {
+		return fmt.Errorf("contract %s: nil ABI", addr.Hex())
+	}
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		if u.Contracts == nil {
+			u.Contracts = make(map[common.Address]ContractSub)
+		}
+		sub.Events = append([]string(nil), sub.Events...)
+		u.Contracts[addr] = sub
+	})
+}
+
+func (s *Store) ClearContract(ctx context.Context, chatID int64, addr common.Address) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		delete(u.Contracts, addr)
+	})
+}
+
+func (s *Store) SetLevel(ctx context.Context, chatID int64, level Level) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		u.Level = level.normalize()
+	})
+}
+
+// Level возвращает уровень уведомлений чата (latest, если чат неизвестен).
+func (s *Store) Level(chatID int64) Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if u := s.data[chatID]; u != nil {
+		return u.Level
+	}
+	return Level{}
+}
+
+func (s *Store) ClearLargeTx(ctx context.Context, chatID int64) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		u.LargeTxMinWei = nil
+		u.LargeTxMinUSD = nil
+	})
+}
+
+func (s *Store) ClearWallet(ctx context.Context, chatID int64) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		u.Wallet = nil
+	})
+}
+
+func (s *Store) ClearAll(ctx context.Context, chatID int64) error {
+	return s.update(ctx, chatID, func(u *UserSubs) {
+		*u = UserSubs{}
+	})
 }
 
 // GetCopy возвращает копию подписок пользователя (чтобы снаружи не было гонок/мутирования)
@@ -81,65 +316,330 @@ func (s *Store) GetCopy(chatID int64) (UserSubs, bool) {
 	if u == nil {
 		return UserSubs{}, false
 	}
+	return u.clone(), true
+}
 
-	var out UserSubs
-	if u.LargeTxMinWei != nil {
-		out.LargeTxMinWei = new(big.Int).Set(u.LargeTxMinWei)
+// MatchTx — чаты, которым интересна транзакция: по порогу объёма или
+// потому что отправитель/получатель — отслеживаемый кошелёк.
+func (s *Store) MatchTx(sender common.Address, receiver *common.Address, valueWei *big.Int) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var m matchSet
+	if valueWei != nil && valueWei.Sign() > 0 {
+		m.addThresholds(s.idx.largeTx.upTo(valueWei))
+		if len(s.idx.largeUSD) > 0 {
+			// у нативных валют EVM-сетей 18 знаков
+			if cents := s.nativePrice.Cents(valueWei, 18); cents != nil {
+				m.addThresholds(s.idx.largeUSD.upTo(cents))
+			}
+		}
 	}
-	if u.Wallet != nil {
-		a := *u.Wallet
-		out.Wallet = &a
+	m.addChats(s.idx.wallets[sender])
+	if receiver != nil {
+		m.addChats(s.idx.wallets[*receiver])
 	}
-	return out, true
+	return m.out
 }
 
-func (s *Store) MatchTx(sender common.Address, receiver *common.Address, valueWei *big.Int) []int64 {
+// MatchTokenTransfer — чаты, которым интересен ERC-20 перевод: по порогу токена
+// или потому что отправитель/получатель — отслеживаемый кошелёк.
+func (s *Store) MatchTokenTransfer(token, from, to common.Address, amount *big.Int) []int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var out []int64
-	for chatID, u := range s.data {
-		if u == nil {
-			continue
-		}
+	var m matchSet
+	if amount != nil {
+		m.addThresholds(s.idx.tokens[token].upTo(amount))
+	}
+	m.addChats(s.idx.wallets[from])
+	m.addChats(s.idx.wallets[to])
+	return m.out
+}
 
-		// large volume
-		if u.LargeTxMinWei != nil && valueWei != nil && valueWei.Sign() > 0 {
-			if valueWei.Cmp(u.LargeTxMinWei) >= 0 {
-				out = append(out, chatID)
-				continue
-			}
+// MatchWallet — чаты, чей отслеживаемый кошелёк среди addrs.
+func (s *Store) MatchWallet(addrs ...common.Address) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var m matchSet
+	for _, a := range addrs {
+		m.addChats(s.idx.wallets[a])
+	}
+	return m.out
+}
+
+// MatchContractLog — чаты, подписанные на событие контракта из лога.
+func (s *Store) MatchContractLog(l *types.Log) []ContractMatch {
+	if l == nil || len(l.Topics) == 0 {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []ContractMatch
+	for chatID, c := range s.idx.contracts[l.Address] {
+		if c.wants(l.Topics[0]) {
+			out = append(out, ContractMatch{ChatID: chatID, ABI: c.ABI})
 		}
+	}
+	return out
+}
 
-		// wallet
-		if u.Wallet != nil {
-			if sender == *u.Wallet {
-				out = append(out, chatID)
-				continue
-			}
-			if receiver != nil && *receiver == *u.Wallet {
-				out = append(out, chatID)
-				continue
+// ContractAddresses — контракты, на события которых есть подписки.
+func (s *Store) ContractAddresses() []common.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]common.Address, 0, len(s.idx.contracts))
+	for addr := range s.idx.contracts {
+		out = append(out, addr)
+	}
+	return out
+}
+
+// ContractABIs — ABI всех подписок на контракты (для базы селекторов).
+func (s *Store) ContractABIs() []*abi.ABI {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []*abi.ABI
+	for _, u := range s.data {
+		if u == nil {
+			continue
+		}
+		for _, c := range u.Contracts {
+			if c.ABI != nil {
+				out = append(out, c.ABI)
 			}
 		}
 	}
 	return out
 }
 
-func (s *Store) getOrCreate(chatID int64) *UserSubs {
-	u := s.data[chatID]
-	if u == nil {
-		u = &UserSubs{}
-		s.data[chatID] = u
+// WantsValueTransfers — есть ли подписки на переводы ETH (порог или кошелёк).
+func (s *Store) WantsValueTransfers() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.idx.largeTx) > 0 || len(s.idx.largeUSD) > 0 || len(s.idx.wallets) > 0
+}
+
+// WantsTokenTransfers — есть ли хоть одна подписка, для которой нужны логи блока.
+func (s *Store) WantsTokenTransfers() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.idx.wallets) > 0 || len(s.idx.tokens) > 0
+}
+
+// update применяет fn к копии подписок чата, сохраняет результат и только
+// после успешной записи подменяет состояние в памяти.
+func (s *Store) update(ctx context.Context, chatID int64, fn func(u *UserSubs)) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	next, _ := s.GetCopy(chatID)
+	fn(&next)
+
+	if s.persist != nil {
+		var err error
+		if next.isEmpty() {
+			err = s.persist.DeleteSubscription(ctx, s.chainID, chatID)
+		} else {
+			rec := toRecord(chatID, next)
+			rec.ChainID = s.chainID
+			err = s.persist.UpsertSubscription(ctx, rec)
+		}
+		if err != nil {
+			return fmt.Errorf("persist subscription: %w", err)
+		}
 	}
-	return u
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next.isEmpty() {
+		s.set(chatID, nil)
+		return nil
+	}
+	s.set(chatID, &next)
+	return nil
 }
 
-func (s *Store) cleanupIfEmpty(chatID int64, u *UserSubs) {
+// set подменяет подписки чата (nil — удаляет) и переиндексирует их.
+// Вызывается под s.mu на запись.
+func (s *Store) set(chatID int64, u *UserSubs) {
+	if old := s.data[chatID]; old != nil {
+		s.idx.remove(chatID, old)
+	}
 	if u == nil {
+		delete(s.data, chatID)
 		return
 	}
-	if u.LargeTxMinWei == nil && u.Wallet == nil {
-		delete(s.data, chatID)
+	s.data[chatID] = u
+	s.idx.add(chatID, u)
+}
+
+func (u *UserSubs) isEmpty() bool {
+	return u.LargeTxMinWei == nil && u.LargeTxMinUSD == nil && u.Wallet == nil && len(u.Tokens) == 0 && len(u.Contracts) == 0 && u.Gas == nil && u.Level.IsLatest()
+}
+
+func (u *UserSubs) clone() UserSubs {
+	out := UserSubs{Level: u.Level}
+	if u.LargeTxMinWei != nil {
+		out.LargeTxMinWei = new(big.Int).Set(u.LargeTxMinWei)
+	}
+	if u.LargeTxMinUSD != nil {
+		out.LargeTxMinUSD = new(big.Int).Set(u.LargeTxMinUSD)
+	}
+	if u.Wallet != nil {
+		a := *u.Wallet
+		out.Wallet = &a
+	}
+	if u.Gas != nil {
+		g := *u.Gas
+		g.ThresholdWei = new(big.Int).Set(g.ThresholdWei)
+		out.Gas = &g
+	}
+	if len(u.Tokens) > 0 {
+		out.Tokens = make(map[common.Address]TokenSub, len(u.Tokens))
+		for addr, ts := range u.Tokens {
+			ts.MinAmount = new(big.Int).Set(ts.MinAmount)
+			out.Tokens[addr] = ts
+		}
+	}
+	if len(u.Contracts) > 0 {
+		out.Contracts = make(map[common.Address]ContractSub, len(u.Contracts))
+		for addr, c := range u.Contracts {
+			c.Events = append([]string(nil), c.Events...)
+			out.Contracts[addr] = c
+		}
+	}
+	return out
+}
+
+func toRecord(chatID int64, u UserSubs) storage.SubscriptionRecord {
+	rec := storage.SubscriptionRecord{
+		ChatID:        chatID,
+		NotifyLevel:   string(u.Level.normalize().Kind),
+		Confirmations: u.Level.Confirmations,
+	}
+	if rec.NotifyLevel == "" {
+		rec.NotifyLevel = string(LevelLatest)
+	}
+	if u.LargeTxMinWei != nil {
+		x := u.LargeTxMinWei.String()
+		rec.LargeTxMinWei = &x
+	}
+	if u.LargeTxMinUSD != nil {
+		x := prices.CentsString(u.LargeTxMinUSD)
+		rec.LargeTxMinUSD = &x
+	}
+	if u.Wallet != nil {
+		x := u.Wallet.Hex()
+		rec.WalletAddr = &x
+	}
+	if u.Gas != nil {
+		rec.Gas = &storage.GasSubscription{
+			Metric:       string(u.Gas.Metric),
+			Direction:    string(u.Gas.Direction),
+			ThresholdWei: u.Gas.ThresholdWei.String(),
+		}
+	}
+	for addr, ts := range u.Tokens {
+		rec.Tokens = append(rec.Tokens, storage.TokenSubscription{
+			TokenAddr: addr.Hex(),
+			MinAmount: ts.MinAmount.String(),
+			Decimals:  ts.Decimals,
+			Symbol:    ts.Symbol,
+		})
+	}
+	for addr, c := range u.Contracts {
+		rec.Contracts = append(rec.Contracts, storage.ContractSubscription{
+			ContractAddr: addr.Hex(),
+			ABI:          c.RawABI,
+			Events:       c.Events,
+		})
+	}
+	return rec
+}
+
+func fromRecord(rec storage.SubscriptionRecord) (*UserSubs, error) {
+	u := &UserSubs{}
+	switch LevelKind(rec.NotifyLevel) {
+	case "", LevelLatest:
+	case LevelSafe, LevelFinalized:
+		u.Level = Level{Kind: LevelKind(rec.NotifyLevel)}
+	case LevelConfirmations:
+		u.Level = Level{Kind: LevelConfirmations, Confirmations: rec.Confirmations}.normalize()
+	default:
+		return nil, fmt.Errorf("bad notify_level %q", rec.NotifyLevel)
+	}
+	if rec.LargeTxMinWei != nil {
+		v, ok := new(big.Int).SetString(*rec.LargeTxMinWei, 10)
+		if !ok {
+			return nil, fmt.Errorf("bad large_tx_min_wei %q", *rec.LargeTxMinWei)
+		}
+		u.LargeTxMinWei = v
+	}
+	if rec.LargeTxMinUSD != nil {
+		v, err := prices.ParseCentsString(*rec.LargeTxMinUSD)
+		if err != nil {
+			return nil, fmt.Errorf("bad large_tx_min_usd: %w", err)
+		}
+		u.LargeTxMinUSD = v
+	}
+	if rec.WalletAddr != nil {
+		if !common.IsHexAddress(*rec.WalletAddr) {
+			return nil, fmt.Errorf("bad wallet_addr %q", *rec.WalletAddr)
+		}
+		a := common.HexToAddress(*rec.WalletAddr)
+		u.Wallet = &a
+	}
+	if rec.Gas != nil {
+		v, ok := new(big.Int).SetString(rec.Gas.ThresholdWei, 10)
+		if !ok {
+			return nil, fmt.Errorf("bad gas_threshold_wei %q", rec.Gas.ThresholdWei)
+		}
+		g := GasAlert{Metric: GasMetric(rec.Gas.Metric), Direction: GasDirection(rec.Gas.Direction), ThresholdWei: v}
+		if err := g.validate(); err != nil {
+			return nil, err
+		}
+		u.Gas = &g
+	}
+	for _, t := range rec.Tokens {
+		if !common.IsHexAddress(t.TokenAddr) {
+			return nil, fmt.Errorf("bad token_addr %q", t.TokenAddr)
+		}
+		v, ok := new(big.Int).SetString(t.MinAmount, 10)
+		if !ok {
+			return nil, fmt.Errorf("bad min_amount %q for token %s", t.MinAmount, t.TokenAddr)
+		}
+		if u.Tokens == nil {
+			u.Tokens = make(map[common.Address]TokenSub)
+		}
+		u.Tokens[common.HexToAddress(t.TokenAddr)] = TokenSub{MinAmount: v, Decimals: t.Decimals, Symbol: t.Symbol}
+	}
+	for _, c := range rec.Contracts {
+		if !common.IsHexAddress(c.ContractAddr) {
+			return nil, fmt.Errorf("bad contract_addr %q", c.ContractAddr)
+		}
+		if u.Contracts == nil {
+			u.Contracts = make(map[common.Address]ContractSub)
+		}
+		if c.ABI == "" {
+			u.Contracts[common.HexToAddress(c.ContractAddr)] = ContractSub{}
+			continue
+		}
+		parsed, err := contracts.ParseABI([]byte(c.ABI))
+		if err != nil {
+			return nil, fmt.Errorf("contract %s: %w", c.ContractAddr, err)
+		}
+		events, err := contracts.ResolveEvents(parsed, c.Events)
+		if err != nil {
+			return nil, fmt.Errorf("contract %s: %w", c.ContractAddr, err)
+		}
+		u.Contracts[common.HexToAddress(c.ContractAddr)] = ContractSub{ABI: parsed, RawABI: c.ABI, Events: events}
 	}
+	return u, nil
 }
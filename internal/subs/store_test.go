@@ -1,18 +1,26 @@
 package subs
 
 import (
+	"context"
+	"errors"
 	"math/big"
 	"testing"
 
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/prices"
+	"github.com/pvzzle/scanblock/internal/storage"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 func TestStore_MatchTx_LargeVolume(t *testing.T) {
+	ctx := context.Background()
 	s := NewStore()
 	chatID := int64(42)
 
 	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-	s.SetLargeTxMin(chatID, oneEth)
+	s.SetLargeTxMin(ctx, chatID, oneEth)
 
 	from := common.HexToAddress("0x1111111111111111111111111111111111111111")
 	to := common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -30,12 +38,49 @@ func TestStore_MatchTx_LargeVolume(t *testing.T) {
 	}
 }
 
+func TestStore_MatchTx_LargeVolumeUSD(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	usdChat, ethChat := int64(1), int64(2)
+
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	_ = s.SetLargeTxMinUSD(ctx, usdChat, big.NewInt(5000_00)) // $5000
+	_ = s.SetLargeTxMin(ctx, ethChat, new(big.Int).Mul(oneEth, big.NewInt(10)))
+
+	from := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	twoEth := new(big.Int).Mul(oneEth, big.NewInt(2))
+
+	// без цены порог в USD не срабатывает
+	if got := s.MatchTx(from, nil, twoEth); len(got) != 0 {
+		t.Fatalf("expected no match without price, got=%v", got)
+	}
+
+	s.SetNativePrice(prices.Price{Answer: big.NewInt(3000_00000000), Decimals: 8})
+	if got := s.MatchTx(from, nil, twoEth); len(got) != 1 || got[0] != usdChat {
+		t.Fatalf("expected USD match for 2 ETH at $3000, got=%v", got)
+	}
+
+	// цена упала — тот же перевод уже меньше порога
+	s.SetNativePrice(prices.Price{Answer: big.NewInt(2000_00000000), Decimals: 8})
+	if got := s.MatchTx(from, nil, twoEth); len(got) != 0 {
+		t.Fatalf("expected no match for 2 ETH at $2000, got=%v", got)
+	}
+
+	// порог в ETH заменяет порог в USD и наоборот
+	_ = s.SetLargeTxMin(ctx, usdChat, oneEth)
+	u, _ := s.GetCopy(usdChat)
+	if u.LargeTxMinUSD != nil || s.WantsNativePrice() {
+		t.Fatalf("expected USD threshold replaced, got %+v", u)
+	}
+}
+
 func TestStore_MatchTx_Wallet(t *testing.T) {
+	ctx := context.Background()
 	s := NewStore()
 	chatID := int64(7)
 
 	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
-	s.SetWallet(chatID, wallet)
+	s.SetWallet(ctx, chatID, wallet)
 
 	other := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
 
@@ -51,22 +96,23 @@ func TestStore_MatchTx_Wallet(t *testing.T) {
 }
 
 func TestStore_ClearAndCleanup(t *testing.T) {
+	ctx := context.Background()
 	s := NewStore()
 	chatID := int64(1)
 
 	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
 	addr := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
 
-	s.SetLargeTxMin(chatID, oneEth)
-	s.SetWallet(chatID, addr)
+	s.SetLargeTxMin(ctx, chatID, oneEth)
+	s.SetWallet(ctx, chatID, addr)
 
-	s.ClearLargeTx(chatID)
+	s.ClearLargeTx(ctx, chatID)
 	u, ok := s.GetCopy(chatID)
 	if !ok || u.Wallet == nil || u.LargeTxMinWei != nil {
 		t.Fatalf("expected only wallet to remain, ok=%v, subs=%+v", ok, u)
 	}
 
-	s.ClearWallet(chatID)
+	s.ClearWallet(ctx, chatID)
 	_, ok = s.GetCopy(chatID)
 	if ok {
 		t.Fatalf("expected cleanup (no subs) => no record")
@@ -74,11 +120,12 @@ func TestStore_ClearAndCleanup(t *testing.T) {
 }
 
 func TestStore_GetCopy_IsCopy(t *testing.T) {
+	ctx := context.Background()
 	s := NewStore()
 	chatID := int64(1)
 
 	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-	s.SetLargeTxMin(chatID, oneEth)
+	s.SetLargeTxMin(ctx, chatID, oneEth)
 
 	u, ok := s.GetCopy(chatID)
 	if !ok || u.LargeTxMinWei == nil {
@@ -92,3 +139,286 @@ func TestStore_GetCopy_IsCopy(t *testing.T) {
 		t.Fatalf("expected stored value unchanged, got=%v", u2.LargeTxMinWei)
 	}
 }
+
+type fakePersister struct {
+	subs    map[int64]storage.SubscriptionRecord
+	failErr error
+}
+
+func newFakePersister() *fakePersister {
+	return &fakePersister{subs: make(map[int64]storage.SubscriptionRecord)}
+}
+
+func (f *fakePersister) UpsertSubscription(ctx context.Context, sub storage.SubscriptionRecord) error {
+	if f.failErr != nil {
+		return f.failErr
+	}
+	f.subs[sub.ChatID] = sub
+	return nil
+}
+
+func (f *fakePersister) DeleteSubscription(ctx context.Context, chainID string, chatID int64) error {
+	if f.failErr != nil {
+		return f.failErr
+	}
+	delete(f.subs, chatID)
+	return nil
+}
+
+func (f *fakePersister) list() []storage.SubscriptionRecord {
+	var out []storage.SubscriptionRecord
+	for _, sub := range f.subs {
+		out = append(out, sub)
+	}
+	return out
+}
+
+func TestStore_WriteThroughAndLoad(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	if err := s.SetLargeTxMin(ctx, 1, oneEth); err != nil {
+		t.Fatalf("SetLargeTxMin: %v", err)
+	}
+	if err := s.SetWallet(ctx, 1, wallet); err != nil {
+		t.Fatalf("SetWallet: %v", err)
+	}
+	if err := s.SetWallet(ctx, 2, wallet); err != nil {
+		t.Fatalf("SetWallet: %v", err)
+	}
+
+	rec, ok := p.subs[1]
+	if !ok || rec.LargeTxMinWei == nil || *rec.LargeTxMinWei != oneEth.String() {
+		t.Fatalf("expected persisted large tx min, got=%+v", rec)
+	}
+	if rec.WalletAddr == nil || *rec.WalletAddr != wallet.Hex() {
+		t.Fatalf("expected persisted wallet, got=%+v", rec)
+	}
+
+	if err := s.ClearAll(ctx, 2); err != nil {
+		t.Fatalf("ClearAll: %v", err)
+	}
+	if _, ok := p.subs[2]; ok {
+		t.Fatalf("expected chat 2 to be deleted from persister")
+	}
+
+	// "рестарт": новый Store из сохранённых записей
+	s2 := NewPersistentStore(p, "1")
+	if err := s2.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	u, ok := s2.GetCopy(1)
+	if !ok || u.LargeTxMinWei == nil || u.LargeTxMinWei.Cmp(oneEth) != 0 || u.Wallet == nil || *u.Wallet != wallet {
+		t.Fatalf("expected subs restored, ok=%v subs=%+v", ok, u)
+	}
+	if _, ok := s2.GetCopy(2); ok {
+		t.Fatalf("expected chat 2 to stay unsubscribed")
+	}
+
+	// порог в USD сохраняется долларами и восстанавливается в центах
+	if err := s.SetLargeTxMinUSD(ctx, 3, big.NewInt(150050)); err != nil {
+		t.Fatalf("SetLargeTxMinUSD: %v", err)
+	}
+	if rec := p.subs[3]; rec.LargeTxMinUSD == nil || *rec.LargeTxMinUSD != "1500.50" || rec.LargeTxMinWei != nil {
+		t.Fatalf("expected persisted usd threshold, got=%+v", rec)
+	}
+	s3 := NewPersistentStore(p, "1")
+	if err := s3.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if u, ok := s3.GetCopy(3); !ok || u.LargeTxMinUSD == nil || u.LargeTxMinUSD.Int64() != 150050 || !s3.WantsNativePrice() {
+		t.Fatalf("expected usd threshold restored, ok=%v subs=%+v", ok, u)
+	}
+}
+
+func TestStore_PersistErrorKeepsMemoryUnchanged(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	if err := s.SetWallet(ctx, 1, wallet); err != nil {
+		t.Fatalf("SetWallet: %v", err)
+	}
+
+	p.failErr = errors.New("db down")
+	if err := s.ClearWallet(ctx, 1); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	u, ok := s.GetCopy(1)
+	if !ok || u.Wallet == nil || *u.Wallet != wallet {
+		t.Fatalf("expected wallet to remain after failed write, ok=%v subs=%+v", ok, u)
+	}
+}
+
+func TestStore_MatchTokenTransfer(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	other := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	if s.WantsTokenTransfers() {
+		t.Fatalf("expected no token interest on empty store")
+	}
+
+	// 1 000 000 USDT (6 decimals)
+	min := new(big.Int).Mul(big.NewInt(1_000_000), big.NewInt(1_000_000))
+	if err := s.SetTokenMin(ctx, 1, usdt, TokenSub{MinAmount: min, Decimals: 6, Symbol: "USDT"}); err != nil {
+		t.Fatalf("SetTokenMin: %v", err)
+	}
+	if err := s.SetWallet(ctx, 2, wallet); err != nil {
+		t.Fatalf("SetWallet: %v", err)
+	}
+	if !s.WantsTokenTransfers() {
+		t.Fatalf("expected token interest")
+	}
+
+	got := s.MatchTokenTransfer(usdt, other, other, new(big.Int).Mul(min, big.NewInt(2)))
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected threshold match for chat 1, got=%v", got)
+	}
+	if got := s.MatchTokenTransfer(usdt, other, other, big.NewInt(1)); len(got) != 0 {
+		t.Fatalf("expected no match below threshold, got=%v", got)
+	}
+	if got := s.MatchTokenTransfer(other, other, wallet, big.NewInt(1)); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("expected wallet match for incoming transfer, got=%v", got)
+	}
+
+	s2 := NewPersistentStore(newFakePersister(), "1")
+	if err := s2.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	u, ok := s2.GetCopy(1)
+	ts, found := u.Tokens[usdt]
+	if !ok || !found || ts.MinAmount.Cmp(min) != 0 || ts.Decimals != 6 || ts.Symbol != "USDT" {
+		t.Fatalf("expected token sub restored, ok=%v subs=%+v", ok, u)
+	}
+
+	if err := s.ClearToken(ctx, 1, usdt); err != nil {
+		t.Fatalf("ClearToken: %v", err)
+	}
+	if _, ok := s.GetCopy(1); ok {
+		t.Fatalf("expected chat 1 to be removed after last token cleared")
+	}
+}
+
+func TestStore_MatchContractLog(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+
+	raw := `[{"type":"event","name":"Ping","inputs":[]},{"type":"event","name":"Pong","inputs":[]}]`
+	parsed, err := contracts.ParseABI([]byte(raw))
+	if err != nil {
+		t.Fatalf("ParseABI: %v", err)
+	}
+	vault := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+
+	if err := s.SetContract(ctx, 1, vault, ContractSub{ABI: parsed, RawABI: raw}); err != nil {
+		t.Fatalf("SetContract: %v", err)
+	}
+	if err := s.SetContract(ctx, 2, vault, ContractSub{ABI: parsed, RawABI: raw, Events: []string{"Pong"}}); err != nil {
+		t.Fatalf("SetContract: %v", err)
+	}
+	if got := s.ContractAddresses(); len(got) != 1 || got[0] != vault {
+		t.Fatalf("unexpected contract addresses: %v", got)
+	}
+
+	ping := &types.Log{Address: vault, Topics: []common.Hash{parsed.Events["Ping"].ID}}
+	if got := s.MatchContractLog(ping); len(got) != 1 || got[0].ChatID != 1 {
+		t.Fatalf("expected Ping only for chat 1, got=%+v", got)
+	}
+	pong := &types.Log{Address: vault, Topics: []common.Hash{parsed.Events["Pong"].ID}}
+	if got := s.MatchContractLog(pong); len(got) != 2 {
+		t.Fatalf("expected Pong for both chats, got=%+v", got)
+	}
+	pong.Address = common.HexToAddress("0xdddddddddddddddddddddddddddddddddddddddd")
+	if got := s.MatchContractLog(pong); len(got) != 0 {
+		t.Fatalf("expected no match for other contract, got=%+v", got)
+	}
+
+	s2 := NewPersistentStore(newFakePersister(), "1")
+	if err := s2.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	u, _ := s2.GetCopy(2)
+	c, ok := u.Contracts[vault]
+	if !ok || c.ABI == nil || len(c.Events) != 1 || c.Events[0] != "Pong" {
+		t.Fatalf("expected contract sub restored, got=%+v", u.Contracts)
+	}
+
+	if err := s.ClearContract(ctx, 1, vault); err != nil {
+		t.Fatalf("ClearContract: %v", err)
+	}
+	if _, ok := s.GetCopy(1); ok {
+		t.Fatalf("expected chat 1 to be removed after last contract cleared")
+	}
+}
+
+func TestStore_ContractWithoutABI(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	s := NewPersistentStore(p, "1")
+	deployed := common.HexToAddress("0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")
+
+	if err := s.SetContract(ctx, 1, deployed, ContractSub{}); err != nil {
+		t.Fatalf("SetContract: %v", err)
+	}
+	l := &types.Log{Address: deployed, Topics: []common.Hash{common.HexToHash("0x01")}}
+	if got := s.MatchContractLog(l); len(got) != 1 || got[0].ChatID != 1 || got[0].ABI != nil {
+		t.Fatalf("expected any log to match without ABI, got=%+v", got)
+	}
+	if got := s.ContractABIs(); len(got) != 0 {
+		t.Fatalf("expected no ABIs for selectors, got=%d", len(got))
+	}
+
+	s2 := NewPersistentStore(newFakePersister(), "1")
+	if err := s2.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	u, _ := s2.GetCopy(1)
+	if c, ok := u.Contracts[deployed]; !ok || c.ABI != nil {
+		t.Fatalf("expected ABI-less contract sub restored, got=%+v", u.Contracts)
+	}
+}
+
+func TestStore_LoadOnlyOwnChain(t *testing.T) {
+	ctx := context.Background()
+	p := newFakePersister()
+	wallet := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	arb := NewPersistentStore(p, "42161")
+	if err := arb.SetWallet(ctx, 1, wallet); err != nil {
+		t.Fatalf("SetWallet: %v", err)
+	}
+	if rec := p.subs[1]; rec.ChainID != "42161" {
+		t.Fatalf("expected record scoped to chain 42161, got %+v", rec)
+	}
+
+	mainnet := NewPersistentStore(p, "1")
+	if err := mainnet.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := mainnet.GetCopy(1); ok {
+		t.Fatalf("expected arbitrum subscription not to leak into mainnet store")
+	}
+	if got := mainnet.MatchWallet(wallet); len(got) != 0 {
+		t.Fatalf("expected no mainnet match, got=%v", got)
+	}
+
+	arb2 := NewPersistentStore(p, "42161")
+	if err := arb2.Load(p.list()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := arb2.MatchWallet(wallet); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected arbitrum match after reload, got=%v", got)
+	}
+}
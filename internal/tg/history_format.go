@@ -5,11 +5,15 @@ import (
 	"math/big"
 	"strings"
 
+	"github.com/pvzzle/scanblock/internal/chains"
 	"github.com/pvzzle/scanblock/internal/ethwatch"
+	"github.com/pvzzle/scanblock/internal/prices"
 	"github.com/pvzzle/scanblock/internal/storage"
 )
 
-func FormatHistory(items []storage.HistoryItem) string {
+// FormatHistory — история чата; nets нужны для имени сети и символа валюты
+// (сеть показываем, только если их больше одной).
+func FormatHistory(items []storage.HistoryItem, nets chains.Set) string {
 	var sb strings.Builder
 	sb.WriteString("🕘 History (последние 10)\n\n")
 
@@ -34,15 +38,49 @@ func FormatHistory(items []storage.HistoryItem) string {
 			bn = fmt.Sprintf(" #%d", *it.BlockNum)
 		}
 
+		net := nets.ByID(it.ChainID)
+		if len(nets) > 1 {
+			bn += " · " + net.Name
+		}
+
 		sb.WriteString(fmt.Sprintf(
-			"• %s (%s)%s\n  %s ETH%s\n",
-			hashShort, it.EventType, bn, valEth, status,
+			"• %s (%s)%s\n  %s %s%s%s\n",
+			hashShort, it.EventType, bn, valEth, net.Symbol, usdSuffix(it.ValueUSD), status,
 		))
+
+		for _, t := range it.Transfers {
+			sb.WriteString("  " + formatTransferLine(t) + "\n")
+		}
 	}
 
 	return sb.String()
 }
 
+func formatTransferLine(t storage.TokenTransferRecord) string {
+	token := shortenHash(t.TokenAddr)
+	switch {
+	case t.TokenID == nil:
+		// decimals в истории не храним — показываем сырые единицы
+		return fmt.Sprintf("🪙 %s: %s units%s", token, t.Amount, usdSuffix(t.ValueUSD))
+	case t.Standard == "erc721":
+		return fmt.Sprintf("🖼 ERC721 %s #%s", token, *t.TokenID)
+	default:
+		return fmt.Sprintf("🖼 ERC1155 %s #%s × %s", token, *t.TokenID, t.Amount)
+	}
+}
+
+// usdSuffix — " (~$1,500.50)" из суммы в БД; пусто, если цены не было.
+func usdSuffix(v *string) string {
+	if v == nil {
+		return ""
+	}
+	cents, err := prices.ParseCentsString(*v)
+	if err != nil {
+		return ""
+	}
+	return ethwatch.USDSuffix(cents)
+}
+
 func shortenHash(h string) string {
 	if len(h) <= 14 {
 		return h
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pvzzle/scanblock/internal/chains"
 	"github.com/pvzzle/scanblock/internal/storage"
 )
 
@@ -23,7 +24,7 @@ func TestFormatHistory(t *testing.T) {
 		},
 	}
 
-	txt := FormatHistory(items)
+	txt := FormatHistory(items, nil)
 
 	if txt == "" {
 		t.Fatal("expected non-empty")
@@ -45,6 +46,73 @@ func TestFormatHistory(t *testing.T) {
 	}
 }
 
+func TestFormatHistory_Transfers(t *testing.T) {
+	id := "42"
+	items := []storage.HistoryItem{
+		{
+			EventType: storage.EventNotify,
+			Hash:      "0x" + repeat("2", 64),
+			ValueWei:  "0",
+			Transfers: []storage.TokenTransferRecord{
+				{Standard: "erc721", TokenAddr: "0x" + repeat("a", 40), TokenID: &id, Amount: "1"},
+				{Standard: "erc1155", TokenAddr: "0x" + repeat("b", 40), TokenID: &id, Amount: "5"},
+			},
+		},
+	}
+
+	txt := FormatHistory(items, nil)
+	if !has(txt, "🖼 ERC721 0xaaaaaaaa…aaaa #42") {
+		t.Fatalf("expected erc721 line: %s", txt)
+	}
+	if !has(txt, "#42 × 5") {
+		t.Fatalf("expected erc1155 amount: %s", txt)
+	}
+}
+
+func TestFormatHistory_Networks(t *testing.T) {
+	items := []storage.HistoryItem{
+		{EventType: storage.EventNotify, Hash: "0x" + repeat("3", 64), ChainID: "137", ValueWei: "2000000000000000000"},
+		{EventType: storage.EventSearch, Hash: "0x" + repeat("4", 64), ChainID: "1", ValueWei: "0"},
+	}
+	nets := chains.Set{chains.Resolve(1), chains.Resolve(137)}
+
+	txt := FormatHistory(items, nets)
+	if !has(txt, "(notify) · Polygon\n  2.000000 POL") {
+		t.Fatalf("expected polygon item with POL: %s", txt)
+	}
+	if !has(txt, "(search) · Ethereum\n  0.000000 ETH") {
+		t.Fatalf("expected ethereum item: %s", txt)
+	}
+
+	// одна сеть — имя не показываем
+	if txt := FormatHistory(items[:1], nets[1:]); has(txt, "Polygon") || !has(txt, "POL") {
+		t.Fatalf("expected symbol without network name: %s", txt)
+	}
+}
+
+func TestFormatHistory_USD(t *testing.T) {
+	usd, tokenUSD := "3000.00", "1500.50"
+	items := []storage.HistoryItem{
+		{
+			EventType: storage.EventNotify,
+			Hash:      "0x" + repeat("5", 64),
+			ValueWei:  "1000000000000000000",
+			ValueUSD:  &usd,
+			Transfers: []storage.TokenTransferRecord{
+				{Standard: "erc20", TokenAddr: "0x" + repeat("c", 40), Amount: "1500500000", ValueUSD: &tokenUSD},
+			},
+		},
+	}
+
+	txt := FormatHistory(items, nil)
+	if !has(txt, "1.000000 ETH (~$3,000.00)") {
+		t.Fatalf("expected usd value: %s", txt)
+	}
+	if !has(txt, "1500500000 units (~$1,500.50)") {
+		t.Fatalf("expected token usd value: %s", txt)
+	}
+}
+
 func has(s, sub string) bool {
 	for i := 0; i+len(sub) <= len(s); i++ {
 		if s[i:i+len(sub)] == sub {
@@ -5,6 +5,10 @@ import (
 	"math/big"
 	"regexp"
 	"strings"
+
+	"github.com/pvzzle/scanblock/internal/ens"
+	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
 )
 
 var (
@@ -12,7 +16,8 @@ var (
 	reEthAddr = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{40}$`)
 	weiPerEth = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
 
-	ErrInvalidAmount = errors.New("invalid eth amount")
+	ErrInvalidAmount       = errors.New("invalid eth amount")
+	ErrInvalidGasThreshold = errors.New("invalid gas threshold")
 )
 
 func IsTxHash(s string) bool {
@@ -25,6 +30,11 @@ func IsEthAddress(s string) bool {
 	return reEthAddr.MatchString(s)
 }
 
+// IsAddressOrName — 0x-адрес или ENS-имя (vitalik.eth).
+func IsAddressOrName(s string) bool {
+	return IsEthAddress(s) || ens.IsName(s)
+}
+
 // ParseEthToWei парсит ETH-строку ("1.5", "0,5") в Wei (floor), требует > 0.
 func ParseEthToWei(amount string) (*big.Int, error) {
 	amount = strings.TrimSpace(amount)
@@ -46,3 +56,34 @@ func ParseEthToWei(amount string) (*big.Int, error) {
 
 	return out, nil
 }
+
+// ParseSearchQuery разбирает запрос поиска: "0x…" или "<сеть> 0x…" / "<сеть>:0x…".
+// network пустой, если сеть не указана.
+func ParseSearchQuery(text string) (network, hash string) {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, " \t:"); i >= 0 {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+	}
+	return "", text
+}
+
+// ParseGasThreshold парсит порог газового алерта: "<10" — ниже 10 gwei,
+// ">50" — выше 50 gwei (можно с пробелом и дробью: "< 0.5").
+func ParseGasThreshold(text string) (subs.GasDirection, *big.Int, error) {
+	text = strings.TrimSpace(text)
+	var dir subs.GasDirection
+	switch {
+	case strings.HasPrefix(text, "<"):
+		dir = subs.GasBelow
+	case strings.HasPrefix(text, ">"):
+		dir = subs.GasAbove
+	default:
+		return "", nil, ErrInvalidGasThreshold
+	}
+
+	wei, err := tokens.ParseUnits(text[1:], 9)
+	if err != nil {
+		return "", nil, ErrInvalidGasThreshold
+	}
+	return dir, wei, nil
+}
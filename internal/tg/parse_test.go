@@ -3,6 +3,8 @@ package tg
 import (
 	"math/big"
 	"testing"
+
+	"github.com/pvzzle/scanblock/internal/subs"
 )
 
 func TestParseEthToWei(t *testing.T) {
@@ -62,6 +64,30 @@ func TestValidators(t *testing.T) {
 	if IsEthAddress("0x" + repeat("b", 39)) {
 		t.Fatalf("expected invalid address")
 	}
+
+	if !IsAddressOrName("vitalik.eth") || !IsAddressOrName("0x"+repeat("b", 40)) {
+		t.Fatalf("expected address or ENS name")
+	}
+	if IsAddressOrName("0x"+repeat("a", 64)) || IsAddressOrName("vitalik") {
+		t.Fatalf("expected tx hash and bare label to be rejected")
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	hash := "0x" + repeat("a", 64)
+	cases := []struct{ in, network, hash string }{
+		{hash, "", hash},
+		{"  " + hash + " ", "", hash},
+		{"arbitrum " + hash, "arbitrum", hash},
+		{"base:" + hash, "base", hash},
+		{"137   " + hash, "137", hash},
+	}
+	for _, tc := range cases {
+		network, h := ParseSearchQuery(tc.in)
+		if network != tc.network || h != tc.hash {
+			t.Fatalf("ParseSearchQuery(%q) = %q, %q; want %q, %q", tc.in, network, h, tc.network, tc.hash)
+		}
+	}
 }
 
 func repeat(s string, n int) string {
@@ -71,3 +97,19 @@ func repeat(s string, n int) string {
 	}
 	return out
 }
+
+func TestParseGasThreshold(t *testing.T) {
+	dir, wei, err := ParseGasThreshold("<10")
+	if err != nil || dir != subs.GasBelow || wei.Cmp(big.NewInt(10_000_000_000)) != 0 {
+		t.Fatalf("expected below 10 gwei, got=%s %v %v", dir, wei, err)
+	}
+	dir, wei, err = ParseGasThreshold("> 0,5")
+	if err != nil || dir != subs.GasAbove || wei.Cmp(big.NewInt(500_000_000)) != 0 {
+		t.Fatalf("expected above 0.5 gwei, got=%s %v %v", dir, wei, err)
+	}
+	for _, bad := range []string{"10", "<", "<0", "<-1", ">abc"} {
+		if _, _, err := ParseGasThreshold(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
@@ -2,20 +2,29 @@ package tg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
+	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/pvzzle/scanblock/internal/bus"
+	"github.com/pvzzle/scanblock/internal/chains"
+	"github.com/pvzzle/scanblock/internal/contracts"
+	"github.com/pvzzle/scanblock/internal/ens"
 	"github.com/pvzzle/scanblock/internal/ethwatch"
+	"github.com/pvzzle/scanblock/internal/prices"
 	"github.com/pvzzle/scanblock/internal/storage"
 	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	tgbot "github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
@@ -26,50 +35,150 @@ const (
 
 	cbSubLarge  = "sub_large"
 	cbSubWallet = "sub_wallet"
+	cbSubToken  = "sub_token"
+	// cbSubContract — события своего контракта по ABI
+	cbSubContract = "sub_contract"
+	// cbContractAllEvents — подписаться на все события присланного ABI
+	cbContractAllEvents = "contract_events_all"
+	// cbSubGas — алерт на base fee / priority fee; cbGasMetricPrefix + subs.GasMetric
+	cbSubGas          = "sub_gas"
+	cbGasMetricPrefix = "gas_metric:"
 
 	cbMySubs      = "my_subs"
 	cbUnsubLarge  = "unsub_large"
 	cbUnsubWallet = "unsub_wallet"
 	cbUnsubAll    = "unsub_all"
-	cbBackToMain  = "back_main"
+	cbUnsubGas    = "unsub_gas"
+	// cbUnsubTokenPrefix + адрес токена
+	cbUnsubTokenPrefix = "unsub_token:"
+	// cbUnsubContractPrefix + адрес контракта
+	cbUnsubContractPrefix = "unsub_contract:"
+	cbBackToMain          = "back_main"
+
+	cbNotifyLevel = "notify_level"
+	// cbLevelPrefix + latest / safe / finalized / число подтверждений / custom
+	cbLevelPrefix = "level:"
+	levelCustom   = "custom"
 
 	cbHistory = "history"
+
+	// cbNetwork — выбор сети для подписок; cbNetworkPrefix + ключ сети
+	cbNetwork       = "network"
+	cbNetworkPrefix = "network:"
+
+	// cbWatchContractPrefix + chain id + ":" + адрес — следить за только что созданным контрактом
+	cbWatchContractPrefix = "watch:"
+	// cbWatchWalletPrefix + адрес — подписаться на кошелёк, найденный поиском
+	cbWatchWalletPrefix = "watch_wallet:"
 )
 
+// ChainReader — RPC-вызовы, нужные для поиска транзакции (ethclient.Client или rpcpool.Pool).
+type ChainReader interface {
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// Network — сеть, в которой бот ищет транзакции и ведёт подписки.
+type Network struct {
+	chains.Network
+	Reader ChainReader
+	Subs   *subs.Store
+	// Prices — Chainlink-агрегаторы сети; nil — без оценок в USD
+	Prices *prices.Oracle
+}
+
+type network struct {
+	Network
+	// tokens — decimals/symbol токенов этой сети
+	tokens *tokens.Registry
+}
+
 type Service struct {
-	bot     *tgbot.Bot
-	eth     *ethclient.Client
-	chainID *big.Int
+	bot *tgbot.Bot
+
+	// networks — в порядке из конфига; первая — сеть по умолчанию
+	networks []*network
+	chainSet chains.Set
 
-	subStore *subs.Store
 	notifyCh <-chan bus.Notification
 
-	state *StateStore
+	state     *StateStore
+	selectors *contracts.Selectors
+
+	// ens — имена вместо адресов во вводе и рядом с адресами в ответах (nil — ENS не настроен)
+	ens *ens.Resolver
 
 	repo storage.Repository
 }
 
 func NewService(
 	b *tgbot.Bot,
-	eth *ethclient.Client,
-	chainID *big.Int,
-	subStore *subs.Store,
+	networks []Network,
 	notifyCh <-chan bus.Notification,
 	repo storage.Repository,
+	selectors *contracts.Selectors,
+	names *ens.Resolver,
 ) *Service {
 	s := &Service{
 		bot:      b,
-		eth:      eth,
-		chainID:  chainID,
-		subStore: subStore,
 		notifyCh: notifyCh,
 		state:    NewStateStore(),
 		repo:     repo,
+
+		selectors: selectors,
+		ens:       names,
+	}
+	for _, n := range networks {
+		s.networks = append(s.networks, &network{Network: n, tokens: tokens.NewRegistry(n.Reader)})
+		s.chainSet = append(s.chainSet, n.Network)
 	}
 	s.registerHandlers()
 	return s
 }
 
+// net — сеть, выбранная в чате (по умолчанию первая из конфига).
+func (s *Service) net(chatID int64) *network {
+	if key := s.state.Network(chatID); key != "" {
+		for _, n := range s.networks {
+			if n.Key == key {
+				return n
+			}
+		}
+	}
+	return s.networks[0]
+}
+
+// setNetwork переключает чат на сеть и запоминает выбор в БД (по chain_id):
+// после рестарта бота чат остаётся в своей сети.
+func (s *Service) setNetwork(ctx context.Context, chatID int64, n chains.Network) {
+	s.state.SetNetwork(chatID, n.Key)
+	if err := s.repo.SetChatNetwork(ctx, chatID, n.IDString()); err != nil {
+		log.Printf("[tg] save chat network error: chat=%d err=%v", chatID, err)
+	}
+}
+
+// RestoreNetworks поднимает из БД сети, выбранные в чатах. Сеть, которой больше
+// нет в конфиге, пропускается — чат вернётся к сети по умолчанию.
+func (s *Service) RestoreNetworks(ctx context.Context) error {
+	saved, err := s.repo.ListChatNetworks(ctx)
+	if err != nil {
+		return err
+	}
+	for chatID, chainID := range saved {
+		for _, n := range s.networks {
+			if n.IDString() == chainID {
+				s.state.SetNetwork(chatID, n.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// multiChain — больше одной сети: тогда в меню есть выбор сети.
+func (s *Service) multiChain() bool { return len(s.networks) > 1 }
+
 func (s *Service) registerHandlers() {
 	s.bot.RegisterHandler(tgbot.HandlerTypeMessageText, "/start", tgbot.MatchTypeExact, s.onStart)
 
@@ -77,15 +186,29 @@ func (s *Service) registerHandlers() {
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbSubscribe, tgbot.MatchTypeExact, s.onCbSubscribe)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbSubLarge, tgbot.MatchTypeExact, s.onCbSubLarge)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbSubWallet, tgbot.MatchTypeExact, s.onCbSubWallet)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbSubToken, tgbot.MatchTypeExact, s.onCbSubToken)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbSubContract, tgbot.MatchTypeExact, s.onCbSubContract)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbContractAllEvents, tgbot.MatchTypeExact, s.onCbContractAllEvents)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbSubGas, tgbot.MatchTypeExact, s.onCbSubGas)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbGasMetricPrefix, tgbot.MatchTypePrefix, s.onCbGasMetric)
 
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbMySubs, tgbot.MatchTypeExact, s.onCbMySubs)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbUnsubLarge, tgbot.MatchTypeExact, s.onCbUnsubLarge)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbUnsubWallet, tgbot.MatchTypeExact, s.onCbUnsubWallet)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbUnsubAll, tgbot.MatchTypeExact, s.onCbUnsubAll)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbUnsubGas, tgbot.MatchTypeExact, s.onCbUnsubGas)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbUnsubTokenPrefix, tgbot.MatchTypePrefix, s.onCbUnsubToken)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbUnsubContractPrefix, tgbot.MatchTypePrefix, s.onCbUnsubContract)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbBackToMain, tgbot.MatchTypeExact, s.onCbBackToMain)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbNotifyLevel, tgbot.MatchTypeExact, s.onCbNotifyLevel)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbLevelPrefix, tgbot.MatchTypePrefix, s.onCbLevel)
 
 	s.bot.RegisterHandler(tgbot.HandlerTypeMessageText, "", tgbot.MatchTypePrefix, s.onAnyText)
 	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbHistory, tgbot.MatchTypeExact, s.onCbHistory)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbNetwork, tgbot.MatchTypeExact, s.onCbNetwork)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbNetworkPrefix, tgbot.MatchTypePrefix, s.onCbSetNetwork)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbWatchContractPrefix, tgbot.MatchTypePrefix, s.onCbWatchContract)
+	s.bot.RegisterHandler(tgbot.HandlerTypeCallbackQueryData, cbWatchWalletPrefix, tgbot.MatchTypePrefix, s.onCbWatchWallet)
 
 }
 
@@ -95,13 +218,54 @@ func (s *Service) StartNotifyLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case n := <-s.notifyCh:
-			_, err := s.bot.SendMessage(ctx, &tgbot.SendMessageParams{
-				ChatID: n.ChatID,
-				Text:   n.Text,
-			})
-			if err != nil {
-				log.Printf("[tg] send notify error: %v", err)
-			}
+			s.deliver(ctx, n)
+		}
+	}
+}
+
+// deliver отправляет уведомление. Уведомление с ключом (чат, tx, событие) не
+// уходит, если событие уже есть в chat_tx, а само событие пишется только после
+// того, как Telegram принял сообщение: не доставленное сообщение не помечается
+// доставленным, и повторная обработка блока отправит его снова.
+func (s *Service) deliver(ctx context.Context, n bus.Notification) {
+	keyed := n.TxHash != "" && n.Event != ""
+	event := storage.TxEventType(n.Event)
+	if keyed {
+		sent, err := s.repo.HasChatEvent(ctx, n.ChatID, n.TxHash, event)
+		if err != nil {
+			// без БД лучше дубль, чем потерянное уведомление
+			log.Printf("[tg] chat %d event for %s error: %v", n.ChatID, n.TxHash, err)
+		} else if sent {
+			return
+		}
+	}
+
+	params := &tgbot.SendMessageParams{
+		ChatID: n.ChatID,
+		Text:   n.Text,
+	}
+	if len(n.Deployed) > 0 {
+		params.ReplyMarkup = watchContractKeyboard(n.ChainID, n.Deployed)
+	}
+	_, err := s.bot.SendMessage(ctx, params)
+	var tooMany *tgbot.TooManyRequestsError
+	if errors.As(err, &tooMany) {
+		// лимит Telegram: ждём, сколько просят, и пробуем ещё раз
+		select {
+		case <-time.After(time.Duration(tooMany.RetryAfter) * time.Second):
+			_, err = s.bot.SendMessage(ctx, params)
+		case <-ctx.Done():
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("[tg] send notify error: %v", err)
+		return
+	}
+
+	if keyed && !n.More {
+		if _, err := s.repo.AddChatEvent(ctx, n.ChatID, n.TxHash, event); err != nil {
+			log.Printf("[tg] chat %d event for %s error: %v", n.ChatID, n.TxHash, err)
 		}
 	}
 }
@@ -114,20 +278,79 @@ func (s *Service) onStart(ctx context.Context, b *tgbot.Bot, upd *models.Update)
 	s.state.Set(chatID, StateIdle)
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
-		ChatID: chatID,
-		Text:   "Привет! Я могу искать транзакции и управлять подписками.\n\nВыбери действие:",
-		ReplyMarkup: &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{
-					{Text: "Search", CallbackData: cbSearch},
-					{Text: "Subscribe", CallbackData: cbSubscribe},
-				},
-				{
-					{Text: "My subscriptions", CallbackData: cbMySubs},
-					{Text: "History", CallbackData: cbHistory},
-				},
-			},
+		ChatID:      chatID,
+		Text:        "Привет! Я могу искать транзакции и управлять подписками.\n\nВыбери действие:",
+		ReplyMarkup: s.mainMenu(chatID),
+	})
+}
+
+// mainMenu — кнопки главного меню; выбор сети — только если сетей несколько.
+func (s *Service) mainMenu(chatID int64) *models.InlineKeyboardMarkup {
+	keyboard := [][]models.InlineKeyboardButton{
+		{
+			{Text: "Search", CallbackData: cbSearch},
+			{Text: "Subscribe", CallbackData: cbSubscribe},
 		},
+		{
+			{Text: "My subscriptions", CallbackData: cbMySubs},
+			{Text: "History", CallbackData: cbHistory},
+		},
+	}
+	if s.multiChain() {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: "Сеть: " + s.net(chatID).Name, CallbackData: cbNetwork},
+		})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+func (s *Service) onCbNetwork(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	s.state.Set(chatID, StateIdle)
+
+	current := s.net(chatID)
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(s.networks)+1)
+	for _, n := range s.networks {
+		label := fmt.Sprintf("%s (%s)", n.Name, n.Symbol)
+		if n == current {
+			label = "• " + label
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: label, CallbackData: cbNetworkPrefix + n.Key}})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Назад", CallbackData: cbBackToMain}})
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        fmt.Sprintf("Сейчас: %s.\nВ какой сети настраивать подписки? Подписки у каждой сети свои.", current.Name),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+func (s *Service) onCbSetNetwork(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	n, ok := s.chainSet.Find(strings.TrimPrefix(cb.Data, cbNetworkPrefix))
+	if !ok {
+		return
+	}
+	s.state.Set(chatID, StateIdle)
+	s.setNetwork(ctx, chatID, n)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        fmt.Sprintf("✅ Сеть: %s. Подписки и уведомления ниже — для неё.", n.Name),
+		ReplyMarkup: s.mainMenu(chatID),
 	})
 }
 
@@ -143,7 +366,7 @@ func (s *Service) onCbSearch(ctx context.Context, b *tgbot.Bot, upd *models.Upda
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   "Введи хэш транзакции (0x...):",
+		Text:   "Введи хэш транзакции (0x...), адрес или ENS-имя (vitalik.eth):",
 	})
 }
 
@@ -157,13 +380,22 @@ func (s *Service) onCbSubscribe(ctx context.Context, b *tgbot.Bot, upd *models.U
 	chatID := cb.Message.Message.Chat.ID
 	s.state.Set(chatID, StateIdle)
 
+	net := s.net(chatID)
+	text := "Что отслеживать?"
+	if s.multiChain() {
+		text = fmt.Sprintf("Что отслеживать в сети %s?", net.Name)
+	}
+
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   "Что отслеживать?",
+		Text:   text,
 		ReplyMarkup: &models.InlineKeyboardMarkup{
 			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{{Text: "Крупные объемы (ETH)", CallbackData: cbSubLarge}},
+				{{Text: fmt.Sprintf("Крупные объемы (%s)", net.Symbol), CallbackData: cbSubLarge}},
 				{{Text: "Кошелёк (sender/receiver)", CallbackData: cbSubWallet}},
+				{{Text: "Крупные переводы токена (ERC-20)", CallbackData: cbSubToken}},
+				{{Text: "События своего контракта (ABI)", CallbackData: cbSubContract}},
+				{{Text: "Газ (base fee / priority fee)", CallbackData: cbSubGas}},
 			},
 		},
 	})
@@ -181,7 +413,7 @@ func (s *Service) onCbSubLarge(ctx context.Context, b *tgbot.Bot, upd *models.Up
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   "Введи сумму в ETH (> 0), например: 1.5",
+		Text:   s.largePrompt(chatID),
 	})
 }
 
@@ -197,10 +429,149 @@ func (s *Service) onCbSubWallet(ctx context.Context, b *tgbot.Bot, upd *models.U
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   "Введи адрес кошелька (0x...):",
+		Text:   "Введи адрес кошелька (0x...) или ENS-имя (vitalik.eth):",
+	})
+}
+
+func (s *Service) onCbSubToken(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	s.state.Set(chatID, StateAwaitTokenAddress)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Введи адрес контракта токена (0x...):",
+	})
+}
+
+func (s *Service) onCbSubContract(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	s.state.Set(chatID, StateAwaitContractAddress)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Введи адрес контракта (0x...):",
+	})
+}
+
+func (s *Service) onCbSubGas(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	s.state.Set(chatID, StateIdle)
+
+	net := s.net(chatID)
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "За чем следить?",
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: "Base fee" + gasNow(net, subs.GasBaseFee), CallbackData: cbGasMetricPrefix + string(subs.GasBaseFee)}},
+				{{Text: "Priority fee" + gasNow(net, subs.GasPriorityFee), CallbackData: cbGasMetricPrefix + string(subs.GasPriorityFee)}},
+				{{Text: "Назад", CallbackData: cbSubscribe}},
+			},
+		},
+	})
+}
+
+func (s *Service) onCbGasMetric(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	metric := subs.GasMetric(strings.TrimPrefix(cb.Data, cbGasMetricPrefix))
+	if metric != subs.GasBaseFee && metric != subs.GasPriorityFee {
+		return
+	}
+	s.state.Set(chatID, StateAwaitGasThreshold)
+	s.state.SetPendingGasMetric(chatID, metric)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text: fmt.Sprintf("%s%s.\nВведи порог в gwei со знаком: <10 — уведомить, когда опустится ниже 10 gwei, >50 — когда поднимется выше 50.",
+			gasMetricLabel(metric), gasNow(s.net(chatID), metric)),
+	})
+}
+
+func (s *Service) handleSetGas(ctx context.Context, b *tgbot.Bot, chatID int64, text string) {
+	metric, ok := s.state.PendingGasMetric(chatID)
+	if !ok {
+		s.state.Set(chatID, StateIdle)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Используй /start, чтобы открыть меню.",
+		})
+		return
+	}
+
+	dir, threshold, err := ParseGasThreshold(text)
+	if err != nil {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Нужен знак и число gwei > 0, например <10 или >50. Попробуй ещё раз.",
+		})
+		return
+	}
+
+	net := s.net(chatID)
+	alert := subs.GasAlert{Metric: metric, Direction: dir, ThresholdWei: threshold}
+	if err := net.Subs.SetGasAlert(ctx, chatID, alert); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+	s.state.Set(chatID, StateIdle)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text: fmt.Sprintf("✅ Ок! Газовый алерт: %s%s.\nПосле срабатывания уведомлю снова, когда значение отойдёт от порога назад на %d%%.",
+			gasAlertLabel(alert), gasNow(net, metric), subs.GasHysteresisPercent),
 	})
 }
 
+// gasMetricLabel — метрика газа для меню.
+func gasMetricLabel(m subs.GasMetric) string {
+	if m == subs.GasPriorityFee {
+		return fmt.Sprintf("Priority fee (медиана за %d блоков)", ethwatch.GasPriorityWindow)
+	}
+	return "Base fee"
+}
+
+// gasAlertLabel — "base fee ниже 10.00 gwei".
+func gasAlertLabel(a subs.GasAlert) string {
+	dir := "выше"
+	if a.Direction == subs.GasBelow {
+		dir = "ниже"
+	}
+	return fmt.Sprintf("%s %s %s gwei", strings.ToLower(gasMetricLabel(a.Metric)), dir, ethwatch.WeiToGweiString(a.ThresholdWei))
+}
+
+// gasNow — " (сейчас 12.34 gwei)" по последнему блоку сети; пусто, если значения ещё нет.
+func gasNow(net *network, m subs.GasMetric) string {
+	r, ok := net.Subs.Gas()
+	if !ok || r.Value(m) == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (сейчас %s gwei)", ethwatch.WeiToGweiString(r.Value(m)))
+}
+
 func (s *Service) onAnyText(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
 	if upd.Message == nil {
 		return
@@ -208,6 +579,12 @@ func (s *Service) onAnyText(ctx context.Context, b *tgbot.Bot, upd *models.Updat
 	chatID := upd.Message.Chat.ID
 	text := strings.TrimSpace(upd.Message.Text)
 
+	// файл с ABI приходит документом без текста
+	if upd.Message.Document != nil {
+		s.handleDocument(ctx, b, chatID, upd.Message.Document)
+		return
+	}
+
 	// команды — не обрабатываем тут
 	if strings.HasPrefix(text, "/") {
 		return
@@ -224,6 +601,27 @@ func (s *Service) onAnyText(ctx context.Context, b *tgbot.Bot, upd *models.Updat
 	case StateAwaitWalletAddress:
 		s.handleSetWallet(ctx, b, chatID, text)
 
+	case StateAwaitTokenAddress:
+		s.handleTokenAddress(ctx, b, chatID, text)
+
+	case StateAwaitTokenAmount:
+		s.handleSetTokenMin(ctx, b, chatID, text)
+
+	case StateAwaitConfirmations:
+		s.handleSetConfirmations(ctx, b, chatID, text)
+
+	case StateAwaitContractAddress:
+		s.handleContractAddress(ctx, b, chatID, text)
+
+	case StateAwaitContractABI:
+		s.handleContractABI(ctx, b, chatID, []byte(text))
+
+	case StateAwaitContractEvents:
+		s.handleContractEvents(ctx, b, chatID, strings.Split(text, ","))
+
+	case StateAwaitGasThreshold:
+		s.handleSetGas(ctx, b, chatID, text)
+
 	default:
 		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 			ChatID: chatID,
@@ -232,19 +630,45 @@ func (s *Service) onAnyText(ctx context.Context, b *tgbot.Bot, upd *models.Updat
 	}
 }
 
-func (s *Service) handleSearchTx(ctx context.Context, b *tgbot.Bot, chatID int64, hashStr string) {
+func (s *Service) handleSearchTx(ctx context.Context, b *tgbot.Bot, chatID int64, query string) {
+	selector, hashStr := ParseSearchQuery(query)
+	if selector == "" && IsAddressOrName(hashStr) {
+		s.handleSearchAddress(ctx, b, chatID, hashStr)
+		return
+	}
 	if !IsTxHash(hashStr) {
 		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 			ChatID: chatID,
-			Text:   "Похоже, это не хэш транзакции. Ожидаю 0x + 64 hex символа.",
+			Text:   "Похоже, это не хэш транзакции. Ожидаю 0x + 64 hex символа (можно с сетью впереди: arbitrum 0x...), адрес или ENS-имя.",
+		})
+		return
+	}
+
+	candidates, ok := s.searchNetworks(chatID, selector)
+	if !ok {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Не знаю сеть %q. Доступны: %s.", selector, s.networkKeys()),
 		})
 		return
 	}
 
 	h := common.HexToHash(hashStr)
 
-	tx, isPending, err := s.eth.TransactionByHash(ctx, h)
-	if err != nil {
+	var (
+		net       *network
+		tx        *types.Transaction
+		isPending bool
+		err       error
+	)
+	for _, n := range candidates {
+		tx, isPending, err = n.Reader.TransactionByHash(ctx, h)
+		if err == nil {
+			net = n
+			break
+		}
+	}
+	if net == nil {
 		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 			ChatID: chatID,
 			Text:   fmt.Sprintf("Не нашёл транзакцию: %v", err),
@@ -252,109 +676,192 @@ func (s *Service) handleSearchTx(ctx context.Context, b *tgbot.Bot, chatID int64
 		return
 	}
 
-	signer := types.LatestSignerForChainID(s.chainID)
+	signer := types.LatestSignerForChainID(new(big.Int).SetUint64(net.ID))
 	from, _ := types.Sender(signer, tx)
 
 	to := tx.To()
 	toStr := "contract-creation"
+	addrs := []common.Address{from}
 	if to != nil {
 		toStr = to.Hex()
+		addrs = append(addrs, *to)
 	}
-
-	var gasPriceWei *string
-	if gp := tx.GasPrice(); gp != nil {
-		s := gp.String()
-		gasPriceWei = &s
-	}
+	names := s.ens.Names(ctx, addrs...)
 
 	var (
-		blockNum  *uint64
-		blockTime *time.Time
-		status    *uint8
+		receipt *types.Receipt
+		block   *types.Block
 	)
-
 	if !isPending {
-		receipt, rerr := s.eth.TransactionReceipt(ctx, h)
-		if rerr == nil && receipt != nil {
-			bn := receipt.BlockNumber.Uint64()
-			blockNum = &bn
-
-			st := uint8(receipt.Status) // 1/0
-			status = &st
-
-			block, berr := s.eth.BlockByNumber(ctx, receipt.BlockNumber)
-			if berr == nil && block != nil {
-				tm := time.Unix(int64(block.Time()), 0).UTC()
-				blockTime = &tm
+		if r, rerr := net.Reader.TransactionReceipt(ctx, h); rerr == nil && r != nil {
+			receipt = r
+			if bl, berr := net.Reader.BlockByNumber(ctx, r.BlockNumber); berr == nil && bl != nil {
+				block = bl
 			}
 		}
 	}
 
+	var baseFee *big.Int
+	if block != nil {
+		baseFee = block.BaseFee()
+	}
+	fees := ethwatch.TxFeesOf(tx, baseFee)
+
 	txRec := storage.TxRecord{
-		Hash:        tx.Hash().Hex(),
-		ChainID:     s.chainID.String(),
-		BlockNum:    blockNum,
-		BlockTime:   blockTime,
-		FromAddr:    from.Hex(),
-		ToAddr:      &toStr,
-		ValueWei:    tx.Value().String(),
-		Nonce:       tx.Nonce(),
-		TxType:      tx.Type(),
-		Gas:         tx.Gas(),
-		GasPriceWei: gasPriceWei,
-		Status:      status,
+		Hash:     tx.Hash().Hex(),
+		ChainID:  net.IDString(),
+		FromAddr: from.Hex(),
+		ToAddr:   &toStr,
+		ValueWei: tx.Value().String(),
+		Nonce:    tx.Nonce(),
+		TxType:   tx.Type(),
+		Gas:      tx.Gas(),
+	}
+	if sel, ok := contracts.SelectorHex(tx.Data()); ok {
+		txRec.MethodSelector = &sel
+	}
+	fees.FillRecord(&txRec, receipt)
+	if receipt != nil {
+		bn := receipt.BlockNumber.Uint64()
+		txRec.BlockNum = &bn
+		st := uint8(receipt.Status) // 1/0
+		txRec.Status = &st
+	}
+	var revert string
+	if receipt != nil && receipt.Status == types.ReceiptStatusFailed {
+		revert = ethwatch.RevertReason(ctx, net.Reader, s.selectors, tx, from, receipt.BlockNumber.Uint64())
+		if revert != "" {
+			txRec.RevertReason = &revert
+		}
+	}
+	if block != nil {
+		tm := time.Unix(int64(block.Time()), 0).UTC()
+		txRec.BlockTime = &tm
+	}
+	// USD — по цене на блоке транзакции (для pending — по последней)
+	var priceBlock *big.Int
+	if receipt != nil {
+		priceBlock = receipt.BlockNumber
+	}
+	valueUSD := s.nativeUSD(ctx, net, tx.Value(), priceBlock)
+	if valueUSD != nil {
+		v := prices.CentsString(valueUSD)
+		txRec.ValueUSD = &v
+	}
+
+	var deployed []string
+	if addr, ok := ethwatch.CreatedAddress(tx, from, receipt); ok && !isPending {
+		deployed = append(deployed, addr.Hex())
+		txRec.CreatedContracts = deployed
 	}
 
 	if err := s.repo.UpsertTx(ctx, txRec); err != nil {
 		log.Printf("[tg] db upsert search tx error: %v", err)
 	}
-	_ = s.repo.AddChatEvent(ctx, chatID, txRec.Hash, storage.EventSearch)
+	_, _ = s.repo.AddChatEvent(ctx, chatID, txRec.Hash, storage.EventSearch)
 
 	valueEth := ethwatch.WeiToEthString(tx.Value())
+	toLabel := toStr
+	if to != nil {
+		toLabel = ethwatch.FormatAddress(*to, names)
+	}
 
 	msg := fmt.Sprintf(
-		"✅ Транзакция найдена\n\nHash: %s\nFrom: %s\nTo: %s\nValue: %s ETH\nNonce: %d\nType: %d\nPending: %v\nGas: %d",
+		"✅ Транзакция найдена\n\nNetwork: %s\nHash: %s\nFrom: %s\nTo: %s\nValue: %s %s%s\nNonce: %d\nType: %s\nPending: %v\nGas: %d",
+		net.Name,
 		tx.Hash().Hex(),
-		from.Hex(),
-		toStr,
+		ethwatch.FormatAddress(from, names),
+		toLabel,
 		valueEth,
+		net.Symbol,
+		ethwatch.USDSuffix(valueUSD),
 		tx.Nonce(),
-		tx.Type(),
+		ethwatch.TxTypeName(tx.Type()),
 		isPending,
 		tx.Gas(),
 	)
+	if call, ok := s.selectors.Decode(tx.Data()); ok {
+		msg += "\nCall: " + call.String()
+	}
+	for _, addr := range deployed {
+		msg += "\nDeployed contract: " + addr
+	}
 
 	// Если уже в блоке — добавим статус/блок/время
-	if !isPending {
-		receipt, rerr := s.eth.TransactionReceipt(ctx, h)
-		if rerr == nil && receipt != nil {
-			status := "FAILED"
-			if receipt.Status == 1 {
-				status = "SUCCESS"
-			}
+	if receipt != nil {
+		status := "FAILED"
+		if receipt.Status == 1 {
+			status = "SUCCESS"
+		}
 
-			block, berr := s.eth.BlockByNumber(ctx, receipt.BlockNumber)
-			var tm string
-			if berr == nil && block != nil {
-				tm = time.Unix(int64(block.Time()), 0).UTC().Format(time.RFC3339)
-			}
+		var tm string
+		if block != nil {
+			tm = time.Unix(int64(block.Time()), 0).UTC().Format(time.RFC3339)
+		}
 
-			msg += fmt.Sprintf("\nStatus: %s\nBlock: #%s\nTime: %s\nGasUsed: %d",
-				status,
-				receipt.BlockNumber.String(),
-				tm,
-				receipt.GasUsed,
-			)
+		msg += fmt.Sprintf("\nStatus: %s\nBlock: #%s\nTime: %s\nGasUsed: %d",
+			status,
+			receipt.BlockNumber.String(),
+			tm,
+			receipt.GasUsed,
+		)
+		if revert != "" {
+			msg += "\nRevert reason: " + revert
 		}
 	}
+	msg += ethwatch.FormatFees(fees, receipt, net.Symbol)
 
-	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+	params := &tgbot.SendMessageParams{
 		ChatID: chatID,
 		Text:   msg,
-	})
+	}
+	if len(deployed) > 0 {
+		params.ReplyMarkup = watchContractKeyboard(net.IDString(), deployed)
+	}
+	_, _ = b.SendMessage(ctx, params)
+}
+
+// searchNetworks — где искать tx: указанная сеть или все, начиная с выбранной
+// в чате. false — сеть с таким именем не настроена.
+func (s *Service) searchNetworks(chatID int64, selector string) ([]*network, bool) {
+	if selector != "" {
+		n, ok := s.chainSet.Find(selector)
+		if !ok {
+			return nil, false
+		}
+		for _, net := range s.networks {
+			if net.ID == n.ID {
+				return []*network{net}, true
+			}
+		}
+		return nil, false
+	}
+
+	first := s.net(chatID)
+	out := []*network{first}
+	for _, n := range s.networks {
+		if n != first {
+			out = append(out, n)
+		}
+	}
+	return out, true
+}
+
+// networkKeys — ключи настроенных сетей для подсказок.
+func (s *Service) networkKeys() string {
+	keys := make([]string, len(s.networks))
+	for i, n := range s.networks {
+		keys[i] = n.Key
+	}
+	return strings.Join(keys, ", ")
 }
 
 func (s *Service) handleSetLarge(ctx context.Context, b *tgbot.Bot, chatID int64, amountStr string) {
+	if isUSDInput(amountStr) {
+		s.handleSetLargeUSD(ctx, b, chatID, amountStr)
+		return
+	}
+
 	amountStr = strings.ReplaceAll(amountStr, ",", ".")
 	f, ok := new(big.Rat).SetString(amountStr)
 	if !ok || f.Sign() <= 0 {
@@ -377,31 +884,524 @@ func (s *Service) handleSetLarge(ctx context.Context, b *tgbot.Bot, chatID int64
 		return
 	}
 
-	s.subStore.SetLargeTxMin(chatID, minWei)
+	if err := s.net(chatID).Subs.SetLargeTxMin(ctx, chatID, minWei); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
 	s.state.Set(chatID, StateIdle)
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   fmt.Sprintf("✅ Ок! Буду уведомлять о транзакциях с Value >= %s ETH.", amountStr),
+		Text:   fmt.Sprintf("✅ Ок! Буду уведомлять о транзакциях с Value >= %s %s.", amountStr, s.net(chatID).Symbol),
 	})
 }
 
-func (s *Service) handleSetWallet(ctx context.Context, b *tgbot.Bot, chatID int64, addrStr string) {
-	if !IsEthAddress(addrStr) {
+// handleSetLargeUSD — порог в долларах: сравнивается со стоимостью Value по
+// текущей цене агрегатора, так что при росте цены срабатывают и меньшие суммы.
+func (s *Service) handleSetLargeUSD(ctx context.Context, b *tgbot.Bot, chatID int64, amountStr string) {
+	net := s.net(chatID)
+	if !net.Prices.HasNative() {
 		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 			ChatID: chatID,
-			Text:   "Похоже, это не адрес. Ожидаю 0x + 40 hex символов.",
+			Text:   fmt.Sprintf("Для сети %s нет курса %s/USD — задай порог в %s.", net.Name, net.Symbol, net.Symbol),
 		})
 		return
 	}
+
+	cents, err := prices.ParseUSD(amountStr)
+	if err != nil {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Нужна сумма в долларах > 0 (например $100000 или 250000 usd). Попробуй ещё раз.",
+		})
+		return
+	}
+
+	if err := net.Subs.SetLargeTxMinUSD(ctx, chatID, cents); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+	s.state.Set(chatID, StateIdle)
+
+	text := fmt.Sprintf("✅ Ок! Буду уведомлять о транзакциях с Value >= %s (по текущему курсу %s).", prices.FormatUSD(cents), net.Symbol)
+	if p, err := net.Prices.Native(ctx, nil); err == nil {
+		text += fmt.Sprintf("\nСейчас это ~%s %s.", ethwatch.WeiToEthString(p.Amount(cents, 18)), net.Symbol)
+	}
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{ChatID: chatID, Text: text})
+}
+
+// nativeUSD — стоимость wei в центах USD на блоке (nil — последний блок); nil,
+// если курса нет.
+func (s *Service) nativeUSD(ctx context.Context, net *network, wei, block *big.Int) *big.Int {
+	if !net.Prices.HasNative() || wei.Sign() == 0 {
+		return nil
+	}
+	p, err := net.Prices.Native(ctx, block)
+	if err != nil {
+		log.Printf("[tg] %s price error: %v", net.Symbol, err)
+		return nil
+	}
+	return p.Cents(wei, 18)
+}
+
+func (s *Service) largePrompt(chatID int64) string {
+	net := s.net(chatID)
+	text := fmt.Sprintf("Введи сумму в %s (> 0), например: 1.5", net.Symbol)
+	if net.Prices.HasNative() {
+		text += ", или в долларах: $100000"
+	}
+	return text
+}
+
+// isUSDInput — сумма задана в долларах: "$1000" или "1000 usd".
+func isUSDInput(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "$") || strings.HasSuffix(s, "usd")
+}
+
+// handleSetWallet подписывает на кошелёк. ENS-имя разрешается один раз: следим
+// за адресом, на который оно указывает сейчас.
+func (s *Service) handleSetWallet(ctx context.Context, b *tgbot.Bot, chatID int64, input string) {
+	addr, name, ok := s.resolveInput(ctx, b, chatID, input)
+	if !ok {
+		return
+	}
+
+	if err := s.net(chatID).Subs.SetWallet(ctx, chatID, addr); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+	s.state.Set(chatID, StateIdle)
+
+	label := addr.Hex()
+	if name != "" {
+		label = name + " (" + addr.Hex() + ")"
+	}
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("✅ Ок! Буду уведомлять о транзакциях, где участвует %s.", label),
+	})
+}
+
+// resolveInput — адрес из ввода пользователя: 0x-адрес или ENS-имя (тогда
+// name — нормализованное имя). При ошибке сам отвечает в чат и возвращает false.
+func (s *Service) resolveInput(ctx context.Context, b *tgbot.Bot, chatID int64, input string) (addr common.Address, name string, ok bool) {
+	input = strings.TrimSpace(input)
+	if IsEthAddress(input) {
+		return common.HexToAddress(input), "", true
+	}
+
+	reply := func(text string) {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{ChatID: chatID, Text: text})
+	}
+	if !ens.IsName(input) {
+		reply("Похоже, это не адрес. Ожидаю 0x + 40 hex символов или ENS-имя (vitalik.eth).")
+		return common.Address{}, "", false
+	}
+	if s.ens == nil {
+		reply("ENS-имена недоступны: не настроена сеть Ethereum (mainnet, Sepolia или Holesky). Введи адрес 0x...")
+		return common.Address{}, "", false
+	}
+
+	name = ens.Normalize(input)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	addr, err := s.ens.Resolve(cctx, name)
+	if errors.Is(err, ens.ErrNotFound) {
+		reply(fmt.Sprintf("Имя %s не найдено или не указывает на адрес.", name))
+		return common.Address{}, "", false
+	}
+	if err != nil {
+		log.Printf("[tg] ens resolve %s error: %v", name, err)
+		reply(fmt.Sprintf("Не удалось разрешить имя %s, попробуй позже.", name))
+		return common.Address{}, "", false
+	}
+	return addr, name, true
+}
+
+// handleSearchAddress — поиск по адресу или ENS-имени: адрес, основное имя
+// и кнопка подписки на кошелёк.
+func (s *Service) handleSearchAddress(ctx context.Context, b *tgbot.Bot, chatID int64, input string) {
+	addr, name, ok := s.resolveInput(ctx, b, chatID, input)
+	if !ok {
+		return
+	}
+	if name == "" && s.ens != nil {
+		name = s.ens.Name(ctx, addr)
+	}
+
+	msg := "🔎 Адрес\n\nAddress: " + addr.Hex()
+	if name != "" {
+		msg += "\nENS: " + name
+	}
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   msg,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{{
+			Text:         "👛 Следить за кошельком",
+			CallbackData: cbWatchWalletPrefix + addr.Hex(),
+		}}}},
+	})
+}
+
+// onCbWatchWallet — подписка на кошелёк из результата поиска (в выбранной сети).
+func (s *Service) onCbWatchWallet(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	addrStr := strings.TrimPrefix(cb.Data, cbWatchWalletPrefix)
+	if !IsEthAddress(addrStr) {
+		return
+	}
+	s.handleSetWallet(ctx, b, cb.Message.Message.Chat.ID, addrStr)
+}
+
+func (s *Service) handleTokenAddress(ctx context.Context, b *tgbot.Bot, chatID int64, addrStr string) {
+	if !IsEthAddress(addrStr) {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Похоже, это не адрес. Ожидаю 0x + 40 hex символов.",
+		})
+		return
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	info, err := s.net(chatID).tokens.Lookup(cctx, common.HexToAddress(addrStr))
+	if err != nil {
+		log.Printf("[tg] token lookup error: chat=%d token=%s err=%v", chatID, addrStr, err)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Не удалось прочитать decimals() у контракта — похоже, это не ERC-20 токен. Попробуй другой адрес.",
+		})
+		return
+	}
+
+	s.state.SetPendingToken(chatID, info)
+	s.state.Set(chatID, StateAwaitTokenAmount)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("Токен: %s, decimals: %d.\nВведи порог в целых токенах (> 0), например: 1000000", info.Label(), info.Decimals),
+	})
+}
+
+func (s *Service) handleSetTokenMin(ctx context.Context, b *tgbot.Bot, chatID int64, amountStr string) {
+	info, ok := s.state.PendingToken(chatID)
+	if !ok {
+		s.state.Set(chatID, StateIdle)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Используй /start, чтобы открыть меню.",
+		})
+		return
+	}
+
+	minAmount, err := tokens.ParseUnits(amountStr, info.Decimals)
+	if err != nil {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Нужно число > 0 (например 1000 или 0.5). Попробуй ещё раз.",
+		})
+		return
+	}
+
+	sub := subs.TokenSub{MinAmount: minAmount, Decimals: info.Decimals, Symbol: info.Symbol}
+	if err := s.net(chatID).Subs.SetTokenMin(ctx, chatID, info.Address, sub); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+	s.state.Set(chatID, StateIdle)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text: fmt.Sprintf("✅ Ок! Буду уведомлять о переводах %s >= %s.",
+			info.Label(), tokens.FormatUnits(minAmount, info.Decimals)),
+	})
+}
+
+func (s *Service) handleSetConfirmations(ctx context.Context, b *tgbot.Bot, chatID int64, text string) {
+	level, err := subs.ParseLevel(text)
+	if err != nil || level.Kind == subs.LevelSafe || level.Kind == subs.LevelFinalized {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Нужно целое число подтверждений > 0 (например 6). Попробуй ещё раз.",
+		})
+		return
+	}
+	s.setLevel(ctx, b, chatID, level)
+}
+
+func (s *Service) setLevel(ctx context.Context, b *tgbot.Bot, chatID int64, level subs.Level) {
+	if err := s.net(chatID).Subs.SetLevel(ctx, chatID, level); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+	s.state.Set(chatID, StateIdle)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("✅ Ок! Уровень уведомлений: %s.", levelLabel(level)),
+	})
+	s.sendMySubs(ctx, b, chatID)
+}
+
+func (s *Service) handleContractAddress(ctx context.Context, b *tgbot.Bot, chatID int64, addrStr string) {
+	if !IsEthAddress(addrStr) {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Похоже, это не адрес. Ожидаю 0x + 40 hex символов.",
+		})
+		return
+	}
+
+	s.state.SetPendingContract(chatID, pendingContract{Address: common.HexToAddress(addrStr)})
+	s.state.Set(chatID, StateAwaitContractABI)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Пришли ABI контракта JSON-файлом (или вставь JSON сообщением). Подойдёт и артефакт Hardhat/Foundry с полем \"abi\".",
+	})
+}
+
+// handleDocument — файл от пользователя; нужен только как ABI контракта.
+func (s *Service) handleDocument(ctx context.Context, b *tgbot.Bot, chatID int64, doc *models.Document) {
+	if s.state.Get(chatID) != StateAwaitContractABI {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Используй /start, чтобы открыть меню.",
+		})
+		return
+	}
+	if doc.FileSize > contracts.MaxABISize {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Файл слишком большой (максимум %d КБ).", contracts.MaxABISize>>10),
+		})
+		return
+	}
+
+	raw, err := s.downloadFile(ctx, b, doc.FileID)
+	if err != nil {
+		log.Printf("[tg] abi download error: chat=%d err=%v", chatID, err)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Не удалось скачать файл, попробуй ещё раз.",
+		})
+		return
+	}
+	s.handleContractABI(ctx, b, chatID, raw)
+}
+
+func (s *Service) downloadFile(ctx context.Context, b *tgbot.Bot, fileID string) ([]byte, error) {
+	cctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	f, err := b.GetFile(cctx, &tgbot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("getFile: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(cctx, http.MethodGet, b.FileDownloadLink(f), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download: status %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, contracts.MaxABISize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > contracts.MaxABISize {
+		return nil, fmt.Errorf("file is larger than %d bytes", contracts.MaxABISize)
+	}
+	return raw, nil
+}
+
+func (s *Service) handleContractABI(ctx context.Context, b *tgbot.Bot, chatID int64, raw []byte) {
+	pc, ok := s.state.PendingContract(chatID)
+	if !ok {
+		s.state.Set(chatID, StateIdle)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Используй /start, чтобы открыть меню.",
+		})
+		return
+	}
+
+	parsed, err := contracts.ParseABI(raw)
+	if err != nil {
+		text := "Не получилось разобрать ABI: ожидаю JSON-массив ABI или артефакт с полем \"abi\". Попробуй ещё раз."
+		if errors.Is(err, contracts.ErrNoEvents) {
+			text = "В этом ABI нет событий — отслеживать нечего. Пришли другой ABI."
+		}
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{ChatID: chatID, Text: text})
+		return
+	}
+
+	pc.ABI = parsed
+	pc.RawABI = string(raw)
+	s.state.SetPendingContract(chatID, pc)
+	s.state.Set(chatID, StateAwaitContractEvents)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text: fmt.Sprintf("События в ABI: %s.\nВведи через запятую, какие отслеживать, или нажми «Все события».",
+			strings.Join(contracts.EventNames(parsed), ", ")),
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: "Все события", CallbackData: cbContractAllEvents}},
+			},
+		},
+	})
+}
+
+func (s *Service) onCbContractAllEvents(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	if s.state.Get(chatID) != StateAwaitContractEvents {
+		return
+	}
+	s.handleContractEvents(ctx, b, chatID, nil)
+}
+
+// handleContractEvents сохраняет подписку; пустой names — все события ABI.
+func (s *Service) handleContractEvents(ctx context.Context, b *tgbot.Bot, chatID int64, names []string) {
+	pc, ok := s.state.PendingContract(chatID)
+	if !ok || pc.ABI == nil {
+		s.state.Set(chatID, StateIdle)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Используй /start, чтобы открыть меню.",
+		})
+		return
+	}
+
+	events, err := contracts.ResolveEvents(pc.ABI, names)
+	if err != nil {
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Не нашёл событие в ABI (%v). Доступны: %s.", err, strings.Join(contracts.EventNames(pc.ABI), ", ")),
+		})
+		return
+	}
+
+	sub := subs.ContractSub{ABI: pc.ABI, RawABI: pc.RawABI, Events: events}
+	if err := s.net(chatID).Subs.SetContract(ctx, chatID, pc.Address, sub); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+	s.selectors.AddABI(pc.ABI)
+	s.state.Set(chatID, StateIdle)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("✅ Ок! Буду уведомлять о событиях контракта %s: %s.", pc.Address.Hex(), contractEventsLabel(sub)),
+	})
+}
+
+// contractEventsLabel — список отслеживаемых событий для сообщений.
+func contractEventsLabel(c subs.ContractSub) string {
+	switch {
+	case c.ABI == nil:
+		return "все логи (без ABI)"
+	case len(c.Events) == 0:
+		return "все события"
+	}
+	return strings.Join(c.Events, ", ")
+}
+
+// watchContractKeyboard — кнопки «следить» под уведомлением о деплое.
+func watchContractKeyboard(chainID string, addrs []string) *models.InlineKeyboardMarkup {
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(addrs))
+	for _, addr := range addrs {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         "👁 Следить за " + shortenHash(addr),
+			CallbackData: cbWatchContractPrefix + chainID + ":" + addr,
+		}})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// onCbWatchContract подписывает чат на все логи нового контракта (без ABI) и
+// сразу предлагает прислать ABI, чтобы события расшифровывались.
+func (s *Service) onCbWatchContract(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	chainID, addrStr, ok := strings.Cut(strings.TrimPrefix(cb.Data, cbWatchContractPrefix), ":")
+	if !ok || !IsEthAddress(addrStr) {
+		return
+	}
+	var net *network
+	for _, n := range s.networks {
+		if n.IDString() == chainID {
+			net = n
+		}
+	}
+	if net == nil {
+		return
+	}
 	addr := common.HexToAddress(addrStr)
 
-	s.subStore.SetWallet(chatID, addr)
+	// дальнейший диалог (ABI) идёт в сети контракта
 	s.state.Set(chatID, StateIdle)
+	s.setNetwork(ctx, chatID, net.Network.Network)
+
+	if u, ok := net.Subs.GetCopy(chatID); ok {
+		if c, exists := u.Contracts[addr]; exists {
+			_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+				ChatID: chatID,
+				Text:   fmt.Sprintf("Уже слежу за контрактом %s: %s.", addr.Hex(), contractEventsLabel(c)),
+			})
+			return
+		}
+	}
+	if err := net.Subs.SetContract(ctx, chatID, addr, subs.ContractSub{}); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+
+	s.state.SetPendingContract(chatID, pendingContract{Address: addr})
+	s.state.Set(chatID, StateAwaitContractABI)
+
+	where := ""
+	if s.multiChain() {
+		where = " в сети " + net.Name
+	}
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text: fmt.Sprintf("✅ Слежу за контрактом %s%s: пришлю все его логи без расшифровки.\n"+
+			"Чтобы расшифровывать события, пришли ABI контракта JSON-файлом или сообщением (или /start, чтобы пропустить).",
+			addr.Hex(), where),
+	})
+}
 
+func (s *Service) sendSaveSubsError(ctx context.Context, b *tgbot.Bot, chatID int64, err error) {
+	log.Printf("[tg] save subs error: chat=%d err=%v", chatID, err)
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   fmt.Sprintf("✅ Ок! Буду уведомлять о транзакциях, где участвует %s.", addr.Hex()),
+		Text:   "Не удалось сохранить подписку, попробуй ещё раз позже.",
 	})
 }
 
@@ -433,7 +1433,10 @@ func (s *Service) onCbUnsubLarge(ctx context.Context, b *tgbot.Bot, upd *models.
 	_ = s.answerCallback(ctx, b, cb.ID)
 
 	chatID := cb.Message.Message.Chat.ID
-	s.subStore.ClearLargeTx(chatID)
+	if err := s.net(chatID).Subs.ClearLargeTx(ctx, chatID); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
@@ -450,7 +1453,10 @@ func (s *Service) onCbUnsubWallet(ctx context.Context, b *tgbot.Bot, upd *models
 	_ = s.answerCallback(ctx, b, cb.ID)
 
 	chatID := cb.Message.Message.Chat.ID
-	s.subStore.ClearWallet(chatID)
+	if err := s.net(chatID).Subs.ClearWallet(ctx, chatID); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
@@ -467,7 +1473,10 @@ func (s *Service) onCbUnsubAll(ctx context.Context, b *tgbot.Bot, upd *models.Up
 	_ = s.answerCallback(ctx, b, cb.ID)
 
 	chatID := cb.Message.Message.Chat.ID
-	s.subStore.ClearAll(chatID)
+	if err := s.net(chatID).Subs.ClearAll(ctx, chatID); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
@@ -476,7 +1485,75 @@ func (s *Service) onCbUnsubAll(ctx context.Context, b *tgbot.Bot, upd *models.Up
 	s.sendMySubs(ctx, b, chatID)
 }
 
-func (s *Service) onCbBackToMain(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+func (s *Service) onCbUnsubGas(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	if err := s.net(chatID).Subs.ClearGasAlert(ctx, chatID); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "✅ Газовый алерт удалён.",
+	})
+	s.sendMySubs(ctx, b, chatID)
+}
+
+func (s *Service) onCbUnsubToken(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	addrStr := strings.TrimPrefix(cb.Data, cbUnsubTokenPrefix)
+	if !IsEthAddress(addrStr) {
+		return
+	}
+	if err := s.net(chatID).Subs.ClearToken(ctx, chatID, common.HexToAddress(addrStr)); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "✅ Подписка на токен удалена.",
+	})
+	s.sendMySubs(ctx, b, chatID)
+}
+
+func (s *Service) onCbUnsubContract(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	addrStr := strings.TrimPrefix(cb.Data, cbUnsubContractPrefix)
+	if !IsEthAddress(addrStr) {
+		return
+	}
+	if err := s.net(chatID).Subs.ClearContract(ctx, chatID, common.HexToAddress(addrStr)); err != nil {
+		s.sendSaveSubsError(ctx, b, chatID, err)
+		return
+	}
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "✅ Подписка на события контракта удалена.",
+	})
+	s.sendMySubs(ctx, b, chatID)
+}
+
+func (s *Service) onCbNotifyLevel(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
 	cb := upd.CallbackQuery
 	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
 		return
@@ -488,33 +1565,96 @@ func (s *Service) onCbBackToMain(ctx context.Context, b *tgbot.Bot, upd *models.
 
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
-		Text:   "Главное меню:",
+		Text: fmt.Sprintf("Когда присылать уведомления? Сейчас: %s.\n"+
+			"Чем глубже блок, тем меньше шанс, что tx пропадёт из-за реорга, но тем позже придёт уведомление.",
+			levelLabel(s.net(chatID).Subs.Level(chatID))),
 		ReplyMarkup: &models.InlineKeyboardMarkup{
 			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{
-					{Text: "Search", CallbackData: cbSearch},
-					{Text: "Subscribe", CallbackData: cbSubscribe},
-				},
-				{
-					{Text: "My subscriptions", CallbackData: cbMySubs},
-					{Text: "History", CallbackData: cbHistory},
-				},
+				{{Text: "Сразу (latest)", CallbackData: cbLevelPrefix + string(subs.LevelLatest)}},
+				{{Text: "12 подтверждений", CallbackData: cbLevelPrefix + "12"}},
+				{{Text: "Safe", CallbackData: cbLevelPrefix + string(subs.LevelSafe)}},
+				{{Text: "Finalized", CallbackData: cbLevelPrefix + string(subs.LevelFinalized)}},
+				{{Text: "Своё число подтверждений", CallbackData: cbLevelPrefix + levelCustom}},
+				{{Text: "Назад", CallbackData: cbMySubs}},
 			},
 		},
 	})
 }
 
+func (s *Service) onCbLevel(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	value := strings.TrimPrefix(cb.Data, cbLevelPrefix)
+	if value == levelCustom {
+		s.state.Set(chatID, StateAwaitConfirmations)
+		_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Введи число подтверждений (> 0), например: 6",
+		})
+		return
+	}
+
+	level, err := subs.ParseLevel(value)
+	if err != nil {
+		return
+	}
+	s.setLevel(ctx, b, chatID, level)
+}
+
+// levelLabel — уровень уведомлений для меню.
+func levelLabel(l subs.Level) string {
+	switch {
+	case l.IsLatest():
+		return "сразу (latest)"
+	case l.Kind == subs.LevelConfirmations:
+		return fmt.Sprintf("после %d подтверждений", l.Confirmations)
+	case l.Kind == subs.LevelSafe:
+		return "когда блок станет safe"
+	default:
+		return "когда блок станет finalized"
+	}
+}
+
+func (s *Service) onCbBackToMain(ctx context.Context, b *tgbot.Bot, upd *models.Update) {
+	cb := upd.CallbackQuery
+	if cb == nil || cb.Message.Type == models.MaybeInaccessibleMessageTypeInaccessibleMessage {
+		return
+	}
+	_ = s.answerCallback(ctx, b, cb.ID)
+
+	chatID := cb.Message.Message.Chat.ID
+	s.state.Set(chatID, StateIdle)
+
+	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Главное меню:",
+		ReplyMarkup: s.mainMenu(chatID),
+	})
+}
+
 func (s *Service) sendMySubs(ctx context.Context, b *tgbot.Bot, chatID int64) {
-	u, ok := s.subStore.GetCopy(chatID)
+	net := s.net(chatID)
+	u, ok := net.Subs.GetCopy(chatID)
 
 	var lines []string
-	lines = append(lines, "📌 Твои подписки:")
+	if s.multiChain() {
+		lines = append(lines, fmt.Sprintf("📌 Твои подписки (%s):", net.Name))
+	} else {
+		lines = append(lines, "📌 Твои подписки:")
+	}
 
-	if !ok || (u.LargeTxMinWei == nil && u.Wallet == nil) {
+	if !ok {
 		lines = append(lines, "— нет активных подписок")
 	} else {
 		if u.LargeTxMinWei != nil {
-			lines = append(lines, fmt.Sprintf("— Крупные объемы: Value >= %s ETH", ethwatch.WeiToEthString(u.LargeTxMinWei)))
+			lines = append(lines, fmt.Sprintf("— Крупные объемы: Value >= %s %s", ethwatch.WeiToEthString(u.LargeTxMinWei), net.Symbol))
+		} else if u.LargeTxMinUSD != nil {
+			lines = append(lines, fmt.Sprintf("— Крупные объемы: Value >= %s (в %s по текущему курсу)", prices.FormatUSD(u.LargeTxMinUSD), net.Symbol))
 		} else {
 			lines = append(lines, "— Крупные объемы: (нет)")
 		}
@@ -526,17 +1666,62 @@ func (s *Service) sendMySubs(ctx context.Context, b *tgbot.Bot, chatID int64) {
 	}
 
 	// кнопки удаления показываем всегда (удобнее)
+	keyboard := [][]models.InlineKeyboardButton{
+		{{Text: "Удалить: крупные объемы", CallbackData: cbUnsubLarge}},
+		{{Text: "Удалить: кошелёк", CallbackData: cbUnsubWallet}},
+	}
+
+	tokenAddrs := make([]common.Address, 0, len(u.Tokens))
+	for addr := range u.Tokens {
+		tokenAddrs = append(tokenAddrs, addr)
+	}
+	sort.Slice(tokenAddrs, func(i, j int) bool { return tokenAddrs[i].Cmp(tokenAddrs[j]) < 0 })
+	for _, addr := range tokenAddrs {
+		ts := u.Tokens[addr]
+		info := tokens.Info{Address: addr, Symbol: ts.Symbol, Decimals: ts.Decimals}
+		lines = append(lines, fmt.Sprintf("— Токен %s: перевод >= %s", info.Label(), tokens.FormatUnits(ts.MinAmount, ts.Decimals)))
+
+		name := ts.Symbol
+		if name == "" {
+			name = shortenHash(addr.Hex())
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: "Удалить: токен " + name, CallbackData: cbUnsubTokenPrefix + addr.Hex()},
+		})
+	}
+
+	contractAddrs := make([]common.Address, 0, len(u.Contracts))
+	for addr := range u.Contracts {
+		contractAddrs = append(contractAddrs, addr)
+	}
+	sort.Slice(contractAddrs, func(i, j int) bool { return contractAddrs[i].Cmp(contractAddrs[j]) < 0 })
+	for _, addr := range contractAddrs {
+		lines = append(lines, fmt.Sprintf("— Контракт %s: %s", addr.Hex(), contractEventsLabel(u.Contracts[addr])))
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: "Удалить: контракт " + shortenHash(addr.Hex()), CallbackData: cbUnsubContractPrefix + addr.Hex()},
+		})
+	}
+
+	if u.Gas != nil {
+		lines = append(lines, fmt.Sprintf("— Газ: %s%s", gasAlertLabel(*u.Gas), gasNow(net, u.Gas.Metric)))
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Удалить: газ", CallbackData: cbUnsubGas}})
+	}
+
+	lines = append(lines, fmt.Sprintf("— Уведомлять: %s", levelLabel(u.Level)))
+
+	if s.multiChain() {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Другая сеть", CallbackData: cbNetwork}})
+	}
+	keyboard = append(keyboard,
+		[]models.InlineKeyboardButton{{Text: "Уровень уведомлений", CallbackData: cbNotifyLevel}},
+		[]models.InlineKeyboardButton{{Text: "Удалить всё", CallbackData: cbUnsubAll}},
+		[]models.InlineKeyboardButton{{Text: "Назад", CallbackData: cbBackToMain}},
+	)
+
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
-		ChatID: chatID,
-		Text:   strings.Join(lines, "\n"),
-		ReplyMarkup: &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{{Text: "Удалить: крупные объемы", CallbackData: cbUnsubLarge}},
-				{{Text: "Удалить: кошелёк", CallbackData: cbUnsubWallet}},
-				{{Text: "Удалить всё", CallbackData: cbUnsubAll}},
-				{{Text: "Назад", CallbackData: cbBackToMain}},
-			},
-		},
+		ChatID:      chatID,
+		Text:        strings.Join(lines, "\n"),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
 	})
 }
 
@@ -571,7 +1756,7 @@ func (s *Service) onCbHistory(ctx context.Context, b *tgbot.Bot, upd *models.Upd
 		return
 	}
 
-	text := FormatHistory(items)
+	text := FormatHistory(items, s.chainSet)
 	_, _ = b.SendMessage(ctx, &tgbot.SendMessageParams{
 		ChatID: chatID,
 		Text:   text,
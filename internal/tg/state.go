@@ -1,6 +1,14 @@
 package tg
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/pvzzle/scanblock/internal/subs"
+	"github.com/pvzzle/scanblock/internal/tokens"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
 
 type ChatState int
 
@@ -9,21 +17,58 @@ const (
 	StateAwaitTxHash
 	StateAwaitLargeAmountEth
 	StateAwaitWalletAddress
+	StateAwaitTokenAddress
+	StateAwaitTokenAmount
+	StateAwaitConfirmations
+	StateAwaitContractAddress
+	StateAwaitContractABI
+	StateAwaitContractEvents
+	StateAwaitGasThreshold
 )
 
+// pendingContract — контракт, для которого идёт диалог подписки на события.
+type pendingContract struct {
+	Address common.Address
+	ABI     *abi.ABI // nil, пока ABI не прислан
+	RawABI  string
+}
+
 type StateStore struct {
 	mu    sync.Mutex
 	state map[int64]ChatState
+
+	// token — токен, для которого ждём порог (между двумя шагами диалога)
+	token map[int64]tokens.Info
+
+	// contract — контракт, для которого ждём ABI и список событий
+	contract map[int64]pendingContract
+
+	// gas — метрика, для которой ждём порог газового алерта
+	gas map[int64]subs.GasMetric
+
+	// network — ключ выбранной сети чата (не сбрасывается вместе с диалогом)
+	network map[int64]string
 }
 
 func NewStateStore() *StateStore {
-	return &StateStore{state: make(map[int64]ChatState)}
+	return &StateStore{
+		state:    make(map[int64]ChatState),
+		token:    make(map[int64]tokens.Info),
+		contract: make(map[int64]pendingContract),
+		gas:      make(map[int64]subs.GasMetric),
+		network:  make(map[int64]string),
+	}
 }
 
 func (s *StateStore) Set(chatID int64, st ChatState) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.state[chatID] = st
+	if st == StateIdle {
+		delete(s.token, chatID)
+		delete(s.contract, chatID)
+		delete(s.gas, chatID)
+	}
 }
 
 func (s *StateStore) Get(chatID int64) ChatState {
@@ -31,3 +76,55 @@ func (s *StateStore) Get(chatID int64) ChatState {
 	defer s.mu.Unlock()
 	return s.state[chatID]
 }
+
+func (s *StateStore) SetPendingToken(chatID int64, info tokens.Info) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token[chatID] = info
+}
+
+func (s *StateStore) PendingToken(chatID int64) (tokens.Info, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.token[chatID]
+	return info, ok
+}
+
+func (s *StateStore) SetPendingContract(chatID int64, c pendingContract) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contract[chatID] = c
+}
+
+func (s *StateStore) PendingContract(chatID int64) (pendingContract, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contract[chatID]
+	return c, ok
+}
+
+func (s *StateStore) SetPendingGasMetric(chatID int64, m subs.GasMetric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gas[chatID] = m
+}
+
+func (s *StateStore) PendingGasMetric(chatID int64) (subs.GasMetric, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.gas[chatID]
+	return m, ok
+}
+
+func (s *StateStore) SetNetwork(chatID int64, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.network[chatID] = key
+}
+
+// Network — ключ выбранной сети; пусто, если чат её не выбирал.
+func (s *StateStore) Network(chatID int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.network[chatID]
+}
@@ -0,0 +1,259 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// TransferTopic — topic0 события Transfer(address,address,uint256) (ERC-20 и ERC-721)
+	TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	// ERC-1155
+	TransferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	TransferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+
+	selectorDecimals = crypto.Keccak256([]byte("decimals()"))[:4]
+	selectorSymbol   = crypto.Keccak256([]byte("symbol()"))[:4]
+
+	ErrNotToken      = errors.New("address does not look like an ERC-20 token")
+	ErrInvalidAmount = errors.New("invalid token amount")
+)
+
+type Info struct {
+	Address  common.Address
+	Symbol   string
+	Decimals uint8
+}
+
+type Standard string
+
+const (
+	ERC20   Standard = "erc20"
+	ERC721  Standard = "erc721"
+	ERC1155 Standard = "erc1155"
+)
+
+// Transfer — декодированный лог перевода токена.
+type Transfer struct {
+	Standard Standard
+	TxHash   common.Hash
+	LogIndex uint
+	Token    common.Address
+	From     common.Address
+	To       common.Address
+
+	// Amount — сумма ERC-20 перевода (nil для NFT)
+	Amount *big.Int
+
+	// TokenIDs/Amounts — NFT: у ERC-721 один id с количеством 1,
+	// у ERC-1155 TransferBatch может быть несколько
+	TokenIDs []*big.Int
+	Amounts  []*big.Int
+}
+
+// TransferTopics — topic0 всех логов, которые понимает DecodeTransfer.
+func TransferTopics() []common.Hash {
+	return []common.Hash{TransferTopic, TransferSingleTopic, TransferBatchTopic}
+}
+
+// DecodeTransfer разбирает ERC-20/ERC-721 Transfer и ERC-1155 TransferSingle/TransferBatch.
+func DecodeTransfer(l *types.Log) (Transfer, bool) {
+	if l == nil || len(l.Topics) == 0 {
+		return Transfer{}, false
+	}
+	switch l.Topics[0] {
+	case TransferTopic:
+		if t, ok := DecodeERC20Transfer(l); ok {
+			return t, true
+		}
+		return decodeERC721Transfer(l)
+	case TransferSingleTopic:
+		return decodeTransferSingle(l)
+	case TransferBatchTopic:
+		return decodeTransferBatch(l)
+	}
+	return Transfer{}, false
+}
+
+// DecodeERC20Transfer разбирает лог Transfer с тремя topics и uint256 в data.
+// ERC-721 Transfer (tokenId в четвёртом topic) сюда не подходит.
+func DecodeERC20Transfer(l *types.Log) (Transfer, bool) {
+	if l == nil || len(l.Topics) != 3 || l.Topics[0] != TransferTopic || len(l.Data) != 32 {
+		return Transfer{}, false
+	}
+	t := baseTransfer(l, ERC20, l.Topics[1], l.Topics[2])
+	t.Amount = new(big.Int).SetBytes(l.Data)
+	return t, true
+}
+
+func decodeERC721Transfer(l *types.Log) (Transfer, bool) {
+	if len(l.Topics) != 4 || len(l.Data) != 0 {
+		return Transfer{}, false
+	}
+	t := baseTransfer(l, ERC721, l.Topics[1], l.Topics[2])
+	t.TokenIDs = []*big.Int{l.Topics[3].Big()}
+	t.Amounts = []*big.Int{big.NewInt(1)}
+	return t, true
+}
+
+// TransferSingle(operator, from, to, id, value): operator/from/to в topics
+func decodeTransferSingle(l *types.Log) (Transfer, bool) {
+	if len(l.Topics) != 4 || len(l.Data) != 64 {
+		return Transfer{}, false
+	}
+	t := baseTransfer(l, ERC1155, l.Topics[2], l.Topics[3])
+	t.TokenIDs = []*big.Int{new(big.Int).SetBytes(l.Data[:32])}
+	t.Amounts = []*big.Int{new(big.Int).SetBytes(l.Data[32:])}
+	return t, true
+}
+
+var batchArgs = func() abi.Arguments {
+	u256s, _ := abi.NewType("uint256[]", "", nil)
+	return abi.Arguments{{Type: u256s}, {Type: u256s}}
+}()
+
+func decodeTransferBatch(l *types.Log) (Transfer, bool) {
+	if len(l.Topics) != 4 {
+		return Transfer{}, false
+	}
+	vals, err := batchArgs.Unpack(l.Data)
+	if err != nil || len(vals) != 2 {
+		return Transfer{}, false
+	}
+	ids, ok1 := vals[0].([]*big.Int)
+	amounts, ok2 := vals[1].([]*big.Int)
+	if !ok1 || !ok2 || len(ids) != len(amounts) || len(ids) == 0 {
+		return Transfer{}, false
+	}
+	t := baseTransfer(l, ERC1155, l.Topics[2], l.Topics[3])
+	t.TokenIDs = ids
+	t.Amounts = amounts
+	return t, true
+}
+
+func baseTransfer(l *types.Log, std Standard, from, to common.Hash) Transfer {
+	return Transfer{
+		Standard: std,
+		TxHash:   l.TxHash,
+		LogIndex: l.Index,
+		Token:    l.Address,
+		From:     common.BytesToAddress(from.Bytes()),
+		To:       common.BytesToAddress(to.Bytes()),
+	}
+}
+
+// Registry кэширует decimals()/symbol() токенов — они не меняются.
+type Registry struct {
+	caller ethereum.ContractCaller
+
+	mu    sync.RWMutex
+	cache map[common.Address]Info
+}
+
+func NewRegistry(c ethereum.ContractCaller) *Registry {
+	return &Registry{caller: c, cache: make(map[common.Address]Info)}
+}
+
+func (r *Registry) Lookup(ctx context.Context, addr common.Address) (Info, error) {
+	r.mu.RLock()
+	info, ok := r.cache[addr]
+	r.mu.RUnlock()
+	if ok {
+		return info, nil
+	}
+
+	out, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: selectorDecimals}, nil)
+	if err != nil {
+		return Info{}, fmt.Errorf("decimals(): %w", err)
+	}
+	if len(out) != 32 || new(big.Int).SetBytes(out).Cmp(big.NewInt(255)) > 0 {
+		return Info{}, ErrNotToken
+	}
+	info = Info{Address: addr, Decimals: out[31]}
+
+	// symbol() необязателен по стандарту
+	if out, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: selectorSymbol}, nil); err == nil {
+		info.Symbol = decodeSymbol(out)
+	}
+
+	r.mu.Lock()
+	r.cache[addr] = info
+	r.mu.Unlock()
+	return info, nil
+}
+
+// decodeSymbol понимает ABI string и старый вариант с bytes32 (MKR и т.п.).
+func decodeSymbol(out []byte) string {
+	if len(out) == 32 {
+		return strings.TrimRight(string(out), "\x00")
+	}
+	if len(out) < 64 {
+		return ""
+	}
+	off := new(big.Int).SetBytes(out[:32])
+	if !off.IsUint64() || off.Uint64()+32 > uint64(len(out)) {
+		return ""
+	}
+	start := off.Uint64()
+	n := new(big.Int).SetBytes(out[start : start+32])
+	if !n.IsUint64() || start+32+n.Uint64() > uint64(len(out)) {
+		return ""
+	}
+	return string(out[start+32 : start+32+n.Uint64()])
+}
+
+// ParseUnits переводит "1000000" / "0,5" в минимальные единицы токена (floor), требует > 0.
+func ParseUnits(amount string, decimals uint8) (*big.Int, error) {
+	amount = strings.TrimSpace(amount)
+	amount = strings.ReplaceAll(amount, ",", ".")
+
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok || r.Sign() <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	r.Mul(r, new(big.Rat).SetInt(pow10(decimals)))
+
+	out := new(big.Int).Div(r.Num(), r.Denom())
+	if out.Sign() <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	return out, nil
+}
+
+// FormatUnits — сумма в целых токенах, не больше 6 знаков после точки, без хвостовых нулей.
+func FormatUnits(raw *big.Int, decimals uint8) string {
+	if raw == nil {
+		return "0"
+	}
+	prec := int(decimals)
+	if prec > 6 {
+		prec = 6
+	}
+	s := new(big.Rat).SetFrac(raw, pow10(decimals)).FloatString(prec)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Label — "USDT (0xdAC1…)" или просто адрес, если symbol неизвестен.
+func (i Info) Label() string {
+	if i.Symbol == "" {
+		return i.Address.Hex()
+	}
+	return fmt.Sprintf("%s (%s)", i.Symbol, i.Address.Hex())
+}
+
+func pow10(n uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,126 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type fakeCaller struct {
+	token common.Address
+	out   map[string][]byte
+	calls int
+}
+
+func (f *fakeCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	out, ok := f.out[common.Bytes2Hex(msg.Data)]
+	if !ok || msg.To == nil || *msg.To != f.token {
+		return nil, errors.New("execution reverted")
+	}
+	return out, nil
+}
+
+func TestParseAndFormatUnits(t *testing.T) {
+	raw, err := ParseUnits("1000000", 6)
+	if err != nil || raw.String() != "1000000000000" {
+		t.Fatalf("unexpected parse: %v %v", raw, err)
+	}
+	raw, err = ParseUnits("0,5", 18)
+	if err != nil || raw.String() != "500000000000000000" {
+		t.Fatalf("unexpected parse: %v %v", raw, err)
+	}
+	for _, bad := range []string{"", "abc", "0", "-1", "0.0000001"} {
+		if _, err := ParseUnits(bad, 6); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	if got := FormatUnits(big.NewInt(1_500_000), 6); got != "1.5" {
+		t.Fatalf("expected 1.5, got %s", got)
+	}
+	if got := FormatUnits(big.NewInt(42), 0); got != "42" {
+		t.Fatalf("expected 42, got %s", got)
+	}
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	ctx := context.Background()
+	addr := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	// symbol() как ABI string
+	symbol := append(common.LeftPadBytes([]byte{0x20}, 32), common.LeftPadBytes([]byte{4}, 32)...)
+	symbol = append(symbol, common.RightPadBytes([]byte("USDT"), 32)...)
+
+	c := &fakeCaller{token: addr, out: map[string][]byte{
+		common.Bytes2Hex(selectorDecimals): common.LeftPadBytes([]byte{6}, 32),
+		common.Bytes2Hex(selectorSymbol):   symbol,
+	}}
+	r := NewRegistry(c)
+
+	info, err := r.Lookup(ctx, addr)
+	if err != nil || info.Decimals != 6 || info.Symbol != "USDT" {
+		t.Fatalf("unexpected info: %+v err=%v", info, err)
+	}
+	if _, err := r.Lookup(ctx, addr); err != nil || c.calls != 2 {
+		t.Fatalf("expected cached lookup, calls=%d err=%v", c.calls, err)
+	}
+
+	if _, err := r.Lookup(ctx, common.HexToAddress("0x01")); err == nil {
+		t.Fatalf("expected error for non-token address")
+	}
+}
+
+func TestDecodeTransfer_NFT(t *testing.T) {
+	coll := common.HexToAddress("0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D")
+	operator := common.HexToHash("0x09")
+	from := common.HexToHash("0x01")
+	to := common.HexToHash("0x02")
+
+	// ERC-721: tokenId в четвёртом topic, data пустая
+	tr, ok := DecodeTransfer(&types.Log{
+		Address: coll,
+		Topics:  []common.Hash{TransferTopic, from, to, common.BigToHash(big.NewInt(7))},
+	})
+	if !ok || tr.Standard != ERC721 || len(tr.TokenIDs) != 1 || tr.TokenIDs[0].Int64() != 7 || tr.Amounts[0].Int64() != 1 {
+		t.Fatalf("unexpected erc721: %+v ok=%v", tr, ok)
+	}
+	if tr.From != common.BytesToAddress(from.Bytes()) || tr.To != common.BytesToAddress(to.Bytes()) {
+		t.Fatalf("unexpected from/to: %+v", tr)
+	}
+
+	single := append(common.LeftPadBytes([]byte{3}, 32), common.LeftPadBytes([]byte{10}, 32)...)
+	tr, ok = DecodeTransfer(&types.Log{
+		Address: coll,
+		Topics:  []common.Hash{TransferSingleTopic, operator, from, to},
+		Data:    single,
+	})
+	if !ok || tr.Standard != ERC1155 || tr.TokenIDs[0].Int64() != 3 || tr.Amounts[0].Int64() != 10 {
+		t.Fatalf("unexpected erc1155 single: %+v ok=%v", tr, ok)
+	}
+	if tr.From != common.BytesToAddress(from.Bytes()) {
+		t.Fatalf("operator must not be taken as sender: %+v", tr)
+	}
+
+	data, err := batchArgs.Pack([]*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{big.NewInt(5), big.NewInt(6)})
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	tr, ok = DecodeTransfer(&types.Log{
+		Address: coll,
+		Topics:  []common.Hash{TransferBatchTopic, operator, from, to},
+		Data:    data,
+	})
+	if !ok || len(tr.TokenIDs) != 2 || tr.TokenIDs[1].Int64() != 2 || tr.Amounts[1].Int64() != 6 {
+		t.Fatalf("unexpected erc1155 batch: %+v ok=%v", tr, ok)
+	}
+
+	if _, ok := DecodeTransfer(&types.Log{Topics: []common.Hash{TransferBatchTopic, operator, from, to}, Data: []byte{1}}); ok {
+		t.Fatalf("expected malformed batch to be rejected")
+	}
+}
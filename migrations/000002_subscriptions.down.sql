@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS subscriptions;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+  chat_id BIGINT PRIMARY KEY,
+
+  large_tx_min_wei NUMERIC(78,0) NULL,
+  wallet_addr      TEXT NULL,
+
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
\ No newline at end of file
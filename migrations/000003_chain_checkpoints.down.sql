@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS chain_checkpoints;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS chain_checkpoints (
+  chain_id TEXT PRIMARY KEY,
+
+  block_number BIGINT NOT NULL,
+  block_hash   TEXT NOT NULL,
+
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
\ No newline at end of file
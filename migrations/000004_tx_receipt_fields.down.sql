@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS effective_gas_price_wei;
+ALTER TABLE transactions DROP COLUMN IF EXISTS gas_used;
+
+COMMIT;
\ No newline at end of file
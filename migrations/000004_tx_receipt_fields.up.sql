@@ -0,0 +1,2 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS gas_used BIGINT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS effective_gas_price_wei NUMERIC(78,0) NULL;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS token_subscriptions;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS token_subscriptions (
+  chat_id    BIGINT NOT NULL REFERENCES subscriptions(chat_id) ON DELETE CASCADE,
+  token_addr TEXT NOT NULL,
+
+  min_amount NUMERIC(78,0) NOT NULL,
+  decimals   SMALLINT NOT NULL,
+  symbol     TEXT NOT NULL DEFAULT '',
+
+  PRIMARY KEY (chat_id, token_addr)
+);
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS token_transfers;
+
+COMMIT;
\ No newline at end of file
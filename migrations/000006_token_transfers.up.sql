@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS token_transfers (
+  tx_hash   TEXT NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  log_index INT NOT NULL,
+  seq       INT NOT NULL DEFAULT 0,
+
+  standard   TEXT NOT NULL, -- erc20|erc721|erc1155
+  token_addr TEXT NOT NULL,
+  from_addr  TEXT NOT NULL,
+  to_addr    TEXT NOT NULL,
+  token_id   NUMERIC(78,0) NULL,
+  amount     NUMERIC(78,0) NOT NULL,
+
+  PRIMARY KEY (tx_hash, log_index, seq)
+);
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS notify_confirmations;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS notify_level;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS notify_level TEXT NOT NULL DEFAULT 'latest';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS notify_confirmations BIGINT NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS contract_subscriptions;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS contract_subscriptions (
+  chat_id       BIGINT NOT NULL REFERENCES subscriptions(chat_id) ON DELETE CASCADE,
+  contract_addr TEXT NOT NULL,
+
+  abi    JSONB NOT NULL,
+  events TEXT[] NOT NULL DEFAULT '{}',
+
+  PRIMARY KEY (chat_id, contract_addr)
+);
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS method_selector;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS method_selector TEXT NULL;
\ No newline at end of file
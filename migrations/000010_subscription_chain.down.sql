@@ -0,0 +1,24 @@
+BEGIN;
+
+-- в схеме без сетей остаются только подписки mainnet
+DELETE FROM subscriptions WHERE chain_id <> '1';
+
+ALTER TABLE token_subscriptions DROP CONSTRAINT IF EXISTS token_subscriptions_chat_chain_fkey;
+ALTER TABLE contract_subscriptions DROP CONSTRAINT IF EXISTS contract_subscriptions_chat_chain_fkey;
+ALTER TABLE token_subscriptions DROP CONSTRAINT IF EXISTS token_subscriptions_pkey;
+ALTER TABLE contract_subscriptions DROP CONSTRAINT IF EXISTS contract_subscriptions_pkey;
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_chat_chain_pkey;
+
+ALTER TABLE token_subscriptions DROP COLUMN IF EXISTS chain_id;
+ALTER TABLE contract_subscriptions DROP COLUMN IF EXISTS chain_id;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS chain_id;
+
+ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_pkey PRIMARY KEY (chat_id);
+ALTER TABLE token_subscriptions ADD CONSTRAINT token_subscriptions_pkey PRIMARY KEY (chat_id, token_addr);
+ALTER TABLE contract_subscriptions ADD CONSTRAINT contract_subscriptions_pkey PRIMARY KEY (chat_id, contract_addr);
+ALTER TABLE token_subscriptions ADD CONSTRAINT token_subscriptions_chat_id_fkey
+  FOREIGN KEY (chat_id) REFERENCES subscriptions(chat_id) ON DELETE CASCADE;
+ALTER TABLE contract_subscriptions ADD CONSTRAINT contract_subscriptions_chat_id_fkey
+  FOREIGN KEY (chat_id) REFERENCES subscriptions(chat_id) ON DELETE CASCADE;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- подписки по сетям: ключ (chat_id, chain_id). Подписки до мультичейна относим
+-- к сети, которую обрабатывал бот (единственный checkpoint), иначе — к mainnet
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS chain_id TEXT NOT NULL DEFAULT '1';
+ALTER TABLE token_subscriptions ADD COLUMN IF NOT EXISTS chain_id TEXT NOT NULL DEFAULT '1';
+ALTER TABLE contract_subscriptions ADD COLUMN IF NOT EXISTS chain_id TEXT NOT NULL DEFAULT '1';
+
+UPDATE subscriptions SET chain_id = (SELECT chain_id FROM chain_checkpoints)
+WHERE (SELECT count(*) FROM chain_checkpoints) = 1;
+UPDATE token_subscriptions SET chain_id = (SELECT chain_id FROM chain_checkpoints)
+WHERE (SELECT count(*) FROM chain_checkpoints) = 1;
+UPDATE contract_subscriptions SET chain_id = (SELECT chain_id FROM chain_checkpoints)
+WHERE (SELECT count(*) FROM chain_checkpoints) = 1;
+
+ALTER TABLE token_subscriptions DROP CONSTRAINT IF EXISTS token_subscriptions_chat_id_fkey;
+ALTER TABLE contract_subscriptions DROP CONSTRAINT IF EXISTS contract_subscriptions_chat_id_fkey;
+ALTER TABLE token_subscriptions DROP CONSTRAINT IF EXISTS token_subscriptions_pkey;
+ALTER TABLE contract_subscriptions DROP CONSTRAINT IF EXISTS contract_subscriptions_pkey;
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_pkey;
+
+ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_chat_chain_pkey PRIMARY KEY (chat_id, chain_id);
+ALTER TABLE token_subscriptions ADD CONSTRAINT token_subscriptions_pkey PRIMARY KEY (chat_id, chain_id, token_addr);
+ALTER TABLE contract_subscriptions ADD CONSTRAINT contract_subscriptions_pkey PRIMARY KEY (chat_id, chain_id, contract_addr);
+ALTER TABLE token_subscriptions ADD CONSTRAINT token_subscriptions_chat_chain_fkey
+  FOREIGN KEY (chat_id, chain_id) REFERENCES subscriptions(chat_id, chain_id) ON DELETE CASCADE;
+ALTER TABLE contract_subscriptions ADD CONSTRAINT contract_subscriptions_chat_chain_fkey
+  FOREIGN KEY (chat_id, chain_id) REFERENCES subscriptions(chat_id, chain_id) ON DELETE CASCADE;
+
+ALTER TABLE subscriptions ALTER COLUMN chain_id DROP DEFAULT;
+ALTER TABLE token_subscriptions ALTER COLUMN chain_id DROP DEFAULT;
+ALTER TABLE contract_subscriptions ALTER COLUMN chain_id DROP DEFAULT;
\ No newline at end of file
@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS blob_hashes;
+ALTER TABLE transactions DROP COLUMN IF EXISTS blob_gas_price_wei;
+ALTER TABLE transactions DROP COLUMN IF EXISTS blob_fee_cap_wei;
+ALTER TABLE transactions DROP COLUMN IF EXISTS blob_gas;
+ALTER TABLE transactions DROP COLUMN IF EXISTS base_fee_wei;
+ALTER TABLE transactions DROP COLUMN IF EXISTS max_priority_fee_per_gas_wei;
+ALTER TABLE transactions DROP COLUMN IF EXISTS max_fee_per_gas_wei;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_fee_per_gas_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_priority_fee_per_gas_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS base_fee_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_gas BIGINT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_fee_cap_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_gas_price_wei NUMERIC(78,0) NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS blob_hashes INT NULL;
\ No newline at end of file
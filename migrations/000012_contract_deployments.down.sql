@@ -0,0 +1,8 @@
+BEGIN;
+
+DELETE FROM contract_subscriptions WHERE abi IS NULL;
+ALTER TABLE contract_subscriptions ALTER COLUMN abi SET NOT NULL;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS created_contracts;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_contracts TEXT[] NULL;
+
+-- подписка без ABI (на только что задеплоенный контракт) — все логи без расшифровки
+ALTER TABLE contract_subscriptions ALTER COLUMN abi DROP NOT NULL;
\ No newline at end of file
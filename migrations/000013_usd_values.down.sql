@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS large_tx_min_usd;
+ALTER TABLE token_transfers DROP COLUMN IF EXISTS value_usd;
+ALTER TABLE transactions DROP COLUMN IF EXISTS value_usd;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS value_usd NUMERIC(24,2) NULL;
+ALTER TABLE token_transfers ADD COLUMN IF NOT EXISTS value_usd NUMERIC(24,2) NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS large_tx_min_usd NUMERIC(24,2) NULL;
\ No newline at end of file
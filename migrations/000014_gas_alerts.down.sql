@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS gas_threshold_wei;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS gas_direction;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS gas_metric;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS gas_metric TEXT NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS gas_direction TEXT NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS gas_threshold_wei NUMERIC(78,0) NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS revert_reason TEXT NULL;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS chat_tx_event_created_idx;
+
+COMMIT;
\ No newline at end of file
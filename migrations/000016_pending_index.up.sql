@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS chat_tx_event_created_idx ON chat_tx(event_type, created_at);
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS held_notifications;
+
+COMMIT;
\ No newline at end of file
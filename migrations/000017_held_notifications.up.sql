@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS held_notifications (
+  chain_id  TEXT NOT NULL,
+  chat_id   BIGINT NOT NULL,
+  tx_hash   TEXT NOT NULL,
+
+  block_number BIGINT NOT NULL,
+  messages     JSONB NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (chain_id, chat_id, tx_hash)
+);
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS chat_settings;
+
+COMMIT;
\ No newline at end of file
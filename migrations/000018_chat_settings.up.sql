@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS chat_settings (
+  chat_id  BIGINT PRIMARY KEY,
+  chain_id TEXT NOT NULL,
+
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
\ No newline at end of file